@@ -0,0 +1,5 @@
+#!/bin/bash
+# Record the Ollama responses of a full run into testdata/cassettes
+# and keep the export as the expected result of the replay
+OLLAMA_HOST=${OLLAMA_HOST:-http://localhost:11434} \
+go test -run TestVCRReplayRun -record -v .
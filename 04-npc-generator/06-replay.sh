@@ -0,0 +1,4 @@
+#!/bin/bash
+# Replay the cassette (no Ollama, no GPU) and check that
+# generation -> parse -> dedup -> store -> export still gives the recorded result
+go test -run TestVCRReplayRun -v . && echo "🎉 replay ok"
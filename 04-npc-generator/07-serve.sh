@@ -0,0 +1,5 @@
+#!/bin/bash
+OLLAMA_HOST=http://localhost:11434 \
+LLM=qwen2.5:0.5b \
+HTTP_PORT=8080 \
+go run . serve
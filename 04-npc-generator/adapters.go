@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/ollama/ollama/api"
+)
+
+// PromptAdapter rewrites the messages of every request for the models of its families:
+// the prompts are written once, in the style of the chat models, and the adapter
+// fits them to the models that need another style
+type PromptAdapter struct {
+	Name string `json:"name"`
+	// Families are matched with the family of the model (show API), or with its name (llama3.2:3b is llama)
+	Families []string `json:"families"`
+	// MergeSystem joins the system messages into one (the templates keeping only one)
+	MergeSystem bool `json:"merge_system,omitempty"`
+	// SystemAsUser moves the system messages in front of the first user message (the models ignoring them)
+	SystemAsUser bool `json:"system_as_user,omitempty"`
+	// RestateSchema adds the JSON schema of the answer to the last user message
+	RestateSchema bool `json:"restate_schema,omitempty"`
+	// UserSuffix ends the last user message (a soft switch of the model)
+	UserSuffix string `json:"user_suffix,omitempty"`
+}
+
+// DefaultAdapter leaves the messages as they are
+const DefaultAdapter = "default"
+
+var builtinAdapters = []PromptAdapter{
+	{Name: DefaultAdapter},
+	// the llama 3 templates render one system header
+	{Name: "llama", Families: []string{"llama"}, MergeSystem: true},
+	{Name: "qwen", Families: []string{"qwen"}, MergeSystem: true},
+	// the small phi models follow a schema in the text better than the format alone
+	{Name: "phi", Families: []string{"phi"}, MergeSystem: true, RestateSchema: true},
+	// the gemma templates have no system role
+	{Name: "gemma", Families: []string{"gemma"}, SystemAsUser: true},
+}
+
+// LoadAdapters returns the built-in adapters and the custom ones, every JSON file of the directories
+// (the installed packs, then ADAPTERS_DIR) registers an adapter (or replaces an adapter registered before)
+func LoadAdapters(dirs ...string) (map[string]PromptAdapter, error) {
+	adapters := map[string]PromptAdapter{}
+	for _, adapter := range builtinAdapters {
+		adapters[adapter.Name] = adapter
+	}
+	err := readPacks(dirs, func(path string, data []byte) error {
+		adapter := PromptAdapter{}
+		err := json.Unmarshal(data, &adapter)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if adapter.Name == "" {
+			adapter.Name = strings.TrimSuffix(filepath.Base(path), ".json")
+		}
+		if adapter.MergeSystem && adapter.SystemAsUser {
+			return fmt.Errorf("%s: merge_system and system_as_user exclude each other", path)
+		}
+		adapters[adapter.Name] = adapter
+		return nil
+	})
+	return adapters, err
+}
+
+// modelFamily is the family in the name of the model: llama3.2:3b is llama3, hf.co/org/Phi-3-mini:q4 is phi
+func modelFamily(model string) string {
+	name := strings.ToLower(model)
+	name = name[strings.LastIndex(name, "/")+1:]
+	name, _, _ = strings.Cut(name, ":")
+	name, _, _ = strings.Cut(name, ".")
+	name, _, _ = strings.Cut(name, "-")
+	return name
+}
+
+// familyMatch scores a family of an adapter against a family of the model:
+// 2 for the same family (qwen3), 1 for the same family without the version (qwen), 0 otherwise
+func familyMatch(adapterFamily, family string) int {
+	adapterFamily, family = strings.ToLower(adapterFamily), strings.ToLower(family)
+	switch {
+	case family == "":
+		return 0
+	case adapterFamily == family:
+		return 2
+	case adapterFamily == strings.TrimRight(family, "0123456789"):
+		return 1
+	}
+	return 0
+}
+
+// SelectAdapter returns the adapter of the model: the adapter named by PROMPT_ADAPTER,
+// or the adapter of its family (the family of the show API, or the family in its name),
+// a family with its version (qwen3) is preferred to the family (qwen)
+func SelectAdapter(adapters map[string]PromptAdapter, name, model, family string) (PromptAdapter, error) {
+	if name != "" {
+		adapter, ok := adapters[name]
+		if !ok {
+			return adapter, fmt.Errorf("unknown prompt adapter %q (%s)", name, strings.Join(slices.Sorted(maps.Keys(adapters)), ", "))
+		}
+		return adapter, nil
+	}
+	best, bestScore := adapters[DefaultAdapter], 0
+	for _, adapterName := range slices.Sorted(maps.Keys(adapters)) {
+		adapter := adapters[adapterName]
+		for _, adapterFamily := range adapter.Families {
+			score := max(familyMatch(adapterFamily, family), familyMatch(adapterFamily, modelFamily(model)))
+			if score > bestScore {
+				best, bestScore = adapter, score
+			}
+		}
+	}
+	return best, nil
+}
+
+// Apply returns the messages rewritten for the model, the messages are not modified
+func (p PromptAdapter) Apply(messages []api.Message, schema map[string]any) []api.Message {
+	if !p.MergeSystem && !p.SystemAsUser && !p.RestateSchema && p.UserSuffix == "" {
+		return messages
+	}
+	system := []string{}
+	adapted := []api.Message{}
+	for _, message := range messages {
+		if message.Role == "system" && (p.MergeSystem || p.SystemAsUser) {
+			system = append(system, strings.TrimSpace(message.Content))
+			continue
+		}
+		adapted = append(adapted, message)
+	}
+	if len(system) > 0 {
+		joined := strings.Join(system, "\n\n")
+		first := slices.IndexFunc(adapted, func(message api.Message) bool { return message.Role == "user" })
+		if p.SystemAsUser && first >= 0 {
+			adapted[first].Content = joined + "\n\n" + adapted[first].Content
+		} else {
+			adapted = slices.Insert(adapted, 0, api.Message{Role: "system", Content: joined})
+		}
+	}
+	last := -1
+	for idx, message := range adapted {
+		if message.Role == "user" {
+			last = idx
+		}
+	}
+	if last >= 0 {
+		if p.RestateSchema && schema != nil {
+			data, err := json.Marshal(schema)
+			if err == nil {
+				adapted[last].Content += "\nAnswer with a JSON object of this schema, without any other text:\n" + string(data)
+			}
+		}
+		adapted[last].Content += p.UserSuffix
+	}
+	return adapted
+}
+
+// adapterCache keeps the adapter of every model of the generator (the judge models too)
+type adapterCache struct {
+	mutex    sync.Mutex
+	adapters map[string]PromptAdapter
+	// name is the adapter of PROMPT_ADAPTER ("": by family)
+	name string
+	// families are the families probed by the capabilities, by model
+	families map[string]string
+	selected map[string]PromptAdapter
+}
+
+func newAdapterCache(adapters map[string]PromptAdapter, name string) (*adapterCache, error) {
+	if name != "" {
+		_, err := SelectAdapter(adapters, name, "", "")
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &adapterCache{adapters: adapters, name: name, families: map[string]string{}, selected: map[string]PromptAdapter{}}, nil
+}
+
+// SetFamily records the family of a model, probed by the capabilities
+func (c *adapterCache) SetFamily(model, family string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.families[model] = family
+	delete(c.selected, model)
+}
+
+// For returns the adapter of the model
+func (c *adapterCache) For(model string) PromptAdapter {
+	if c == nil {
+		return PromptAdapter{Name: DefaultAdapter}
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	adapter, ok := c.selected[model]
+	if !ok {
+		// the name is checked by newAdapterCache
+		adapter, _ = SelectAdapter(c.adapters, c.name, model, c.families[model])
+		c.selected[model] = adapter
+	}
+	return adapter
+}
@@ -0,0 +1,165 @@
+//go:build !minimal
+
+package main
+
+import (
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+//go:embed templates/approval.html
+var approvalTemplate string
+
+// storeSlots stores the slots of a generation, or submits them to the approval queue
+func storeSlots(registry *Registry, slots []Slot, approval bool) error {
+	if approval {
+		return SubmitSlots(registry, slots)
+	}
+	return StoreSlots(registry, slots)
+}
+
+// reviewer only lets the requests with the reviewer token through, as a bearer token or as
+// the password of the basic authentication (the browser asks for it on the page of the reviewers)
+func (s *Server) reviewer(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.reviewerToken == "" {
+			writeError(w, http.StatusForbidden, errors.New("the approval routes need REVIEWER_TOKEN"))
+			return
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			_, token, ok = r.BasicAuth()
+		}
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.reviewerToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="reviewers"`)
+			writeError(w, http.StatusUnauthorized, errors.New("invalid reviewer token"))
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// pendingRoute reads the campaign and the pending ID of the route
+func (s *Server) pendingRoute(w http.ResponseWriter, r *http.Request) (*Registry, int, bool) {
+	registry, err := s.storage.Registry(r.PathValue("campaign"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return nil, 0, false
+	}
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid pending ID %q", r.PathValue("id")))
+		return nil, 0, false
+	}
+	return registry, id, true
+}
+
+// writePendingError answers 404 for an unknown pending character, 409 for a taken name
+func writePendingError(w http.ResponseWriter, status int, err error) {
+	switch {
+	case errors.Is(err, ErrNotPending):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, ErrNameTaken):
+		writeError(w, http.StatusConflict, err)
+	default:
+		writeError(w, status, err)
+	}
+}
+
+// handleListPending answers the characters waiting for a reviewer:
+// GET /campaigns/{campaign}/pending
+func (s *Server) handleListPending(w http.ResponseWriter, r *http.Request) {
+	registry, err := s.storage.Registry(r.PathValue("campaign"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, registry.ListPending())
+}
+
+// handleEditPending changes the fields of the body, the others are kept:
+// PATCH /campaigns/{campaign}/pending/{id} {"name": "Thorgar", "tags": ["villain"]}
+func (s *Server) handleEditPending(w http.ResponseWriter, r *http.Request) {
+	registry, id, ok := s.pendingRoute(w, r)
+	if !ok {
+		return
+	}
+	patch := map[string]json.RawMessage{}
+	err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&patch)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	pending, err := registry.EditPending(id, patch)
+	if err != nil {
+		writePendingError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, pending)
+}
+
+// handleApprove stores the pending character and exports its kind again:
+// POST /campaigns/{campaign}/pending/{id}/approve
+func (s *Server) handleApprove(w http.ResponseWriter, r *http.Request) {
+	registry, id, ok := s.pendingRoute(w, r)
+	if !ok {
+		return
+	}
+	character, err := registry.Approve(id)
+	if err != nil {
+		writePendingError(w, http.StatusInternalServerError, err)
+		return
+	}
+	fmt.Printf("✅ %s approved (%s)\n", character.DisplayName(), r.PathValue("campaign"))
+	err = s.export(r.PathValue("campaign"), registry, character.Kind)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, character)
+}
+
+// handleReject drops the pending character:
+// POST /campaigns/{campaign}/pending/{id}/reject
+func (s *Server) handleReject(w http.ResponseWriter, r *http.Request) {
+	registry, id, ok := s.pendingRoute(w, r)
+	if !ok {
+		return
+	}
+	pending, err := registry.Reject(id)
+	if err != nil {
+		writePendingError(w, http.StatusInternalServerError, err)
+		return
+	}
+	fmt.Printf("🚫 %s rejected (%s)\n", pending.Character.DisplayName(), r.PathValue("campaign"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleApprovals is the page of the reviewers, it uses the pending routes:
+// GET /admin/approvals?campaign=default
+func (s *Server) handleApprovals(w http.ResponseWriter, r *http.Request) {
+	campaign := r.URL.Query().Get("campaign")
+	if campaign == "" {
+		campaign = DefaultCampaign
+	}
+	err := checkCampaign(campaign)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	tpl, err := template.New("approval").Parse(approvalTemplate)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	tpl.Execute(w, map[string]string{"Campaign": campaign})
+}
@@ -0,0 +1,56 @@
+//go:build !minimal
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReviewerToken(t *testing.T) {
+	server := NewServer(NewGenerator(nil, "fake"), NewStorage(t.TempDir()), SortOptions{})
+	handler := server.Handler()
+	request := func(method, path string, auth func(r *http.Request)) int {
+		r := httptest.NewRequest(method, path, nil)
+		if auth != nil {
+			auth(r)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+	bearer := func(token string) func(r *http.Request) {
+		return func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) }
+	}
+
+	// without a token on the server, nobody reviews
+	if code := request("GET", "/campaigns/default/pending", bearer("")); code != http.StatusForbidden {
+		t.Errorf("no reviewer token: %d, want 403", code)
+	}
+	server.reviewerToken = "s3cret"
+	for _, route := range []struct{ method, path string }{
+		{"GET", "/campaigns/default/pending"},
+		{"PATCH", "/campaigns/default/pending/1"},
+		{"POST", "/campaigns/default/pending/1/approve"},
+		{"POST", "/campaigns/default/pending/1/reject"},
+		{"GET", "/admin/approvals"},
+	} {
+		if code := request(route.method, route.path, nil); code != http.StatusUnauthorized {
+			t.Errorf("%s %s without a token: %d, want 401", route.method, route.path, code)
+		}
+		if code := request(route.method, route.path, bearer("wrong")); code != http.StatusUnauthorized {
+			t.Errorf("%s %s with another token: %d, want 401", route.method, route.path, code)
+		}
+	}
+	if code := request("GET", "/campaigns/default/pending", bearer("s3cret")); code != http.StatusOK {
+		t.Errorf("bearer token: %d, want 200", code)
+	}
+	// the page of the reviewers gets the token from the browser
+	if code := request("GET", "/admin/approvals", func(r *http.Request) { r.SetBasicAuth("alice", "s3cret") }); code != http.StatusOK {
+		t.Errorf("basic authentication: %d, want 200", code)
+	}
+	if code := request("POST", "/campaigns/default/pending/1/reject", bearer("s3cret")); code != http.StatusNotFound {
+		t.Errorf("reject an unknown character: %d, want 404", code)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Archive retires the stored character (killed off, rejected): it stays in the registry,
+// so its names are still in the dedup, but the listings and the exports leave it out
+func (r *Registry) Archive(id int, reason string) (Character, error) {
+	now := time.Now()
+	return r.Modify(id, func(character *Character) {
+		character.ArchivedAt, character.ArchiveReason = &now, strings.TrimSpace(reason)
+	})
+}
+
+// Restore brings an archived character back
+func (r *Registry) Restore(id int) (Character, error) {
+	return r.Modify(id, func(character *Character) {
+		character.ArchivedAt, character.ArchiveReason = nil, ""
+	})
+}
+
+// FilterArchived leaves the archived characters out, unless they are included
+func FilterArchived(characters []Character, include bool) []Character {
+	if include {
+		return characters
+	}
+	return slices.DeleteFunc(slices.Clone(characters), Character.Archived)
+}
+
+// runArchive retires a stored character or restores it:
+// archive --reason "killed by the dragon" 12, archive --restore 12
+func (a *App) runArchive(args []string) error {
+	flags := flag.NewFlagSet("archive", flag.ExitOnError)
+	campaign := flags.String("campaign", getEnv("CAMPAIGN", DefaultCampaign), "campaign of the character")
+	reason := flags.String("reason", "", "why the character is retired (killed, rejected...)")
+	restore := flags.Bool("restore", false, "bring the archived character back")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return errors.New("usage: archive [--reason] [--restore] <id>")
+	}
+	id, err := strconv.Atoi(flags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("invalid ID %q", flags.Arg(0))
+	}
+	registry, err := a.storage.Registry(*campaign)
+	if err != nil {
+		return err
+	}
+
+	if *restore {
+		character, err := registry.Restore(id)
+		if err != nil {
+			return err
+		}
+		fmt.Println("♻️ restored:", character.Code, character.Name)
+		return nil
+	}
+	character, err := registry.Archive(id, *reason)
+	if err != nil {
+		return err
+	}
+	fmt.Println("🪦 archived:", character.Code, character.Name, character.ArchiveReason)
+	return nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+// ErrBackendDown is returned without calling Ollama while the circuit is open
+var ErrBackendDown = errors.New("ollama is unavailable")
+
+// Backend watches Ollama for the serve mode: a heartbeat every interval, and a circuit breaker
+// opened after failures consecutive connection errors (Ollama restarts for a model update),
+// while it is open the requests fail at once and the heartbeat closes it when Ollama is back
+type Backend struct {
+	client   *api.Client
+	interval time.Duration
+	failures int
+
+	mutex       sync.Mutex
+	consecutive int
+	down        bool
+	downSince   time.Time
+	lastError   string
+	up          chan struct{}
+}
+
+func NewBackend(client *api.Client, interval time.Duration, failures int) *Backend {
+	return &Backend{client: client, interval: interval, failures: max(failures, 1), up: make(chan struct{})}
+}
+
+// BackendStatus is the state of the circuit, for the readiness probe
+type BackendStatus struct {
+	Up        bool       `json:"up"`
+	DownSince *time.Time `json:"down_since,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+}
+
+func (b *Backend) Status() BackendStatus {
+	if b == nil {
+		return BackendStatus{Up: true}
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	status := BackendStatus{Up: !b.down, LastError: b.lastError}
+	if b.down {
+		downSince := b.downSince
+		status.DownSince = &downSince
+	}
+	return status
+}
+
+// Monitor sends a heartbeat every interval until the context is done
+func (b *Backend) Monitor(ctx context.Context) {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			heartbeatCtx, cancel := context.WithTimeout(ctx, b.interval)
+			err := b.client.Heartbeat(heartbeatCtx)
+			cancel()
+			if ctx.Err() != nil {
+				return
+			}
+			b.record(err, true)
+		}
+	}
+}
+
+// record counts the consecutive errors of the breaker classes: the circuit opens after
+// failures errors (at once for a failed heartbeat, a hung Ollama times it out) and closes after a success
+func (b *Backend) record(err error, heartbeat bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if err == nil {
+		b.consecutive = 0
+		if b.down {
+			fmt.Printf("💚 ollama is back after %s\n", time.Since(b.downSince).Round(time.Second))
+			b.down, b.lastError = false, ""
+			close(b.up)
+		}
+		return
+	}
+	b.consecutive++
+	b.lastError = err.Error()
+	if !b.down && (heartbeat || b.consecutive >= b.failures) {
+		fmt.Println("💔 ollama is down:", err)
+		b.down, b.downSince = true, time.Now()
+		b.up = make(chan struct{})
+	}
+}
+
+// Wait blocks while the circuit is open
+func (b *Backend) Wait(ctx context.Context) error {
+	if b == nil {
+		return nil
+	}
+	b.mutex.Lock()
+	up, down := b.up, b.down
+	b.mutex.Unlock()
+	if !down {
+		return nil
+	}
+	select {
+	case <-up:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Do calls Ollama unless the circuit is open, the errors are retried with the policy
+// before they count as a failure (the classes of the breaker); a nil backend only retries
+func (b *Backend) Do(ctx context.Context, policy RetryPolicy, call func() error) error {
+	if b == nil {
+		return policy.Do(ctx, call)
+	}
+	if !b.Status().Up {
+		return ErrBackendDown
+	}
+	err := policy.Do(ctx, func() error {
+		if !b.Status().Up {
+			return ErrBackendDown
+		}
+		return call()
+	})
+	if err == nil || policy[ClassifyError(err)].Breaker {
+		b.record(err, false)
+	}
+	return err
+}
+
+// retryAfter is a heartbeat interval in seconds
+func (b *Backend) retryAfter() string {
+	if b == nil {
+		return "1"
+	}
+	return strconv.Itoa(max(int(b.interval.Seconds()), 1))
+}
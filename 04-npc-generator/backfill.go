@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// BackfillState is the checkpoint of a backfill (backfill.<field>.json of the campaign):
+// the characters the model failed to fill are skipped by the next run (unless --retry-failed),
+// the filled ones are stored one by one and are not missing the field any more
+type BackfillState struct {
+	Field     string    `json:"field"`
+	Filled    int       `json:"filled"`
+	Failed    []int     `json:"failed,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func loadBackfillState(path, field string) (BackfillState, error) {
+	state := BackfillState{Field: field}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	err = json.Unmarshal(data, &state)
+	if err != nil {
+		return state, fmt.Errorf("%s: %w", path, err)
+	}
+	return state, nil
+}
+
+func (s BackfillState) save(path string) error {
+	s.UpdatedAt = time.Now()
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// missingField is true when the character has no value for the field
+// (backstory, equipment, an extra of the genre or a stat)
+func missingField(character Character, field string, extras []GenreExtra) bool {
+	switch field {
+	case "backstory":
+		return character.Backstory == ""
+	case "equipment":
+		return character.Equipment == nil
+	}
+	if extra, ok := findExtra(extras, field); ok {
+		return character.Extras[extra.Name] == ""
+	}
+	for name := range character.Stats {
+		if strings.EqualFold(name, field) {
+			return false
+		}
+	}
+	return true
+}
+
+// runBackfill generates one field for every stored character without it (a field added to the
+// genre, a new stat...), the characters are stored one by one so an interrupted backfill resumes:
+// backfill --field pronunciation --pause 2s
+func (a *App) runBackfill(ctx context.Context, args []string) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx = WithPriority(ctx, PriorityBackground)
+
+	flags := flag.NewFlagSet("backfill", flag.ExitOnError)
+	campaign := flags.String("campaign", getEnv("CAMPAIGN", DefaultCampaign), "campaign of the characters")
+	field := flags.String("field", "", "field to fill: backstory, equipment, an extra of the genre or a stat (STR)")
+	systemName := flags.String("system", os.Getenv("SYSTEM"), "game system of the stats")
+	pause := flags.Duration("pause", 0, "pause between two characters (rate limiting)")
+	limit := flags.Int("limit", 0, "number of characters filled by this run (0: all)")
+	retryFailed := flags.Bool("retry-failed", false, "try again the characters the previous runs failed to fill")
+	dryRun := flags.Bool("dry-run", false, "count the characters to fill without asking the model")
+	flags.Parse(args)
+	*field = strings.ToLower(*field)
+	if *field == "" || *field == "name" {
+		return errors.New("usage: backfill --field <field> (backstory, equipment, an extra of the genre or a stat)")
+	}
+	system, err := a.generator.System(*systemName)
+	if err != nil {
+		return err
+	}
+	if *field != "equipment" {
+		_, _, err = fieldSchema(*field, system, a.generator.genre.Extras)
+		if err != nil {
+			return err
+		}
+	}
+
+	registry, err := a.storage.Registry(*campaign)
+	if err != nil {
+		return err
+	}
+	statePath, err := a.storage.ExportPath(*campaign, "backfill."+Slug(*field)+".json")
+	if err != nil {
+		return err
+	}
+	state, err := loadBackfillState(statePath, *field)
+	if err != nil {
+		return err
+	}
+	if *retryFailed {
+		state.Failed = nil
+	}
+	characters := slices.DeleteFunc(registry.List(), func(character Character) bool {
+		return character.Archived() || !missingField(character, *field, a.generator.genre.Extras) || slices.Contains(state.Failed, character.ID)
+	})
+	if *limit > 0 {
+		characters = characters[:min(*limit, len(characters))]
+	}
+	fmt.Printf("🩹 %d characters without %s in %s", len(characters), *field, *campaign)
+	if len(state.Failed) > 0 {
+		fmt.Printf(" (%d failed before, --retry-failed)", len(state.Failed))
+	}
+	fmt.Println()
+	if *dryRun || len(characters) == 0 {
+		return nil
+	}
+
+	start := time.Now()
+	for idx, character := range characters {
+		if idx > 0 && *pause > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(*pause):
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		filled, err := a.generator.RegenerateField(ctx, character, *field, system)
+		if ctx.Err() != nil {
+			break
+		}
+		if err != nil {
+			fmt.Println("😡", character.Name+":", err)
+			state.Failed = append(state.Failed, character.ID)
+		} else {
+			_, err = registry.Update(filled)
+			if err != nil {
+				return err
+			}
+			state.Filled++
+		}
+		err = state.save(statePath)
+		if err != nil {
+			return err
+		}
+		done := idx + 1
+		remaining := time.Duration(float64(time.Since(start)) / float64(done) * float64(len(characters)-done))
+		fmt.Printf("🩹 %d/%d %s (%s left)\n", done, len(characters), character.Name, remaining.Round(time.Second))
+	}
+	if ctx.Err() != nil {
+		fmt.Println("👋 interrupted, run the backfill again to resume")
+		return nil
+	}
+	fmt.Printf("✅ %s filled, %d failed (%s)\n", *field, len(state.Failed), statePath)
+	return nil
+}
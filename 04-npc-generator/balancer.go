@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Balancing strategies of the Ollama hosts
+const (
+	BalanceLeastLoaded = "least-loaded" // the host with the fewest requests in flight
+	BalanceRoundRobin  = "round-robin"
+)
+
+// OllamaHost is a host of the balancer
+type OllamaHost struct {
+	url       *url.URL
+	inFlight  int
+	requests  int
+	down      bool
+	lastError string
+}
+
+// Balancer is the HTTP transport of the Ollama client with several hosts (OLLAMA_HOSTS):
+// every request goes to a host that is up, a connection error marks the host down and
+// the request is sent to the next host, the health check brings the hosts back
+type Balancer struct {
+	mutex     sync.Mutex
+	hosts     []*OllamaHost
+	strategy  string
+	next      int
+	transport http.RoundTripper
+}
+
+// NewBalancer parses the comma separated hosts
+func NewBalancer(hosts, strategy string, transport http.RoundTripper) (*Balancer, error) {
+	if strategy != BalanceLeastLoaded && strategy != BalanceRoundRobin {
+		return nil, fmt.Errorf("unknown balancing %q (%s, %s)", strategy, BalanceLeastLoaded, BalanceRoundRobin)
+	}
+	balancer := &Balancer{strategy: strategy, transport: transport}
+	for _, host := range strings.Split(hosts, ",") {
+		host = strings.TrimSpace(host)
+		if host == "" {
+			continue
+		}
+		if !strings.Contains(host, "://") {
+			host = "http://" + host
+		}
+		hostURL, err := url.Parse(host)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Ollama host %q: %w", host, err)
+		}
+		balancer.hosts = append(balancer.hosts, &OllamaHost{url: hostURL})
+	}
+	if len(balancer.hosts) == 0 {
+		return nil, errors.New("no Ollama host in OLLAMA_HOSTS")
+	}
+	return balancer, nil
+}
+
+// Base is the URL given to the client, the balancer replaces it for every request
+func (b *Balancer) Base() *url.URL {
+	return b.hosts[0].url
+}
+
+// pick returns an up host not tried yet, nil when there is none
+func (b *Balancer) pick(tried map[*OllamaHost]bool) *OllamaHost {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	var picked *OllamaHost
+	pickedIdx := 0
+	for offset := range b.hosts {
+		idx := (b.next + offset) % len(b.hosts)
+		host := b.hosts[idx]
+		if host.down || tried[host] {
+			continue
+		}
+		if picked == nil || b.strategy == BalanceLeastLoaded && host.inFlight < picked.inFlight {
+			picked, pickedIdx = host, idx
+		}
+		if b.strategy == BalanceRoundRobin {
+			break
+		}
+	}
+	if picked != nil {
+		// the ties of the least loaded hosts rotate too
+		b.next = (pickedIdx + 1) % len(b.hosts)
+		picked.inFlight++
+		picked.requests++
+	}
+	return picked
+}
+
+// release ends a request of the host, an error marks it down
+func (b *Balancer) release(host *OllamaHost, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	host.inFlight--
+	if err != nil && !host.down {
+		fmt.Println("💔", host.url.Host, "is down:", err)
+		host.down, host.lastError = true, err.Error()
+	}
+}
+
+// RoundTrip sends the request to a host, and to the next ones after a connection error
+func (b *Balancer) RoundTrip(req *http.Request) (*http.Response, error) {
+	tried := map[*OllamaHost]bool{}
+	var lastErr error
+	for {
+		host := b.pick(tried)
+		if host == nil {
+			if lastErr == nil {
+				lastErr = errors.New("every Ollama host is down")
+			}
+			return nil, lastErr
+		}
+		tried[host] = true
+
+		hostReq := req.Clone(req.Context())
+		hostReq.URL.Scheme, hostReq.URL.Host, hostReq.Host = host.url.Scheme, host.url.Host, host.url.Host
+		// the body of the first attempt is consumed
+		if len(tried) > 1 && req.Body != nil {
+			if req.GetBody == nil {
+				b.release(host, nil)
+				return nil, lastErr
+			}
+			body, err := req.GetBody()
+			if err != nil {
+				b.release(host, nil)
+				return nil, err
+			}
+			hostReq.Body = body
+		}
+
+		resp, err := b.transport.RoundTrip(hostReq)
+		if err != nil {
+			if req.Context().Err() != nil {
+				b.release(host, nil)
+				return nil, err
+			}
+			b.release(host, err)
+			lastErr = err
+			continue
+		}
+		// the request is in flight until its answer is read
+		resp.Body = newReleasingBody(resp.Body, func() { b.release(host, nil) })
+		return resp, nil
+	}
+}
+
+// releasingBody calls release once the answer is read (the client closes the body),
+// closing the body again does not release twice
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func newReleasingBody(body io.ReadCloser, release func()) *releasingBody {
+	return &releasingBody{ReadCloser: body, release: sync.OnceFunc(release)}
+}
+
+func (b *releasingBody) Close() error {
+	defer b.release()
+	return b.ReadCloser.Close()
+}
+
+// Monitor checks the down hosts every interval, a host answering is up again
+func (b *Balancer) Monitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		b.mutex.Lock()
+		down := []*OllamaHost{}
+		for _, host := range b.hosts {
+			if host.down {
+				down = append(down, host)
+			}
+		}
+		b.mutex.Unlock()
+
+		for _, host := range down {
+			checkCtx, cancel := context.WithTimeout(ctx, interval)
+			req, _ := http.NewRequestWithContext(checkCtx, http.MethodHead, host.url.String(), nil)
+			resp, err := b.transport.RoundTrip(req)
+			cancel()
+			if err != nil {
+				continue
+			}
+			resp.Body.Close()
+			b.mutex.Lock()
+			host.down, host.lastError = false, ""
+			b.mutex.Unlock()
+			fmt.Println("💚", host.url.Host, "is back")
+		}
+	}
+}
+
+// HostStatus is the state of a host, for the readiness probe
+type HostStatus struct {
+	Host      string `json:"host"`
+	Up        bool   `json:"up"`
+	InFlight  int    `json:"in_flight"`
+	Requests  int    `json:"requests"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+func (b *Balancer) Status() []HostStatus {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	statuses := []HostStatus{}
+	for _, host := range b.hosts {
+		statuses = append(statuses, HostStatus{
+			Host: host.url.Host, Up: !host.down, InFlight: host.inFlight, Requests: host.requests, LastError: host.lastError,
+		})
+	}
+	return statuses
+}
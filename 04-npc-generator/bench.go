@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ModelBench is the outcome of the benchmark suite for a model, the rates are between 0 and 1
+type ModelBench struct {
+	Model string `json:"model"`
+	// Validity is the ratio of the answers matching the schema (not empty, not truncated, valid JSON)
+	Validity float64 `json:"validity"`
+	// Duplicates is the ratio of the answers with a name already generated
+	Duplicates float64 `json:"duplicates"`
+	// LatencyMS is the average time of a generation request
+	LatencyMS int64 `json:"latency_ms"`
+	// Style is the average judge score of the names
+	Style    float64    `json:"style"`
+	Metrics  RunMetrics `json:"metrics"`
+	Duration string     `json:"duration"`
+	// Error is why the model could not be benchmarked (not installed, Ollama down)
+	Error string `json:"error,omitempty"`
+}
+
+// BenchModel runs every case of the suite with the model instead of the generation model (nothing is stored),
+// the judge model grades the names of all the models
+func (g *Generator) BenchModel(ctx context.Context, model string, suite PromptTestSuite, judgeModel string) ModelBench {
+	bench := ModelBench{Model: model}
+	benched := *g
+	benched.model, benched.modelDigest = model, ""
+	// the local syllables would bypass the model
+	benched.syllables = nil
+
+	start := time.Now()
+	styles := 0.0
+	for _, testCase := range suite.Cases {
+		spec, slots, metrics, err := benched.runTestCase(ctx, testCase)
+		bench.Metrics = bench.Metrics.Add(metrics)
+		if err != nil {
+			bench.Error = err.Error()
+			return bench
+		}
+		names := []string{}
+		for _, slot := range slots {
+			if slot.Status == SlotOK {
+				names = append(names, slot.Character.Name)
+			}
+		}
+		score, _, err := g.judgeStyle(ctx, judgeModel, spec, names)
+		if err != nil {
+			bench.Error = "judge: " + err.Error()
+			return bench
+		}
+		styles += score
+		fmt.Printf("🏁 %s %-12s %d names, style %.2f\n", model, testCase.Name, len(names), score)
+	}
+
+	attempts := float64(max(bench.Metrics.Attempts, 1))
+	bench.Validity = 1 - float64(bench.Metrics.Empty+bench.Metrics.Invalid+bench.Metrics.Truncated)/attempts
+	bench.Duplicates = float64(bench.Metrics.Duplicates) / attempts
+	bench.LatencyMS = bench.Metrics.GenerationMS / int64(max(bench.Metrics.Attempts, 1))
+	bench.Style = styles / float64(max(len(suite.Cases), 1))
+	bench.Duration = time.Since(start).Round(time.Second).String()
+	return bench
+}
+
+// BenchMarkdown renders the comparison table of the models
+func BenchMarkdown(benches []ModelBench) string {
+	rows := [][]string{}
+	for _, bench := range benches {
+		if bench.Error != "" {
+			rows = append(rows, []string{bench.Model, "", "", "", "", "", bench.Error})
+			continue
+		}
+		rows = append(rows, []string{
+			bench.Model,
+			fmt.Sprintf("%.0f%%", bench.Validity*100),
+			fmt.Sprintf("%.0f%%", bench.Duplicates*100),
+			strconv.FormatInt(bench.LatencyMS, 10) + " ms",
+			fmt.Sprintf("%.2f", bench.Style),
+			strconv.Itoa(bench.Metrics.Attempts),
+			"",
+		})
+	}
+	return RenderTable([]string{"Model", "Schema validity", "Duplicates", "Latency", "Style", "Attempts", "Error"}, rows)
+}
+
+// runBench compares models on the prompt test suite (bench models --models llama3.2,qwen2.5,phi3):
+// schema validity, duplicate rate, latency and judge score per model
+func (a *App) runBench(ctx context.Context, args []string) error {
+	if len(args) < 1 || args[0] != "models" {
+		return errors.New("usage: bench models --models a,b,c [--suite suite.json] [--judge model] [--output bench.json]")
+	}
+	flags := flag.NewFlagSet("bench models", flag.ExitOnError)
+	names := flags.String("models", os.Getenv("BENCH_MODELS"), "models to compare (comma separated)")
+	suitePath := flags.String("suite", os.Getenv("PROMPT_TEST_SUITE"), "suite file (JSON), the built-in suite by default")
+	judgeModel := flags.String("judge", getEnv("JUDGE_LLM", a.generator.model), "model grading the names of every model")
+	outputPath := flags.String("output", "", "write the results to this JSON file")
+	flags.Parse(args[1:])
+
+	models := []string{}
+	for _, name := range strings.Split(*names, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			models = append(models, name)
+		}
+	}
+	if len(models) == 0 {
+		return errors.New("no model to compare, use --models a,b,c")
+	}
+	suite, err := LoadPromptTestSuite(*suitePath)
+	if err != nil {
+		return err
+	}
+
+	benches := []ModelBench{}
+	for _, model := range models {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		bench := a.generator.BenchModel(ctx, model, suite, *judgeModel)
+		if bench.Error != "" {
+			fmt.Printf("😡 %s: %s\n", model, bench.Error)
+		}
+		benches = append(benches, bench)
+	}
+	if *outputPath != "" {
+		data, err := json.MarshalIndent(benches, "", "  ")
+		if err != nil {
+			return err
+		}
+		err = os.WriteFile(*outputPath, data, 0644)
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Print(BenchMarkdown(benches))
+	return nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// BrowseRow is the summary of a character in the pages of browse,
+// the whole character is read from the registry when it is opened
+type BrowseRow struct {
+	ID       int
+	Name     string
+	Kind     string
+	Tags     []string
+	Archived bool
+	// key is the collation key of the name, the kind and the tags, for the search
+	key string
+}
+
+// Browser pages the summaries of the stored characters and filters them by name, kind and tags
+type Browser struct {
+	registry *Registry
+	rows     []BrowseRow
+	matches  []BrowseRow
+	query    string
+	page     int
+	limit    int
+}
+
+func NewBrowser(registry *Registry, characters []Character, limit int) *Browser {
+	rows := make([]BrowseRow, 0, len(characters))
+	for _, character := range characters {
+		rows = append(rows, BrowseRow{
+			ID:       character.ID,
+			Name:     character.Name,
+			Kind:     character.Kind,
+			Tags:     character.Tags,
+			Archived: character.Archived(),
+			key:      collationKey(strings.Join(append([]string{character.Name, character.Kind}, character.Tags...), " ")),
+		})
+	}
+	return &Browser{registry: registry, rows: rows, matches: rows, limit: limit}
+}
+
+// Filter keeps the rows matching every word of the query (a part of the name, the kind or a tag),
+// and goes back to the first page; an empty query keeps every row
+func (b *Browser) Filter(query string) {
+	b.query, b.page = strings.TrimSpace(query), 0
+	words := strings.Fields(collationKey(b.query))
+	b.matches = []BrowseRow{}
+	for _, row := range b.rows {
+		matching := true
+		for _, word := range words {
+			if !strings.Contains(row.key, word) {
+				matching = false
+				break
+			}
+		}
+		if matching {
+			b.matches = append(b.matches, row)
+		}
+	}
+}
+
+// Pages is the number of pages of the matching rows (1 without rows)
+func (b *Browser) Pages() int {
+	return max((len(b.matches)+b.limit-1)/b.limit, 1)
+}
+
+// Move goes delta pages forward or back, within the pages
+func (b *Browser) Move(delta int) {
+	b.page = min(max(b.page+delta, 0), b.Pages()-1)
+}
+
+// Render writes the current page
+func (b *Browser) Render(w io.Writer) {
+	start, end := min(b.page*b.limit, len(b.matches)), min((b.page+1)*b.limit, len(b.matches))
+	for _, row := range b.matches[start:end] {
+		archived := ""
+		if row.Archived {
+			archived = " 🗄️"
+		}
+		fmt.Fprintf(w, "%6d  %-28s %-12s %s%s\n", row.ID, row.Name, row.Kind, strings.Join(row.Tags, ","), archived)
+	}
+	filter := ""
+	if b.query != "" {
+		filter = fmt.Sprintf(", filter %q", b.query)
+	}
+	fmt.Fprintf(w, "📖 page %d/%d, %d of %d characters%s\n", b.page+1, b.Pages(), len(b.matches), len(b.rows), filter)
+}
+
+// Open writes the whole character, read from the registry
+func (b *Browser) Open(w io.Writer, id int) error {
+	character, ok := b.registry.Get(id)
+	if !ok {
+		return fmt.Errorf("no character with the ID %d", id)
+	}
+	data, err := json.MarshalIndent(character, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, string(data))
+	return nil
+}
+
+const browseHelp = "n: next page, p: previous page, /text: filter (/ alone: no filter), <id>: open a character, q: quit"
+
+// runBrowse pages the characters of the campaign in the terminal:
+// browse --campaign curse-of-strahd --limit 20 --query "dwarf villain"
+func (a *App) runBrowse(args []string) error {
+	flags := flag.NewFlagSet("browse", flag.ExitOnError)
+	campaign := flags.String("campaign", getEnv("CAMPAIGN", DefaultCampaign), "campaign of the characters")
+	limit := flags.Int("limit", 20, "number of characters per page")
+	query := flags.String("query", "", "first filter (words of the name, the kind or the tags)")
+	includeArchived := flags.Bool("include-archived", false, "browse the archived characters too")
+	flags.Parse(args)
+	if *limit < 1 {
+		return fmt.Errorf("limit must be 1 or more")
+	}
+
+	registry, err := a.storage.Registry(*campaign)
+	if err != nil {
+		return err
+	}
+	characters := FilterArchived(registry.List(), *includeArchived)
+	SortCharacters(characters, a.sortOptions)
+	browser := NewBrowser(registry, characters, *limit)
+	browser.Filter(*query)
+	browser.Render(os.Stdout)
+	fmt.Println(browseHelp)
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Print("browse> ")
+		if !scanner.Scan() {
+			fmt.Println()
+			return scanner.Err()
+		}
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "q":
+			return nil
+		case line == "" || line == "n":
+			browser.Move(1)
+		case line == "p":
+			browser.Move(-1)
+		case strings.HasPrefix(line, "/"):
+			browser.Filter(strings.TrimPrefix(line, "/"))
+		default:
+			id, err := strconv.Atoi(line)
+			if err != nil {
+				fmt.Println(browseHelp)
+				continue
+			}
+			err = browser.Open(os.Stdout, id)
+			if err != nil {
+				fmt.Println("😡:", err)
+			}
+			continue
+		}
+		browser.Render(os.Stdout)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrTokenBudget stops a run before a request would exceed its token budget
+var ErrTokenBudget = errors.New("token budget exceeded")
+
+// TokenBudget counts the prompt and eval tokens of the requests of a run,
+// a request is refused when the largest request so far wouldn't fit (Max 0: no limit)
+type TokenBudget struct {
+	Max int
+
+	mutex   sync.Mutex
+	used    int
+	largest int
+}
+
+type tokenBudgetKey struct{}
+
+// WithTokenBudget attaches the budget to the requests of the context
+func WithTokenBudget(ctx context.Context, budget *TokenBudget) context.Context {
+	return context.WithValue(ctx, tokenBudgetKey{}, budget)
+}
+
+// tokenBudget returns the budget of the context, nil without budget
+func tokenBudget(ctx context.Context) *TokenBudget {
+	budget, _ := ctx.Value(tokenBudgetKey{}).(*TokenBudget)
+	return budget
+}
+
+// Check is called before a request
+func (b *TokenBudget) Check() error {
+	if b == nil || b.Max == 0 {
+		return nil
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.used+b.largest > b.Max {
+		return fmt.Errorf("%w: %d of %d tokens used, the next request needs about %d", ErrTokenBudget, b.used, b.Max, b.largest)
+	}
+	return nil
+}
+
+// Record adds the tokens of an answer
+func (b *TokenBudget) Record(tokens int) {
+	if b == nil {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.used += tokens
+	b.largest = max(b.largest, tokens)
+}
+
+// Used returns the tokens of the requests so far
+func (b *TokenBudget) Used() int {
+	if b == nil {
+		return 0
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.used
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+
+	"github.com/ollama/ollama/api"
+)
+
+// Capabilities of the model, probed with the show and version APIs
+type Capabilities struct {
+	ServerVersion string
+	ContextLength int
+	// StructuredOutputs is true when the server supports a JSON schema as format (0.5.0+)
+	StructuredOutputs bool
+	// Reasoning models think before they answer (<think> in the template)
+	Reasoning bool
+	Tools     bool
+	// Digest of the model (list API), recorded in the provenance of the characters
+	Digest string
+	// Family of the model (llama, qwen2...), it selects the prompt adapter
+	Family string
+}
+
+// promptBudget is the room kept for the prompt in the context (the faction and events prompts list candidates)
+const promptBudget = 1024
+
+// ProbeCapabilities asks Ollama what the model can do
+func ProbeCapabilities(ctx context.Context, client *api.Client, model string) (Capabilities, error) {
+	capabilities := Capabilities{}
+
+	version, err := client.Version(ctx)
+	if err != nil {
+		return capabilities, err
+	}
+	capabilities.ServerVersion = version
+	capabilities.StructuredOutputs = versionAtLeast(version, "0.5.0")
+
+	show, err := client.Show(ctx, &api.ShowRequest{Model: model})
+	if err != nil {
+		return capabilities, err
+	}
+	architecture, _ := show.ModelInfo["general.architecture"].(string)
+	// the JSON numbers are float64
+	contextLength, _ := show.ModelInfo[architecture+".context_length"].(float64)
+	capabilities.ContextLength = int(contextLength)
+	capabilities.Reasoning = strings.Contains(show.Template, "<think>")
+	capabilities.Tools = strings.Contains(show.Template, ".Tools")
+	capabilities.Family = show.Details.Family
+
+	// the digest is only for the provenance, a failed list is not an error
+	list, err := client.List(ctx)
+	if err == nil {
+		for _, listed := range list.Models {
+			if listed.Name == model || listed.Name == model+":latest" {
+				capabilities.Digest = listed.Digest
+			}
+		}
+	}
+	return capabilities, nil
+}
+
+// Adjust adapts the generator to the capabilities of the model and returns the warnings:
+// num_ctx fits the largest answer and its prompt (without exceeding the context length, NUM_CTX=auto
+// clamps the sizes per request to it),
+// the num_predict limits are capped, and a reasoning model gets the softened retries
+func (g *Generator) Adjust(capabilities Capabilities) []string {
+	warnings := []string{}
+	if !capabilities.StructuredOutputs {
+		warnings = append(warnings, fmt.Sprintf("Ollama %s doesn't support the structured outputs (0.5.0+), most answers will be invalid", capabilities.ServerVersion))
+	}
+
+	if capabilities.ContextLength > 0 {
+		g.limits = maps.Clone(g.limits)
+		maxNumPredict := 0
+		for domain, limits := range g.limits {
+			if limits.NumPredict > capabilities.ContextLength-promptBudget {
+				warnings = append(warnings, fmt.Sprintf("the num_predict of %s (%d) exceeds the context length of the model (%d)", domain, limits.NumPredict, capabilities.ContextLength))
+				limits.NumPredict = max(capabilities.ContextLength-promptBudget, capabilities.ContextLength/2)
+				g.limits[domain] = limits
+			}
+			maxNumPredict = max(maxNumPredict, limits.NumPredict)
+		}
+
+		switch {
+		case g.contextSizer != nil:
+			g.contextSizer.SetContextLength(capabilities.ContextLength)
+		case g.numCtx > capabilities.ContextLength:
+			warnings = append(warnings, fmt.Sprintf("NUM_CTX (%d) exceeds the context length of the model (%d)", g.numCtx, capabilities.ContextLength))
+			g.numCtx = capabilities.ContextLength
+		case g.numCtx == 0:
+			g.numCtx = min(maxNumPredict+promptBudget, capabilities.ContextLength)
+		}
+	}
+
+	if g.toolCalling && !capabilities.Tools {
+		warnings = append(warnings, "the model doesn't support the tools, TOOL_CALLING is disabled")
+		g.toolCalling = false
+	}
+	if capabilities.Reasoning && !g.autoAdjust {
+		// the aggressive sampling options derail the reasoning models
+		warnings = append(warnings, "reasoning model: the retries use the softened options (AUTO_ADJUST)")
+		g.autoAdjust = true
+	}
+	return warnings
+}
+
+// versionAtLeast compares the dotted versions (0.5.7 >= 0.5.0), a dev build is recent
+func versionAtLeast(version, minimum string) bool {
+	parts := strings.Split(strings.TrimPrefix(version, "v"), ".")
+	minimumParts := strings.Split(minimum, ".")
+	for idx, minimumPart := range minimumParts {
+		if idx >= len(parts) {
+			return false
+		}
+		value, err := strconv.Atoi(strings.SplitN(parts[idx], "-", 2)[0])
+		if err != nil {
+			return true
+		}
+		minimumValue, _ := strconv.Atoi(minimumPart)
+		if value != minimumValue {
+			return value > minimumValue
+		}
+	}
+	return true
+}
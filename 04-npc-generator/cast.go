@@ -0,0 +1,500 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/ollama/ollama/api"
+)
+
+// CastMatrix is the target of a cast: the minimum number of characters of every role,
+// the ratios and the relationships between the roles, and the allowed alignments and temperaments
+type CastMatrix struct {
+	Size  int            `json:"size"`
+	Roles map[string]int `json:"roles"`
+	// Ratios: at least Min characters of Role per character of Per (an antagonist per protagonist)
+	Ratios []CastRatio `json:"ratios"`
+	// Links: every character of From has a relationship Relation with a character of To
+	Links        []CastLink `json:"links"`
+	Alignments   []string   `json:"alignments"`
+	Temperaments []string   `json:"temperaments"`
+	// MaxShare is the largest share of the cast with the same alignment or temperament
+	MaxShare float64 `json:"max_share"`
+}
+
+type CastRatio struct {
+	Role string `json:"role"`
+	Per  string `json:"per"`
+	Min  int    `json:"min"`
+}
+
+type CastLink struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Relation string `json:"relation"`
+}
+
+var defaultCastMatrix = CastMatrix{
+	Size:  6,
+	Roles: map[string]int{"protagonist": 1, "antagonist": 1, "ally": 1, "neutral": 1},
+	Ratios: []CastRatio{
+		{Role: "antagonist", Per: "protagonist", Min: 1},
+	},
+	Links: []CastLink{
+		{From: "antagonist", To: "protagonist", Relation: "rival"},
+		{From: "ally", To: "protagonist", Relation: "ally"},
+	},
+	Alignments: []string{
+		"lawful good", "neutral good", "chaotic good",
+		"lawful neutral", "true neutral", "chaotic neutral",
+		"lawful evil", "neutral evil", "chaotic evil",
+	},
+	Temperaments: []string{"sanguine", "choleric", "melancholic", "phlegmatic"},
+	MaxShare:     0.5,
+}
+
+// LoadCastMatrix reads the matrix file, the missing fields are the ones of the default matrix
+func LoadCastMatrix(path string) (CastMatrix, error) {
+	matrix := defaultCastMatrix
+	if path == "" {
+		return matrix, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return matrix, err
+	}
+	// the roles of the file replace the default ones, json.Unmarshal would merge the maps
+	matrix.Roles = nil
+	err = json.Unmarshal(data, &matrix)
+	if err != nil {
+		return matrix, fmt.Errorf("%s: %w", path, err)
+	}
+	if matrix.Roles == nil {
+		matrix.Roles = maps.Clone(defaultCastMatrix.Roles)
+	}
+	if len(matrix.Roles) == 0 || len(matrix.Alignments) == 0 || len(matrix.Temperaments) == 0 {
+		return matrix, fmt.Errorf("%s: the matrix needs roles, alignments and temperaments", path)
+	}
+	return matrix, nil
+}
+
+// roleNames are the roles of the matrix, sorted
+func (m CastMatrix) roleNames() []string {
+	names := slices.Collect(maps.Keys(m.Roles))
+	for _, ratio := range m.Ratios {
+		names = append(names, ratio.Role, ratio.Per)
+	}
+	for _, link := range m.Links {
+		names = append(names, link.From, link.To)
+	}
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+// PlanRoles returns the roles of the cast: the minimums, the ratios,
+// then the roles without minimum (or every role) in turn up to the size
+func PlanRoles(matrix CastMatrix) []string {
+	counts := maps.Clone(matrix.Roles)
+	for _, ratio := range matrix.Ratios {
+		counts[ratio.Role] = max(counts[ratio.Role], ratio.Min*counts[ratio.Per])
+	}
+	roles := []string{}
+	for _, role := range matrix.roleNames() {
+		for range counts[role] {
+			roles = append(roles, role)
+		}
+	}
+	fillers := slices.DeleteFunc(matrix.roleNames(), func(role string) bool { return matrix.Roles[role] > 0 })
+	if len(fillers) == 0 {
+		fillers = matrix.roleNames()
+	}
+	for idx := 0; len(roles) < matrix.Size; idx++ {
+		roles = append(roles, fillers[idx%len(fillers)])
+	}
+	return roles
+}
+
+// CastMember is a character of the registry with its place in the cast
+type CastMember struct {
+	CharacterID   int                `json:"character_id,omitempty"`
+	Code          string             `json:"code,omitempty"`
+	Name          string             `json:"name"`
+	Kind          string             `json:"kind"`
+	Role          string             `json:"role"`
+	Alignment     string             `json:"alignment"`
+	Temperament   string             `json:"temperament"`
+	Relationships []CastRelationship `json:"relationships"`
+}
+
+type CastRelationship struct {
+	Name     string `json:"name"`
+	Relation string `json:"relation"`
+}
+
+// Cast is a coherent set of characters, Gaps are the rules of the matrix still broken
+type Cast struct {
+	Name    string       `json:"name"`
+	Members []CastMember `json:"members"`
+	Gaps    []string     `json:"gaps,omitempty"`
+}
+
+func (c Cast) byRole(role string) []CastMember {
+	return slices.DeleteFunc(slices.Clone(c.Members), func(member CastMember) bool { return member.Role != role })
+}
+
+func (m CastMember) relatedTo(name, relation string) bool {
+	return slices.ContainsFunc(m.Relationships, func(relationship CastRelationship) bool {
+		return strings.EqualFold(relationship.Name, name) && strings.EqualFold(relationship.Relation, relation)
+	})
+}
+
+// CastGap is a rule of the matrix broken by the cast
+type CastGap struct {
+	Rule string
+	// Role is the role of the missing characters
+	Role    string
+	Missing int
+	// Members are the members to change (a missing link, an alignment or a temperament too common)
+	Members []string
+	Field   string
+	Value   string
+}
+
+// ValidateCast returns the rules of the matrix broken by the cast
+func ValidateCast(cast Cast, matrix CastMatrix) []CastGap {
+	gaps := []CastGap{}
+	for _, role := range matrix.roleNames() {
+		if missing := matrix.Roles[role] - len(cast.byRole(role)); missing > 0 {
+			gaps = append(gaps, CastGap{Rule: fmt.Sprintf("at least %d %s", matrix.Roles[role], role), Role: role, Missing: missing})
+		}
+	}
+	for _, ratio := range matrix.Ratios {
+		expected := ratio.Min * len(cast.byRole(ratio.Per))
+		if missing := expected - len(cast.byRole(ratio.Role)); missing > 0 {
+			gaps = append(gaps, CastGap{Rule: fmt.Sprintf("%d %s per %s", ratio.Min, ratio.Role, ratio.Per), Role: ratio.Role, Missing: missing})
+		}
+	}
+	for _, link := range matrix.Links {
+		targets := cast.byRole(link.To)
+		unlinked := []string{}
+		for _, member := range cast.byRole(link.From) {
+			if !slices.ContainsFunc(targets, func(target CastMember) bool { return member.relatedTo(target.Name, link.Relation) }) {
+				unlinked = append(unlinked, member.Name)
+			}
+		}
+		if len(unlinked) > 0 && len(targets) > 0 {
+			gaps = append(gaps, CastGap{Rule: fmt.Sprintf("every %s is a %s of a %s", link.From, link.Relation, link.To), Role: link.To, Members: unlinked, Field: "relation", Value: link.Relation})
+		}
+	}
+	share := func(field string, value func(member CastMember) string) {
+		groups := map[string][]string{}
+		for _, member := range cast.Members {
+			groups[value(member)] = append(groups[value(member)], member.Name)
+		}
+		maxCount := max(int(matrix.MaxShare*float64(len(cast.Members))), 1)
+		for _, key := range slices.Sorted(maps.Keys(groups)) {
+			if excess := len(groups[key]) - maxCount; excess > 0 && matrix.MaxShare > 0 {
+				gaps = append(gaps, CastGap{Rule: fmt.Sprintf("at most %.0f%% %s %s", matrix.MaxShare*100, field, key), Members: groups[key][len(groups[key])-excess:], Field: field, Value: key})
+			}
+		}
+	}
+	share("alignment", func(member CastMember) string { return member.Alignment })
+	share("temperament", func(member CastMember) string { return member.Temperament })
+	return gaps
+}
+
+// castSchema is the answer of the traits of the new members
+func castSchema(matrix CastMatrix, names []string) map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"members": map[string]any{
+				"type": "array",
+				"items": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"name":        map[string]any{"type": "string", "enum": names},
+						"alignment":   map[string]any{"type": "string", "enum": matrix.Alignments},
+						"temperament": map[string]any{"type": "string", "enum": matrix.Temperaments},
+						"relationships": map[string]any{
+							"type": "array",
+							"items": map[string]any{
+								"type": "object",
+								"properties": map[string]any{
+									"name":     map[string]any{"type": "string"},
+									"relation": map[string]any{"type": "string"},
+								},
+								"required": []string{"name", "relation"},
+							},
+						},
+					},
+					"required": []string{"name", "alignment", "temperament", "relationships"},
+				},
+			},
+		},
+		"required": []string{"members"},
+	}
+}
+
+// AssignTraits asks the alignment, the temperament and the relationships of the members
+// at the indexes, the others are the rest of the cast; a constraint of a member is added
+// to the prompt (an alignment to avoid) (3 attempts)
+func (g *Generator) AssignTraits(ctx context.Context, cast *Cast, matrix CastMatrix, indexes []int, constraints map[int]string) error {
+	userContent := "Give these characters of a cast an alignment, a temperament and their relationships with the other characters of the cast (rival, ally, mentor, sibling, lover, debtor...):\n"
+	names := []string{}
+	for _, idx := range indexes {
+		member := cast.Members[idx]
+		userContent += fmt.Sprintf("- %s (%s), the %s of the cast", member.Name, member.Kind, member.Role)
+		if constraints[idx] != "" {
+			userContent += ", " + constraints[idx]
+		}
+		userContent += "\n"
+		names = append(names, member.Name)
+	}
+	others := ""
+	for idx, member := range cast.Members {
+		if !slices.Contains(indexes, idx) {
+			others += fmt.Sprintf("- %s (%s), the %s, %s, %s\n", member.Name, member.Kind, member.Role, member.Alignment, member.Temperament)
+		}
+	}
+	if others != "" {
+		userContent += "The other characters of the cast:\n" + others
+	}
+	for _, link := range matrix.Links {
+		userContent += fmt.Sprintf("Every %s is a %s of a %s.\n", link.From, link.Relation, link.To)
+	}
+	messages := []api.Message{
+		{Role: "system", Content: g.genre.Instructions},
+		{Role: "user", Content: userContent},
+	}
+	options := map[string]interface{}{"temperature": 0.8}
+
+	for attempt := 0; attempt < 3; attempt++ {
+		answer, err := g.chat(ctx, DomainCast, messages, castSchema(matrix, names), options)
+		if err != nil {
+			return err
+		}
+		traits := struct {
+			Members []CastMember `json:"members"`
+		}{}
+		err = decodeAnswer(answer.Content, &traits)
+		if err == nil && len(traits.Members) < len(indexes) {
+			err = fmt.Errorf("expected %d members, got %d", len(indexes), len(traits.Members))
+		}
+		if err != nil {
+			fmt.Println("😡 cast:", err)
+			continue
+		}
+		for _, assigned := range traits.Members {
+			for _, idx := range indexes {
+				member := &cast.Members[idx]
+				if strings.EqualFold(member.Name, assigned.Name) {
+					member.Alignment, member.Temperament = assigned.Alignment, assigned.Temperament
+					member.Relationships = slices.DeleteFunc(assigned.Relationships, func(relationship CastRelationship) bool {
+						return strings.EqualFold(relationship.Name, member.Name)
+					})
+				}
+			}
+		}
+		return nil
+	}
+	return errors.New("no valid traits of the cast after 3 attempts")
+}
+
+// linkMember fills a missing link: the member gets the relation with the member of the role
+// having the fewest of them
+func linkMember(cast *Cast, name, role, relation string) {
+	targets := cast.byRole(role)
+	incoming := func(target CastMember) int {
+		count := 0
+		for _, member := range cast.Members {
+			if member.relatedTo(target.Name, relation) {
+				count++
+			}
+		}
+		return count
+	}
+	target := slices.MinFunc(targets, func(a, b CastMember) int { return incoming(a) - incoming(b) })
+	for idx := range cast.Members {
+		if cast.Members[idx].Name == name {
+			cast.Members[idx].Relationships = append(cast.Members[idx].Relationships, CastRelationship{Name: target.Name, Relation: relation})
+		}
+	}
+}
+
+// castRounds is the number of attempts to fill the gaps of a cast
+const castRounds = 3
+
+// BuildCast generates the characters of the planned roles, assigns their traits, then fills
+// the gaps of the matrix: the missing roles are generated, the missing links are added,
+// the too common alignments and temperaments are assigned again
+func (g *Generator) BuildCast(ctx context.Context, registry *Registry, spec Spec, matrix CastMatrix) (Cast, error) {
+	cast := Cast{}
+	addMembers := func(roles []string) ([]int, error) {
+		spec.Count = len(roles)
+		slots, err := NewRun(g, registry.Deduper(), spec).Generate(ctx)
+		if err != nil {
+			return nil, err
+		}
+		err = StoreSlots(registry, slots)
+		if err != nil {
+			return nil, err
+		}
+		indexes := []int{}
+		for idx, slot := range slots {
+			if slot.Status != SlotOK {
+				continue
+			}
+			indexes = append(indexes, len(cast.Members))
+			cast.Members = append(cast.Members, CastMember{
+				CharacterID: slot.Character.ID, Code: slot.Character.Code,
+				Name: slot.Character.Name, Kind: slot.Character.Kind, Role: roles[idx],
+			})
+		}
+		return indexes, nil
+	}
+
+	indexes, err := addMembers(PlanRoles(matrix))
+	if err != nil {
+		return cast, err
+	}
+	if len(indexes) > 0 {
+		err = g.AssignTraits(ctx, &cast, matrix, indexes, nil)
+		if err != nil {
+			return cast, err
+		}
+	}
+
+	for round := 0; round < castRounds; round++ {
+		gaps := ValidateCast(cast, matrix)
+		if len(gaps) == 0 {
+			break
+		}
+		missingRoles := []string{}
+		constraints := map[int]string{}
+		for _, gap := range gaps {
+			fmt.Println("🎭 gap:", gap.Rule)
+			switch {
+			case gap.Missing > 0:
+				for range gap.Missing {
+					missingRoles = append(missingRoles, gap.Role)
+				}
+			case gap.Field == "relation":
+				for _, name := range gap.Members {
+					linkMember(&cast, name, gap.Role, gap.Value)
+				}
+			default:
+				for idx, member := range cast.Members {
+					if slices.Contains(gap.Members, member.Name) {
+						constraints[idx] = strings.TrimPrefix(constraints[idx]+fmt.Sprintf(", not %s", gap.Value), ", ")
+					}
+				}
+			}
+		}
+		indexes := slices.Sorted(maps.Keys(constraints))
+		if len(missingRoles) > 0 {
+			added, err := addMembers(missingRoles)
+			if err != nil {
+				return cast, err
+			}
+			indexes = append(indexes, added...)
+		}
+		if len(indexes) > 0 {
+			err = g.AssignTraits(ctx, &cast, matrix, indexes, constraints)
+			if err != nil {
+				return cast, err
+			}
+		}
+	}
+	for _, gap := range ValidateCast(cast, matrix) {
+		cast.Gaps = append(cast.Gaps, gap.Rule)
+	}
+	return cast, nil
+}
+
+// CastMarkdown renders the members and a Mermaid graph of their relationships
+func CastMarkdown(cast Cast) string {
+	markdown := "# " + escapeMarkdown(cast.Name) + "\n\n"
+	rows := [][]string{}
+	for _, member := range cast.Members {
+		rows = append(rows, []string{member.Role, member.Name, member.Kind, member.Alignment, member.Temperament, member.Code})
+	}
+	markdown += RenderTable([]string{"Role", "Name", "Kind", "Alignment", "Temperament", "Code"}, rows)
+
+	markdown += "\n## Relationships\n\n```mermaid\ngraph LR\n"
+	nodes := map[string]string{}
+	for idx, member := range cast.Members {
+		nodes[strings.ToLower(member.Name)] = fmt.Sprintf("C%d", idx)
+		markdown += fmt.Sprintf("    C%d[\"%s<br>%s\"]\n", idx, mermaidLabel(member.Name), mermaidLabel(member.Role))
+	}
+	for idx, member := range cast.Members {
+		for _, relationship := range member.Relationships {
+			if node, ok := nodes[strings.ToLower(relationship.Name)]; ok {
+				markdown += fmt.Sprintf("    C%d -- \"%s\" --> %s\n", idx, mermaidLabel(relationship.Relation), node)
+			}
+		}
+	}
+	markdown += "```\n"
+	if len(cast.Gaps) > 0 {
+		markdown += "\n## Gaps\n\n"
+		for _, gap := range cast.Gaps {
+			markdown += "- " + gap + "\n"
+		}
+	}
+	return markdown
+}
+
+// runCast generates a cast satisfying a matrix of roles: cast --name "The Heist" --matrix heist.json
+func (a *App) runCast(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("cast", flag.ExitOnError)
+	campaign := flags.String("campaign", getEnv("CAMPAIGN", DefaultCampaign), "campaign of the characters")
+	name := flags.String("name", "Cast", "name of the cast")
+	matrixPath := flags.String("matrix", os.Getenv("CAST_MATRIX"), "JSON file of the target matrix (default: a protagonist, an antagonist, an ally)")
+	kind := flags.String("kind", a.generator.kinds[0].Name, "kind of the characters")
+	mix := flags.String("mix", "", "parent kinds of a hybrid (dwarf+human)")
+	flags.Parse(args)
+
+	matrix, err := LoadCastMatrix(*matrixPath)
+	if err != nil {
+		return err
+	}
+	spec := Spec{Level: 1}
+	spec.Kind, spec.Parents, err = ResolveKind(a.generator.kinds, *kind, *mix)
+	if err != nil {
+		return err
+	}
+	registry, err := a.storage.Registry(*campaign)
+	if err != nil {
+		return err
+	}
+
+	cast, err := a.generator.BuildCast(ctx, registry, spec, matrix)
+	if err != nil {
+		return err
+	}
+	cast.Name = *name
+	slug := Slug(cast.Name)
+	if slug == "" {
+		slug = "cast"
+	}
+	exportPath, err := a.storage.ExportPath(*campaign, "casts", slug+".json")
+	if err != nil {
+		return err
+	}
+	err = writeExport(exportPath, cast, CastMarkdown(cast))
+	if err != nil {
+		return err
+	}
+	fmt.Println("🎭", len(cast.Members), "characters", exportPath)
+	if len(cast.Gaps) > 0 {
+		return fmt.Errorf("the cast still breaks the matrix: %s", strings.Join(cast.Gaps, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/ollama/ollama/api"
+)
+
+// NewClient returns the Ollama client, wrapped by the VCR recorder when VCR_MODE is set,
+// with several hosts (OLLAMA_HOSTS) the requests are balanced by the returned balancer,
+// with GPU_SLOTS the heavy requests of all the hosts are scheduled by priority
+func NewClient() (*api.Client, *Balancer, error) {
+	mode, hosts := os.Getenv("VCR_MODE"), os.Getenv("OLLAMA_HOSTS")
+	transport, err := proxyTransport()
+	if err != nil {
+		return nil, nil, err
+	}
+	slots, err := ParseGPUSlots(getEnv("GPU_SLOTS", "0"))
+	if err != nil {
+		return nil, nil, err
+	}
+	if mode == "" && hosts == "" && slots == 0 && transport == http.DefaultTransport {
+		client, err := api.ClientFromEnvironment()
+		return client, nil, err
+	}
+
+	ollamaUrl := os.Getenv("OLLAMA_HOST")
+	if ollamaUrl == "" {
+		ollamaUrl = "http://localhost:11434"
+	}
+	if !strings.Contains(ollamaUrl, "://") {
+		ollamaUrl = "http://" + ollamaUrl
+	}
+	base, err := url.Parse(ollamaUrl)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var balancer *Balancer
+	if hosts != "" {
+		balancer, err = NewBalancer(hosts, getEnv("OLLAMA_BALANCE", BalanceLeastLoaded), transport)
+		if err != nil {
+			return nil, nil, err
+		}
+		base, transport = balancer.Base(), balancer
+	}
+	// the replayed answers don't take a slot
+	if slots > 0 {
+		transport = NewGPUScheduler(transport, slots)
+	}
+	if mode != "" {
+		transport, err = NewVCRTransport(mode, os.Getenv("VCR_CASSETTE"), transport)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return api.NewClient(base, &http.Client{Transport: transport}), balancer, nil
+}
+
+// proxyTransport is the transport of an Ollama behind an authenticated reverse proxy:
+// the headers of OLLAMA_HEADERS (JSON object) and OLLAMA_BEARER_TOKEN on every request,
+// the CA bundle of OLLAMA_CA_BUNDLE and the client certificate of OLLAMA_CLIENT_CERT
+// and OLLAMA_CLIENT_KEY (PEM files); without them it is the default transport
+func proxyTransport() (http.RoundTripper, error) {
+	headers := map[string]string{}
+	if value := os.Getenv("OLLAMA_HEADERS"); value != "" {
+		err := json.Unmarshal([]byte(value), &headers)
+		if err != nil {
+			return nil, fmt.Errorf("OLLAMA_HEADERS: %w", err)
+		}
+	}
+	if token := os.Getenv("OLLAMA_BEARER_TOKEN"); token != "" {
+		headers["Authorization"] = "Bearer " + token
+	}
+
+	var transport http.RoundTripper = http.DefaultTransport
+	tlsConfig, err := proxyTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		custom := http.DefaultTransport.(*http.Transport).Clone()
+		custom.TLSClientConfig = tlsConfig
+		transport = custom
+	}
+	if len(headers) > 0 {
+		transport = &headerTransport{headers: headers, transport: transport}
+	}
+	return transport, nil
+}
+
+func proxyTLSConfig() (*tls.Config, error) {
+	caBundle, certFile, keyFile := os.Getenv("OLLAMA_CA_BUNDLE"), os.Getenv("OLLAMA_CLIENT_CERT"), os.Getenv("OLLAMA_CLIENT_KEY")
+	if caBundle == "" && certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caBundle != "" {
+		pem, err := os.ReadFile(caBundle)
+		if err != nil {
+			return nil, err
+		}
+		// the bundle is added to the system roots (a public and a private proxy)
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("OLLAMA_CA_BUNDLE: no certificate in %s", caBundle)
+		}
+		config.RootCAs = pool
+	}
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, errors.New("OLLAMA_CLIENT_CERT and OLLAMA_CLIENT_KEY go together")
+		}
+		certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+	return config, nil
+}
+
+// headerTransport adds the headers to every request
+type headerTransport struct {
+	headers   map[string]string
+	transport http.RoundTripper
+}
+
+func (h *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for name, value := range h.headers {
+		req.Header.Set(name, value)
+	}
+	return h.transport.RoundTrip(req)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"slices"
+	"strings"
+)
+
+// TableCode returns a pronounceable 3 or 4 letter code derived from the name (THOR for Thorgar),
+// that is not in the used codes
+func TableCode(name string, used map[string]bool) string {
+	letters := []byte{}
+	for _, r := range collationKey(name) {
+		if r >= 'a' && r <= 'z' {
+			letters = append(letters, byte(r)-'a'+'A')
+		}
+	}
+	if len(letters) == 0 {
+		letters = []byte("NPC")
+	}
+
+	// the candidates keep the order of the letters in the name and alternate
+	// consonants and vowels: the first letter, then the next letter of the other class...
+	candidates := []string{}
+	var walk func(code []byte, from int)
+	walk = func(code []byte, from int) {
+		if len(code) >= 3 {
+			candidates = append(candidates, string(code))
+		}
+		if len(code) == 4 {
+			return
+		}
+		for idx := from; idx < len(letters); idx++ {
+			if isVowel(letters[idx]) != isVowel(code[len(code)-1]) {
+				walk(append(slices.Clone(code), letters[idx]), idx+1)
+			}
+		}
+	}
+	walk([]byte{letters[0]}, 1)
+
+	// the 3 letter codes first, in the order of the name
+	for _, size := range []int{3, 4} {
+		for _, candidate := range candidates {
+			if len(candidate) == size && !used[candidate] {
+				return candidate
+			}
+		}
+	}
+
+	// exhausted names: the first letter with a generic ending
+	for _, vowel := range "AEIOU" {
+		for _, consonant := range "BDGKLMNRST" {
+			for _, ending := range []string{"", "A", "O"} {
+				candidate := string(letters[0]) + string(vowel) + string(consonant) + ending
+				if !used[candidate] {
+					return candidate
+				}
+			}
+		}
+	}
+	return string(letters[0]) + "XX"
+}
+
+func isVowel(letter byte) bool {
+	return strings.IndexByte("AEIOUY", letter) >= 0
+}
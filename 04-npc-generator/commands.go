@@ -0,0 +1,1169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"04-npc-generator/config"
+)
+
+// App gathers what the commands need
+type App struct {
+	generator   *Generator
+	storage     *Storage
+	sortOptions SortOptions
+	markdown    MarkdownOptions
+	// stdout carries the results of --stdin (the logs go to stderr)
+	stdout io.Writer
+	// offline refuses the network calls other than Ollama (nil: not offline-strict)
+	offline *OfflineGuard
+	// transport carries the requests other than Ollama (the sinks, Discord, the portraits),
+	// the offline guard in the offline-strict mode
+	transport http.RoundTripper
+	// config is the origin of the settings (config show)
+	config *config.Layers
+	// summary is the outcome of the run of the command (nil: the command has no run summary),
+	// written to summaryPath (RUN_SUMMARY, --summary) with "-" for stderr
+	summary     *RunSummary
+	summaryPath string
+}
+
+// runGenerate generates a batch of characters for the campaign,
+// the run is exported as characters.<kind>.json, .md and .csv
+// (the flags default to the environment variables)
+func (a *App) runGenerate(ctx context.Context, args []string) error {
+	level, err := strconv.Atoi(getEnv("LEVEL", "1"))
+	if err != nil {
+		return err
+	}
+	flags := flag.NewFlagSet("generate", flag.ExitOnError)
+	campaign := flags.String("campaign", getEnv("CAMPAIGN", DefaultCampaign), "campaign of the characters")
+	spec := Spec{}
+	flags.StringVar(&spec.Kind, "kind", os.Getenv("KIND"), "kind of the characters (default: the first kind of the genre)")
+	flags.StringVar(&spec.Class, "class", os.Getenv("CLASS"), "class of the characters (enables the equipment stage)")
+	flags.IntVar(&spec.Level, "level", level, "level of the characters")
+	flags.StringVar(&spec.System, "system", os.Getenv("SYSTEM"), "game system of the stats (dnd5e, pf2e, osr or a custom one)")
+	flags.IntVar(&spec.Count, "count", 15, "number of characters")
+	flags.BoolVar(&spec.Aliases, "aliases", os.Getenv("ALIASES") == "true", "give the characters a title and aliases")
+	flags.BoolVar(&spec.Coverage, "coverage", os.Getenv("COVERAGE") == "true", "give every character a prefix of the kind in turn, so the names span its phonetic rules")
+	flags.BoolVar(&spec.NameOnly, "name-only", os.Getenv("NAME_ONLY") == "true", "generate the names only, with a minimal prompt and schema (fast mode)")
+	mix := flags.String("mix", os.Getenv("MIX"), "parent kinds of a hybrid (dwarf+human)")
+	childOf := flags.Int("child-of", 0, "ID of the stored parent: the characters keep its kind and family name")
+	siblingOf := flags.Int("sibling-of", 0, "ID of the stored sibling: the characters keep its kind and family name")
+	jsonlPath := flags.String("jsonl", os.Getenv("JSONL_OUTPUT"), "append every stored character to this JSON Lines file")
+	stdin := flags.Bool("stdin", false, "read the specs from stdin (JSONL) and write the slots to stdout (JSONL)")
+	genreName := flags.String("genre", "", "genre pack (fantasy, scifi, cyberpunk, western or a custom one)")
+	themeName := flags.String("theme", "", "seasonal pack added to the genre (halloween, winterfest or a custom one)")
+	out := flags.String("out", os.Getenv("OUTPUT_TEMPLATE"), "template of the export paths ({{.Campaign}}, {{.Kind}}, {{.Genre}}, {{.Date}}, {{.Time}}, {{.Format}})")
+	maxTokens, err := strconv.Atoi(getEnv("MAX_TOKENS_PER_RUN", "0"))
+	if err != nil {
+		return err
+	}
+	flags.IntVar(&maxTokens, "max-tokens-per-run", maxTokens, "stop the run before its prompt and eval tokens exceed this budget (0: no limit)")
+	flags.BoolVar(&a.generator.strict, "strict", a.generator.strict, "verify every accepted character with a second request")
+	flags.BoolVar(&a.generator.review, "review", a.generator.review, "grade every accepted character with the rubric of the judge model (JUDGE_LLM)")
+	flags.StringVar(&a.generator.transliterate, "transliterate", a.generator.transliterate, "add the ascii_name of the characters: loose (drop the letters without an ASCII form) or strict (reject them)")
+	parallel, err := strconv.Atoi(getEnv("PARALLEL", "1"))
+	if err != nil {
+		return err
+	}
+	flags.IntVar(&parallel, "parallel", parallel, "number of characters generated at the same time (with several OLLAMA_HOSTS)")
+	sinkURL := flags.String("sink", os.Getenv("SINK_URL"), "publish every stored character to nats://host:4222, kafka://rest-proxy:8082 or webhook://host/path")
+	notesDir := flags.String("notes", os.Getenv("NOTES_DIR"), "directory of the campaign notes (.md, .txt) grounding the characters")
+	syllables := flags.Bool("syllables", os.Getenv("SYLLABLES") == "true", "combine the names locally from the syllable table of the kind (name-only, no model once the table is saved)")
+	syllablesMaxAge, err := time.ParseDuration(getEnv("SYLLABLES_MAX_AGE", "0s"))
+	if err != nil {
+		return err
+	}
+	flags.DurationVar(&syllablesMaxAge, "syllables-max-age", syllablesMaxAge, "ask the model again for a syllable table older than this (0: never)")
+	withPortraits := flags.Bool("portraits", os.Getenv("PORTRAITS") == "true", "save a PNG portrait of every character next to the exports (PORTRAIT_URL)")
+	fewShot := flags.Bool("few-shot", os.Getenv("FEW_SHOT") != "false", "give the saved examples of the campaign (few-shot) to the model")
+	flags.StringVar(&a.summaryPath, "summary", a.summaryPath, "write the JSON summary of the run to this file (- for stderr)")
+	flags.Parse(args)
+	if *syllables {
+		spec.NameOnly = true
+	}
+
+	err = checkTransliterate(a.generator.transliterate)
+	if err != nil {
+		return err
+	}
+	err = a.loadNotes(ctx, *notesDir)
+	if err != nil {
+		return err
+	}
+	// the template is checked before the generation
+	var layout *OutputLayout
+	if *out != "" {
+		layout, err = NewOutputLayout(*out)
+		if err != nil {
+			return err
+		}
+	}
+
+	if *genreName != "" {
+		genre, err := FindGenre(a.generator.genres, *genreName)
+		if err != nil {
+			return err
+		}
+		a.generator.UseGenre(genre)
+		// the theme of THEME is kept with the new genre
+		if *themeName == "" {
+			*themeName = os.Getenv("THEME")
+		}
+	}
+	err = a.generator.UseTheme(*themeName)
+	if err != nil {
+		return err
+	}
+	if spec.Kind == "" {
+		spec.Kind = a.generator.kinds[0].Name
+	}
+
+	if *stdin {
+		return a.runStream(ctx, os.Stdin, a.stdout, *campaign)
+	}
+
+	_, err = a.generator.System(spec.System)
+	if err != nil {
+		return err
+	}
+	err = checkNameOnly(spec)
+	if err != nil {
+		return err
+	}
+	spec.Kind, spec.Parents, err = ResolveKind(a.generator.kinds, spec.Kind, *mix)
+	if err != nil {
+		return err
+	}
+
+	registry, err := a.storage.Registry(*campaign)
+	if err != nil {
+		return err
+	}
+	if *childOf != 0 || *siblingOf != 0 {
+		spec, err = a.relativeSpec(registry, spec, *childOf, *siblingOf)
+		if err != nil {
+			return err
+		}
+	}
+	if *syllables {
+		a.generator.syllables, err = a.syllableTable(ctx, spec, syllablesMaxAge, false)
+		if err != nil {
+			return err
+		}
+	}
+	if *fewShot {
+		path, err := a.storage.FewShotPath(*campaign)
+		if err != nil {
+			return err
+		}
+		a.generator.fewShot, err = LoadFewShot(path)
+		if err != nil {
+			return err
+		}
+	}
+	var portraits *PortraitClient
+	if *withPortraits {
+		portraits, err = a.portraitClient()
+		if err != nil {
+			return err
+		}
+	}
+
+	var jsonl *JSONLWriter
+	if *jsonlPath != "" {
+		jsonl, err = OpenJSONL(*jsonlPath, os.Getenv("JSONL_FSYNC") == "true")
+		if err != nil {
+			return err
+		}
+		defer jsonl.Close()
+	}
+	var sink *Sink
+	if *sinkURL != "" {
+		err = a.offline.Refuse("sink " + *sinkURL)
+		if err != nil {
+			return err
+		}
+		buffer, err := strconv.Atoi(getEnv("SINK_BUFFER", "100"))
+		if err != nil {
+			return err
+		}
+		sink, err = NewSink(*sinkURL, getEnv("SINK_TOPIC", "npc.{{.Campaign}}.{{.Kind}}"), buffer, a.transport)
+		if err != nil {
+			return err
+		}
+	}
+
+	// the slots are stored one by one, so the JSONL file grows during the run
+	budget := &TokenBudget{Max: maxTokens}
+	ctx = WithTokenBudget(ctx, budget)
+	slots := []Slot{}
+	stopped := ""
+	metrics, err := GenerateParallel(ctx, a.generator, registry.Deduper(), spec, parallel, func(slot Slot) error {
+		stored := []Slot{slot}
+		err := StoreSlots(registry, stored)
+		if err != nil {
+			return err
+		}
+		slots = append(slots, stored[0])
+		if stored[0].Status != SlotOK {
+			return nil
+		}
+		if jsonl != nil {
+			err = jsonl.Write(*stored[0].Character)
+			if err != nil {
+				return err
+			}
+		}
+		if sink != nil {
+			return sink.Publish(ctx, *campaign, *stored[0].Character)
+		}
+		return nil
+	})
+	// the queued characters are published before the exports, a lost one fails the run after them
+	var sinkErr error
+	if sink != nil {
+		sinkErr = sink.Close()
+	}
+	// the budget stops the run, the slots so far are exported
+	if errors.Is(err, ErrTokenBudget) {
+		stopped = err.Error()
+		fmt.Printf("💸 %s: %d of %d characters\n", err, len(slots), spec.Count)
+	} else if err != nil {
+		return err
+	}
+	// the workers finish out of order
+	slices.SortFunc(slots, func(a, b Slot) int { return a.Index - b.Index })
+
+	exportPath, err := a.storage.ExportPath(*campaign, "characters."+spec.Kind+".json")
+	if err != nil {
+		return err
+	}
+	paths := map[string]string{"json": exportPath, "md": strings.TrimSuffix(exportPath, ".json") + ".md", "csv": strings.TrimSuffix(exportPath, ".json") + ".csv"}
+	if layout != nil {
+		paths, err = layout.Paths(OutputFields{Campaign: *campaign, Kind: spec.Kind, Genre: a.generator.genre.Name}, time.Now())
+		if err != nil {
+			return err
+		}
+		exportPath = paths["json"]
+	}
+	output := RunOutput{Campaign: *campaign, Genre: a.generator.genre.Name, Spec: spec, Slots: slots, Metrics: metrics, Stopped: stopped}
+	output.Metrics.Tokens = budget.Used()
+	err = output.WriteFormats(paths, a.sortOptions, a.generator.genre, a.markdown)
+	if err != nil {
+		return err
+	}
+	a.summary = NewRunSummary("generate", output, paths)
+	fmt.Println("📝", exportPath, len(output.Failed()), "failed or filtered")
+	fmt.Printf("📈 %+v\n", output.Metrics)
+	fmt.Printf("⏱️ %s per character\n", perItem(output.Metrics, len(output.Characters())))
+	if spec.Coverage {
+		fmt.Println("🔤 coverage:", CoverageSummary(coveragePrefixes(a.generator.kinds, spec), output.Characters()))
+	}
+	if portraits != nil {
+		err = a.runPortraits(ctx, portraits, output.Characters(), filepath.Dir(exportPath))
+		if err != nil {
+			return err
+		}
+	}
+	return sinkErr
+}
+
+// runSystems lists the game systems (built-in and SYSTEMS_DIR)
+func (a *App) runSystems() error {
+	for _, name := range SystemNames(a.generator.systems) {
+		system := a.generator.systems[name]
+		stats := []string{}
+		for _, stat := range system.Stats {
+			stats = append(stats, fmt.Sprintf("%s %d..%d", stat.Name, stat.Min, stat.Max))
+		}
+		fmt.Printf("%-8s %s (%s)\n", name, system.Title, strings.Join(stats, ", "))
+	}
+	return nil
+}
+
+// runPromptTest runs the prompt regression suite and fails when an average score
+// is below its threshold, to check a prompt change before merging it
+func (a *App) runPromptTest(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("prompt-test", flag.ExitOnError)
+	suitePath := flags.String("suite", os.Getenv("PROMPT_TEST_SUITE"), "suite file (JSON), the built-in suite by default")
+	judgeModel := flags.String("judge", getEnv("JUDGE_LLM", a.generator.model), "model grading the style")
+	outputPath := flags.String("output", "", "write the results to this JSON file")
+	flags.Parse(args)
+
+	suite, err := LoadPromptTestSuite(*suitePath)
+	if err != nil {
+		return err
+	}
+	results, err := a.generator.RunPromptTest(ctx, suite, *judgeModel)
+	if err != nil {
+		return err
+	}
+	if *outputPath != "" {
+		data, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return err
+		}
+		err = os.WriteFile(*outputPath, data, 0644)
+		if err != nil {
+			return err
+		}
+	}
+	average, err := CheckThresholds(results, suite.Thresholds)
+	fmt.Printf("📏 average style %.2f validity %.2f diversity %.2f\n", average.Style, average.Validity, average.Diversity)
+	if err != nil {
+		return err
+	}
+	fmt.Println("✅ prompt test passed")
+	return nil
+}
+
+// runRegen re-attempts the failed or filtered slots of a run output, found by their Slot.Index
+// (the slots of the export are sorted), the successful slots keep their character and their ID
+func (a *App) runRegen(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("regen", flag.ExitOnError)
+	onlyFailed := flags.Bool("only-failed", false, "re-attempt only the failed or filtered slots")
+	flags.StringVar(&a.summaryPath, "summary", a.summaryPath, "write the JSON summary of the run to this file (- for stderr)")
+	flags.Parse(args)
+	if !*onlyFailed || flags.NArg() != 1 {
+		return errors.New("usage: regen --only-failed <output.json>")
+	}
+	outputPath := flags.Arg(0)
+
+	output, err := ReadRunOutput(outputPath)
+	if err != nil {
+		return err
+	}
+	registry, err := a.storage.Registry(output.Campaign)
+	if err != nil {
+		return err
+	}
+	run := NewRun(a.generator, registry.Deduper(), output.Spec)
+
+	failed := output.Failed()
+	fmt.Println("🔄", len(failed), "slots to regenerate")
+	for _, index := range failed {
+		slot, err := run.GenerateSlot(ctx, index)
+		if err != nil {
+			return err
+		}
+		slots := []Slot{slot}
+		err = StoreSlots(registry, slots)
+		if err != nil {
+			return err
+		}
+		output.Slots[output.slot(index)] = slots[0]
+	}
+
+	output.Metrics = output.Metrics.Add(run.Metrics())
+	err = output.Write(outputPath, a.sortOptions, a.generator.genre, a.markdown)
+	if err != nil {
+		return err
+	}
+	a.summary = NewRunSummary("regen", output, map[string]string{"json": outputPath})
+	fmt.Println("📝", outputPath, len(output.Failed()), "still failed or filtered")
+	return nil
+}
+
+// runReport writes the HTML diversity report of a run output,
+// or of the whole registry of a campaign with --campaign
+func (a *App) runReport(args []string) error {
+	flags := flag.NewFlagSet("report", flag.ExitOnError)
+	campaign := flags.String("campaign", "", "report on the whole registry of the campaign")
+	tags := tagFlags{}
+	flags.Var(&tags, "tag", "only the characters of the registry with this tag (repeatable)")
+	includeArchived := flags.Bool("include-archived", false, "report on the archived characters of the registry too")
+	flags.Parse(args)
+
+	if *campaign != "" {
+		registry, err := a.storage.Registry(*campaign)
+		if err != nil {
+			return err
+		}
+		reportPath, err := a.storage.ExportPath(*campaign, "report.html")
+		if err != nil {
+			return err
+		}
+		err = WriteHTMLReport(reportPath, "Campaign "+*campaign, FilterByTags(FilterArchived(registry.List(), *includeArchived), tags))
+		if err != nil {
+			return err
+		}
+		fmt.Println("📊", reportPath)
+		return nil
+	}
+
+	if flags.NArg() != 1 {
+		return errors.New("usage: report <output.json> | report --campaign <campaign>")
+	}
+	outputPath := flags.Arg(0)
+	output, err := ReadRunOutput(outputPath)
+	if err != nil {
+		return err
+	}
+	reportPath := strings.TrimSuffix(outputPath, ".json") + ".html"
+	err = WriteHTMLReport(reportPath, outputPath, output.Characters())
+	if err != nil {
+		return err
+	}
+	fmt.Println("📊", reportPath)
+	return nil
+}
+
+// runFaction generates a faction of the campaign, its members are pulled from
+// or added to the registry, it is exported in factions/<name>.json and .md
+func (a *App) runFaction(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("faction", flag.ExitOnError)
+	campaign := flags.String("campaign", getEnv("CAMPAIGN", DefaultCampaign), "campaign of the faction")
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		return errors.New("usage: faction [--campaign <campaign>]")
+	}
+
+	faction, exportPath, err := a.createFaction(ctx, *campaign)
+	if err != nil {
+		return err
+	}
+	fmt.Println("🏰", faction.Name, exportPath)
+	return nil
+}
+
+func (a *App) createFaction(ctx context.Context, campaign string) (Faction, string, error) {
+	registry, err := a.storage.Registry(campaign)
+	if err != nil {
+		return Faction{}, "", err
+	}
+
+	// up to 5 random characters of the registry can be recruited
+	candidates := registry.List()
+	rand.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+	candidates = candidates[:min(5, len(candidates))]
+
+	faction, err := a.generator.GenerateFaction(ctx, candidates)
+	if err != nil {
+		return faction, "", err
+	}
+	err = LinkMembers(registry, &faction)
+	if err != nil {
+		return faction, "", err
+	}
+
+	slug := Slug(faction.Name)
+	if slug == "" {
+		slug = "faction"
+	}
+	exportPath, err := a.storage.ExportPath(campaign, "factions", slug+".json")
+	if err != nil {
+		return faction, "", err
+	}
+	return faction, exportPath, writeExport(exportPath, faction, FactionMarkdown(faction))
+}
+
+// runEvents generates the timeline of the campaign, the exported factions and
+// up to 8 characters of the registry can be involved, it is exported in events.json and .md
+func (a *App) runEvents(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("events", flag.ExitOnError)
+	campaign := flags.String("campaign", getEnv("CAMPAIGN", DefaultCampaign), "campaign of the timeline")
+	count := flags.Int("count", 8, "number of events")
+	flags.Parse(args)
+
+	timeline, exportPath, err := a.createTimeline(ctx, *campaign, *count)
+	if err != nil {
+		return err
+	}
+	fmt.Println("📜", len(timeline.Events), "events", exportPath)
+	return nil
+}
+
+func (a *App) createTimeline(ctx context.Context, campaign string, count int) (Timeline, string, error) {
+	registry, err := a.storage.Registry(campaign)
+	if err != nil {
+		return Timeline{}, "", err
+	}
+	factionsDir, err := a.storage.ExportPath(campaign, "factions")
+	if err != nil {
+		return Timeline{}, "", err
+	}
+	factions, err := LoadFactions(factionsDir)
+	if err != nil {
+		return Timeline{}, "", err
+	}
+	characters := registry.List()
+	rand.Shuffle(len(characters), func(i, j int) {
+		characters[i], characters[j] = characters[j], characters[i]
+	})
+	characters = characters[:min(8, len(characters))]
+
+	timeline, err := a.generator.GenerateTimeline(ctx, count, factions, characters)
+	if err != nil {
+		return timeline, "", err
+	}
+	LinkParticipants(registry, &timeline)
+
+	exportPath, err := a.storage.ExportPath(campaign, "events.json")
+	if err != nil {
+		return timeline, "", err
+	}
+	return timeline, exportPath, writeExport(exportPath, timeline, TimelineMarkdown(timeline))
+}
+
+// runWorld builds a whole setting from a seed file (world build <world.yaml>):
+// the inhabitants of every settlement, then the factions and the timeline
+func (a *App) runWorld(ctx context.Context, args []string) error {
+	if len(args) != 2 || args[0] != "build" {
+		return errors.New("usage: world build <world.yaml>")
+	}
+	seed, err := LoadWorldSeed(args[1])
+	if err != nil {
+		return err
+	}
+	registry, err := a.storage.Registry(seed.Campaign)
+	if err != nil {
+		return err
+	}
+
+	for regionIdx := range seed.Regions {
+		region := &seed.Regions[regionIdx]
+		kind, parents, err := cultureKind(a.generator.kinds, region.Culture)
+		if err != nil {
+			return fmt.Errorf("%s: %w", region.Name, err)
+		}
+		taken := []string{}
+		for idx := range region.Settlements {
+			settlement := &region.Settlements[idx]
+			if settlement.Name == "" {
+				settlement.Name, err = a.generator.NameSettlement(ctx, *region, kind, taken)
+				if err != nil {
+					return err
+				}
+			}
+			taken = append(taken, settlement.Name)
+			if settlement.Population == 0 {
+				continue
+			}
+
+			run := NewRun(a.generator, registry.Deduper(), Spec{Kind: kind, Parents: parents, Level: 1, Count: settlement.Population})
+			slots, err := run.Generate(ctx)
+			if err != nil {
+				return err
+			}
+			for _, slot := range slots {
+				if slot.Status == SlotOK {
+					slot.Character.Region, slot.Character.Settlement = region.Name, settlement.Name
+				}
+			}
+			err = StoreSlots(registry, slots)
+			if err != nil {
+				return err
+			}
+			settlement.Characters = []string{}
+			for _, slot := range slots {
+				if slot.Status == SlotOK {
+					settlement.Characters = append(settlement.Characters, slot.Character.Name)
+				}
+			}
+			fmt.Println("🏘️", settlement.Name, len(settlement.Characters), "/", settlement.Population, "inhabitants")
+		}
+	}
+
+	for range seed.Factions {
+		faction, exportPath, err := a.createFaction(ctx, seed.Campaign)
+		if err != nil {
+			return err
+		}
+		fmt.Println("🏰", faction.Name, exportPath)
+	}
+	if seed.Events > 0 {
+		timeline, exportPath, err := a.createTimeline(ctx, seed.Campaign, seed.Events)
+		if err != nil {
+			return err
+		}
+		fmt.Println("📜", len(timeline.Events), "events", exportPath)
+	}
+
+	exportPath, err := a.storage.ExportPath(seed.Campaign, "world.json")
+	if err != nil {
+		return err
+	}
+	err = writeExport(exportPath, seed, WorldMarkdown(seed))
+	if err != nil {
+		return err
+	}
+	fmt.Println("🌍", seed.Name, exportPath)
+	return nil
+}
+
+// writeExport writes the JSON export and its Markdown version next to it
+func writeExport(jsonPath string, value any, markdown string) error {
+	err := os.MkdirAll(filepath.Dir(jsonPath), 0755)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(jsonPath, data, 0644)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(strings.TrimSuffix(jsonPath, ".json")+".md", []byte(markdown), 0644)
+}
+
+// runExport exports the characters of the registry, or only the characters added
+// or changed since a time (--since) or since the last export of the consumer (--since-last)
+func (a *App) runExport(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	campaign := flags.String("campaign", getEnv("CAMPAIGN", DefaultCampaign), "campaign of the characters")
+	format := flags.String("format", "jsonl", "format of the export: json, jsonl, csv or md")
+	output := flags.String("output", "", "path of the export (default: data/<campaign>/export.<format>)")
+	sinceLast := flags.Bool("since-last", false, "only the characters added or changed since the last export of the consumer")
+	consumer := flags.String("consumer", "default", "name of the downstream tool, every consumer has its own watermark")
+	since := flags.String("since", "", "only the characters added or changed after this time (RFC 3339)")
+	includeArchived := flags.Bool("include-archived", false, "export the archived characters too")
+	flags.BoolVar(&a.markdown.Details, "details", a.markdown.Details, "md: the backstories in collapsible <details> sections under the table")
+	flags.StringVar(&a.markdown.Names, "names", a.markdown.Names, "md: the names of the kinds with a script: romanized, native or both")
+	flags.Parse(args)
+	err := checkNames(a.markdown.Names)
+	if err != nil {
+		return err
+	}
+
+	registry, err := a.storage.Registry(*campaign)
+	if err != nil {
+		return err
+	}
+	// the watermark is taken before the listing, a character stored meanwhile is in the next export
+	now := time.Now()
+	sinceTime := time.Time{}
+	switch {
+	case *sinceLast && *since != "":
+		return errors.New("--since and --since-last can't be used together")
+	case *sinceLast:
+		sinceTime = registry.Watermark(*consumer)
+	case *since != "":
+		sinceTime, err = time.Parse(time.RFC3339, *since)
+		if err != nil {
+			return err
+		}
+	}
+	characters := FilterArchived(registry.Since(sinceTime), *includeArchived)
+	SortCharacters(characters, a.sortOptions)
+
+	content := ""
+	switch *format {
+	case "json":
+		data, err := json.MarshalIndent(characters, "", "  ")
+		if err != nil {
+			return err
+		}
+		content = string(data) + "\n"
+	case "jsonl":
+		for _, character := range characters {
+			data, err := json.Marshal(character)
+			if err != nil {
+				return err
+			}
+			content += string(data) + "\n"
+		}
+	case "csv":
+		content, err = CSVTable(characters, a.generator.genre)
+		if err != nil {
+			return err
+		}
+	case "md":
+		content = MarkdownTable(characters, a.generator.genre, a.markdown)
+	default:
+		return fmt.Errorf("unknown format %q (json, jsonl, csv or md)", *format)
+	}
+
+	exportPath := *output
+	if exportPath == "" {
+		exportPath, err = a.storage.ExportPath(*campaign, "export."+*format)
+		if err != nil {
+			return err
+		}
+	}
+	err = os.MkdirAll(filepath.Dir(exportPath), 0755)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(exportPath, []byte(content), 0644)
+	if err != nil {
+		return err
+	}
+	if *sinceLast {
+		err = registry.SetWatermark(*consumer, now)
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Println("📦", len(characters), "characters", exportPath)
+	return nil
+}
+
+// runAnnotate tags, untags or annotates a stored character:
+// tag <id> villain arc2, untag <id> arc2, note <id> "owes money to the guild"
+func (a *App) runAnnotate(command string, args []string) error {
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	campaign := flags.String("campaign", getEnv("CAMPAIGN", DefaultCampaign), "campaign of the character")
+	flags.Parse(args)
+	if flags.NArg() < 2 {
+		return fmt.Errorf("usage: %s <id> <tags or note>...", command)
+	}
+	id, err := strconv.Atoi(flags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("invalid ID %q", flags.Arg(0))
+	}
+	registry, err := a.storage.Registry(*campaign)
+	if err != nil {
+		return err
+	}
+
+	var character Character
+	switch command {
+	case "tag":
+		character, err = registry.Tag(id, flags.Args()[1:]...)
+	case "untag":
+		character, err = registry.Untag(id, flags.Args()[1:]...)
+	case "note":
+		character, err = registry.Modify(id, func(character *Character) {
+			character.Notes = strings.TrimSpace(strings.Join(flags.Args()[1:], " "))
+		})
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println("🏷️", character.Code, character.Name, strings.Join(character.Tags, " "))
+	return nil
+}
+
+// runList prints the stored characters as a Markdown table,
+// filtered by kind and tags: list --tag villain --tag arc2 (without the archived characters)
+func (a *App) runList(args []string) error {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	campaign := flags.String("campaign", getEnv("CAMPAIGN", DefaultCampaign), "campaign of the characters")
+	kind := flags.String("kind", "", "only the characters of this kind")
+	tags := tagFlags{}
+	flags.Var(&tags, "tag", "only the characters with this tag (repeatable)")
+	includeArchived := flags.Bool("include-archived", false, "list the archived characters too")
+	flags.Parse(args)
+
+	registry, err := a.storage.Registry(*campaign)
+	if err != nil {
+		return err
+	}
+	characters := FilterByTags(FilterArchived(registry.List(), *includeArchived), tags)
+	if *kind != "" {
+		characters = slices.DeleteFunc(characters, func(character Character) bool {
+			return !strings.EqualFold(character.Kind, *kind)
+		})
+	}
+	SortCharacters(characters, a.sortOptions)
+	fmt.Print(MarkdownTable(characters, a.generator.genre, a.markdown))
+	return nil
+}
+
+// runProvenance shows how a stored character was generated (provenance show <id>)
+func (a *App) runProvenance(args []string) error {
+	if len(args) < 1 || args[0] != "show" {
+		return errors.New("usage: provenance show [--campaign] <id>")
+	}
+	flags := flag.NewFlagSet("provenance show", flag.ExitOnError)
+	campaign := flags.String("campaign", getEnv("CAMPAIGN", DefaultCampaign), "campaign of the character")
+	flags.Parse(args[1:])
+	if flags.NArg() != 1 {
+		return errors.New("usage: provenance show [--campaign] <id>")
+	}
+	id, err := strconv.Atoi(flags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("invalid ID %q", flags.Arg(0))
+	}
+
+	registry, err := a.storage.Registry(*campaign)
+	if err != nil {
+		return err
+	}
+	character, ok := registry.Get(id)
+	if !ok {
+		return fmt.Errorf("no character with the ID %d", id)
+	}
+	if character.Provenance == nil {
+		return fmt.Errorf("%s has no provenance (imported or generated before the provenance)", character.Name)
+	}
+	data, err := json.MarshalIndent(struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+		*Provenance
+	}{character.ID, character.Name, character.Provenance}, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+// tagFlags collects the repeated --tag flags
+type tagFlags []string
+
+func (t *tagFlags) String() string {
+	return strings.Join(*t, ",")
+}
+
+func (t *tagFlags) Set(value string) error {
+	*t = append(*t, value)
+	return nil
+}
+
+// runReservation reserves (or releases) a name for a holder:
+// reserve --holder alice <name>, release --holder alice <name>
+func (a *App) runReservation(command string, args []string) error {
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	campaign := flags.String("campaign", getEnv("CAMPAIGN", DefaultCampaign), "campaign of the name")
+	holder := flags.String("holder", os.Getenv("HOLDER"), "player or tool holding the name")
+	flags.Parse(args)
+	if flags.NArg() != 1 || *holder == "" {
+		return fmt.Errorf("usage: %s --holder <holder> <name>", command)
+	}
+	name := flags.Arg(0)
+
+	registry, err := a.storage.Registry(*campaign)
+	if err != nil {
+		return err
+	}
+	if command == "release" {
+		err = registry.Release(name, *holder)
+		if err != nil {
+			return err
+		}
+		fmt.Println("🔓", name, "released")
+		return nil
+	}
+	_, err = registry.Reserve(name, *holder)
+	if err != nil {
+		return err
+	}
+	fmt.Println("🔒", name, "reserved by", *holder)
+	return nil
+}
+
+// runStore merges another registry file into the campaign:
+// store merge --policy rename ../other/data/default/registry.json
+// (store import reads the exports back, store migrate upgrades the stored characters, see migrate.go)
+func (a *App) runStore(ctx context.Context, args []string) error {
+	if len(args) > 0 && args[0] == "migrate" {
+		return a.runStoreMigrate(ctx, args[1:])
+	}
+	if len(args) > 0 && args[0] == "import" {
+		return a.runStoreImport(args[1:])
+	}
+	if len(args) < 1 || args[0] != "merge" {
+		return errors.New("usage: store merge [--policy skip|rename|keep-both] [--dry-run] <registry.json> | store import [--format auto|md|csv|json] [--kind K] [--dry-run] <export>... | store migrate [--dry-run]")
+	}
+	flags := flag.NewFlagSet("store merge", flag.ExitOnError)
+	campaign := flags.String("campaign", getEnv("CAMPAIGN", DefaultCampaign), "campaign receiving the characters")
+	policy := flags.String("policy", MergeSkip, "policy of the name conflicts: skip, rename or keep-both")
+	dryRun := flags.Bool("dry-run", false, "only write the report")
+	flags.Parse(args[1:])
+	if flags.NArg() != 1 {
+		return errors.New("usage: store merge [--policy skip|rename|keep-both] [--dry-run] <registry.json>")
+	}
+
+	source, err := OpenRegistry(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	characters := source.List()
+	if len(characters) == 0 {
+		return fmt.Errorf("%s: no character to merge", flags.Arg(0))
+	}
+	registry, err := a.storage.Registry(*campaign)
+	if err != nil {
+		return err
+	}
+	report, err := registry.Merge(flags.Arg(0), characters, *policy, *dryRun)
+	if err != nil {
+		return err
+	}
+	return a.writeMergeReport(*campaign, "merge.json", report)
+}
+
+// runStoreImport reads Markdown, CSV and JSON exports (or the tables of the old script) back into the campaign:
+// store import --kind Dwarf --dry-run ../03-generate-names/characters.Dwarf_1.md
+func (a *App) runStoreImport(args []string) error {
+	flags := flag.NewFlagSet("store import", flag.ExitOnError)
+	campaign := flags.String("campaign", getEnv("CAMPAIGN", DefaultCampaign), "campaign receiving the characters")
+	policy := flags.String("policy", MergeSkip, "policy of the name conflicts: skip, rename or keep-both")
+	format := flags.String("format", ImportAuto, "format of the exports: auto (by the extension), md, csv or json")
+	kind := flags.String("kind", "", "kind of the rows without one")
+	dryRun := flags.Bool("dry-run", false, "only write the report")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		return errors.New("usage: store import [--format auto|md|csv|json] [--kind K] [--policy skip|rename|keep-both] [--dry-run] <export>...")
+	}
+
+	importer := Importer{Genres: []Genre{a.generator.genre}, Kind: *kind}
+	for _, genre := range a.generator.genres {
+		importer.Genres = append(importer.Genres, genre)
+	}
+	characters, warnings := []Character{}, []string{}
+	for _, path := range flags.Args() {
+		imported, fileWarnings, err := importer.ReadFile(path, *format)
+		if err != nil {
+			return err
+		}
+		for _, warning := range fileWarnings {
+			fmt.Println("⚠️", warning)
+		}
+		characters = append(characters, imported...)
+		warnings = append(warnings, fileWarnings...)
+	}
+	if len(characters) == 0 {
+		return fmt.Errorf("%s: no character to import", strings.Join(flags.Args(), ", "))
+	}
+	registry, err := a.storage.Registry(*campaign)
+	if err != nil {
+		return err
+	}
+	report, err := registry.Merge(strings.Join(flags.Args(), ", "), characters, *policy, *dryRun)
+	if err != nil {
+		return err
+	}
+	report.Warnings = warnings
+	return a.writeMergeReport(*campaign, "import.json", report)
+}
+
+// writeMergeReport prints the conflicts of a merge or an import and exports its report
+func (a *App) writeMergeReport(campaign, name string, report MergeReport) error {
+	for _, entry := range report.Entries {
+		switch entry.Action {
+		case "skipped":
+			fmt.Printf("⏭️ %s skipped (%s duplicate of %s)\n", entry.Name, entry.Conflict, entry.With)
+		case "renamed":
+			fmt.Printf("✏️ %s renamed %s (%s duplicate of %s)\n", entry.Name, entry.Stored, entry.Conflict, entry.With)
+		}
+	}
+
+	exportPath, err := a.storage.ExportPath(campaign, name)
+	if err != nil {
+		return err
+	}
+	err = writeExport(exportPath, report, MergeMarkdown(report))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("🔀 %d imported (%d renamed), %d skipped %s\n", report.Imported, report.Renamed, report.Skipped, exportPath)
+	return nil
+}
+
+// runLint checks that the cast of the campaign is not too homogeneous (name prefixes,
+// surnames, classes, extras of the genre), --fix regenerates the names of the clusters
+func (a *App) runLint(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	campaign := flags.String("campaign", getEnv("CAMPAIGN", DefaultCampaign), "campaign of the cast")
+	kind := flags.String("kind", "", "only the characters of this kind")
+	tags := tagFlags{}
+	flags.Var(&tags, "tag", "only the characters with this tag (repeatable)")
+	maxShare := flags.Float64("max-share", 0.5, "largest share of the cast with the same value")
+	fix := flags.Bool("fix", false, "regenerate the names of the clusters")
+	flags.Parse(args)
+	if *maxShare <= 0 || *maxShare >= 1 {
+		return errors.New("max-share must be between 0 and 1 (excluded)")
+	}
+
+	registry, err := a.storage.Registry(*campaign)
+	if err != nil {
+		return err
+	}
+	cast := func() []Character {
+		characters := FilterByTags(registry.List(), tags)
+		if *kind != "" {
+			characters = slices.DeleteFunc(characters, func(character Character) bool {
+				return !strings.EqualFold(character.Kind, *kind)
+			})
+		}
+		return characters
+	}
+
+	findings := LintCast(cast(), *maxShare)
+	for _, finding := range findings {
+		label := finding.Check
+		if finding.Field != "" {
+			label += " " + finding.Field
+		}
+		fmt.Printf("🧐 %s %q: %d/%d (%.0f%%), %s\n", label, finding.Value, finding.Count, finding.Total, finding.Share*100, finding.Suggestion)
+	}
+
+	if *fix && len(findings) > 0 {
+		for _, finding := range findings {
+			if finding.Check != LintPrefix && finding.Check != LintSurname {
+				continue
+			}
+			// the most recent characters of the cluster are renamed
+			for _, id := range finding.IDs[len(finding.IDs)-finding.Excess:] {
+				character, ok := registry.Get(id)
+				if !ok || !inNameCluster(character, finding) {
+					continue
+				}
+				fixed, err := a.generator.FixName(ctx, character, finding)
+				if err == nil {
+					fixed, err = registry.Update(fixed)
+				}
+				if err != nil {
+					fmt.Println("😡:", err)
+					continue
+				}
+				fmt.Println("✏️", character.Name, "->", fixed.Name)
+			}
+		}
+		findings = LintCast(cast(), *maxShare)
+	}
+
+	if len(findings) > 0 {
+		return fmt.Errorf("%d lint findings in %s", len(findings), *campaign)
+	}
+	fmt.Println("✅ the cast of", *campaign, "is diverse")
+	return nil
+}
+
+// runRegenField regenerates one field of a stored character (name, backstory,
+// equipment or a stat), the other fields are kept: regen-field --id 3 --field backstory;
+// the change is reviewed before it is stored
+func (a *App) runRegenField(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("regen-field", flag.ExitOnError)
+	campaign := flags.String("campaign", getEnv("CAMPAIGN", DefaultCampaign), "campaign of the character")
+	id := flags.Int("id", 0, "ID of the character")
+	field := flags.String("field", "", "field to regenerate: name, backstory, equipment or a stat (STR)")
+	systemName := flags.String("system", os.Getenv("SYSTEM"), "game system of the stats")
+	yes := flags.Bool("yes", false, "store the regenerated field without the review")
+	flags.Parse(args)
+	if *id == 0 || *field == "" {
+		return errors.New("usage: regen-field --id <id> --field <field>")
+	}
+
+	system, err := a.generator.System(*systemName)
+	if err != nil {
+		return err
+	}
+	registry, err := a.storage.Registry(*campaign)
+	if err != nil {
+		return err
+	}
+	character, ok := registry.Get(*id)
+	if !ok {
+		return fmt.Errorf("no character with the ID %d in %s", *id, *campaign)
+	}
+
+	regenerated, err := a.generator.RegenerateField(ctx, character, strings.ToLower(*field), system)
+	if err != nil {
+		return err
+	}
+	character, err = a.reviewUpdate(registry, *campaign, "regen-field", character, regenerated, *yes)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(character, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+// runLines writes the dialogue lines of a stored character (--id) or of every character
+// without lines (--missing), for the voice scripts
+func (a *App) runLines(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("lines", flag.ExitOnError)
+	campaign := flags.String("campaign", getEnv("CAMPAIGN", DefaultCampaign), "campaign of the characters")
+	id := flags.Int("id", 0, "ID of the character")
+	missing := flags.Bool("missing", false, "every character without lines")
+	count := flags.Int("count", 3, "number of lines per character")
+	flags.Parse(args)
+	if (*id == 0) == !*missing {
+		return errors.New("usage: lines --id <id> | --missing [--count 3]")
+	}
+	if *count < 1 || *count > 8 {
+		return errors.New("count must be between 1 and 8")
+	}
+
+	registry, err := a.storage.Registry(*campaign)
+	if err != nil {
+		return err
+	}
+	characters := registry.List()
+	characters = slices.DeleteFunc(characters, func(character Character) bool {
+		if *missing {
+			return len(character.Lines) > 0
+		}
+		return character.ID != *id
+	})
+	if *id != 0 && len(characters) == 0 {
+		return fmt.Errorf("no character with the ID %d in %s", *id, *campaign)
+	}
+	for _, character := range characters {
+		dialogue, err := a.generator.WriteLines(ctx, character, *count)
+		if err != nil {
+			return err
+		}
+		_, err = registry.Modify(character.ID, func(stored *Character) {
+			stored.Lines, stored.Age = dialogue.Lines, dialogue.Age
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("🗣️ %s (%s): %d lines\n", character.Name, dialogue.Age, len(dialogue.Lines))
+	}
+	return nil
+}
+
+// runVoice exports the lines of the campaign as voice scripts:
+// a .ssml file per character, or an ElevenLabs or Coqui script
+func (a *App) runVoice(args []string) error {
+	flags := flag.NewFlagSet("voice", flag.ExitOnError)
+	campaign := flags.String("campaign", getEnv("CAMPAIGN", DefaultCampaign), "campaign of the characters")
+	format := flags.String("format", VoiceSSML, "format of the scripts: ssml, elevenlabs or coqui")
+	output := flags.String("output", "", "directory of the scripts (default: data/<campaign>/voice)")
+	tags := tagFlags{}
+	flags.Var(&tags, "tag", "only the characters with this tag (repeatable)")
+	includeArchived := flags.Bool("include-archived", false, "write the scripts of the archived characters too")
+	flags.Parse(args)
+
+	registry, err := a.storage.Registry(*campaign)
+	if err != nil {
+		return err
+	}
+	dir := *output
+	if dir == "" {
+		dir, err = a.storage.ExportPath(*campaign, "voice")
+		if err != nil {
+			return err
+		}
+	}
+	characters := FilterByTags(FilterArchived(registry.List(), *includeArchived), tags)
+	SortCharacters(characters, a.sortOptions)
+	paths, err := WriteVoiceScripts(characters, *format, dir)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return errors.New("no character with lines (see the lines command)")
+	}
+	for _, path := range paths {
+		fmt.Println("🎙️", path)
+	}
+	return nil
+}
@@ -0,0 +1,543 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// CLIFlag is a flag of a command, for the completion and the man page
+type CLIFlag struct {
+	Name  string
+	Usage string
+	Bool  bool
+	// Values are the fixed values of the flag, Source the dynamic ones
+	// (kinds, genres, systems, campaigns, models) or files
+	Values []string
+	Source string
+}
+
+// CLICommand is a command of the CLI, for the completion and the man page
+type CLICommand struct {
+	Name    string
+	Args    string
+	Summary string
+	Flags   []CLIFlag
+}
+
+var campaignFlag = CLIFlag{Name: "campaign", Usage: "campaign of the characters", Source: "campaigns"}
+
+var cliCommands = []CLICommand{
+	{Name: "generate", Summary: "generate characters and store them in the registry of the campaign (the default command)", Flags: []CLIFlag{
+		campaignFlag,
+		{Name: "kind", Usage: "kind of the characters", Source: "kinds"},
+		{Name: "class", Usage: "class of the characters (enables the equipment stage)"},
+		{Name: "level", Usage: "level of the characters"},
+		{Name: "system", Usage: "game system of the stats", Source: "systems"},
+		{Name: "count", Usage: "number of characters"},
+		{Name: "aliases", Usage: "give the characters a title and aliases", Bool: true},
+		{Name: "coverage", Usage: "give every character a prefix of the kind in turn", Bool: true},
+		{Name: "name-only", Usage: "generate the names only (fast mode)", Bool: true},
+		{Name: "syllables", Usage: "combine the names locally from the syllable table of the kind", Bool: true},
+		{Name: "few-shot", Usage: "give the saved examples of the campaign to the model", Bool: true},
+		{Name: "summary", Usage: "JSON summary of the run (- for stderr)", Source: "files"},
+		{Name: "syllables-max-age", Usage: "ask the model again for a syllable table older than this"},
+		{Name: "portraits", Usage: "save a PNG portrait of every character next to the exports", Bool: true},
+		{Name: "mix", Usage: "parent kinds of a hybrid (dwarf+human)"},
+		{Name: "child-of", Usage: "ID of the stored parent of the characters"},
+		{Name: "sibling-of", Usage: "ID of the stored sibling of the characters"},
+		{Name: "jsonl", Usage: "append every stored character to this JSON Lines file", Source: "files"},
+		{Name: "stdin", Usage: "read the specs from stdin (JSONL) and write the slots to stdout (JSONL)", Bool: true},
+		{Name: "genre", Usage: "genre pack", Source: "genres"},
+		{Name: "theme", Usage: "seasonal pack added to the genre", Source: "themes"},
+		{Name: "out", Usage: "template of the export paths"},
+		{Name: "max-tokens-per-run", Usage: "stop the run before its tokens exceed this budget"},
+		{Name: "strict", Usage: "verify every accepted character with a second request", Bool: true},
+		{Name: "review", Usage: "grade every accepted character with the rubric of the judge model", Bool: true},
+		{Name: "parallel", Usage: "number of characters generated at the same time"},
+		{Name: "sink", Usage: "publish every stored character to a NATS subject or a Kafka topic"},
+		{Name: "notes", Usage: "directory of the campaign notes grounding the characters", Source: "files"},
+		{Name: "transliterate", Usage: "add the ascii_name of the characters", Values: []string{TransliterateLoose, TransliterateStrict}},
+	}},
+	{Name: "serve", Summary: "start the HTTP server", Flags: []CLIFlag{
+		{Name: "read-only", Usage: "only serve the stored content", Bool: true},
+		{Name: "approval", Usage: "submit the generated characters to the approval queue", Bool: true},
+	}},
+	{Name: "discord", Args: "serve | register", Summary: "run the Discord bot answering /npc, or register its slash command", Flags: []CLIFlag{
+		campaignFlag,
+		{Name: "guild", Usage: "register the command in this guild only"},
+	}},
+	{Name: "schedule", Summary: "generate characters on a cron schedule", Flags: []CLIFlag{
+		campaignFlag,
+		{Name: "cron", Usage: "cron expression of the generations", Values: []string{"@hourly", "@daily", "@nightly", "@weekly"}},
+	}},
+	{Name: "prompt-test", Summary: "score the prompts with a suite of seeded generations", Flags: []CLIFlag{
+		{Name: "suite", Usage: "suite file (JSON)", Source: "files"},
+		{Name: "judge", Usage: "model grading the style", Source: "models"},
+		{Name: "output", Usage: "write the results to this JSON file", Source: "files"},
+	}},
+	{Name: "bench", Args: "models", Summary: "compare models on the prompt test suite", Flags: []CLIFlag{
+		{Name: "models", Usage: "models to compare (comma separated)", Source: "models"},
+		{Name: "suite", Usage: "suite file (JSON)", Source: "files"},
+		{Name: "judge", Usage: "model grading the names of every model", Source: "models"},
+		{Name: "output", Usage: "write the results to this JSON file", Source: "files"},
+	}},
+	{Name: "regen", Args: "<output.json>", Summary: "re-attempt the failed slots of an export", Flags: []CLIFlag{
+		{Name: "only-failed", Usage: "re-attempt only the failed or filtered slots", Bool: true},
+		{Name: "summary", Usage: "JSON summary of the run (- for stderr)", Source: "files"},
+	}},
+	{Name: "regen-field", Summary: "regenerate one field of a stored character", Flags: []CLIFlag{
+		campaignFlag,
+		{Name: "id", Usage: "ID of the character"},
+		{Name: "field", Usage: "field to regenerate (or a stat)", Values: []string{"name", "backstory", "equipment"}},
+		{Name: "system", Usage: "game system of the stats", Source: "systems"},
+		{Name: "yes", Usage: "store the regenerated field without the review", Bool: true},
+	}},
+	{Name: "pack", Args: "install [--force] <file.genpack> | list | remove <name>", Summary: "install, list and remove the generation packs", Flags: []CLIFlag{
+		{Name: "force", Usage: "replace the installed pack of the same name", Bool: true},
+	}},
+	{Name: "backfill", Summary: "generate a field for every stored character without it", Flags: []CLIFlag{
+		campaignFlag,
+		{Name: "field", Usage: "field to fill (an extra of the genre or a stat)", Values: []string{"backstory", "equipment"}},
+		{Name: "system", Usage: "game system of the stats", Source: "systems"},
+		{Name: "pause", Usage: "pause between two characters (rate limiting)"},
+		{Name: "limit", Usage: "number of characters filled by this run"},
+		{Name: "retry-failed", Usage: "try again the characters the previous runs failed to fill", Bool: true},
+		{Name: "dry-run", Usage: "count the characters to fill", Bool: true},
+	}},
+	{Name: "report", Args: "[output.json]", Summary: "write the HTML diversity report", Flags: []CLIFlag{
+		campaignFlag,
+		{Name: "tag", Usage: "only the characters with this tag (repeatable)"},
+		{Name: "include-archived", Usage: "report on the archived characters of the registry too", Bool: true},
+	}},
+	{Name: "cast", Summary: "generate a cast satisfying a matrix of roles, alignments and relationships", Flags: []CLIFlag{
+		campaignFlag,
+		{Name: "name", Usage: "name of the cast"},
+		{Name: "matrix", Usage: "JSON file of the target matrix", Source: "files"},
+		{Name: "kind", Usage: "kind of the characters", Source: "kinds"},
+		{Name: "mix", Usage: "parent kinds of a hybrid (dwarf+human)"},
+	}},
+	{Name: "faction", Summary: "generate a faction recruiting stored characters", Flags: []CLIFlag{
+		campaignFlag,
+	}},
+	{Name: "events", Summary: "generate the timeline of the campaign", Flags: []CLIFlag{
+		campaignFlag,
+		{Name: "count", Usage: "number of events"},
+	}},
+	{Name: "riddles", Summary: "generate riddles checked by a solver model", Flags: []CLIFlag{
+		campaignFlag,
+		{Name: "theme", Usage: "theme of the riddles"},
+		{Name: "difficulty", Usage: "difficulty of the riddles", Values: riddleDifficulties},
+		{Name: "count", Usage: "number of riddles"},
+		{Name: "solver", Usage: "model solving the riddles", Source: "models"},
+		{Name: "keep-unsolved", Usage: "keep the riddles the solver can't solve", Bool: true},
+	}},
+	{Name: "map", Summary: "generate the layout of a settlement and the homes of its inhabitants", Flags: []CLIFlag{
+		campaignFlag,
+		{Name: "settlement", Usage: "settlement of the map"},
+		{Name: "width", Usage: "columns of the grid"},
+		{Name: "height", Usage: "rows of the grid"},
+		{Name: "districts", Usage: "maximum number of districts"},
+	}},
+	{Name: "shop", Summary: "generate a merchant and the inventory of the shop", Flags: []CLIFlag{
+		campaignFlag,
+		{Name: "kind", Usage: "kind of the merchant", Source: "kinds"},
+		{Name: "settlement", Usage: "settlement of the shop"},
+		{Name: "population", Usage: "population of the settlement, gives its size"},
+		{Name: "size", Usage: "settlement size, instead of the population"},
+		{Name: "trade", Usage: "goods of the shop"},
+	}},
+	{Name: "quick", Args: "[<kind>]", Summary: "print a few names as fast as possible, for the game table", Flags: []CLIFlag{
+		campaignFlag,
+		{Name: "kind", Usage: "kind of the names", Source: "kinds"},
+		{Name: "count", Usage: "number of names"},
+		{Name: "parallel", Usage: "requests at the same time"},
+		{Name: "num-predict", Usage: "tokens of an answer"},
+	}},
+	{Name: "syllables", Summary: "ask the model once for the syllable tables of the kinds", Flags: []CLIFlag{
+		{Name: "kind", Usage: "kind of the table", Source: "kinds"},
+		{Name: "mix", Usage: "parent kinds of a hybrid (dwarf+human)"},
+		{Name: "refresh", Usage: "ask the model again for the saved tables", Bool: true},
+		{Name: "samples", Usage: "number of combined names printed per kind"},
+	}},
+	{Name: "few-shot", Summary: "save the best stored names of the kinds as examples of the prompts", Flags: []CLIFlag{
+		campaignFlag,
+		{Name: "kind", Usage: "kind of the examples", Source: "kinds"},
+		{Name: "top", Usage: "number of examples per kind"},
+		{Name: "candidates", Usage: "number of the last stored names graded per kind"},
+		{Name: "min-score", Usage: "minimum grade of an example (0 to 1)"},
+		{Name: "judge", Usage: "model grading the names", Source: "models"},
+	}},
+	{Name: "run", Summary: "run a named pipeline of stages for every character", Flags: []CLIFlag{
+		campaignFlag,
+		{Name: "pipeline", Usage: "name of the pipeline", Source: "pipelines"},
+		{Name: "kind", Usage: "kind of the characters", Source: "kinds"},
+		{Name: "system", Usage: "game system of the stats stage", Source: "systems"},
+		{Name: "class", Usage: "class of the equipment stage"},
+		{Name: "level", Usage: "level of the equipment stage"},
+		{Name: "count", Usage: "number of characters"},
+		{Name: "summary", Usage: "JSON summary of the run (- for stderr)", Source: "files"},
+	}},
+	{Name: "world", Args: "build <world.yaml>", Summary: "build a whole setting from a seed file"},
+	{Name: "export", Summary: "export the registry of the campaign", Flags: []CLIFlag{
+		campaignFlag,
+		{Name: "format", Usage: "format of the export", Values: []string{"json", "jsonl", "csv", "md"}},
+		{Name: "output", Usage: "path of the export", Source: "files"},
+		{Name: "since-last", Usage: "only the characters changed since the last export of the consumer", Bool: true},
+		{Name: "consumer", Usage: "name of the downstream tool"},
+		{Name: "since", Usage: "only the characters changed after this time (RFC 3339)"},
+		{Name: "include-archived", Usage: "export the archived characters too", Bool: true},
+		{Name: "details", Usage: "md: the backstories in collapsible sections", Bool: true},
+		{Name: "names", Usage: "md: the names of the kinds with a script", Values: []string{NamesRomanized, NamesNative, NamesBoth}},
+	}},
+	{Name: "list", Summary: "list the stored characters", Flags: []CLIFlag{
+		campaignFlag,
+		{Name: "kind", Usage: "only the characters of this kind", Source: "kinds"},
+		{Name: "tag", Usage: "only the characters with this tag (repeatable)"},
+		{Name: "include-archived", Usage: "list the archived characters too", Bool: true},
+	}},
+	{Name: "browse", Summary: "page and filter the stored characters in the terminal", Flags: []CLIFlag{
+		campaignFlag,
+		{Name: "limit", Usage: "number of characters per page"},
+		{Name: "query", Usage: "first filter (words of the name, the kind or the tags)"},
+		{Name: "include-archived", Usage: "browse the archived characters too", Bool: true},
+	}},
+	{Name: "archive", Args: "<id>", Summary: "retire a stored character, its names stay taken", Flags: []CLIFlag{
+		campaignFlag,
+		{Name: "reason", Usage: "why the character is retired"},
+		{Name: "restore", Usage: "bring the archived character back", Bool: true},
+	}},
+	{Name: "tag", Args: "<id> <tags>...", Summary: "tag a stored character", Flags: []CLIFlag{campaignFlag}},
+	{Name: "untag", Args: "<id> <tags>...", Summary: "remove tags of a stored character", Flags: []CLIFlag{campaignFlag}},
+	{Name: "note", Args: "<id> <note>...", Summary: "set the note of a stored character", Flags: []CLIFlag{campaignFlag}},
+	{Name: "reserve", Args: "<name>", Summary: "reserve a name for a player", Flags: []CLIFlag{
+		campaignFlag,
+		{Name: "holder", Usage: "player or tool holding the name"},
+	}},
+	{Name: "release", Args: "<name>", Summary: "release a reserved name", Flags: []CLIFlag{
+		campaignFlag,
+		{Name: "holder", Usage: "player or tool holding the name"},
+	}},
+	{Name: "store", Args: "merge <registry.json> | import <export>... | migrate", Summary: "merge another registry or import exports into the campaign, or migrate the stored characters", Flags: []CLIFlag{
+		campaignFlag,
+		{Name: "policy", Usage: "policy of the name conflicts", Values: []string{MergeSkip, MergeRename, MergeKeepBoth}},
+		{Name: "format", Usage: "format of the imported exports", Values: []string{ImportAuto, ImportMarkdown, ImportCSV, ImportJSON}},
+		{Name: "kind", Usage: "kind of the imported rows without one", Source: "kinds"},
+		{Name: "dry-run", Usage: "only write the report (merge, import) or list the pending migrations (migrate)", Bool: true},
+	}},
+	{Name: "lint", Summary: "check the diversity of the cast of the campaign", Flags: []CLIFlag{
+		campaignFlag,
+		{Name: "kind", Usage: "only the characters of this kind", Source: "kinds"},
+		{Name: "tag", Usage: "only the characters with this tag (repeatable)"},
+		{Name: "max-share", Usage: "largest share of the cast with the same value"},
+		{Name: "fix", Usage: "regenerate the names of the clusters", Bool: true},
+	}},
+	{Name: "lines", Summary: "write the dialogue lines of stored characters, for the voice scripts", Flags: []CLIFlag{
+		campaignFlag,
+		{Name: "id", Usage: "ID of the character"},
+		{Name: "missing", Usage: "every character without lines", Bool: true},
+		{Name: "count", Usage: "number of lines per character"},
+	}},
+	{Name: "voice", Summary: "export the lines as SSML, ElevenLabs or Coqui scripts", Flags: []CLIFlag{
+		campaignFlag,
+		{Name: "format", Usage: "format of the scripts", Values: []string{VoiceSSML, VoiceElevenLabs, VoiceCoqui}},
+		{Name: "output", Usage: "directory of the scripts", Source: "files"},
+		{Name: "tag", Usage: "only the characters with this tag (repeatable)"},
+		{Name: "include-archived", Usage: "write the scripts of the archived characters too", Bool: true},
+	}},
+	{Name: "reroll", Args: "<id>", Summary: "regenerate a deterministic variation of a stored character", Flags: []CLIFlag{
+		campaignFlag,
+		{Name: "variation", Usage: "variation of the character (0: the original)"},
+		{Name: "replace", Usage: "store the variation in place of the character", Bool: true},
+		{Name: "yes", Usage: "replace the character without the review", Bool: true},
+	}},
+	{Name: "improve", Summary: "regenerate the stored characters graded below a score, the worst first", Flags: []CLIFlag{
+		campaignFlag,
+		{Name: "threshold", Usage: "score below which a character is regenerated"},
+		{Name: "limit", Usage: "most characters regenerated by the run"},
+		{Name: "attempts", Usage: "variations tried per character"},
+		{Name: "grade-missing", Usage: "grade the characters without a grade first", Bool: true},
+		{Name: "review", Usage: "review the changes of every improved character", Bool: true},
+		{Name: "dry-run", Usage: "only list the characters that would be regenerated", Bool: true},
+	}},
+	{Name: "provenance", Args: "show <id>", Summary: "show the model, prompt version, options and seed of a stored character", Flags: []CLIFlag{campaignFlag}},
+	{Name: "drift", Args: "check", Summary: "re-run the benchmark spec and report when the model changed its answers", Flags: []CLIFlag{
+		{Name: "kind", Usage: "kind of the benchmark spec", Source: "kinds"},
+		{Name: "count", Usage: "number of characters of the benchmark spec"},
+		{Name: "seed", Usage: "seed of the first character"},
+		{Name: "update", Usage: "replace the baseline of the digest", Bool: true},
+	}},
+	{Name: "models", Args: "ensure", Summary: "pull the missing models of the configuration (LLM or MODELS)", Flags: []CLIFlag{
+		{Name: "attempts", Usage: "attempts of a pull before it fails"},
+	}},
+	{Name: "systems", Summary: "list the game systems"},
+	{Name: "config", Args: "show", Summary: "print the effective configuration and the source of every value", Flags: []CLIFlag{
+		{Name: "effective", Usage: "print the effective value of every setting and its source", Bool: true},
+	}},
+	{Name: "completion", Args: "bash|zsh|fish", Summary: "print the shell completion script", Flags: []CLIFlag{programFlag}},
+	{Name: "man", Summary: "print the man page (roff)", Flags: []CLIFlag{programFlag}},
+}
+
+var programFlag = CLIFlag{Name: "program", Usage: "name of the installed binary"}
+
+// CommandNames returns the names of the commands
+func CommandNames() []string {
+	names := []string{}
+	for _, command := range cliCommands {
+		names = append(names, command.Name)
+	}
+	return names
+}
+
+// runCompletion prints the completion script of the shell:
+// source <(npc-generator completion bash)
+func (a *App) runCompletion(args []string) error {
+	flags := flag.NewFlagSet("completion", flag.ExitOnError)
+	program := flags.String("program", "npc-generator", "name of the installed binary")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return errors.New("usage: completion [--program npc-generator] bash|zsh|fish")
+	}
+	switch flags.Arg(0) {
+	case "bash":
+		fmt.Fprint(a.stdout, BashCompletion(*program))
+	case "zsh":
+		fmt.Fprint(a.stdout, "autoload -U +X bashcompinit && bashcompinit\n"+BashCompletion(*program))
+	case "fish":
+		fmt.Fprint(a.stdout, FishCompletion(*program))
+	default:
+		return fmt.Errorf("unknown shell %q (bash, zsh, fish)", flags.Arg(0))
+	}
+	return nil
+}
+
+// runComplete prints the dynamic values of a flag, one per line (called by the completion scripts)
+func (a *App) runComplete(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: __complete kinds|genres|themes|systems|pipelines|campaigns|models")
+	}
+	values, err := a.completionValues(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	for _, value := range values {
+		fmt.Fprintln(a.stdout, value)
+	}
+	return nil
+}
+
+func (a *App) completionValues(ctx context.Context, source string) ([]string, error) {
+	switch source {
+	case "kinds":
+		// the kinds of every genre, --genre can be anywhere on the line
+		kinds := []string{}
+		for _, genre := range a.generator.genres {
+			for _, kind := range genre.Kinds {
+				kinds = append(kinds, kind.Name)
+			}
+		}
+		slices.Sort(kinds)
+		return slices.Compact(kinds), nil
+	case "genres":
+		return slices.Sorted(maps.Keys(a.generator.genres)), nil
+	case "themes":
+		return slices.Sorted(maps.Keys(a.generator.themes)), nil
+	case "systems":
+		return SystemNames(a.generator.systems), nil
+	case "pipelines":
+		pipelines, err := LoadPipelines(os.Getenv("PIPELINES"))
+		if err != nil {
+			return nil, err
+		}
+		return slices.Sorted(maps.Keys(pipelines)), nil
+	case "campaigns":
+		entries, err := os.ReadDir(a.storage.dir)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		campaigns := []string{}
+		for _, entry := range entries {
+			if entry.IsDir() && checkCampaign(entry.Name()) == nil {
+				campaigns = append(campaigns, entry.Name())
+			}
+		}
+		return campaigns, nil
+	case "models":
+		// the completion must not hang on an unreachable server
+		ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		defer cancel()
+		list, err := a.generator.client.List(ctx)
+		if err != nil {
+			return nil, err
+		}
+		models := []string{}
+		for _, model := range list.Models {
+			models = append(models, model.Name)
+		}
+		return models, nil
+	}
+	return nil, fmt.Errorf("unknown completion %q", source)
+}
+
+// bashFunction is the name of the completion function of the program
+func bashFunction(program string) string {
+	return "_" + strings.Map(func(r rune) rune {
+		if r == '-' || r == '.' {
+			return '_'
+		}
+		return r
+	}, program)
+}
+
+// BashCompletion is the bash completion script, zsh loads it with bashcompinit
+func BashCompletion(program string) string {
+	builder := strings.Builder{}
+	function := bashFunction(program)
+	fmt.Fprintf(&builder, "# bash completion of %s\n", program)
+	fmt.Fprintf(&builder, "%s() {\n", function)
+	builder.WriteString("    local cur=\"${COMP_WORDS[COMP_CWORD]}\" prev=\"${COMP_WORDS[COMP_CWORD-1]}\"\n")
+	builder.WriteString("    if [ \"$COMP_CWORD\" -eq 1 ] && [[ \"$cur\" != -* ]]; then\n")
+	fmt.Fprintf(&builder, "        COMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(CommandNames(), " "))
+	builder.WriteString("        return\n    fi\n")
+
+	// the values of the flags (the same flag has the same values in every command)
+	builder.WriteString("    case \"$prev\" in\n")
+	done := map[string]bool{}
+	for _, command := range cliCommands {
+		for _, cliFlag := range command.Flags {
+			if cliFlag.Bool || done[cliFlag.Name] || cliFlag.Source == "" && len(cliFlag.Values) == 0 {
+				continue
+			}
+			done[cliFlag.Name] = true
+			switch {
+			case cliFlag.Source == "files":
+				fmt.Fprintf(&builder, "        --%s) COMPREPLY=($(compgen -f -- \"$cur\")); return ;;\n", cliFlag.Name)
+			case cliFlag.Source != "":
+				fmt.Fprintf(&builder, "        --%s) COMPREPLY=($(compgen -W \"$(%s __complete %s 2>/dev/null)\" -- \"$cur\")); return ;;\n", cliFlag.Name, program, cliFlag.Source)
+			default:
+				fmt.Fprintf(&builder, "        --%s) COMPREPLY=($(compgen -W %q -- \"$cur\")); return ;;\n", cliFlag.Name, strings.Join(cliFlag.Values, " "))
+			}
+		}
+	}
+	builder.WriteString("    esac\n")
+
+	// the flags of the command (go run . --kind Elf is a generation)
+	builder.WriteString("    local command=\"${COMP_WORDS[1]}\"\n")
+	builder.WriteString("    [[ \"$command\" == -* ]] && command=generate\n")
+	builder.WriteString("    case \"$command\" in\n")
+	for _, command := range cliCommands {
+		names := []string{}
+		for _, cliFlag := range command.Flags {
+			names = append(names, "--"+cliFlag.Name)
+		}
+		fmt.Fprintf(&builder, "        %s) COMPREPLY=($(compgen -W %q -- \"$cur\")) ;;\n", command.Name, strings.Join(names, " "))
+	}
+	builder.WriteString("        *) COMPREPLY=($(compgen -f -- \"$cur\")) ;;\n")
+	builder.WriteString("    esac\n}\n")
+	fmt.Fprintf(&builder, "complete -o default -F %s %s\n", function, program)
+	return builder.String()
+}
+
+// FishCompletion is the fish completion script
+func FishCompletion(program string) string {
+	builder := strings.Builder{}
+	fmt.Fprintf(&builder, "# fish completion of %s\n", program)
+	fmt.Fprintf(&builder, "complete -c %s -f\n", program)
+	for _, command := range cliCommands {
+		fmt.Fprintf(&builder, "complete -c %s -n __fish_use_subcommand -a %s -d %q\n", program, command.Name, command.Summary)
+	}
+	for _, command := range cliCommands {
+		for _, cliFlag := range command.Flags {
+			line := fmt.Sprintf("complete -c %s -n '__fish_seen_subcommand_from %s' -l %s -d %q", program, command.Name, cliFlag.Name, cliFlag.Usage)
+			switch {
+			case cliFlag.Bool:
+			case cliFlag.Source == "files":
+				line += " -r -F"
+			case cliFlag.Source != "":
+				line += fmt.Sprintf(" -x -a '(%s __complete %s 2>/dev/null)'", program, cliFlag.Source)
+			case len(cliFlag.Values) > 0:
+				line += fmt.Sprintf(" -x -a %q", strings.Join(cliFlag.Values, " "))
+			default:
+				line += " -x"
+			}
+			builder.WriteString(line + "\n")
+		}
+	}
+	return builder.String()
+}
+
+// roffEscape escapes the backslashes and the leading dots of the man page
+func roffEscape(text string) string {
+	text = strings.ReplaceAll(text, `\`, `\e`)
+	text = strings.ReplaceAll(text, "-", `\-`)
+	if strings.HasPrefix(text, ".") || strings.HasPrefix(text, "'") {
+		text = `\&` + text
+	}
+	return text
+}
+
+// ManPage is the man page of the CLI (section 1, roff)
+func ManPage(program string, date time.Time) string {
+	builder := strings.Builder{}
+	fmt.Fprintf(&builder, ".TH %s 1 %q\n", strings.ToUpper(program), date.Format("2006-01-02"))
+	builder.WriteString(".SH NAME\n")
+	fmt.Fprintf(&builder, "%s \\- generate non-player characters with Ollama\n", roffEscape(program))
+	builder.WriteString(".SH SYNOPSIS\n")
+	fmt.Fprintf(&builder, ".B %s\n.I command\n[\\fIflags\\fR] [\\fIargs\\fR]\n", roffEscape(program))
+	builder.WriteString(".SH DESCRIPTION\n")
+	builder.WriteString("Generates characters (names, equipment, stats, backstories) with a local model served by Ollama, ")
+	builder.WriteString("stores them in the registry of a campaign without duplicates, and exports them (JSON, Markdown, CSV).\n")
+	builder.WriteString(".SH COMMANDS\n")
+	for _, command := range cliCommands {
+		fmt.Fprintf(&builder, ".TP\n.B %s", roffEscape(command.Name))
+		if command.Args != "" {
+			fmt.Fprintf(&builder, " \\fI%s\\fR", roffEscape(command.Args))
+		}
+		fmt.Fprintf(&builder, "\n%s\n", roffEscape(command.Summary))
+		for _, cliFlag := range command.Flags {
+			fmt.Fprintf(&builder, ".RS\n.TP\n.B \\-\\-%s\n%s", roffEscape(cliFlag.Name), roffEscape(cliFlag.Usage))
+			if len(cliFlag.Values) > 0 {
+				fmt.Fprintf(&builder, " (%s)", roffEscape(strings.Join(cliFlag.Values, ", ")))
+			}
+			builder.WriteString("\n.RE\n")
+		}
+	}
+	builder.WriteString(".SH ENVIRONMENT\n")
+	environment := [][2]string{
+		{"OLLAMA_HOST", "url of the Ollama server"},
+		{"LLM", "model of the generation"},
+		{"GENRE", "genre pack (fantasy, scifi, cyberpunk, western)"},
+		{"CAMPAIGN", "campaign of the generation"},
+		{"DATA_DIR", "directory of the registries and exports (./data)"},
+		{"CONFIG_DIR", "directory of the configuration files (one file per variable)"},
+		{"CONFIG_FILE", "configuration file of KEY=VALUE lines"},
+	}
+	for _, variable := range environment {
+		fmt.Fprintf(&builder, ".TP\n.B %s\n%s\n", variable[0], roffEscape(variable[1]))
+	}
+	builder.WriteString("The README lists every variable.\n")
+	builder.WriteString(".SH EXIT STATUS\n")
+	fmt.Fprintf(&builder, ".TP\n.B %d\nsuccess, every slot of the generation has a stored character\n", ExitOK)
+	fmt.Fprintf(&builder, ".TP\n.B %d\nfailure, an error or no stored character\n", ExitFailure)
+	builder.WriteString(".TP\n.B 2\nwrong flags\n")
+	fmt.Fprintf(&builder, ".TP\n.B %d\npartial success, some slots of the generation failed or were filtered\n", ExitPartial)
+	builder.WriteString(".SH FILES\n")
+	builder.WriteString(".TP\n.I DATA_DIR/<campaign>/registry.json\nthe characters of the campaign, locked during the changes\n")
+	return builder.String()
+}
+
+// runMan prints the man page: npc-generator man > /usr/local/share/man/man1/npc-generator.1
+func (a *App) runMan(args []string) error {
+	flags := flag.NewFlagSet("man", flag.ExitOnError)
+	program := flags.String("program", "npc-generator", "name of the installed binary")
+	flags.Parse(args)
+	_, err := io.WriteString(a.stdout, ManPage(*program, time.Now()))
+	return err
+}
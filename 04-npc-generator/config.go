@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"slices"
+	"strings"
+
+	"04-npc-generator/config"
+)
+
+// settings are the variables of the configuration with their default and their flag,
+// config show --effective prints where their values come from
+var settings = []config.Setting{
+	{Name: "OLLAMA_HOST", Default: "localhost"},
+	{Name: "OLLAMA_HOSTS"},
+	{Name: "GPU_SLOTS", Default: "0"},
+	{Name: "OLLAMA_BALANCE", Default: "least-loaded"},
+	{Name: "OLLAMA_HEADERS", Secret: true},
+	{Name: "OLLAMA_BEARER_TOKEN", Secret: true},
+	{Name: "OLLAMA_CA_BUNDLE"},
+	{Name: "OLLAMA_CLIENT_CERT"},
+	{Name: "OLLAMA_CLIENT_KEY"},
+	{Name: "OLLAMA_CHECK_INTERVAL", Default: "5s"},
+	{Name: "OLLAMA_MAX_FAILURES", Default: "3"},
+	{Name: "OFFLINE_STRICT", Flag: "offline-strict", Bool: true},
+	{Name: "LLM"},
+	{Name: "JUDGE_LLM"},
+	{Name: "SOLVER_LLM"},
+	{Name: "MODELS"},
+	{Name: "EMBEDDING_MODEL", Default: "nomic-embed-text"},
+	{Name: "DEDUP", Default: DedupExact},
+	{Name: "PROBE_CAPABILITIES", Default: "true"},
+	{Name: "NUM_CTX", Default: "0"},
+	{Name: "DRIFT_SEED", Default: "42"},
+	{Name: "CAMPAIGN", Default: DefaultCampaign, Flag: "campaign"},
+	{Name: "KIND", Flag: "kind"},
+	{Name: "MIX", Flag: "mix"},
+	{Name: "CLASS", Flag: "class"},
+	{Name: "LEVEL", Default: "1", Flag: "level"},
+	{Name: "SYSTEM", Flag: "system"},
+	{Name: "GENRE", Default: "fantasy", Flag: "genre"},
+	{Name: "THEME", Flag: "theme"},
+	{Name: "ALIASES", Flag: "aliases", Bool: true},
+	{Name: "COVERAGE", Flag: "coverage", Bool: true},
+	{Name: "NAME_ONLY", Flag: "name-only", Bool: true},
+	{Name: "SYLLABLES", Flag: "syllables", Bool: true},
+	{Name: "QUICK_COUNT", Default: "5", Flag: "count"},
+	{Name: "QUICK_PARALLEL", Default: "5", Flag: "parallel"},
+	{Name: "QUICK_NUM_PREDICT", Default: "32", Flag: "num-predict"},
+	{Name: "SYLLABLES_MAX_AGE", Default: "0s", Flag: "syllables-max-age"},
+	{Name: "FEW_SHOT", Default: "true", Flag: "few-shot", Bool: true},
+	{Name: "STRICT", Flag: "strict", Bool: true},
+	{Name: "REVIEW", Flag: "review", Bool: true},
+	{Name: "RUBRICS_DIR"},
+	{Name: "TRANSLITERATE", Flag: "transliterate"},
+	{Name: "OUTPUT_LANGUAGE"},
+	{Name: "STORY_TABLES"},
+	{Name: "SEED", Default: "0"},
+	{Name: "PARALLEL", Default: "1", Flag: "parallel"},
+	{Name: "MAX_TOKENS_PER_RUN", Default: "0", Flag: "max-tokens-per-run"},
+	{Name: "AUTO_ADJUST"},
+	{Name: "TOOL_CALLING"},
+	{Name: "ESCALATION_AFTER"},
+	{Name: "ESCALATION_MAX_TEMPERATURE"},
+	{Name: "ESCALATION_MAX_TOP_K"},
+	{Name: "NOTES_DIR", Flag: "notes"},
+	{Name: "NOTES_TOP_K", Default: "3"},
+	{Name: "VECTOR_EF_SEARCH", Default: "64"},
+	{Name: "GENRES_DIR"},
+	{Name: "THEMES_DIR"},
+	{Name: "SYSTEMS_DIR"},
+	{Name: "PACKS_DIR", Default: "./packs"},
+	{Name: "ADAPTERS_DIR"},
+	{Name: "PROMPT_ADAPTER"},
+	{Name: "EQUIPMENT_RULES"},
+	{Name: "SHOP_ECONOMY"},
+	{Name: "MAP_WIDTH", Default: "48", Flag: "width"},
+	{Name: "MAP_HEIGHT", Default: "20", Flag: "height"},
+	{Name: "KIND_OPTIONS"},
+	{Name: "DOMAIN_LIMITS"},
+	{Name: "RETRY_POLICY"},
+	{Name: "PIPELINES"},
+	{Name: "PIPELINE", Flag: "pipeline"},
+	{Name: "CAST_MATRIX"},
+	{Name: "PROMPT_TEST_SUITE", Flag: "suite"},
+	{Name: "BENCH_MODELS", Flag: "models"},
+	{Name: "IMPROVE_LIMIT", Default: "10", Flag: "limit"},
+	{Name: "PORTRAITS", Flag: "portraits", Bool: true},
+	{Name: "PORTRAIT_URL"},
+	{Name: "PORTRAIT_SIZE", Default: "512x512"},
+	{Name: "PORTRAIT_STEPS", Default: "25"},
+	{Name: "PORTRAIT_CONCURRENCY", Default: "2"},
+	{Name: "DATA_DIR", Default: "./data"},
+	{Name: "OUTPUT_TEMPLATE", Flag: "out"},
+	{Name: "SORT", Default: SortByOrder},
+	{Name: "COLLATION", Default: CollationBinary},
+	{Name: "MARKDOWN_DETAILS", Flag: "details", Bool: true},
+	{Name: "NAME_SCRIPT", Default: NamesRomanized, Flag: "names"},
+	{Name: "JSONL_OUTPUT", Flag: "jsonl"},
+	{Name: "RUN_SUMMARY", Flag: "summary"},
+	{Name: "DISCORD_WEBHOOK_URL", Secret: true},
+	{Name: "DISCORD_HOOK_EVENTS", Default: "generated"},
+	{Name: "DISCORD_PUBLIC_KEY"},
+	{Name: "DISCORD_APPLICATION_ID"},
+	{Name: "DISCORD_BOT_TOKEN", Secret: true},
+	{Name: "DISCORD_CAMPAIGN"},
+	{Name: "DISCORD_RATE_LIMIT", Default: "5"},
+	{Name: "DISCORD_RATE_WINDOW", Default: "1m"},
+	{Name: "DISCORD_API_URL", Default: "https://discord.com/api/v10"},
+	{Name: "JSONL_FSYNC"},
+	{Name: "SINK_URL", Flag: "sink"},
+	{Name: "SINK_TOPIC", Default: "npc.{{.Campaign}}.{{.Kind}}"},
+	{Name: "SINK_BUFFER", Default: "100"},
+	{Name: "SINK_RETRY_ATTEMPTS", Default: "5"},
+	{Name: "SINK_RETRY_BACKOFF", Default: "500ms"},
+	{Name: "SINK_RETRY_MAX_BACKOFF", Default: "30s"},
+	{Name: "SINK_DEAD_LETTER"},
+	{Name: "SINK_WEBHOOK_SECRET", Secret: true},
+	{Name: "HTTP_PORT", Default: "8080"},
+	{Name: "READ_ONLY", Flag: "read-only", Bool: true},
+	{Name: "APPROVAL", Flag: "approval", Bool: true},
+	{Name: "REVIEWER_TOKEN", Secret: true},
+	{Name: "JOB_WORKERS", Default: "1"},
+	{Name: "QUALITY_WINDOW", Default: "1h"},
+	{Name: "SCHEDULE", Default: "@nightly"},
+	{Name: "SCHEDULE_COUNT", Default: "5"},
+	{Name: "SCHEDULE_PAUSE", Default: "10s"},
+	{Name: "HOLDER"},
+	{Name: "VCR_MODE"},
+	{Name: "VCR_CASSETTE"},
+}
+
+// runConfig prints the effective configuration, the flags of a command can be given after --:
+// config show --effective -- --kind Elf --count 5
+func (a *App) runConfig(args []string) error {
+	if len(args) < 1 || args[0] != "show" {
+		return errors.New("usage: config show --effective [-- <flags of a command>]")
+	}
+	flags := flag.NewFlagSet("config show", flag.ExitOnError)
+	effective := flags.Bool("effective", false, "print the effective value of every setting and its source")
+	flags.Parse(args[1:])
+	if !*effective {
+		return errors.New("usage: config show --effective [-- <flags of a command>]")
+	}
+
+	// the flags of the command are only read for the settings, the other flags are skipped
+	rest := flags.Args()
+	for idx := 0; idx < len(rest); idx++ {
+		if !strings.HasPrefix(rest[idx], "-") {
+			continue
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(rest[idx], "-"), "=")
+		isBool := slices.ContainsFunc(settings, func(setting config.Setting) bool { return setting.Flag == name && setting.Bool })
+		switch {
+		case hasValue:
+		case isBool:
+			value = "true"
+		case idx+1 < len(rest):
+			idx++
+			value = rest[idx]
+		}
+		a.config.SetFlag(name, value)
+	}
+
+	for _, value := range a.config.Effective() {
+		source := value.Source
+		if value.Origin != "" {
+			source += " " + value.Origin
+		}
+		fmt.Fprintf(a.stdout, "%-26s %-32s %s\n", value.Name, value.Display(), source)
+	}
+	return nil
+}
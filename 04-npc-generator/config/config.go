@@ -0,0 +1,202 @@
+// Package config layers the sources of the settings: the flags of a command take precedence
+// over the environment, the environment over the configuration files (CONFIG_DIR, then CONFIG_FILE),
+// and the files over the defaults. The files are applied to the environment, so the code
+// reads every setting from the environment and only the origins are kept here.
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Sources of a value
+const (
+	FromDefault = "default"
+	FromFile    = "file"
+	FromEnv     = "env"
+	FromFlag    = "flag"
+)
+
+// Setting is a variable of the configuration, Flag is the flag overriding it ("": env only)
+type Setting struct {
+	Name    string
+	Default string
+	Flag    string
+	// Bool flags take no value
+	Bool bool
+	// Secret values are masked by Value.Display
+	Secret bool
+}
+
+// Value is the effective value of a setting and where it came from
+type Value struct {
+	Setting
+	Value  string
+	Source string
+	// Origin is the path of the file or the flag of the value
+	Origin string
+}
+
+// Display is the value for the logs, a set secret is masked
+func (v Value) Display() string {
+	if v.Secret && v.Value != "" {
+		return "********"
+	}
+	return v.Value
+}
+
+// Layers is the resolved configuration
+type Layers struct {
+	settings []Setting
+	// origins are the files of the variables set by the configuration files
+	origins map[string]string
+	// flags are the values of the flags of the command
+	flags map[string]string
+	// unknown are the variables of the files without a setting
+	unknown []string
+}
+
+// Load applies the configuration files to the environment, a variable of the environment is kept:
+// dir holds one file per variable (a Kubernetes ConfigMap or Secret), file has KEY=VALUE lines
+func Load(settings []Setting, dir, file string) (*Layers, error) {
+	layers := &Layers{settings: settings, origins: map[string]string{}, flags: map[string]string{}}
+	values, err := readDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	fileValues, err := readFile(file)
+	if err != nil {
+		return nil, err
+	}
+	for name, origin := range fileValues {
+		if _, ok := values[name]; !ok {
+			values[name] = origin
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		if _, ok := os.LookupEnv(name); ok {
+			continue
+		}
+		err = os.Setenv(name, values[name].value)
+		if err != nil {
+			return nil, err
+		}
+		layers.origins[name] = values[name].origin
+		if !slices.ContainsFunc(settings, func(setting Setting) bool { return setting.Name == name }) {
+			layers.unknown = append(layers.unknown, name)
+		}
+	}
+	return layers, nil
+}
+
+// entry is a variable of a configuration file and where it is (the path, the line)
+type entry struct {
+	value  string
+	origin string
+}
+
+// readDir returns the value and the path of every file of the directory
+func readDir(dir string) (map[string]entry, error) {
+	values := map[string]entry{}
+	if dir == "" {
+		return values, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, dirEntry := range entries {
+		// the ..data entries are the internals of the Kubernetes volumes
+		if strings.HasPrefix(dirEntry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, dirEntry.Name())
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			continue
+		}
+		value, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		values[dirEntry.Name()] = entry{strings.TrimSpace(string(value)), path}
+	}
+	return values, nil
+}
+
+// readFile returns the KEY=VALUE lines of the file (blank lines and # comments are skipped,
+// the quotes around a value are removed) with their line
+func readFile(file string) (map[string]entry, error) {
+	values := map[string]entry{}
+	if file == "" {
+		return values, nil
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(strings.TrimPrefix(text, "export "), "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("%s:%d: expected NAME=value", file, line)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		values[name] = entry{value, fmt.Sprintf("%s:%d", file, line)}
+	}
+	return values, scanner.Err()
+}
+
+// Unknown returns the variables of the files without a setting (a typo or a removed setting)
+func (l *Layers) Unknown() []string {
+	return l.unknown
+}
+
+// SetFlag records a flag of the command line, it overrides the settings with the same flag
+func (l *Layers) SetFlag(name, value string) {
+	l.flags[name] = value
+}
+
+// Resolve returns the effective value of the setting
+func (l *Layers) Resolve(setting Setting) Value {
+	value := Value{Setting: setting, Value: setting.Default, Source: FromDefault}
+	if flagValue, ok := l.flags[setting.Flag]; ok && setting.Flag != "" {
+		value.Value, value.Source, value.Origin = flagValue, FromFlag, "--"+setting.Flag
+		return value
+	}
+	envValue, ok := os.LookupEnv(setting.Name)
+	switch {
+	case !ok || envValue == "":
+	case l.origins[setting.Name] != "":
+		value.Value, value.Source, value.Origin = envValue, FromFile, l.origins[setting.Name]
+	default:
+		value.Value, value.Source = envValue, FromEnv
+	}
+	return value
+}
+
+// Effective returns the effective value of every setting, in the order of the settings
+func (l *Layers) Effective() []Value {
+	values := []Value{}
+	for _, setting := range l.settings {
+		values = append(values, l.Resolve(setting))
+	}
+	return values
+}
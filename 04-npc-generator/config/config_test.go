@@ -0,0 +1,143 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+var kindSetting = Setting{Name: "NPC_TEST_KIND", Default: "Human", Flag: "kind"}
+
+// unsetAfter removes the variables the configuration files set in the environment
+func unsetAfter(t *testing.T, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		if _, ok := os.LookupEnv(name); ok {
+			t.Fatalf("%s is already set", name)
+		}
+	}
+	t.Cleanup(func() {
+		for _, name := range names {
+			os.Unsetenv(name)
+		}
+	})
+}
+
+func writeFile(t *testing.T, path, content string) string {
+	t.Helper()
+	err := os.WriteFile(path, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPrecedence(t *testing.T) {
+	for _, testCase := range []struct {
+		name   string
+		flag   string
+		env    string
+		dir    string
+		file   string
+		value  string
+		source string
+		origin string
+	}{
+		{name: "default", value: "Human", source: FromDefault},
+		{name: "file", file: "Elf", value: "Elf", source: FromFile, origin: "npc.env:2"},
+		{name: "dir over file", dir: "Dwarf", file: "Elf", value: "Dwarf", source: FromFile, origin: "NPC_TEST_KIND"},
+		{name: "env over dir", env: "Orc", dir: "Dwarf", file: "Elf", value: "Orc", source: FromEnv},
+		{name: "flag over env", flag: "Gnome", env: "Orc", dir: "Dwarf", file: "Elf", value: "Gnome", source: FromFlag, origin: "--kind"},
+		{name: "flag over default", flag: "Gnome", value: "Gnome", source: FromFlag, origin: "--kind"},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			tmp := t.TempDir()
+			dir, file := "", ""
+			if testCase.dir != "" {
+				dir = filepath.Join(tmp, "config")
+				os.Mkdir(dir, 0755)
+				writeFile(t, filepath.Join(dir, kindSetting.Name), testCase.dir+"\n")
+			}
+			if testCase.file != "" {
+				file = writeFile(t, filepath.Join(tmp, "npc.env"), "# the kind\n"+kindSetting.Name+"="+testCase.file+"\n")
+			}
+			if testCase.env != "" {
+				t.Setenv(kindSetting.Name, testCase.env)
+			} else {
+				unsetAfter(t, kindSetting.Name)
+			}
+
+			layers, err := Load([]Setting{kindSetting}, dir, file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if testCase.flag != "" {
+				layers.SetFlag("kind", testCase.flag)
+			}
+			value := layers.Resolve(kindSetting)
+			if value.Value != testCase.value || value.Source != testCase.source {
+				t.Errorf("%s from %s, want %s from %s", value.Value, value.Source, testCase.value, testCase.source)
+			}
+			if filepath.Base(value.Origin) != filepath.Base(testCase.origin) {
+				t.Errorf("origin %q, want %q", value.Origin, testCase.origin)
+			}
+			if effective := layers.Effective(); len(effective) != 1 || effective[0] != value {
+				t.Errorf("effective %+v, want %+v", effective, value)
+			}
+		})
+	}
+}
+
+func TestUnknown(t *testing.T) {
+	unsetAfter(t, "NPC_TEST_KIND", "NPC_TEST_OLAMA_HOST", "NPC_TEST_COUNT", "NPC_TEST_REMOVED")
+	t.Setenv("NPC_TEST_SHADOWED", "env")
+	tmp := t.TempDir()
+	dir := filepath.Join(tmp, "config")
+	os.Mkdir(dir, 0755)
+	writeFile(t, filepath.Join(dir, "NPC_TEST_REMOVED"), "1")
+	// the internals of a Kubernetes volume
+	writeFile(t, filepath.Join(dir, "..data"), "x")
+	file := writeFile(t, filepath.Join(tmp, "npc.env"), `
+export NPC_TEST_KIND="Elf"
+NPC_TEST_OLAMA_HOST='http://ollama:11434'
+NPC_TEST_COUNT = 5
+NPC_TEST_SHADOWED=file
+`)
+	settings := []Setting{kindSetting, {Name: "NPC_TEST_COUNT", Default: "1"}}
+
+	layers, err := Load(settings, dir, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the variables of the environment are not reported, even without a setting
+	if unknown := layers.Unknown(); !slices.Equal(unknown, []string{"NPC_TEST_OLAMA_HOST", "NPC_TEST_REMOVED"}) {
+		t.Errorf("unknown %q", unknown)
+	}
+	if value := layers.Resolve(kindSetting); value.Value != "Elf" {
+		t.Errorf("quoted value %q", value.Value)
+	}
+	if value := os.Getenv("NPC_TEST_OLAMA_HOST"); value != "http://ollama:11434" {
+		t.Errorf("single quoted value %q", value)
+	}
+	if value := layers.Resolve(settings[1]); value.Value != "5" || value.Origin != file+":4" {
+		t.Errorf("count %q from %s", value.Value, value.Origin)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tmp := t.TempDir()
+	file := writeFile(t, filepath.Join(tmp, "npc.env"), "KIND=Elf\nnot a variable\n")
+	_, err := Load(nil, "", file)
+	if err == nil || err.Error() != file+":2: expected NAME=value" {
+		t.Errorf("error %v", err)
+	}
+	_, err = Load(nil, filepath.Join(tmp, "missing"), "")
+	if err == nil {
+		t.Error("a missing CONFIG_DIR is an error")
+	}
+	_, err = Load(nil, "", filepath.Join(tmp, "missing.env"))
+	if err == nil {
+		t.Error("a missing CONFIG_FILE is an error")
+	}
+}
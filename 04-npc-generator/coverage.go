@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+var (
+	// Common prefixes: El-, Cel-, Gal-
+	prefixesRule = regexp.MustCompile(`(?i)prefixes:\s*(.+)`)
+	// Favor hard consonants (k, t, d, g)
+	lettersRule = regexp.MustCompile(`\(([a-zA-Z](?:\s*,\s*[a-zA-Z])+)\)`)
+)
+
+// CoveragePrefixes returns the prefixes of the coverage mode: the prefixes of the kind,
+// or the common prefixes and the letters of its phonetic rules, or the alphabet
+func CoveragePrefixes(kind KindDefinition) []string {
+	if len(kind.Prefixes) > 0 {
+		return kind.Prefixes
+	}
+	prefixes := []string{}
+	add := func(prefix string) {
+		prefix = strings.Trim(strings.TrimSpace(prefix), "-.")
+		if prefix == "" || slices.ContainsFunc(prefixes, func(p string) bool { return strings.EqualFold(p, prefix) }) {
+			return
+		}
+		runes := []rune(prefix)
+		runes[0] = unicode.ToUpper(runes[0])
+		prefixes = append(prefixes, string(runes))
+	}
+	for _, rule := range kind.Rules {
+		if match := prefixesRule.FindStringSubmatch(rule); match != nil {
+			for _, prefix := range strings.Split(match[1], ",") {
+				add(prefix)
+			}
+		}
+	}
+	for _, rule := range kind.Rules {
+		for _, match := range lettersRule.FindAllStringSubmatch(rule, -1) {
+			for _, letter := range strings.Split(match[1], ",") {
+				add(letter)
+			}
+		}
+	}
+	if len(prefixes) == 0 {
+		for letter := 'A'; letter <= 'Z'; letter++ {
+			add(string(letter))
+		}
+	}
+	return prefixes
+}
+
+// coveragePrefixes of the spec, the prefixes of both parents for a hybrid
+func coveragePrefixes(kinds []KindDefinition, spec Spec) []string {
+	names := spec.Parents
+	if len(names) == 0 {
+		names = []string{spec.Kind}
+	}
+	prefixes := []string{}
+	for _, name := range names {
+		kind, ok := findKind(kinds, name)
+		if !ok {
+			kind = KindDefinition{Name: name}
+		}
+		for _, prefix := range CoveragePrefixes(kind) {
+			if !slices.Contains(prefixes, prefix) {
+				prefixes = append(prefixes, prefix)
+			}
+		}
+	}
+	return prefixes
+}
+
+// hasPrefix compares without the case and the accents (Élrond starts with El)
+func hasPrefix(name, prefix string) bool {
+	return strings.HasPrefix(collationKey(name), collationKey(prefix))
+}
+
+// CoverageSummary counts the accepted names per prefix, in the order of the prefixes
+func CoverageSummary(prefixes []string, characters []Character) string {
+	parts := []string{}
+	for _, prefix := range prefixes {
+		count := 0
+		for _, character := range characters {
+			if hasPrefix(character.Name, prefix) {
+				count++
+			}
+		}
+		parts = append(parts, fmt.Sprintf("%s %d", prefix, count))
+	}
+	return strings.Join(parts, ", ")
+}
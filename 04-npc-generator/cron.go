@@ -0,0 +1,131 @@
+//go:build !minimal
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CronSchedule is a 5 fields cron expression: minute hour day-of-month month day-of-week,
+// every field accepts *, */n, a-b, a-b/n and lists (1,15,30)
+type CronSchedule struct {
+	minutes, hours, days, months, weekdays uint64
+	// with a restricted day of month and day of week, a day matches either of them
+	anyDay, anyWeekday bool
+}
+
+var cronMacros = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@nightly": "0 3 * * *",
+	"@weekly":  "0 0 * * 0",
+}
+
+func ParseCron(expression string) (CronSchedule, error) {
+	schedule := CronSchedule{}
+	if macro, ok := cronMacros[expression]; ok {
+		expression = macro
+	}
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return schedule, fmt.Errorf("cron %q: expected 5 fields (minute hour day month weekday)", expression)
+	}
+
+	var err error
+	bounds := []struct {
+		set      *uint64
+		min, max int
+	}{
+		{&schedule.minutes, 0, 59},
+		{&schedule.hours, 0, 23},
+		{&schedule.days, 1, 31},
+		{&schedule.months, 1, 12},
+		{&schedule.weekdays, 0, 7},
+	}
+	for idx, bound := range bounds {
+		*bound.set, err = parseCronField(fields[idx], bound.min, bound.max)
+		if err != nil {
+			return schedule, fmt.Errorf("cron %q: %w", expression, err)
+		}
+	}
+	// 7 is also sunday
+	if schedule.weekdays&(1<<7) != 0 {
+		schedule.weekdays |= 1
+	}
+	schedule.anyDay, schedule.anyWeekday = fields[2] == "*", fields[4] == "*"
+	return schedule, nil
+}
+
+func parseCronField(field string, min, max int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if before, after, ok := strings.Cut(part, "/"); ok {
+			value, err := strconv.Atoi(after)
+			if err != nil || value < 1 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			rangePart, step = before, value
+		}
+
+		low, high := min, max
+		if rangePart != "*" {
+			before, after, isRange := strings.Cut(rangePart, "-")
+			value, err := strconv.Atoi(before)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value in %q", part)
+			}
+			low, high = value, value
+			if isRange {
+				high, err = strconv.Atoi(after)
+				if err != nil {
+					return 0, fmt.Errorf("invalid range in %q", part)
+				}
+			} else if step > 1 {
+				// 5/15 is 5-max/15
+				high = max
+			}
+		}
+		if low < min || high > max || low > high {
+			return 0, fmt.Errorf("%q is out of the range %d-%d", part, min, max)
+		}
+		for value := low; value <= high; value += step {
+			set |= 1 << value
+		}
+	}
+	return set, nil
+}
+
+func (s CronSchedule) matchDay(t time.Time) bool {
+	day := s.days&(1<<t.Day()) != 0
+	weekday := s.weekdays&(1<<int(t.Weekday())) != 0
+	if s.anyDay || s.anyWeekday {
+		return day && weekday
+	}
+	return day || weekday
+}
+
+// Next returns the first matching minute after t
+func (s CronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// a matching minute is found within a few years, or never (February 30)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case s.months&(1<<int(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.matchDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case s.hours&(1<<t.Hour()) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case s.minutes&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
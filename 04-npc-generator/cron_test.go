@@ -0,0 +1,88 @@
+//go:build !minimal
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronScheduleNext(t *testing.T) {
+	date := func(value string) time.Time {
+		parsed, err := time.Parse("2006-01-02 15:04", value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+	for _, testCase := range []struct {
+		expression string
+		from       string
+		// empty when the schedule never matches
+		next string
+	}{
+		{expression: "30 * * * *", from: "2026-01-15 10:30", next: "2026-01-15 11:30"},
+		{expression: "*/15 9-17 * * *", from: "2026-01-15 17:50", next: "2026-01-16 09:00"},
+		{expression: "0,30 8 * * *", from: "2026-01-15 08:10", next: "2026-01-15 08:30"},
+		// a/n is a-max/n
+		{expression: "10/30 * * * *", from: "2026-01-15 10:30", next: "2026-01-15 10:40"},
+		{expression: "10/30 * * * *", from: "2026-01-15 10:41", next: "2026-01-15 11:10"},
+		{expression: "5/20 * * * *", from: "2026-01-15 10:46", next: "2026-01-15 11:05"},
+		// a restricted day of month and day of week: either of them
+		{expression: "0 0 1 * 1", from: "2026-01-01 00:00", next: "2026-01-05 00:00"},
+		{expression: "0 0 1 * 1", from: "2026-01-27 00:00", next: "2026-02-01 00:00"},
+		// a day of month or a day of week alone: both must match
+		{expression: "0 0 13 * *", from: "2026-01-14 00:00", next: "2026-02-13 00:00"},
+		{expression: "0 0 * * 5", from: "2026-01-14 00:00", next: "2026-01-16 00:00"},
+		{expression: "0 0 13 1-12 *", from: "2026-01-14 00:00", next: "2026-02-13 00:00"},
+		// 7 is also sunday
+		{expression: "0 12 * * 7", from: "2026-01-01 00:00", next: "2026-01-04 12:00"},
+		{expression: "0 12 * * 0", from: "2026-01-01 00:00", next: "2026-01-04 12:00"},
+		{expression: "@weekly", from: "2026-01-01 00:00", next: "2026-01-04 00:00"},
+		// month, year and leap day rollovers
+		{expression: "0 0 31 * *", from: "2026-01-31 12:00", next: "2026-03-31 00:00"},
+		{expression: "0 0 1 1 *", from: "2026-06-01 00:00", next: "2027-01-01 00:00"},
+		{expression: "59 23 * * *", from: "2026-12-31 23:59", next: "2027-01-01 23:59"},
+		{expression: "0 0 29 2 *", from: "2026-03-01 00:00", next: "2028-02-29 00:00"},
+		// never within the 5 years limit
+		{expression: "0 0 30 2 *", from: "2026-01-01 00:00"},
+		{expression: "0 0 31 4,6,9,11 *", from: "2026-01-01 00:00"},
+	} {
+		schedule, err := ParseCron(testCase.expression)
+		if err != nil {
+			t.Errorf("%q: %v", testCase.expression, err)
+			continue
+		}
+		next := schedule.Next(date(testCase.from))
+		expected := time.Time{}
+		if testCase.next != "" {
+			expected = date(testCase.next)
+		}
+		if !next.Equal(expected) {
+			t.Errorf("%q after %s: %v, expected %v", testCase.expression, testCase.from, next, expected)
+		}
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expression := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"@yearly",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"1-b * * * *",
+	} {
+		_, err := ParseCron(expression)
+		if err == nil {
+			t.Errorf("%q is parsed", expression)
+		}
+	}
+}
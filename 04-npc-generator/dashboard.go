@@ -0,0 +1,42 @@
+//go:build !minimal
+
+package main
+
+import (
+	_ "embed"
+	"html/template"
+	"net/http"
+)
+
+//go:embed templates/quality.html
+var qualityTemplate string
+
+// dashboardRefresh is the period of the refresh of the dashboard page (seconds)
+const dashboardRefresh = 10
+
+type dashboardData struct {
+	Window  string
+	Refresh int
+}
+
+// handleQuality answers the rolling rates of the slots by model and kind:
+// GET /admin/quality
+func (s *Server) handleQuality(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.generator.quality.Series())
+}
+
+// handleDashboard is the page of the rates, it polls /admin/quality:
+// GET /admin/dashboard
+func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	tpl, err := template.New("quality").Parse(qualityTemplate)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	window := ""
+	if s.generator.quality != nil {
+		window = s.generator.quality.window.String()
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	tpl.Execute(w, dashboardData{Window: window, Refresh: dashboardRefresh})
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Deduplicator is a strategy of the dedup: it remembers the names and tells
+// which one a new name is too close to (DEDUP stacks the strategies)
+type Deduplicator interface {
+	// Name is the strategy with its setting (levenshtein:2)
+	Name() string
+	// Match returns the remembered name the name duplicates, "" for a new name
+	Match(ctx context.Context, name string) string
+	Add(ctx context.Context, name string)
+	Remove(name string)
+}
+
+// batchDeduplicator remembers many names at once (the embeddings are asked by batches)
+type batchDeduplicator interface {
+	AddAll(ctx context.Context, names []string)
+}
+
+// preparer fetches what Match and Add need for the names (the embeddings) before the deduper is locked,
+// under the lock Match and Add only read what was prepared, the other workers don't wait for the network
+type preparer interface {
+	Prepare(ctx context.Context, names []string)
+}
+
+// Deduper remembers the names already generated during a run,
+// the workers of a parallel run share it; the exact match (ignoring the case)
+// is always checked, the strategies of DEDUP come after it
+type Deduper struct {
+	mutex      sync.Mutex
+	exact      *exactDedup
+	strategies []Deduplicator
+}
+
+func NewDeduper() *Deduper {
+	return &Deduper{exact: &exactDedup{seen: map[string]string{}}}
+}
+
+// Use adds the strategies (once, the workers of a parallel run share the deduper),
+// they remember the names already seen; the names are embedded without the lock
+func (d *Deduper) Use(ctx context.Context, strategies ...DedupStrategy) {
+	for _, strategy := range strategies {
+		deduplicator := strategy.New()
+		remembered := map[string]bool{}
+		for {
+			d.mutex.Lock()
+			if d.uses(strategy.Name) {
+				d.mutex.Unlock()
+				break
+			}
+			// the names added while the previous ones were remembered
+			names := slices.DeleteFunc(d.exact.names(), func(name string) bool { return remembered[name] })
+			if len(names) == 0 {
+				d.strategies = append(d.strategies, deduplicator)
+				d.mutex.Unlock()
+				break
+			}
+			d.mutex.Unlock()
+			if batch, ok := deduplicator.(batchDeduplicator); ok {
+				batch.AddAll(ctx, names)
+			} else {
+				for _, name := range names {
+					deduplicator.Add(ctx, name)
+				}
+			}
+			for _, name := range names {
+				remembered[name] = true
+			}
+		}
+	}
+}
+
+// prepare fetches what the strategies need for the names without the lock
+func (d *Deduper) prepare(ctx context.Context, names []string) {
+	d.mutex.Lock()
+	strategies := slices.Clone(d.strategies)
+	d.mutex.Unlock()
+	for _, strategy := range strategies {
+		if preparer, ok := strategy.(preparer); ok {
+			preparer.Prepare(ctx, names)
+		}
+	}
+}
+
+func (d *Deduper) uses(name string) bool {
+	for _, strategy := range d.strategies {
+		if strategy.Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// match returns the name the name duplicates and the strategy, "" for a new name
+func (d *Deduper) match(ctx context.Context, name string) (string, string) {
+	if match := d.exact.Match(ctx, name); match != "" {
+		return match, d.exact.Name()
+	}
+	for _, strategy := range d.strategies {
+		if match := strategy.Match(ctx, name); match != "" {
+			return match, strategy.Name()
+		}
+	}
+	return "", ""
+}
+
+func (d *Deduper) add(ctx context.Context, name string) {
+	d.exact.Add(ctx, name)
+	for _, strategy := range d.strategies {
+		strategy.Add(ctx, name)
+	}
+}
+
+func (d *Deduper) remove(name string) {
+	d.exact.Remove(name)
+	for _, strategy := range d.strategies {
+		strategy.Remove(name)
+	}
+}
+
+// Add returns false when the name was already seen
+func (d *Deduper) Add(ctx context.Context, name string) bool {
+	return d.AddNames(ctx, []string{name})
+}
+
+// AddNames adds the name and the aliases of a character,
+// it returns false (and adds nothing) when one of them was already seen
+func (d *Deduper) AddNames(ctx context.Context, names []string) bool {
+	d.prepare(ctx, names)
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	added := []string{}
+	for _, name := range names {
+		match, strategy := d.match(ctx, name)
+		if match != "" {
+			if strategy != d.exact.Name() {
+				fmt.Printf("🔁 %s is too close to %s (%s)\n", name, match, strategy)
+			}
+			for _, name := range added {
+				d.remove(name)
+			}
+			return false
+		}
+		d.add(ctx, name)
+		added = append(added, name)
+	}
+	return true
+}
+
+// RemoveNames forgets the name and the aliases of a character
+func (d *Deduper) RemoveNames(names []string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for _, name := range names {
+		d.remove(name)
+	}
+}
+
+// Seen returns true when the name was already seen (without adding it)
+func (d *Deduper) Seen(ctx context.Context, name string) bool {
+	d.prepare(ctx, []string{name})
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	match, _ := d.match(ctx, name)
+	return match != ""
+}
+
+// Remove forgets a name (the character was finally rejected)
+func (d *Deduper) Remove(name string) {
+	d.RemoveNames([]string{name})
+}
+
+// exactDedup matches the same name, ignoring the case and the surrounding spaces
+type exactDedup struct {
+	seen map[string]string
+}
+
+func exactKey(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+func (e *exactDedup) Name() string {
+	return DedupExact
+}
+
+func (e *exactDedup) Match(ctx context.Context, name string) string {
+	return e.seen[exactKey(name)]
+}
+
+func (e *exactDedup) Add(ctx context.Context, name string) {
+	e.seen[exactKey(name)] = name
+}
+
+func (e *exactDedup) Remove(name string) {
+	delete(e.seen, exactKey(name))
+}
+
+func (e *exactDedup) names() []string {
+	names := make([]string, 0, len(e.seen))
+	for _, name := range e.seen {
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"04-npc-generator/vector"
+)
+
+// bigramEmbed embeds a text as the counts of its bigrams, calls counts the requests
+// and block is called before every request
+func bigramEmbed(calls *atomic.Int32, block func(texts []string)) embedFunc {
+	return func(ctx context.Context, texts []string) ([][]float32, error) {
+		calls.Add(1)
+		if block != nil {
+			block(texts)
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		embeddings := [][]float32{}
+		for _, text := range texts {
+			embedding := make([]float32, 64)
+			runes := []rune(" " + text + " ")
+			for idx := range len(runes) - 1 {
+				hash := fnv.New32a()
+				hash.Write([]byte(string(runes[idx : idx+2])))
+				embedding[hash.Sum32()%64]++
+			}
+			embeddings = append(embeddings, embedding)
+		}
+		return embeddings, nil
+	}
+}
+
+func TestParseDedup(t *testing.T) {
+	for _, testCase := range []struct {
+		value string
+		names []string
+		err   bool
+	}{
+		{value: "", names: []string{}},
+		{value: "exact", names: []string{}},
+		{value: "folded, levenshtein", names: []string{"folded", "levenshtein:1"}},
+		{value: "levenshtein:2,embedding", names: []string{"levenshtein:2", "embedding:0.95"}},
+		{value: "folded,folded,embedding:0.9", names: []string{"folded", "embedding:0.9"}},
+		{value: "levenshtein:0", err: true},
+		{value: "levenshtein:two", err: true},
+		{value: "embedding:1.5", err: true},
+		{value: "embedding:0", err: true},
+		{value: "soundex", err: true},
+	} {
+		strategies, err := ParseDedup(testCase.value, bigramEmbed(&atomic.Int32{}, nil), "", vector.DefaultOptions)
+		if testCase.err {
+			if err == nil {
+				t.Errorf("ParseDedup(%q) accepted", testCase.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseDedup(%q): %v", testCase.value, err)
+			continue
+		}
+		names := []string{}
+		for _, strategy := range strategies {
+			names = append(names, strategy.Name)
+		}
+		if !slices.Equal(names, testCase.names) {
+			t.Errorf("ParseDedup(%q) = %v, want %v", testCase.value, names, testCase.names)
+		}
+	}
+}
+
+func TestDedupStrategies(t *testing.T) {
+	ctx := context.Background()
+	for _, testCase := range []struct {
+		strategy, stored, name, match string
+	}{
+		{"folded", "Éowyn", "eowyn", "Éowyn"},
+		{"folded", "Thorin", " THORIN ", "Thorin"},
+		{"folded", "Thorin", "Thorin II", ""},
+		{"levenshtein:1", "Balin", "Bolin", "Balin"},
+		{"levenshtein:1", "Balin", "Bálin", "Balin"},
+		{"levenshtein:1", "Balin", "Dwalin", ""},
+		{"levenshtein:2", "Balin", "Dwalin", "Balin"},
+		{"levenshtein:2", "Balin", "Gimli", ""},
+		{"embedding:0.9", "Thorin Oakenshield", "Thorin Oakenshields", "Thorin Oakenshield"},
+		{"embedding:0.9", "Thorin Oakenshield", "Gimli", ""},
+	} {
+		strategies, err := ParseDedup(testCase.strategy, bigramEmbed(&atomic.Int32{}, nil), "", vector.DefaultOptions)
+		if err != nil {
+			t.Fatal(err)
+		}
+		deduplicator := strategies[0].New()
+		// like the deduper, the embeddings are prepared before Add and Match
+		if preparer, ok := deduplicator.(preparer); ok {
+			preparer.Prepare(ctx, []string{testCase.stored, testCase.name})
+		}
+		deduplicator.Add(ctx, testCase.stored)
+		if match := deduplicator.Match(ctx, testCase.name); match != testCase.match {
+			t.Errorf("%s: %q matches %q, want %q", testCase.strategy, testCase.name, match, testCase.match)
+		}
+		deduplicator.Remove(testCase.stored)
+		if match := deduplicator.Match(ctx, testCase.name); match != "" {
+			t.Errorf("%s: %q matches the removed %q", testCase.strategy, testCase.name, match)
+		}
+	}
+}
+
+func TestDeduperStacked(t *testing.T) {
+	strategies, err := ParseDedup("folded,levenshtein:1", nil, "", vector.DefaultOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	deduper := NewDeduper()
+	if !deduper.Add(ctx, "Balin") {
+		t.Error("Balin is new")
+	}
+	// the strategies remember the names seen before them
+	deduper.Use(ctx, strategies...)
+	if !deduper.Seen(ctx, "BÁLIN") || !deduper.Seen(ctx, "Bolin") {
+		t.Error("the strategies don't match Balin")
+	}
+	// a character with a duplicate alias is not added, nor its name
+	if deduper.AddNames(ctx, []string{"Dwalin", "Bolin"}) {
+		t.Error("Bolin is too close to Balin")
+	}
+	if deduper.Seen(ctx, "Dwalin") {
+		t.Error("Dwalin was added with a duplicate alias")
+	}
+	deduper.RemoveNames([]string{"Balin"})
+	if deduper.Seen(ctx, "Bolin") {
+		t.Error("the strategies still match the removed Balin")
+	}
+}
+
+func TestEmbeddingDedupBatches(t *testing.T) {
+	calls := atomic.Int32{}
+	strategies, err := ParseDedup("embedding", bigramEmbed(&calls, nil), "", vector.DefaultOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	deduper := NewDeduper()
+	for idx := range 100 {
+		deduper.Add(ctx, "Dwarf "+strconv.Itoa(idx))
+	}
+	deduper.Use(ctx, strategies...)
+	// the remembered names are embedded by batches of 64
+	if calls.Load() != 2 {
+		t.Errorf("%d embedding requests for 100 names, want 2", calls.Load())
+	}
+	// the embeddings are cached
+	deduper.Seen(ctx, "Dwarf 7")
+	if calls.Load() != 2 {
+		t.Errorf("%d embedding requests after a cached name, want 2", calls.Load())
+	}
+}
+
+func embeddingDeduper(t *testing.T, embed embedFunc) *Deduper {
+	t.Helper()
+	strategies, err := ParseDedup("folded,embedding:0.999", embed, "", vector.DefaultOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deduper := NewDeduper()
+	deduper.Use(context.Background(), strategies...)
+	return deduper
+}
+
+func TestDeduperConcurrent(t *testing.T) {
+	calls := atomic.Int32{}
+	deduper := embeddingDeduper(t, bigramEmbed(&calls, nil))
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	shared := atomic.Int32{}
+	for worker := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range 20 {
+				name := fmt.Sprintf("Worker%c Xy%c", 'A'+worker, 'a'+idx)
+				if !deduper.AddNames(ctx, []string{name}) {
+					t.Errorf("%s is new", name)
+				}
+				if !deduper.Seen(ctx, name) {
+					t.Errorf("%s was added", name)
+				}
+				// every worker tries the same name, a single one gets it
+				if deduper.Add(ctx, fmt.Sprintf("Shared %c", 'a'+idx)) {
+					shared.Add(1)
+				}
+				deduper.RemoveNames([]string{name + " Alias"})
+			}
+		}()
+	}
+	wg.Wait()
+	if shared.Load() != 20 {
+		t.Errorf("%d shared names added, want 20", shared.Load())
+	}
+	if calls.Load() == 0 {
+		t.Error("the names were not embedded")
+	}
+}
+
+func TestDeduperEmbedsWithoutLock(t *testing.T) {
+	calls := atomic.Int32{}
+	started, release := make(chan struct{}), make(chan struct{})
+	deduper := embeddingDeduper(t, bigramEmbed(&calls, func(texts []string) {
+		if texts[0] == "slow" {
+			close(started)
+			<-release
+		}
+	}))
+	ctx := context.Background()
+
+	slowAdded := make(chan bool)
+	go func() { slowAdded <- deduper.Add(ctx, "Slow") }()
+	<-started
+	// the request of the other worker doesn't hold the deduper
+	fastAdded := make(chan bool)
+	go func() { fastAdded <- deduper.Add(ctx, "Fast") }()
+	select {
+	case added := <-fastAdded:
+		if !added {
+			t.Error("Fast is new")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the deduper is locked during the embedding of another name")
+	}
+	close(release)
+	if !<-slowAdded {
+		t.Error("Slow is new")
+	}
+}
+
+func TestDeduperCanceled(t *testing.T) {
+	calls := atomic.Int32{}
+	deduper := embeddingDeduper(t, bigramEmbed(&calls, nil))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// the exact and folded matches don't need the embeddings
+	if !deduper.Add(ctx, "Þórin") {
+		t.Error("Þórin is new")
+	}
+	if deduper.Add(ctx, "thorin") {
+		t.Error("thorin is Þórin")
+	}
+	if calls.Load() != 0 {
+		t.Errorf("%d embedding requests with a canceled context", calls.Load())
+	}
+}
+
+func TestEmbeddingDedupCacheOnly(t *testing.T) {
+	calls := atomic.Int32{}
+	strategies, err := ParseDedup("embedding:0.999", bigramEmbed(&calls, nil), "", vector.DefaultOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	embedding := strategies[0].New().(*embeddingDedup)
+	ctx := context.Background()
+	// without Prepare, Match and Add only read the index
+	embedding.Add(ctx, "Thorin")
+	if embedding.Match(ctx, "Thorin") != "" || calls.Load() != 0 {
+		t.Errorf("%d embedding requests without Prepare", calls.Load())
+	}
+	embedding.Prepare(ctx, []string{"Thorin"})
+	embedding.Add(ctx, "Thorin")
+	if embedding.Match(ctx, "Thorin") != "Thorin" || calls.Load() != 1 {
+		t.Errorf("%d embedding requests after Prepare, want 1", calls.Load())
+	}
+}
+
+func TestEmbeddingDedupCampaigns(t *testing.T) {
+	// the names of the other campaign are all closer to the checked name than the near duplicate
+	vectors := map[string][]float32{"thorgar": {1, 0}, "thorgarr": {1, 0.2}}
+	others := []string{}
+	for idx := range 100 {
+		name := "other " + strconv.Itoa(idx)
+		vectors[name] = []float32{1, 0.001 * float32(idx)}
+		others = append(others, name)
+	}
+	embed := func(ctx context.Context, texts []string) ([][]float32, error) {
+		embeddings := [][]float32{}
+		for _, text := range texts {
+			embeddings = append(embeddings, vectors[text])
+		}
+		return embeddings, nil
+	}
+	strategies, err := ParseDedup("embedding:0.95", embed, "", vector.DefaultOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	other, campaign := NewDeduper(), NewDeduper()
+	other.Use(ctx, strategies...)
+	campaign.Use(ctx, strategies...)
+	other.AddNames(ctx, others)
+	campaign.Add(ctx, "Thorgarr")
+
+	if !campaign.Seen(ctx, "Thorgar") {
+		t.Error("the names of the other campaign hide the near duplicate")
+	}
+	if other.Seen(ctx, "Thorgar") {
+		t.Error("the other campaign matches a name it doesn't have")
+	}
+}
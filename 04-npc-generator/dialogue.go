@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/ollama/ollama/api"
+)
+
+// Age groups of the characters, they shift the voice hints
+const (
+	AgeYoung = "young"
+	AgeAdult = "adult"
+	AgeElder = "elder"
+)
+
+var dialogueSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"age": map[string]any{"type": "string", "enum": []string{AgeYoung, AgeAdult, AgeElder}},
+		"lines": map[string]any{
+			"type":     "array",
+			"items":    map[string]any{"type": "string", "maxLength": 240},
+			"minItems": 1,
+			"maxItems": 8,
+		},
+	},
+	"required": []string{"age", "lines"},
+}
+
+// Dialogue is the answer of WriteLines
+type Dialogue struct {
+	Age   string   `json:"age"`
+	Lines []string `json:"lines"`
+}
+
+// WriteLines asks the model for count lines spoken by the character (greetings, barks, quest hooks)
+// and for its age group, the lines are plain text for the text-to-speech (3 attempts)
+func (g *Generator) WriteLines(ctx context.Context, character Character, count int) (Dialogue, error) {
+	characterContext, err := json.Marshal(character)
+	if err != nil {
+		return Dialogue{}, err
+	}
+	messages := []api.Message{
+		{Role: "system", Content: g.genre.Instructions},
+		{Role: "user", Content: fmt.Sprintf(
+			"Here is a character: %s\nWrite %d short lines this character says to the players (a greeting, a bark, a rumor, a quest hook), "+
+				"in the voice of the character, without stage directions nor emotes. Also give the age group of the character.",
+			characterContext, count,
+		)},
+	}
+	for attempt := 0; attempt < 3; attempt++ {
+		answer, err := g.chat(ctx, DomainDialogue, messages, dialogueSchema, map[string]interface{}{"temperature": 0.9})
+		if err != nil {
+			return Dialogue{}, err
+		}
+		if answer.Truncated {
+			continue
+		}
+		dialogue := Dialogue{}
+		err = decodeAnswer(answer.Content, &dialogue)
+		if err != nil {
+			// a refusal is only told apart from the lines when the answer has no lines at all,
+			// the lines themselves are in character ("I won't sell to your kind")
+			if classified := classifyAnswer(answer.Content); classified != nil {
+				err = classified
+			}
+			fmt.Println("😡 lines:", err)
+			continue
+		}
+		lines := []string{}
+		for _, line := range dialogue.Lines {
+			line = strings.Join(strings.Fields(line), " ")
+			if line != "" {
+				lines = append(lines, line)
+			}
+		}
+		if len(lines) == 0 {
+			fmt.Println("😡 lines: no line for", character.Name)
+			continue
+		}
+		if !slices.Contains([]string{AgeYoung, AgeAdult, AgeElder}, dialogue.Age) {
+			dialogue.Age = AgeAdult
+		}
+		dialogue.Lines = lines[:min(count, len(lines))]
+		return dialogue, nil
+	}
+	return Dialogue{}, fmt.Errorf("no valid lines for %s after 3 attempts", character.Name)
+}
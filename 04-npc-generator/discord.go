@@ -0,0 +1,389 @@
+//go:build !minimal
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Types of the Discord interactions and of their responses
+const (
+	interactionPing    = 1
+	interactionCommand = 2
+
+	responsePong     = 1
+	responseMessage  = 4
+	responseDeferred = 5
+
+	// flagEphemeral shows a message to the user of the command only
+	flagEphemeral = 64
+)
+
+// discordCommand is the /npc slash command, registered by discord register
+const discordCommand = "npc"
+
+// DiscordInteraction is the part of a Discord interaction read by the bot
+type DiscordInteraction struct {
+	Type          int    `json:"type"`
+	ApplicationID string `json:"application_id"`
+	Token         string `json:"token"`
+	// GuildID is empty in the direct messages, the limits are per user there
+	GuildID string `json:"guild_id"`
+	User    *struct {
+		ID string `json:"id"`
+	} `json:"user"`
+	Member *struct {
+		User struct {
+			ID string `json:"id"`
+		} `json:"user"`
+	} `json:"member"`
+	Data struct {
+		Name    string `json:"name"`
+		Options []struct {
+			Name  string `json:"name"`
+			Value any    `json:"value"`
+		} `json:"options"`
+	} `json:"data"`
+}
+
+// limitKey is the guild of the interaction, or its user in the direct messages
+func (i DiscordInteraction) limitKey() string {
+	if i.GuildID != "" {
+		return i.GuildID
+	}
+	if i.Member != nil {
+		return "user:" + i.Member.User.ID
+	}
+	if i.User != nil {
+		return "user:" + i.User.ID
+	}
+	return ""
+}
+
+func (i DiscordInteraction) option(name string) string {
+	for _, option := range i.Data.Options {
+		if option.Name == name {
+			return fmt.Sprint(option.Value)
+		}
+	}
+	return ""
+}
+
+// GuildLimiter allows limit commands per guild in a sliding window
+type GuildLimiter struct {
+	mutex  sync.Mutex
+	limit  int
+	window time.Duration
+	calls  map[string][]time.Time
+}
+
+func NewGuildLimiter(limit int, window time.Duration) *GuildLimiter {
+	return &GuildLimiter{limit: limit, window: window, calls: map[string][]time.Time{}}
+}
+
+// Allow records a command of the guild, or returns how long the guild waits for the next one
+func (l *GuildLimiter) Allow(guild string, now time.Time) (bool, time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	calls := l.calls[guild]
+	for len(calls) > 0 && now.Sub(calls[0]) >= l.window {
+		calls = calls[1:]
+	}
+	if len(calls) >= l.limit {
+		l.calls[guild] = calls
+		return false, calls[0].Add(l.window).Sub(now)
+	}
+	l.calls[guild] = append(calls, now)
+	return true, 0
+}
+
+// DiscordBot answers the /npc slash commands on the interactions endpoint of the application:
+// the command is acknowledged at once (Discord waits 3 seconds), the character is generated
+// with the serve-mode generator and the acknowledgement is edited with its embed
+type DiscordBot struct {
+	generator *Generator
+	storage   *Storage
+	campaign  string
+	publicKey ed25519.PublicKey
+	limiter   *GuildLimiter
+	api       string
+	client    *http.Client
+	// ctx is the context of the generations, they outlive the interaction requests
+	ctx context.Context
+}
+
+func (b *DiscordBot) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /interactions", b.handleInteraction)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	return mux
+}
+
+// verify checks the Ed25519 signature of the interaction by Discord (it sends invalid ones to test the endpoint)
+func (b *DiscordBot) verify(r *http.Request, body []byte) bool {
+	signature, err := hex.DecodeString(r.Header.Get("X-Signature-Ed25519"))
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		return false
+	}
+	message := append([]byte(r.Header.Get("X-Signature-Timestamp")), body...)
+	return ed25519.Verify(b.publicKey, message, signature)
+}
+
+func (b *DiscordBot) handleInteraction(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if !b.verify(r, body) {
+		writeError(w, http.StatusUnauthorized, errors.New("invalid request signature"))
+		return
+	}
+	interaction := DiscordInteraction{}
+	err = json.Unmarshal(body, &interaction)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	switch {
+	case interaction.Type == interactionPing:
+		writeJSON(w, http.StatusOK, map[string]int{"type": responsePong})
+	case interaction.Type == interactionCommand && interaction.Data.Name == discordCommand:
+		b.handleNPC(w, interaction)
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Errorf("unsupported interaction %d %q", interaction.Type, interaction.Data.Name))
+	}
+}
+
+// handleNPC checks the kind and the limit of the guild, then defers the answer to the generation
+func (b *DiscordBot) handleNPC(w http.ResponseWriter, interaction DiscordInteraction) {
+	request := GenerateRequest{Spec: b.generator.DefaultSpec()}
+	if kind := interaction.option("kind"); kind != "" {
+		request.Spec.Kind = kind
+	}
+	spec, err := b.generator.CheckSpec(request, 1)
+	if err != nil {
+		writeDiscordMessage(w, "😡 "+err.Error())
+		return
+	}
+	if !b.generator.backend.Status().Up {
+		writeDiscordMessage(w, "😴 the model is unavailable, try again in a minute")
+		return
+	}
+	allowed, wait := b.limiter.Allow(interaction.limitKey(), time.Now())
+	if !allowed {
+		writeDiscordMessage(w, fmt.Sprintf("⏳ too many characters, try again in %s", wait.Round(time.Second)))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"type": responseDeferred})
+	go b.generate(interaction, spec)
+}
+
+// writeDiscordMessage answers the interaction with a message only seen by its user
+func writeDiscordMessage(w http.ResponseWriter, content string) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"type": responseMessage,
+		"data": map[string]any{"content": content, "flags": flagEphemeral},
+	})
+}
+
+// generate stores one character of the spec and edits the deferred answer with it,
+// the token of the interaction is valid for 15 minutes
+func (b *DiscordBot) generate(interaction DiscordInteraction, spec Spec) {
+	ctx, cancel := context.WithTimeout(b.ctx, 14*time.Minute)
+	defer cancel()
+	message, err := b.character(ctx, spec)
+	if err != nil {
+		fmt.Println("😡 discord:", err)
+		message = map[string]any{"content": "😡 " + err.Error()}
+	}
+	err = b.editAnswer(ctx, interaction, message)
+	if err != nil {
+		fmt.Println("😡 discord:", err)
+	}
+}
+
+func (b *DiscordBot) character(ctx context.Context, spec Spec) (map[string]any, error) {
+	registry, err := b.storage.Registry(b.campaign)
+	if err != nil {
+		return nil, err
+	}
+	run := NewRun(b.generator, registry.Deduper(), spec)
+	slots, err := run.Generate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = StoreSlots(registry, slots)
+	if err != nil {
+		return nil, err
+	}
+	slot := slots[0]
+	if slot.Status != SlotOK || slot.Character == nil {
+		return nil, fmt.Errorf("no %s: %s", spec.Kind, slot.Reason)
+	}
+	fmt.Printf("🎲 discord: %s (%s)\n", slot.Character.DisplayName(), slot.Character.Kind)
+	return map[string]any{"embeds": []discordEmbed{characterEmbed(*slot.Character, discordColors[HookGenerated], time.Now())}}, nil
+}
+
+// editAnswer replaces the deferred answer of the interaction ("is thinking...")
+func (b *DiscordBot) editAnswer(ctx context.Context, interaction DiscordInteraction, message map[string]any) error {
+	url := fmt.Sprintf("%s/webhooks/%s/%s/messages/@original", b.api, interaction.ApplicationID, interaction.Token)
+	return discordRequest(ctx, b.client, http.MethodPatch, "the answer of the interaction", url, "", message)
+}
+
+// discordRequest sends a JSON request to the Discord API, authenticated by the token of the bot when set;
+// the errors name the endpoint instead of the URL (the URL of an answer has the token of the interaction)
+func discordRequest(ctx context.Context, client *http.Client, method, endpoint, endpointURL, botToken string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpointURL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if botToken != "" {
+		req.Header.Set("Authorization", "Bot "+botToken)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		// the error of the client repeats the URL
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("%s %s: %w", method, endpoint, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s: %s: %s", method, endpoint, resp.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// registerCommand creates (or overwrites) the /npc command of the application, in a guild
+// (available at once, for the tests) or globally; the kinds are its choices (25 at most)
+func (a *App) registerCommand(ctx context.Context, api, applicationID, botToken, guild string) error {
+	if applicationID == "" || botToken == "" {
+		return errors.New("discord register needs DISCORD_APPLICATION_ID and DISCORD_BOT_TOKEN")
+	}
+	choices := []map[string]string{}
+	for _, kind := range a.generator.kinds[:min(len(a.generator.kinds), 25)] {
+		choices = append(choices, map[string]string{"name": kind.Name, "value": kind.Name})
+	}
+	command := map[string]any{
+		"name":        discordCommand,
+		"type":        1,
+		"description": "Generate a character",
+		"options": []map[string]any{{
+			"name": "kind", "description": "kind of the character", "type": 3, "required": false, "choices": choices,
+		}},
+	}
+	url := fmt.Sprintf("%s/applications/%s/commands", api, applicationID)
+	if guild != "" {
+		url = fmt.Sprintf("%s/applications/%s/guilds/%s/commands", api, applicationID, guild)
+	}
+	// POST upserts the command by its name
+	err := discordRequest(ctx, &http.Client{Timeout: 30 * time.Second, Transport: a.transport}, http.MethodPost, "the commands", url, botToken, command)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✅ /%s registered with %d kinds\n", discordCommand, len(choices))
+	return nil
+}
+
+// runDiscord runs the bot (discord serve) on the interactions endpoint of the application,
+// or registers its slash command (discord register)
+func (a *App) runDiscord(ctx context.Context, args []string) error {
+	if len(args) < 1 || (args[0] != "serve" && args[0] != "register") {
+		return errors.New("usage: discord serve [--campaign c] | discord register [--guild id]")
+	}
+	err := a.offline.Refuse("discord bot")
+	if err != nil {
+		return err
+	}
+	api := getEnv("DISCORD_API_URL", "https://discord.com/api/v10")
+	flags := flag.NewFlagSet("discord "+args[0], flag.ExitOnError)
+	campaign := flags.String("campaign", getEnv("DISCORD_CAMPAIGN", getEnv("CAMPAIGN", DefaultCampaign)), "campaign of the characters")
+	guild := flags.String("guild", "", "register the command in this guild only (available at once)")
+	flags.Parse(args[1:])
+	if args[0] == "register" {
+		return a.registerCommand(ctx, api, os.Getenv("DISCORD_APPLICATION_ID"), os.Getenv("DISCORD_BOT_TOKEN"), *guild)
+	}
+
+	publicKey, err := hex.DecodeString(os.Getenv("DISCORD_PUBLIC_KEY"))
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return errors.New("DISCORD_PUBLIC_KEY must be the public key of the application (hex)")
+	}
+	limit, err := strconv.Atoi(getEnv("DISCORD_RATE_LIMIT", "5"))
+	if err != nil || limit < 1 {
+		return fmt.Errorf("DISCORD_RATE_LIMIT must be a positive number, got %q", os.Getenv("DISCORD_RATE_LIMIT"))
+	}
+	window, err := time.ParseDuration(getEnv("DISCORD_RATE_WINDOW", "1m"))
+	if err != nil {
+		return err
+	}
+	_, err = a.storage.Registry(*campaign)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	err = a.loadNotes(ctx, os.Getenv("NOTES_DIR"))
+	if err != nil {
+		return err
+	}
+	err = a.startBackend(ctx)
+	if err != nil {
+		return err
+	}
+	bot := &DiscordBot{
+		generator: a.generator,
+		storage:   a.storage,
+		campaign:  *campaign,
+		publicKey: publicKey,
+		limiter:   NewGuildLimiter(limit, window),
+		api:       api,
+		client:    &http.Client{Timeout: 30 * time.Second, Transport: a.transport},
+		ctx:       ctx,
+	}
+
+	httpPort := getEnv("HTTP_PORT", "8080")
+	httpServer := &http.Server{Addr: ":" + httpPort, Handler: bot.Handler()}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Printf("🤖 /%s on %s/interactions, %d characters per %s per guild\n", discordCommand, httpPort, limit, window)
+	err = httpServer.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		fmt.Println("👋 stopped")
+		return nil
+	}
+	return err
+}
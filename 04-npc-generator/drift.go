@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// DriftBaseline is the hash of the normalized answers of the benchmark spec for a model digest
+type DriftBaseline struct {
+	Model  string    `json:"model"`
+	Digest string    `json:"digest"`
+	Spec   Spec      `json:"spec"`
+	Seed   int       `json:"seed"`
+	Hash   string    `json:"hash"`
+	Names  []string  `json:"names"`
+	At     time.Time `json:"at"`
+}
+
+// DriftBaselines are the baselines of the models, by model then by digest
+type DriftBaselines map[string]map[string]DriftBaseline
+
+// DriftPath returns the path of the drift baselines, shared by the campaigns
+func (s *Storage) DriftPath() string {
+	return filepath.Join(s.dir, ".drift", "baselines.json")
+}
+
+func LoadDriftBaselines(path string) (DriftBaselines, error) {
+	baselines := DriftBaselines{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return baselines, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return baselines, json.Unmarshal(data, &baselines)
+}
+
+func (b DriftBaselines) Save(path string) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// latest returns the most recent baseline of the model with another digest
+func (b DriftBaselines) latest(model, digest string) (DriftBaseline, bool) {
+	others := slices.DeleteFunc(slices.Collect(maps.Values(b[model])), func(baseline DriftBaseline) bool {
+		return baseline.Digest == digest
+	})
+	if len(others) == 0 {
+		return DriftBaseline{}, false
+	}
+	return slices.MaxFunc(others, func(first, second DriftBaseline) int { return first.At.Compare(second.At) }), true
+}
+
+// normalizedSlot is the part of a slot the model decides: the status and the character
+// without the IDs, the times and the provenance
+func normalizedSlot(slot Slot) ([]byte, error) {
+	if slot.Status != SlotOK {
+		return []byte(slot.Status), nil
+	}
+	character := *slot.Character
+	character.ID, character.Code, character.CreatedAt, character.UpdatedAt, character.Provenance = 0, "", nil, nil, nil
+	return json.Marshal(character)
+}
+
+// RunDriftBenchmark generates the slots of the spec with fixed seeds (seed + index), one attempt each,
+// without the notes, the tools and the verification, and returns the hash of the normalized answers
+func (g *Generator) RunDriftBenchmark(ctx context.Context, spec Spec, seed int) (string, []string, error) {
+	bench := *g
+	bench.notes, bench.toolCalling, bench.strict = nil, false, false
+	deduper := NewDeduper()
+	hash := sha256.New()
+	names := []string{}
+	for index := range spec.Count {
+		options := maps.Clone(bench.optionsFor(spec))
+		options["seed"] = seed + index
+		run := NewRun(&bench, deduper, spec)
+		run.options, run.attempts = options, 1
+		slot, err := run.GenerateSlot(ctx, index)
+		if err != nil {
+			return "", nil, err
+		}
+		normalized, err := normalizedSlot(slot)
+		if err != nil {
+			return "", nil, err
+		}
+		hash.Write(append(normalized, '\n'))
+		if slot.Status == SlotOK {
+			names = append(names, slot.Character.Name)
+		} else {
+			names = append(names, "("+slot.Status+")")
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil)), names, nil
+}
+
+// runDrift re-runs the benchmark spec and compares its hash with the baseline of the model digest
+// (drift check): a new digest is compared with the previous one, then recorded; a drift fails the command
+func (a *App) runDrift(ctx context.Context, args []string) error {
+	if len(args) < 1 || args[0] != "check" {
+		return errors.New("usage: drift check [--kind] [--count 5] [--seed 42] [--update]")
+	}
+	seed, err := strconv.Atoi(getEnv("DRIFT_SEED", "42"))
+	if err != nil {
+		return err
+	}
+	flags := flag.NewFlagSet("drift check", flag.ExitOnError)
+	spec := Spec{Level: 1}
+	flags.StringVar(&spec.Kind, "kind", a.generator.kinds[0].Name, "kind of the benchmark spec")
+	flags.IntVar(&spec.Count, "count", 5, "number of characters of the benchmark spec")
+	flags.IntVar(&seed, "seed", seed, "seed of the first character")
+	update := flags.Bool("update", false, "replace the baseline of the digest")
+	flags.Parse(args[1:])
+	spec.Kind, spec.Parents, err = ResolveKind(a.generator.kinds, spec.Kind, "")
+	if err != nil {
+		return err
+	}
+
+	digest := a.generator.modelDigest
+	if digest == "" {
+		digest, err = installedDigest(ctx, a.generator.client, a.generator.model)
+		if err != nil {
+			return err
+		}
+		if digest == "" {
+			return fmt.Errorf("%s is not installed (models ensure)", a.generator.model)
+		}
+	}
+	baselines, err := LoadDriftBaselines(a.storage.DriftPath())
+	if err != nil {
+		return err
+	}
+
+	hash, names, err := a.generator.RunDriftBenchmark(ctx, spec, seed)
+	if err != nil {
+		return err
+	}
+	current := DriftBaseline{Model: a.generator.model, Digest: digest, Spec: spec, Seed: seed, Hash: hash, Names: names, At: time.Now()}
+	fmt.Printf("🧬 %s %.12s: %.12s %v\n", current.Model, digest, hash, names)
+
+	record := func() error {
+		if baselines[current.Model] == nil {
+			baselines[current.Model] = map[string]DriftBaseline{}
+		}
+		baselines[current.Model][digest] = current
+		return baselines.Save(a.storage.DriftPath())
+	}
+	baseline, ok := baselines[current.Model][digest]
+	switch {
+	case ok && !*update:
+		if baseline.Spec.Kind != spec.Kind || baseline.Spec.Count != spec.Count || baseline.Seed != seed {
+			return errors.New("the baseline of the digest has another spec or seed, check with the same ones or --update")
+		}
+		if baseline.Hash != hash {
+			return fmt.Errorf("the answers changed under the same digest %.12s (%v, now %v): Ollama or the prompts changed", digest, baseline.Names, names)
+		}
+		fmt.Println("✅ no drift since", baseline.At.Format(time.RFC3339))
+		return nil
+	case ok:
+		fmt.Println("📌 baseline replaced")
+		return record()
+	}
+
+	previous, ok := baselines.latest(current.Model, digest)
+	err = record()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		fmt.Println("📌 baseline recorded")
+		return nil
+	}
+	if previous.Spec.Kind != spec.Kind || previous.Spec.Count != spec.Count || previous.Seed != seed {
+		fmt.Println("📌 baseline recorded, the previous digest has another spec or seed")
+		return nil
+	}
+	if previous.Hash == hash {
+		fmt.Printf("✅ the update %.12s → %.12s gives the same answers\n", previous.Digest, digest)
+		return nil
+	}
+	return fmt.Errorf("the update %.12s → %.12s changed the answers (%v, now %v)", previous.Digest, digest, previous.Names, names)
+}
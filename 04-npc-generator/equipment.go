@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+
+	"04-npc-generator/model"
+
+	"github.com/ollama/ollama/api"
+)
+
+// Equipment is the loadout of a character, one item per slot
+type Equipment = model.Equipment
+
+// ClassAllowList lists the weapons and armors a class can carry
+type ClassAllowList struct {
+	Weapons []string `json:"weapons"`
+	Armors  []string `json:"armors"`
+}
+
+// EquipmentRules is the allow-list per class (the keys are lower case)
+type EquipmentRules map[string]ClassAllowList
+
+var defaultEquipmentRules = EquipmentRules{
+	"fighter": {
+		Weapons: []string{"Longsword", "Greatsword", "Battleaxe", "Warhammer", "Halberd", "Spear", "Crossbow"},
+		Armors:  []string{"Chain Mail", "Splint Armor", "Plate Armor", "Scale Mail", "Shield"},
+	},
+	"wizard": {
+		Weapons: []string{"Quarterstaff", "Dagger", "Light Crossbow", "Sling"},
+		Armors:  []string{"Robes", "Padded Cloak"},
+	},
+	"rogue": {
+		Weapons: []string{"Dagger", "Shortsword", "Rapier", "Hand Crossbow", "Shortbow"},
+		Armors:  []string{"Leather Armor", "Studded Leather"},
+	},
+	"cleric": {
+		Weapons: []string{"Mace", "Warhammer", "Flail", "Light Crossbow"},
+		Armors:  []string{"Scale Mail", "Chain Mail", "Breastplate", "Shield"},
+	},
+	"ranger": {
+		Weapons: []string{"Longbow", "Shortbow", "Shortsword", "Handaxe", "Spear"},
+		Armors:  []string{"Leather Armor", "Studded Leather", "Hide Armor"},
+	},
+}
+
+// LoadEquipmentRules reads the allow-list file (EQUIPMENT_RULES),
+// the built-in rules are used when there is no file
+func LoadEquipmentRules(path string) (EquipmentRules, error) {
+	if path == "" {
+		return defaultEquipmentRules, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return defaultEquipmentRules, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	rules := EquipmentRules{}
+	err = json.Unmarshal(data, &rules)
+	if err != nil {
+		return nil, err
+	}
+	// the classes are matched case-insensitively
+	lowerRules := EquipmentRules{}
+	for class, allowList := range rules {
+		lowerRules[strings.ToLower(class)] = allowList
+	}
+	return lowerRules, nil
+}
+
+// AllowList returns the allow-list of the class
+func (r EquipmentRules) AllowList(class string) (ClassAllowList, error) {
+	allowList, ok := r[strings.ToLower(class)]
+	if !ok {
+		return allowList, fmt.Errorf("no equipment allow-list for the class %q", class)
+	}
+	return allowList, nil
+}
+
+// Validate checks that every slot of the equipment is allowed for the class
+func (r EquipmentRules) Validate(class string, equipment Equipment) error {
+	allowList, err := r.AllowList(class)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(allowList.Weapons, equipment.Weapon) {
+		return fmt.Errorf("a %s can't use the weapon %q", class, equipment.Weapon)
+	}
+	if !slices.Contains(allowList.Armors, equipment.Armor) {
+		return fmt.Errorf("a %s can't wear the armor %q", class, equipment.Armor)
+	}
+	if len(equipment.Trinkets) == 0 || len(equipment.Trinkets) > 3 {
+		return fmt.Errorf("expected 1 to 3 trinkets, got %d", len(equipment.Trinkets))
+	}
+	return nil
+}
+
+// equipmentSchema restricts the weapon and the armor to the allow-list of the class
+func equipmentSchema(allowList ClassAllowList) map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"weapon": map[string]any{
+				"type": "string",
+				"enum": allowList.Weapons,
+			},
+			"armor": map[string]any{
+				"type": "string",
+				"enum": allowList.Armors,
+			},
+			"trinkets": map[string]any{
+				"type":     "array",
+				"items":    map[string]any{"type": "string"},
+				"minItems": 1,
+				"maxItems": 3,
+			},
+		},
+		"required": []string{"weapon", "armor", "trinkets"},
+	}
+}
+
+// ErrNoValidEquipment is a character the equipment stage rejects (the other errors are the requests)
+var ErrNoValidEquipment = errors.New("no valid equipment")
+
+// Equip runs the equipment stage: the loadout is regenerated
+// (3 attempts) until it complies with the allow-list of the class
+func (g *Generator) Equip(ctx context.Context, rules EquipmentRules, character Character) (Equipment, error) {
+	equipment := Equipment{}
+	allowList, err := rules.AllowList(character.Class)
+	if err != nil {
+		return equipment, fmt.Errorf("%w: %w", ErrNoValidEquipment, err)
+	}
+
+	userContent := fmt.Sprintf(
+		"Generate the equipment of %s, a level %d %s %s. The better the level, the rarer the trinkets.",
+		character.Name, character.Level, character.Kind, character.Class,
+	)
+	messages := []api.Message{
+		{Role: "system", Content: g.genre.Instructions},
+		{Role: "user", Content: userContent},
+	}
+	// the name generation options are too aggressive for item names
+	options := map[string]interface{}{
+		"temperature": 0.8,
+	}
+
+	for attempt := 0; attempt < 3; attempt++ {
+		answer, err := g.chat(ctx, DomainEquipment, messages, equipmentSchema(allowList), options)
+		if err != nil {
+			return equipment, err
+		}
+		equipment = Equipment{}
+		err = decodeAnswer(answer.Content, &equipment)
+		if err != nil {
+			fmt.Println("😡 equipment:", err)
+			continue
+		}
+		err = rules.Validate(character.Class, equipment)
+		if err != nil {
+			fmt.Println("🚫 equipment:", err)
+			continue
+		}
+		return equipment, nil
+	}
+	return equipment, fmt.Errorf("%w for %s after 3 attempts", ErrNoValidEquipment, character.Name)
+}
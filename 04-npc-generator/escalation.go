@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"strconv"
+)
+
+// Escalation raises temperature and top_k when the dedup rejects
+// several candidates in a row, the options are back to normal after a success
+type Escalation struct {
+	// After is the number of duplicates in a row before the escalation
+	After           int
+	TemperatureStep float64
+	MaxTemperature  float64
+	TopKStep        int
+	MaxTopK         int
+}
+
+var defaultEscalation = Escalation{
+	After:           2,
+	TemperatureStep: 0.2,
+	MaxTemperature:  2.0,
+	TopKStep:        10,
+	MaxTopK:         100,
+}
+
+// LoadEscalation reads the bounds from ESCALATION_AFTER, ESCALATION_MAX_TEMPERATURE and ESCALATION_MAX_TOP_K
+func LoadEscalation() (Escalation, error) {
+	escalation := defaultEscalation
+	var err error
+	if value := getEnv("ESCALATION_AFTER", ""); value != "" {
+		escalation.After, err = strconv.Atoi(value)
+		if err != nil {
+			return escalation, fmt.Errorf("ESCALATION_AFTER: %w", err)
+		}
+	}
+	if value := getEnv("ESCALATION_MAX_TEMPERATURE", ""); value != "" {
+		escalation.MaxTemperature, err = strconv.ParseFloat(value, 64)
+		if err != nil {
+			return escalation, fmt.Errorf("ESCALATION_MAX_TEMPERATURE: %w", err)
+		}
+	}
+	if value := getEnv("ESCALATION_MAX_TOP_K", ""); value != "" {
+		escalation.MaxTopK, err = strconv.Atoi(value)
+		if err != nil {
+			return escalation, fmt.Errorf("ESCALATION_MAX_TOP_K: %w", err)
+		}
+	}
+	return escalation, nil
+}
+
+// Apply returns the options escalated for the streak of duplicates
+// (the options are not changed below the threshold, 0 disables the escalation)
+func (e Escalation) Apply(options map[string]interface{}, streak int) map[string]interface{} {
+	if e.After <= 0 || streak < e.After {
+		return options
+	}
+	level := streak - e.After + 1
+	escalated := maps.Clone(options)
+
+	temperature, ok := options["temperature"].(float64)
+	if !ok {
+		temperature = 0.8
+	}
+	escalated["temperature"] = min(temperature+float64(level)*e.TemperatureStep, max(temperature, e.MaxTemperature))
+
+	topK, ok := options["top_k"].(int)
+	if !ok {
+		topK = 40
+	}
+	escalated["top_k"] = min(topK+level*e.TopKStep, max(topK, e.MaxTopK))
+	return escalated
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ollama/ollama/api"
+)
+
+// Event is a world event of the campaign timeline,
+// CausedBy lists the IDs of the earlier events that led to it
+type Event struct {
+	ID          int                `json:"id"`
+	Year        int                `json:"year"`
+	Type        string             `json:"type"`
+	Title       string             `json:"title"`
+	Description string             `json:"description"`
+	Factions    []string           `json:"factions"`
+	Characters  []EventParticipant `json:"characters"`
+	CausedBy    []int              `json:"caused_by"`
+}
+
+// EventParticipant is linked to its character in the registry (when it exists)
+type EventParticipant struct {
+	CharacterID int    `json:"character_id,omitempty"`
+	Code        string `json:"code,omitempty"`
+	Name        string `json:"name"`
+}
+
+// Timeline is the chronological list of the events
+type Timeline struct {
+	Events []Event `json:"events"`
+}
+
+var eventTypes = []string{"war", "battle", "coronation", "death", "disaster", "founding", "discovery", "treaty", "rebellion", "prophecy"}
+
+var timelineSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"events": map[string]any{
+			"type": "array",
+			"items": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"id":          map[string]any{"type": "integer"},
+					"year":        map[string]any{"type": "integer"},
+					"type":        map[string]any{"type": "string", "enum": eventTypes},
+					"title":       map[string]any{"type": "string"},
+					"description": map[string]any{"type": "string"},
+					"factions": map[string]any{
+						"type":  "array",
+						"items": map[string]any{"type": "string"},
+					},
+					"characters": map[string]any{
+						"type": "array",
+						"items": map[string]any{
+							"type":       "object",
+							"properties": map[string]any{"name": map[string]any{"type": "string"}},
+							"required":   []string{"name"},
+						},
+					},
+					"caused_by": map[string]any{
+						"type":  "array",
+						"items": map[string]any{"type": "integer"},
+					},
+				},
+				"required": []string{"id", "year", "type", "title", "description", "factions", "characters", "caused_by"},
+			},
+		},
+	},
+	"required": []string{"events"},
+}
+
+// Validate checks the chronological order and that an event is only caused by earlier events
+func (t Timeline) Validate(count int) error {
+	if len(t.Events) == 0 {
+		return ErrEmptyAnswer
+	}
+	if len(t.Events) < count/2 || len(t.Events) > count*2 {
+		return fmt.Errorf("expected about %d events, got %d", count, len(t.Events))
+	}
+	years := map[int]int{}
+	for idx, event := range t.Events {
+		if strings.TrimSpace(event.Title) == "" {
+			return fmt.Errorf("the event %d has no title", event.ID)
+		}
+		if idx > 0 && event.Year < t.Events[idx-1].Year {
+			return fmt.Errorf("the event %d (%d) is before the event %d (%d)", event.ID, event.Year, t.Events[idx-1].ID, t.Events[idx-1].Year)
+		}
+		if _, ok := years[event.ID]; ok {
+			return fmt.Errorf("the event ID %d is used twice", event.ID)
+		}
+		for _, cause := range event.CausedBy {
+			causeYear, ok := years[cause]
+			if !ok || causeYear > event.Year {
+				return fmt.Errorf("the event %d can't be caused by the event %d", event.ID, cause)
+			}
+		}
+		years[event.ID] = event.Year
+	}
+	return nil
+}
+
+// GenerateTimeline asks for a timeline of about count events,
+// the factions and the characters of the campaign can be involved (3 attempts)
+func (g *Generator) GenerateTimeline(ctx context.Context, count int, factions []Faction, characters []Character) (Timeline, error) {
+	timeline := Timeline{}
+
+	userContent := fmt.Sprintf(
+		"Generate a timeline of %d world events (wars, coronations, disasters...) in chronological order, with their year. "+
+			"Give every event an ID, and list in caused_by the IDs of the earlier events that led to it.",
+		count,
+	)
+	if len(factions) > 0 {
+		userContent += "\nThese factions can be involved:\n"
+		for _, faction := range factions {
+			userContent += fmt.Sprintf("- %s (%s)\n", faction.Name, faction.Ideology)
+		}
+	}
+	if len(characters) > 0 {
+		userContent += "\nThese characters can be involved (keep their name):\n"
+		for _, character := range characters {
+			userContent += fmt.Sprintf("- %s (%s)\n", character.Name, character.Kind)
+		}
+	}
+	messages := []api.Message{
+		{Role: "system", Content: g.genre.Instructions},
+		{Role: "user", Content: userContent},
+	}
+	options := map[string]interface{}{
+		"temperature": 1.0,
+	}
+
+	for attempt := 0; attempt < 3; attempt++ {
+		answer, err := g.chat(ctx, DomainEvents, messages, timelineSchema, options)
+		if err != nil {
+			return timeline, err
+		}
+		if answer.Truncated {
+			continue
+		}
+		timeline = Timeline{}
+		err = decodeAnswer(answer.Content, &timeline)
+		if err == nil {
+			err = timeline.Validate(count)
+		}
+		if err != nil {
+			fmt.Println("😡 events:", err)
+			continue
+		}
+		return timeline, nil
+	}
+	return timeline, fmt.Errorf("no valid timeline after 3 attempts")
+}
+
+// LinkParticipants links the characters of the events to the registry,
+// unlike the faction members the unknown characters are not stored
+func LinkParticipants(registry *Registry, timeline *Timeline) {
+	for eventIdx := range timeline.Events {
+		for idx := range timeline.Events[eventIdx].Characters {
+			participant := &timeline.Events[eventIdx].Characters[idx]
+			character, ok := registry.FindByName(participant.Name)
+			if ok {
+				participant.CharacterID, participant.Code = character.ID, character.Code
+			}
+		}
+	}
+}
+
+// LoadFactions reads the exported factions of the directory
+func LoadFactions(dir string) ([]Faction, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	factions := []Faction{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		faction := Faction{}
+		err = json.Unmarshal(data, &faction)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		factions = append(factions, faction)
+	}
+	return factions, nil
+}
+
+// TimelineMarkdown renders the timeline with a Mermaid chart of the causal links
+func TimelineMarkdown(timeline Timeline) string {
+	markdown := "# Timeline\n\n"
+	for _, event := range timeline.Events {
+		markdown += fmt.Sprintf("## %d - %s\n\n", event.Year, escapeMarkdown(event.Title))
+		markdown += fmt.Sprintf("*%s*. %s\n\n", escapeMarkdown(event.Type), escapeMarkdown(event.Description))
+		if len(event.Factions) > 0 {
+			markdown += "- **Factions**: " + escapeMarkdown(strings.Join(event.Factions, ", ")) + "\n"
+		}
+		if len(event.Characters) > 0 {
+			names := []string{}
+			for _, participant := range event.Characters {
+				if participant.Code != "" {
+					names = append(names, fmt.Sprintf("%s (%s)", participant.Name, participant.Code))
+				} else {
+					names = append(names, participant.Name)
+				}
+			}
+			markdown += "- **Characters**: " + escapeMarkdown(strings.Join(names, ", ")) + "\n"
+		}
+		if len(event.CausedBy) > 0 {
+			causes := []string{}
+			for _, cause := range event.CausedBy {
+				idx := slices.IndexFunc(timeline.Events, func(e Event) bool { return e.ID == cause })
+				if idx >= 0 {
+					causes = append(causes, timeline.Events[idx].Title)
+				}
+			}
+			markdown += "- **Caused by**: " + escapeMarkdown(strings.Join(causes, ", ")) + "\n"
+		}
+		markdown += "\n"
+	}
+
+	markdown += "## Causal links\n\n"
+	markdown += "```mermaid\ngraph TD\n"
+	for _, event := range timeline.Events {
+		markdown += fmt.Sprintf("    E%d[\"%d: %s\"]\n", event.ID, event.Year, mermaidLabel(event.Title))
+	}
+	for _, event := range timeline.Events {
+		for _, cause := range event.CausedBy {
+			markdown += fmt.Sprintf("    E%d --> E%d\n", cause, event.ID)
+		}
+	}
+	markdown += "```\n"
+	return markdown
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/csv"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MarkdownOptions is the rendering of the Markdown exports (MARKDOWN_DETAILS, NAME_SCRIPT)
+type MarkdownOptions struct {
+	// Details moves the backstories under the table, in collapsible <details> sections
+	Details bool
+	// Names is the representation of the names of the kinds with a script (romanized by default)
+	Names string
+}
+
+// displayName is the display name of the character in the representation of the options
+func (o MarkdownOptions) displayName(character Character) string {
+	switch {
+	case character.NativeName == "":
+	case o.Names == NamesNative:
+		character.Name = character.NativeName
+	case o.Names == NamesBoth:
+		character.Name += " (" + character.NativeName + ")"
+	}
+	return character.DisplayName()
+}
+
+// storyColumns are the story tables of the characters, a table none of them has is left out
+func storyColumns(characters []Character) []StoryTable {
+	tables := []StoryTable{}
+	for _, table := range storyTables {
+		if slices.ContainsFunc(characters, func(character Character) bool { return len(storyTableTexts(character, table.Name)) > 0 }) {
+			tables = append(tables, table)
+		}
+	}
+	return tables
+}
+
+// storyTitle is the header of the column of a story table: plot_hooks is Plot hooks
+func storyTitle(table StoryTable) string {
+	title := strings.ReplaceAll(table.Name, "_", " ")
+	return strings.ToUpper(title[:1]) + title[1:]
+}
+
+// MarkdownTable renders the characters as a GFM table, with the terms and the extras
+// of the genre and the story tables; the backstories are a column, or <details> sections under the table
+func MarkdownTable(characters []Character, genre Genre, options MarkdownOptions) string {
+	header := []string{"Index", "Code", "Name", genre.Terms.Kind, "Tags"}
+	for _, extra := range genre.Extras {
+		header = append(header, extra.Name)
+	}
+	tables := storyColumns(characters)
+	for _, table := range tables {
+		header = append(header, storyTitle(table))
+	}
+	grades := slices.ContainsFunc(characters, func(character Character) bool { return character.Grade != nil })
+	if grades {
+		header = append(header, "Grade")
+	}
+	backstories := slices.ContainsFunc(characters, func(character Character) bool { return character.Backstory != "" })
+	if backstories && !options.Details {
+		header = append(header, "Backstory")
+	}
+
+	// Add rows to the Markdown table
+	rows := [][]string{}
+	for idx, character := range characters {
+		row := []string{strconv.Itoa(idx + 1), character.Code, options.displayName(character), character.Kind, strings.Join(character.Tags, " ")}
+		for _, extra := range genre.Extras {
+			row = append(row, character.Extras[extra.Name])
+		}
+		for _, table := range tables {
+			row = append(row, strings.Join(storyTableTexts(character, table.Name), "; "))
+		}
+		if grades {
+			row = append(row, gradeColumn(character.Grade))
+		}
+		if backstories && !options.Details {
+			row = append(row, character.Backstory)
+		}
+		rows = append(rows, row)
+	}
+	table := RenderTable(header, rows)
+	if options.Details {
+		table += BackstoryDetails(characters, options)
+	}
+	return table
+}
+
+// BackstoryDetails renders the backstories as collapsible sections (GitHub renders the Markdown
+// inside <details> when it is separated from the tags by blank lines)
+func BackstoryDetails(characters []Character, options MarkdownOptions) string {
+	builder := strings.Builder{}
+	for _, character := range characters {
+		if character.Backstory == "" {
+			continue
+		}
+		builder.WriteString("\n<details>\n<summary>" + escapeMarkdown(options.displayName(character)) + "</summary>\n\n")
+		for _, paragraph := range strings.Split(character.Backstory, "\n\n") {
+			if paragraph = escapeMarkdown(paragraph); paragraph != "" {
+				builder.WriteString(paragraph + "\n\n")
+			}
+		}
+		builder.WriteString("</details>\n")
+	}
+	return builder.String()
+}
+
+// provenanceColumns are empty for the imported characters
+func provenanceColumns(provenance *Provenance) []string {
+	if provenance == nil {
+		return []string{"", "", "", "", ""}
+	}
+	return []string{
+		provenance.Model,
+		provenance.ModelDigest,
+		provenance.PromptVersion,
+		strconv.Itoa(provenance.Seed),
+		provenance.GeneratedAt.Format(time.RFC3339),
+	}
+}
+
+// CSVTable renders the characters as CSV, with a column per extra of the genre, then per story table
+// (the aliases and the texts of the tables are separated by semicolons)
+func CSVTable(characters []Character, genre Genre) (string, error) {
+	builder := strings.Builder{}
+	writer := csv.NewWriter(&builder)
+	header := []string{"id", "code", "name", "ascii_name", "native_name", "title", "aliases", "kind", "class", "level", "tags", "notes", "grade",
+		"model", "model_digest", "prompt_version", "seed", "generated_at"}
+	for _, extra := range genre.Extras {
+		header = append(header, extra.Name)
+	}
+	tables := storyColumns(characters)
+	for _, table := range tables {
+		header = append(header, table.Name)
+	}
+	err := writer.Write(header)
+	if err != nil {
+		return "", err
+	}
+	for _, character := range characters {
+		record := []string{
+			strconv.Itoa(character.ID),
+			character.Code,
+			character.Name,
+			character.ASCIIName,
+			character.NativeName,
+			character.Title,
+			strings.Join(character.Aliases, "; "),
+			character.Kind,
+			character.Class,
+			strconv.Itoa(character.Level),
+			strings.Join(character.Tags, " "),
+			character.Notes,
+			gradeColumn(character.Grade),
+		}
+		record = append(record, provenanceColumns(character.Provenance)...)
+		for _, extra := range genre.Extras {
+			record = append(record, character.Extras[extra.Name])
+		}
+		for _, table := range tables {
+			record = append(record, strings.Join(storyTableTexts(character, table.Name), "; "))
+		}
+		err = writer.Write(record)
+		if err != nil {
+			return "", err
+		}
+	}
+	writer.Flush()
+	return builder.String(), writer.Error()
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/ollama/ollama/api"
+)
+
+// Faction is an organization with a hierarchy of ranks and 3 to 5 members
+type Faction struct {
+	Name       string          `json:"name"`
+	Ideology   string          `json:"ideology"`
+	Leadership string          `json:"leadership"`
+	Ranks      []string        `json:"ranks"`
+	Symbols    []string        `json:"symbols"`
+	Members    []FactionMember `json:"members"`
+}
+
+// FactionMember is linked to its character in the registry
+type FactionMember struct {
+	CharacterID int    `json:"character_id,omitempty"`
+	Code        string `json:"code,omitempty"`
+	Name        string `json:"name"`
+	Kind        string `json:"kind"`
+	Rank        string `json:"rank"`
+	Role        string `json:"role"`
+}
+
+var factionSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"name":       map[string]any{"type": "string"},
+		"ideology":   map[string]any{"type": "string"},
+		"leadership": map[string]any{"type": "string"},
+		"ranks": map[string]any{
+			"type":     "array",
+			"items":    map[string]any{"type": "string"},
+			"minItems": 2,
+			"maxItems": 5,
+		},
+		"symbols": map[string]any{
+			"type":  "array",
+			"items": map[string]any{"type": "string"},
+		},
+		"members": map[string]any{
+			"type": "array",
+			"items": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"name": map[string]any{"type": "string"},
+					"kind": map[string]any{"type": "string"},
+					"rank": map[string]any{"type": "string"},
+					"role": map[string]any{"type": "string"},
+				},
+				"required": []string{"name", "kind", "rank", "role"},
+			},
+			"minItems": 3,
+			"maxItems": 5,
+		},
+	},
+	"required": []string{"name", "ideology", "leadership", "ranks", "symbols", "members"},
+}
+
+// Validate checks the members count and that every member has a known rank
+func (f Faction) Validate() error {
+	if strings.TrimSpace(f.Name) == "" {
+		return ErrEmptyAnswer
+	}
+	if len(f.Ranks) == 0 {
+		return fmt.Errorf("the faction %s has no rank", f.Name)
+	}
+	if len(f.Members) < 3 || len(f.Members) > 5 {
+		return fmt.Errorf("expected 3 to 5 members, got %d", len(f.Members))
+	}
+	for _, member := range f.Members {
+		if !slices.Contains(f.Ranks, member.Rank) {
+			return fmt.Errorf("the rank %q of %s is not a rank of the faction", member.Rank, member.Name)
+		}
+	}
+	return nil
+}
+
+// GenerateFaction asks for a faction, the candidates are existing characters
+// the model can recruit as members (3 attempts)
+func (g *Generator) GenerateFaction(ctx context.Context, candidates []Character) (Faction, error) {
+	faction := Faction{}
+
+	userContent := "Generate a random faction (guild, cult, order, gang...) with its ideology, its leadership structure, its ranks from the highest to the lowest, its symbols and 3 to 5 members."
+	if len(candidates) > 0 {
+		userContent += "\nYou can recruit some of these existing characters as members (keep their name and kind):\n"
+		for _, candidate := range candidates {
+			userContent += fmt.Sprintf("- %s (%s)\n", candidate.Name, candidate.Kind)
+		}
+	}
+	messages := []api.Message{
+		{Role: "system", Content: g.genre.Instructions},
+		{Role: "system", Content: GenerationInstructions(g.kinds)},
+		{Role: "user", Content: userContent},
+	}
+	options := map[string]interface{}{
+		"temperature": 1.0,
+	}
+
+	for attempt := 0; attempt < 3; attempt++ {
+		answer, err := g.chat(ctx, DomainFaction, messages, factionSchema, options)
+		if err != nil {
+			return faction, err
+		}
+		faction = Faction{}
+		err = decodeAnswer(answer.Content, &faction)
+		if err == nil {
+			err = faction.Validate()
+		}
+		if err != nil {
+			fmt.Println("😡 faction:", err)
+			continue
+		}
+		return faction, nil
+	}
+	return faction, fmt.Errorf("no valid faction after 3 attempts")
+}
+
+// LinkMembers links the members to the registry:
+// the existing characters are reused, the new ones are stored
+func LinkMembers(registry *Registry, faction *Faction) error {
+	for idx := range faction.Members {
+		member := &faction.Members[idx]
+		character, ok := registry.FindByName(member.Name)
+		if !ok {
+			added, err := registry.Add(Character{Name: member.Name, Kind: member.Kind})
+			if err != nil {
+				return err
+			}
+			if len(added) == 0 {
+				continue
+			}
+			character = added[0]
+		}
+		member.CharacterID = character.ID
+		member.Code = character.Code
+		member.Kind = character.Kind
+	}
+	return nil
+}
+
+var slugPattern = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Slug returns a file name friendly version of the name
+func Slug(name string) string {
+	return strings.Trim(slugPattern.ReplaceAllString(strings.ToLower(collationKey(name)), "-"), "-")
+}
+
+// FactionMarkdown renders the faction with a Mermaid organization chart
+func FactionMarkdown(faction Faction) string {
+	markdown := "# " + escapeMarkdown(faction.Name) + "\n\n"
+	markdown += "- **Ideology**: " + escapeMarkdown(faction.Ideology) + "\n"
+	markdown += "- **Leadership**: " + escapeMarkdown(faction.Leadership) + "\n"
+	markdown += "- **Symbols**: " + escapeMarkdown(strings.Join(faction.Symbols, ", ")) + "\n\n"
+
+	markdown += "## Organization chart\n\n"
+	markdown += "```mermaid\ngraph TD\n"
+	markdown += fmt.Sprintf("    F[\"%s\"]\n", mermaidLabel(faction.Name))
+	parent := "F"
+	for rankIdx, rank := range faction.Ranks {
+		rankNode := fmt.Sprintf("R%d", rankIdx)
+		markdown += fmt.Sprintf("    %s --> %s[\"%s\"]\n", parent, rankNode, mermaidLabel(rank))
+		for memberIdx, member := range faction.Members {
+			if member.Rank == rank {
+				markdown += fmt.Sprintf("    %s --> M%d[\"%s (%s)<br>%s\"]\n",
+					rankNode, memberIdx, mermaidLabel(member.Name), mermaidLabel(member.Kind), mermaidLabel(member.Role))
+			}
+		}
+		parent = rankNode
+	}
+	markdown += "```\n\n"
+
+	markdown += "## Members\n\n"
+	rows := [][]string{}
+	for _, rank := range faction.Ranks {
+		for _, member := range faction.Members {
+			if member.Rank == rank {
+				rows = append(rows, []string{rank, member.Name, member.Kind, member.Role, member.Code})
+			}
+		}
+	}
+	return markdown + RenderTable([]string{"Rank", "Name", "Kind", "Role", "Code"}, rows)
+}
+
+// the double quotes would close the Mermaid label
+func mermaidLabel(text string) string {
+	return strings.ReplaceAll(text, `"`, "#quot;")
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Naming customs of the families of a kind (KindDefinition.Family)
+const (
+	FamilySurname = "surname" // the last word is the family name: Thorin Ironforge, Dain Ironforge (default)
+	FamilyClan    = "clan"    // the words from "of" are the clan: Thorin of the Iron Hills
+	FamilyNone    = "none"    // no family name, the relatives only share the sounds of their names
+)
+
+// Relations of the relatives
+const (
+	RelationChild   = "child"
+	RelationSibling = "sibling"
+)
+
+// Relative is the stored character the generated characters are related to
+type Relative struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Relation string `json:"relation"`
+	// Family is the part of the name the relatives keep (empty with the custom none)
+	Family string `json:"family,omitempty"`
+}
+
+// familyCustom returns the naming custom of the kind, a hybrid follows its first parent
+func familyCustom(kinds []KindDefinition, kind string, parents []string) string {
+	if len(parents) > 0 {
+		kind = parents[0]
+	}
+	definition, ok := findKind(kinds, kind)
+	if !ok || definition.Family == "" {
+		return FamilySurname
+	}
+	return definition.Family
+}
+
+func checkFamilyCustom(custom string) error {
+	switch custom {
+	case "", FamilySurname, FamilyClan, FamilyNone:
+		return nil
+	}
+	return fmt.Errorf("unknown family custom %q (%s, %s, %s)", custom, FamilySurname, FamilyClan, FamilyNone)
+}
+
+// familyName returns the family part of the name with the custom,
+// empty when the name has none (a single word)
+func familyName(name, custom string) string {
+	words := strings.Fields(name)
+	if len(words) < 2 || custom == FamilyNone {
+		return ""
+	}
+	if custom == FamilyClan {
+		for idx, word := range words[1:] {
+			if strings.EqualFold(word, "of") {
+				return strings.Join(words[idx+1:], " ")
+			}
+		}
+	}
+	return words[len(words)-1]
+}
+
+// givenName is the name without its family part
+func givenName(name, family string) string {
+	return strings.TrimSpace(strings.TrimSuffix(name, family))
+}
+
+// RelativeSpec makes the characters of the spec children or siblings of the stored character:
+// they get its kind, and its family name with the custom of the kind
+func (g *Generator) RelativeSpec(spec Spec, relative Character, relation string) (Spec, error) {
+	if relation != RelationChild && relation != RelationSibling {
+		return spec, fmt.Errorf("unknown relation %q (%s, %s)", relation, RelationChild, RelationSibling)
+	}
+	spec.Kind, spec.Parents = relative.Kind, relative.Parents
+	spec.Relative = &Relative{
+		ID:       relative.ID,
+		Name:     relative.Name,
+		Relation: relation,
+		Family:   familyName(relative.Name, familyCustom(g.kinds, relative.Kind, relative.Parents)),
+	}
+	return spec, nil
+}
+
+// relativeInstructions ask for a given name sounding like the one of the relative, and the family name
+func relativeInstructions(relative *Relative) string {
+	instructions := fmt.Sprintf("The character is the %s of %s.", relative.Relation, relative.Name)
+	if relative.Family != "" {
+		instructions += fmt.Sprintf(" The name is a new given name followed by the family name %q.", relative.Family)
+	}
+	instructions += fmt.Sprintf(" The given name sounds like %q (the same phonetics and syllables), but it is another name.", givenName(relative.Name, relative.Family))
+	return instructions
+}
+
+// hasFamilyName is true when the name ends with the family name, after a given name
+func hasFamilyName(name, family string) bool {
+	key, familyKey := collationKey(name), collationKey(family)
+	return strings.HasSuffix(key, " "+familyKey) && strings.TrimSpace(strings.TrimSuffix(key, familyKey)) != ""
+}
+
+// relativeSpec resolves --child-of and --sibling-of
+func (a *App) relativeSpec(registry *Registry, spec Spec, childOf, siblingOf int) (Spec, error) {
+	if childOf != 0 && siblingOf != 0 {
+		return spec, errors.New("--child-of and --sibling-of can't be used together")
+	}
+	id, relation := childOf, RelationChild
+	if siblingOf != 0 {
+		id, relation = siblingOf, RelationSibling
+	}
+	relative, ok := registry.Get(id)
+	if !ok {
+		return spec, fmt.Errorf("no character with the ID %d", id)
+	}
+	spec, err := a.generator.RelativeSpec(spec, relative, relation)
+	if err != nil {
+		return spec, err
+	}
+	family := spec.Relative.Family
+	if family == "" {
+		family = "no family name"
+	}
+	fmt.Printf("👪 %s of %s (%s, %s)\n", relation, relative.Name, spec.Kind, family)
+	return spec, nil
+}
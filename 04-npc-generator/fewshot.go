@@ -0,0 +1,240 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+// fewShotBatch is the number of names graded by a request of the judge
+const fewShotBatch = 10
+
+// FewShot is the best stored names of the kinds of a campaign, graded by the judge model,
+// they are the examples of the prompts of the next generations of the campaign
+type FewShot struct {
+	Judge string                      `json:"judge"`
+	At    time.Time                   `json:"at"`
+	Kinds map[string][]FewShotExample `json:"kinds"`
+}
+
+type FewShotExample struct {
+	Name  string  `json:"name"`
+	Score float64 `json:"score"`
+}
+
+// FewShotPath returns the path of the few-shot examples of the campaign
+func (s *Storage) FewShotPath(campaign string) (string, error) {
+	return s.ExportPath(campaign, "few-shot.json")
+}
+
+// LoadFewShot reads the saved examples, nil when the campaign has none
+func LoadFewShot(path string) (*FewShot, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	fewShot := &FewShot{}
+	err = json.Unmarshal(data, fewShot)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return fewShot, nil
+}
+
+func (f *FewShot) Save(path string) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// fewShotInstructions is the system message of the examples of the kind ("" without examples)
+func (f *FewShot) fewShotInstructions(kind string) string {
+	if f == nil || len(f.Kinds[kind]) == 0 {
+		return ""
+	}
+	names := []string{}
+	for _, example := range f.Kinds[kind] {
+		names = append(names, example.Name)
+	}
+	return fmt.Sprintf("Here are %s names the game master liked, follow their style but never reuse them:\n- %s",
+		kind, strings.Join(names, "\n- "))
+}
+
+var judgeNamesSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"scores": map[string]any{
+			"type":  "array",
+			"items": map[string]any{"type": "integer", "minimum": 0, "maximum": 10},
+		},
+	},
+	"required": []string{"scores"},
+}
+
+// judgeNames asks the judge model for the grade of every name (0 to 1), in the order of the names
+func (g *Generator) judgeNames(ctx context.Context, judgeModel string, spec Spec, names []string) ([]float64, error) {
+	rules := GenerationInstructions(g.kinds)
+	if len(spec.Parents) == 2 {
+		rules = hybridInstructions(g.kinds, spec.Kind, spec.Parents)
+	}
+	rubric := g.Rubric(RubricNames)
+	userContent := fmt.Sprintf(
+		"Here are the naming rules:\n%s\nGrade from 0 to 10 each of these %d %s names with these criteria:\n%s\n"+
+			"Give the grades in the order of the names:\n- %s",
+		rules, len(names), spec.Kind, rubric.instructions(), strings.Join(names, "\n- "),
+	)
+	messages := []api.Message{
+		{Role: "system", Content: rubric.Prompt},
+		{Role: "user", Content: userContent},
+	}
+	judge := *g
+	judge.model = judgeModel
+	for attempt := 0; attempt < 3; attempt++ {
+		answer, err := judge.chat(ctx, DomainJudge, messages, judgeNamesSchema, map[string]interface{}{"temperature": 0.0, "seed": 1 + attempt})
+		if err != nil {
+			return nil, err
+		}
+		grades := struct {
+			Scores []int `json:"scores"`
+		}{}
+		err = decodeAnswer(answer.Content, &grades)
+		if err == nil && len(grades.Scores) != len(names) {
+			err = fmt.Errorf("%d grades for %d names", len(grades.Scores), len(names))
+		}
+		if err != nil {
+			fmt.Println("😡 judge:", err)
+			continue
+		}
+		scores := []float64{}
+		for _, score := range grades.Scores {
+			scores = append(scores, float64(min(max(score, 0), 10))/10)
+		}
+		return scores, nil
+	}
+	return nil, fmt.Errorf("no valid grades of the %s names after 3 attempts", spec.Kind)
+}
+
+// SelectFewShot grades the last candidates stored names of the kind (not archived)
+// and returns the top best ones with a score of at least minScore
+func (g *Generator) SelectFewShot(ctx context.Context, judgeModel string, spec Spec, characters []Character, candidates, top int, minScore float64) ([]FewShotExample, error) {
+	names := []string{}
+	for _, character := range slices.Backward(characters) {
+		if len(names) == candidates {
+			break
+		}
+		if character.Kind == spec.Kind && !character.Archived() {
+			names = append(names, character.Name)
+		}
+	}
+
+	examples := []FewShotExample{}
+	for batch := range slices.Chunk(names, fewShotBatch) {
+		scores, err := g.judgeNames(ctx, judgeModel, spec, batch)
+		if err != nil {
+			return nil, err
+		}
+		for idx, score := range scores {
+			if score >= minScore {
+				examples = append(examples, FewShotExample{Name: batch[idx], Score: score})
+			}
+		}
+	}
+	slices.SortStableFunc(examples, func(a, b FewShotExample) int { return cmp.Compare(b.Score, a.Score) })
+	return examples[:min(top, len(examples))], nil
+}
+
+// runFewShot grades the stored names of the kinds of the campaign with the judge model
+// and saves the best ones as the examples of the next generations of the campaign:
+// few-shot --campaign curse-of-strahd --top 5 --judge qwen2.5:7b
+func (a *App) runFewShot(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("few-shot", flag.ExitOnError)
+	campaign := flags.String("campaign", getEnv("CAMPAIGN", DefaultCampaign), "campaign of the characters")
+	kind := flags.String("kind", "", "kind of the examples (default: every kind of the campaign)")
+	top := flags.Int("top", 5, "number of examples per kind")
+	candidates := flags.Int("candidates", 50, "number of the last stored names graded per kind")
+	minScore := flags.Float64("min-score", 0.7, "minimum grade of an example (0 to 1)")
+	judgeModel := flags.String("judge", getEnv("JUDGE_LLM", a.generator.model), "model grading the names")
+	flags.Parse(args)
+
+	registry, err := a.storage.Registry(*campaign)
+	if err != nil {
+		return err
+	}
+	characters := registry.List()
+	kinds := []string{*kind}
+	if *kind == "" {
+		kinds = []string{}
+		for _, character := range characters {
+			if !slices.Contains(kinds, character.Kind) {
+				kinds = append(kinds, character.Kind)
+			}
+		}
+		slices.Sort(kinds)
+	}
+
+	path, err := a.storage.FewShotPath(*campaign)
+	if err != nil {
+		return err
+	}
+	// the examples of the other kinds are kept with --kind
+	fewShot, err := LoadFewShot(path)
+	if err != nil {
+		return err
+	}
+	if fewShot == nil || *kind == "" {
+		fewShot = &FewShot{Kinds: map[string][]FewShotExample{}}
+	}
+	fewShot.Judge, fewShot.At = *judgeModel, time.Now().UTC()
+	for _, name := range kinds {
+		spec := Spec{Kind: name}
+		// the stored kind of a hybrid is Dwarf-Human or Half-Elf
+		if parents := characterParents(characters, name); len(parents) == 2 {
+			spec.Parents = parents
+		}
+		examples, err := a.generator.SelectFewShot(ctx, *judgeModel, spec, characters, *candidates, *top, *minScore)
+		if err != nil {
+			return err
+		}
+		fewShot.Kinds[name] = examples
+		names := []string{}
+		for _, example := range examples {
+			names = append(names, fmt.Sprintf("%s (%.1f)", example.Name, example.Score))
+		}
+		fmt.Printf("🏅 %s: %s\n", name, cmp.Or(strings.Join(names, ", "), "no name above the minimum grade"))
+	}
+	err = fewShot.Save(path)
+	if err != nil {
+		return err
+	}
+	fmt.Println("📝", path)
+	return nil
+}
+
+// characterParents returns the parent kinds of the stored characters of a kind (nil: not a hybrid)
+func characterParents(characters []Character, kind string) []string {
+	for _, character := range characters {
+		if character.Kind == kind && len(character.Parents) > 0 {
+			return character.Parents
+		}
+	}
+	return nil
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"04-npc-generator/model"
+	"04-npc-generator/parse"
+
+	"github.com/ollama/ollama/api"
+)
+
+// Character is the domain model, the JSON decoding normalizes it
+type Character = model.Character
+
+const systemInstructions = `You are an expert NPC generator for games like D&D.
+	You have freedom to be creative to get the best possible output.
+	`
+
+// define schema for a structured output
+// ref: https://ollama.com/blog/structured-outputs
+var characterSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"name": map[string]any{
+			"type": "string",
+		},
+		"kind": map[string]any{
+			"type": "string",
+		},
+	},
+	"required": []string{"name", "kind"},
+}
+
+// Generator asks the model for one character at a time
+type Generator struct {
+	client *api.Client
+	model  string
+	// modelDigest is probed at startup ("" without the probe)
+	modelDigest string
+	options     map[string]interface{}
+	// kindOptions override the options per kind (lower case)
+	kindOptions    map[string]map[string]interface{}
+	equipmentRules EquipmentRules
+	economy        Economy
+	systems        map[string]GameSystem
+	limits         map[string]DomainLimits
+	escalation     Escalation
+	kinds          []KindDefinition
+	genre          Genre
+	genres         map[string]Genre
+	themes         map[string]Pack
+	// numCtx is the context size of every request (0: the Ollama default),
+	// contextSizer sizes it per request instead (NUM_CTX=auto, nil: fixed)
+	numCtx       int
+	contextSizer *ContextSizer
+	// hooks are called on the lifecycle events of the slots (AddHook)
+	hooks []Hook
+	// retry with softened options after an empty answer or a refusal
+	autoAdjust bool
+	// the model can check its names with the check_name_available tool
+	toolCalling bool
+	// strict sends every accepted character back to the model for a verification
+	strict bool
+	// review grades every accepted character with the rubric of the characters (reviewModel is the judge),
+	// a character below the threshold of the rubric is rejected
+	review      bool
+	reviewModel string
+	rubrics     map[string]Rubric
+	// transliterate adds the ascii_name of the characters (loose or strict, "": no ascii_name)
+	transliterate string
+	// notes grounds the characters in the campaign notes (nil: no notes)
+	notes *NotesIndex
+	// balancer spreads the requests over the Ollama hosts (nil: one host)
+	balancer *Balancer
+	// backend is the circuit breaker of the serve mode (nil: no breaker)
+	backend *Backend
+	// dedup are the strategies of the dedup of the runs after the exact match (DEDUP)
+	dedup []DedupStrategy
+	// fewShot are the best stored names of the campaign, examples of the prompts (nil: no examples)
+	fewShot *FewShot
+	// quality keeps the outcomes of the slots for the dashboard of the serve mode (nil: not kept)
+	quality *QualityMonitor
+	// retry is the behavior of the error classes of the requests (RETRY_POLICY)
+	retry RetryPolicy
+	// adapters rewrite the messages for the family of the model (nil: the messages as they are)
+	adapters *adapterCache
+	// language is the language of the texts (OUTPUT_LANGUAGE, "": not checked)
+	language string
+	// storyChances are the chances of the story tables of the characters (STORY_TABLES)
+	storyChances StoryChances
+	// seed is the seed of the runs (SEED, 0: a random seed per run)
+	seed int
+	// syllables combines the names of its kind locally, without the model (nil: the model)
+	syllables *SyllableTable
+}
+
+func NewGenerator(client *api.Client, model string) *Generator {
+	return &Generator{
+		client:         client,
+		model:          model,
+		equipmentRules: defaultEquipmentRules,
+		economy:        defaultEconomy,
+		systems:        map[string]GameSystem{},
+		limits:         defaultDomainLimits,
+		escalation:     defaultEscalation,
+		retry:          defaultRetryPolicy,
+		kinds:          builtinKinds,
+		genre:          builtinGenres[0],
+		genres:         map[string]Genre{},
+		themes:         map[string]Pack{},
+		options: map[string]interface{}{
+			"temperature":    1.7,
+			"repeat_last_n":  2,
+			"repeat_penalty": 2.2,
+			"top_k":          10,
+			"top_p":          0.9,
+		},
+	}
+}
+
+// System returns the game system of the spec, nil without system
+func (g *Generator) System(name string) (*GameSystem, error) {
+	if name == "" {
+		return nil, nil
+	}
+	system, ok := g.systems[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown game system %q (%s)", name, strings.Join(SystemNames(g.systems), ", "))
+	}
+	return &system, nil
+}
+
+// DefaultSpec is a single character of the first kind of the genre
+func (g *Generator) DefaultSpec() Spec {
+	return Spec{Kind: g.kinds[0].Name, Level: 1, Count: 1}
+}
+
+// CheckSpec validates a requested spec and resolves the kind of a hybrid
+func (g *Generator) CheckSpec(request GenerateRequest, maxCount int) (Spec, error) {
+	spec := request.Spec
+	if spec.Count < 1 || spec.Count > maxCount {
+		return spec, fmt.Errorf("count must be between 1 and %d", maxCount)
+	}
+	_, err := g.System(spec.System)
+	if err != nil {
+		return spec, err
+	}
+	err = checkNameOnly(spec)
+	if err != nil {
+		return spec, err
+	}
+	err = checkStoryTables(spec.Tables)
+	if err != nil {
+		return spec, err
+	}
+	spec.Kind, spec.Parents, err = ResolveKind(g.kinds, spec.Kind, request.Mix)
+	if err != nil {
+		return spec, err
+	}
+	return spec, checkKind(spec.Kind)
+}
+
+// Answer is the structured answer of the model
+type Answer struct {
+	Content string
+	// Truncated is true when num_predict cut the answer off
+	Truncated bool
+	// PromptVersion is the digest of the prompt messages of Generate
+	PromptVersion string
+	// Grounding is the sources of the chunks of notes in the prompt
+	Grounding []string
+	// ToolCalls is the number of tools called by the model before the answer
+	ToolCalls int
+}
+
+// Generate returns the JSON answer of the model for the kind (and the game system) of the spec,
+// with the tool calling the model checks its names with available before it answers
+func (g *Generator) Generate(ctx context.Context, spec Spec, options map[string]interface{}, available func(name string) bool) (Answer, error) {
+	userContent := fmt.Sprintf("Generate a random name for an %s (kind always equals %s).", spec.Kind, spec.Kind)
+	if spec.Prefix != "" {
+		userContent += fmt.Sprintf("\nThe name must start with %q.", spec.Prefix)
+	}
+	if spec.Relative != nil {
+		userContent += "\n" + relativeInstructions(spec.Relative)
+	}
+	schema := characterSchema
+
+	system, err := g.System(spec.System)
+	if err != nil {
+		return Answer{}, err
+	}
+	if system != nil {
+		userContent += fmt.Sprintf("\nThe character is for %s. %s", system.Title, system.Vocabulary)
+		schema = system.Schema()
+	}
+	if spec.Aliases {
+		userContent += "\nAlso give the character a title (like \"the Unbent\") and one or two aliases or nicknames (like \"Old Hammer\")."
+		schema = withAliases(schema)
+	}
+	if len(g.genre.Extras) > 0 {
+		extras := []string{}
+		for _, extra := range g.genre.Extras {
+			extras = append(extras, extra.Name+" ("+extra.Description+")")
+		}
+		userContent += "\nAlso give the extras of the character: " + strings.Join(extras, ", ") + "."
+		schema = g.genre.WithExtras(schema)
+	}
+	if len(spec.Tables) > 0 {
+		userContent += storyInstructions(spec.Tables)
+		schema = withStoryTables(schema, spec.Tables)
+	}
+	userContent += g.languageInstructions()
+
+	// Prompt construction
+	messages := []api.Message{
+		{Role: "system", Content: g.genre.Instructions},
+		{Role: "system", Content: GenerationInstructions(g.kinds)},
+	}
+	if len(spec.Parents) == 2 {
+		messages = append(messages, api.Message{Role: "system", Content: hybridInstructions(g.kinds, spec.Kind, spec.Parents)})
+	}
+	if examples := g.fewShot.fewShotInstructions(spec.Kind); examples != "" {
+		messages = append(messages, api.Message{Role: "system", Content: examples})
+	}
+	var toolbox *Toolbox
+	if g.toolCalling && available != nil {
+		userContent += "\nCheck that the name is available with check_name_available before you answer, and choose another name when it is taken."
+		toolbox = NameToolbox(available)
+	}
+	messages = append(messages, api.Message{Role: "user", Content: userContent})
+	// the version is the template, without the drawn chunks of notes
+	version := promptVersion(messages)
+	grounding := []string{}
+	if g.notes != nil {
+		chunks, err := g.notes.Retrieve(ctx, strings.Join([]string{g.genre.Name, spec.Kind, spec.Class}, " "))
+		if err != nil {
+			return Answer{}, err
+		}
+		for _, chunk := range chunks {
+			grounding = append(grounding, chunk.Source)
+		}
+		notes := api.Message{Role: "system", Content: notesInstructions(chunks)}
+		messages = slices.Insert(messages, len(messages)-1, notes)
+	}
+	answer, err := g.chatWithTools(ctx, DomainCharacter, messages, schema, options, toolbox)
+	answer.PromptVersion, answer.Grounding = version, grounding
+	return answer, err
+}
+
+// withAliases returns a copy of the character schema with the title and the aliases
+func withAliases(schema map[string]any) map[string]any {
+	properties := maps.Clone(schema["properties"].(map[string]any))
+	properties["title"] = map[string]any{"type": "string"}
+	properties["aliases"] = map[string]any{
+		"type":     "array",
+		"items":    map[string]any{"type": "string"},
+		"maxItems": 3,
+	}
+	return map[string]any{
+		"type":       "object",
+		"properties": properties,
+		"required":   append(slices.Clone(schema["required"].([]string)), "title", "aliases"),
+	}
+}
+
+// softenedOptions drops the most aggressive sampling options,
+// they are used to retry after an empty answer or a refusal
+func (g *Generator) softenedOptions(base map[string]interface{}) map[string]interface{} {
+	options := map[string]interface{}{}
+	for key, value := range base {
+		if key == "repeat_penalty" || key == "repeat_last_n" {
+			continue
+		}
+		options[key] = value
+	}
+	temperature, ok := options["temperature"].(float64)
+	if ok && temperature > 1.0 {
+		options["temperature"] = 1.0
+	}
+	return options
+}
+
+// chat sends the messages and returns the structured answer of the model,
+// the limits of the domain (num_predict and stop sequences) are added to the options
+func (g *Generator) chat(ctx context.Context, domain string, messages []api.Message, schema map[string]any, options map[string]interface{}) (Answer, error) {
+	return g.chatWithTools(ctx, domain, messages, schema, options, nil)
+}
+
+// chatWithTools answers the tool calls of the model until it gives its structured answer,
+// the last round is sent without the tools
+func (g *Generator) chatWithTools(ctx context.Context, domain string, messages []api.Message, schema map[string]any, options map[string]interface{}, toolbox *Toolbox) (Answer, error) {
+	limits := g.limits[domain]
+	messages = g.adapters.For(g.model).Apply(messages, schema)
+	builder, err := NewChatRequest(g.model).Messages(messages...).Options(withLimits(options, limits)).Format(schema)
+	if err != nil {
+		return Answer{}, err
+	}
+	if g.numCtx > 0 {
+		builder = builder.Option("num_ctx", g.numCtx)
+	}
+
+	answer := Answer{}
+	budget := tokenBudget(ctx)
+	for round := 0; ; round++ {
+		err = budget.Check()
+		if err != nil {
+			return answer, err
+		}
+		// every round sends a fresh request, the last one without the tools
+		tools := api.Tools(nil)
+		if toolbox != nil && round < maxToolRounds {
+			tools = toolbox.Tools
+		}
+		roundBuilder := builder.Tools(tools)
+		chars, numCtx := 0, 0
+		if g.contextSizer != nil {
+			chars = promptChars(roundBuilder.messages, tools)
+			numCtx = g.contextSizer.Size(domain, chars, limits.NumPredict)
+			roundBuilder = roundBuilder.Option("num_ctx", numCtx)
+		}
+		req := roundBuilder.Build()
+		message := api.Message{}
+		respFunc := func(resp api.ChatResponse) error {
+			message = resp.Message
+			answer.Content = resp.Message.Content
+			answer.Truncated = resp.DoneReason == "length"
+			budget.Record(resp.PromptEvalCount + resp.EvalCount)
+			if g.contextSizer != nil {
+				g.contextSizer.Measure(domain, chars, resp.PromptEvalCount, numCtx)
+			}
+			return nil
+		}
+		// Start the chat completion
+		err = g.backend.Do(ctx, g.retry, func() error {
+			return g.client.Chat(ctx, req, respFunc)
+		})
+		if err != nil {
+			return answer, err
+		}
+		if req.Tools == nil || len(message.ToolCalls) == 0 {
+			break
+		}
+		builder = builder.Messages(message)
+		for _, call := range message.ToolCalls {
+			answer.ToolCalls++
+			builder = builder.Messages(api.Message{Role: "tool", Content: toolbox.Call(call.Function)})
+		}
+	}
+	if answer.Truncated {
+		fmt.Printf("✂️ the %s answer was cut off by num_predict (%d)\n", domain, limits.NumPredict)
+	}
+	return answer, nil
+}
+
+// decodeAnswer decodes the JSON object of the answer (parse.Object strips the fences,
+// the prose, the smart quotes and the duplicate keys), the repairs are logged
+func decodeAnswer(content string, value any) error {
+	result, err := parse.Object(content)
+	if len(result.Repairs) > 0 {
+		fmt.Println("🩹 repaired:", strings.Join(result.Repairs, ", "))
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(result.JSON), value)
+}
+
+// ParseCharacter converts the JSON answer of the model to a Character,
+// an empty answer or a refusal is reported with ErrEmptyAnswer or ErrRefusal
+func ParseCharacter(jsonStr string) (Character, error) {
+	character := Character{}
+	err := classifyAnswer(jsonStr)
+	if err != nil {
+		return character, err
+	}
+	err = decodeAnswer(jsonStr, &character)
+	if errors.Is(err, model.ErrMissingField) {
+		return character, fmt.Errorf("%w (%w)", ErrEmptyAnswer, err)
+	}
+	if err != nil {
+		return character, err
+	}
+	err = classifyText(character.Name)
+	if err != nil {
+		return character, err
+	}
+	return character, nil
+}
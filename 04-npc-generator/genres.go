@@ -0,0 +1,276 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// GenreExtra is an additional text field of the characters of a genre (augmentations, starship...)
+type GenreExtra struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// Terms is the vocabulary of the exports
+type Terms struct {
+	Kind string `json:"kind"`
+}
+
+// Pack is the common format of the genre and theme packs (JSON files):
+// the system instructions and the extras of the schema
+type Pack struct {
+	Name         string       `json:"name"`
+	Title        string       `json:"title"`
+	Instructions string       `json:"instructions"`
+	Extras       []GenreExtra `json:"extras,omitempty"`
+}
+
+// Genre is a pack with the kinds and the export terms,
+// the pipeline is the same for every genre
+type Genre struct {
+	Pack
+	Kinds []KindDefinition `json:"kinds"`
+	Terms Terms            `json:"terms"`
+	// Theme is the name of the theme pack added to the genre (UseTheme)
+	Theme string `json:"-"`
+}
+
+var builtinGenres = []Genre{
+	{
+		Pack: Pack{
+			Name:         "fantasy",
+			Title:        "Medieval fantasy",
+			Instructions: systemInstructions,
+		},
+		Kinds: builtinKinds,
+		Terms: Terms{Kind: "Kind"},
+	},
+	{
+		Pack: Pack{
+			Name:  "scifi",
+			Title: "Space opera",
+			Instructions: `You are an expert NPC generator for science fiction games like Traveller or Stars Without Number.
+	You have freedom to be creative to get the best possible output.
+	`,
+			Extras: []GenreExtra{
+				{Name: "starship", Description: "name and class of the starship of the character"},
+				{Name: "rank", Description: "rank or job on board"},
+			},
+		},
+		Kinds: []KindDefinition{
+			{
+				Name: "Android", Plural: "Androids",
+				Rules:   []string{"Model designations mixed with a given name", "Use letters and digits (KX-7, Unit 42)", "Some androids pick a human name"},
+				Pattern: "[Given Name] or [Series Letters] + [-] + [Number]",
+				Culture: "Android names tell their manufacturer and their series",
+			},
+			{
+				Name: "Alien", Plural: "Aliens",
+				Rules:   []string{"Unusual sounds (x, q, z, clicks with ')", "Doubled vowels", "Avoid the earth names"},
+				Pattern: "[Guttural Syllable] + ['] + [Doubled Vowel] + [Consonant]",
+				Culture: "Alien names are often hard to pronounce for the humans",
+			},
+			{
+				Name: "Spacer", Plural: "Spacers",
+				Rules:   []string{"Earth names from every culture", "Short nicknames from the ship life", "Family names of colonies and stations"},
+				Pattern: "[Given Name] + [\"Nickname\"] + [Family Name]",
+				Culture: "Spacers born in the void often take the name of their ship",
+			},
+		},
+		Terms: Terms{Kind: "Species"},
+	},
+	{
+		Pack: Pack{
+			Name:  "cyberpunk",
+			Title: "Cyberpunk",
+			Instructions: `You are an expert NPC generator for cyberpunk games like Cyberpunk RED or Shadowrun.
+	You have freedom to be creative to get the best possible output.
+	`,
+			Extras: []GenreExtra{
+				{Name: "augmentations", Description: "cybernetic implants of the character"},
+				{Name: "affiliation", Description: "gang, corporation or crew of the character"},
+			},
+		},
+		Kinds: []KindDefinition{
+			{
+				Name: "Netrunner", Plural: "Netrunners",
+				Rules:   []string{"A real name and a handle", "Handles use leetspeak, tech and glitch words", "Short and catchy handles"},
+				Pattern: "[Given Name] + [\"Handle\"] + [Family Name]",
+				Culture: "Netrunners are only known by their handle on the Net",
+			},
+			{
+				Name: "Corpo", Plural: "Corpos",
+				Rules:   []string{"Polished full names", "Initials and titles", "Family names of the corporate dynasties"},
+				Pattern: "[Given Name] + [Initial] + [Family Name]",
+				Culture: "A corpo name is a brand",
+			},
+			{
+				Name: "Street Samurai", Plural: "Street Samurai",
+				Rules:   []string{"Street names about weapons and violence", "Mix of Japanese and English words", "One or two words"},
+				Pattern: "[Weapon or Animal] + [Street Word]",
+				Culture: "A street name is earned in a fight",
+			},
+		},
+		Terms: Terms{Kind: "Role"},
+	},
+	{
+		Pack: Pack{
+			Name:  "western",
+			Title: "Western",
+			Instructions: `You are an expert NPC generator for western games like Deadlands or Boot Hill.
+	You have freedom to be creative to get the best possible output.
+	`,
+			Extras: []GenreExtra{
+				{Name: "reputation", Description: "what the people of the town say about the character"},
+			},
+		},
+		Kinds: []KindDefinition{
+			{
+				Name: "Outlaw", Plural: "Outlaws",
+				Rules:   []string{"A nickname between the given name and the family name", "Nicknames about a weapon, a crime or a scar"},
+				Pattern: "[Given Name] + [\"Nickname\"] + [Family Name]",
+				Culture: "An outlaw name is on the wanted posters",
+			},
+			{
+				Name: "Lawman", Plural: "Lawmen",
+				Rules:   []string{"Plain biblical or Anglo-Saxon given names", "Short family names"},
+				Pattern: "[Biblical Name] + [Family Name]",
+				Culture: "A lawman is called by his title and his family name",
+			},
+			{
+				Name: "Homesteader", Plural: "Homesteaders",
+				Rules:   []string{"Names of the immigrants (Irish, German, Scandinavian, Mexican)", "Old-fashioned given names"},
+				Pattern: "[Old-fashioned Given Name] + [Immigrant Family Name]",
+				Culture: "Homesteader families keep the names of the old country",
+			},
+		},
+		Terms: Terms{Kind: "Role"},
+	},
+}
+
+// LoadGenres returns the built-in genres and the custom ones, every JSON file of the directories
+// (the installed packs, then GENRES_DIR) registers a genre (or replaces a genre registered before)
+func LoadGenres(dirs ...string) (map[string]Genre, error) {
+	genres := map[string]Genre{}
+	for _, genre := range builtinGenres {
+		genres[genre.Name] = genre
+	}
+
+	err := readPacks(dirs, func(path string, data []byte) error {
+		genre := Genre{}
+		err := decodePack(path, data, &genre, &genre.Pack)
+		if err != nil {
+			return err
+		}
+		if len(genre.Kinds) == 0 {
+			return fmt.Errorf("%s: the genre has no kind", path)
+		}
+		for _, kind := range genre.Kinds {
+			err = checkFamilyCustom(kind.Family)
+			if err == nil && kind.Script != nil {
+				err = kind.Script.check()
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %s: %w", path, kind.Name, err)
+			}
+		}
+		if genre.Instructions == "" {
+			genre.Instructions = systemInstructions
+		}
+		if genre.Terms.Kind == "" {
+			genre.Terms.Kind = "Kind"
+		}
+		genres[genre.Name] = genre
+		return nil
+	})
+	return genres, err
+}
+
+// readPacks calls read with every JSON file of the pack directories ("" is skipped)
+func readPacks(dirs []string, read func(path string, data []byte) error) error {
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+		if err != nil {
+			return err
+		}
+		for _, path := range paths {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			err = read(path, data)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// decodePack decodes a pack file into value, the pack is named after the file by default
+func decodePack(path string, data []byte, value any, pack *Pack) error {
+	err := json.Unmarshal(data, value)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if pack.Name == "" {
+		pack.Name = strings.TrimSuffix(filepath.Base(path), ".json")
+	}
+	for _, extra := range pack.Extras {
+		if extra.Name == "" {
+			return fmt.Errorf("%s: an extra has no name", path)
+		}
+	}
+	return nil
+}
+
+// FindGenre returns the genre by name
+func FindGenre(genres map[string]Genre, name string) (Genre, error) {
+	genre, ok := genres[name]
+	if !ok {
+		return genre, fmt.Errorf("unknown genre %q (%s)", name, strings.Join(slices.Sorted(maps.Keys(genres)), ", "))
+	}
+	return genre, nil
+}
+
+// WithExtras returns a copy of the character schema with the extras of the pack
+func (g Pack) WithExtras(schema map[string]any) map[string]any {
+	if len(g.Extras) == 0 {
+		return schema
+	}
+	extraProperties := map[string]any{}
+	extraNames := []string{}
+	for _, extra := range g.Extras {
+		extraProperties[extra.Name] = map[string]any{
+			"type":        "string",
+			"description": extra.Description,
+		}
+		extraNames = append(extraNames, extra.Name)
+	}
+
+	properties := maps.Clone(schema["properties"].(map[string]any))
+	properties["extras"] = map[string]any{
+		"type":       "object",
+		"properties": extraProperties,
+		"required":   extraNames,
+	}
+	return map[string]any{
+		"type":       "object",
+		"properties": properties,
+		"required":   append(slices.Clone(schema["required"].([]string)), "extras"),
+	}
+}
+
+// UseGenre switches the instructions and the kinds of the generator
+func (g *Generator) UseGenre(genre Genre) {
+	g.genre = genre
+	g.kinds = genre.Kinds
+}
@@ -0,0 +1,8 @@
+module 04-npc-generator
+
+go 1.23.4
+
+require (
+	github.com/ollama/ollama v0.5.7
+	gopkg.in/yaml.v3 v3.0.1
+)
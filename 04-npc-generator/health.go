@@ -0,0 +1,66 @@
+//go:build !minimal
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+// handleHealthz is the liveness probe: the process answers
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleReadyz is the readiness probe: Ollama answers and the model is available
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+
+	// the read-only mode doesn't need Ollama
+	if s.readOnly {
+		writeJSON(w, http.StatusOK, map[string]string{"storage": "ok"})
+		return
+	}
+	checks := map[string]string{"ollama": "ok", "model": "ok"}
+	status := http.StatusOK
+
+	// the circuit is open: the heartbeat already knows
+	backend := s.generator.backend.Status()
+	if !backend.Up {
+		checks["ollama"] = fmt.Sprintf("down since %s: %s", backend.DownSince.Format(time.RFC3339), backend.LastError)
+		checks["model"] = "unknown"
+		w.Header().Set("Retry-After", s.generator.backend.retryAfter())
+		writeJSON(w, http.StatusServiceUnavailable, checks)
+		return
+	}
+
+	// with several hosts, one host up is enough
+	if s.generator.balancer != nil {
+		hosts := s.generator.balancer.Status()
+		up := slices.ContainsFunc(hosts, func(host HostStatus) bool { return host.Up })
+		if !up {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]any{"ollama": "every host is down", "hosts": hosts})
+			return
+		}
+	}
+
+	err := s.generator.client.Heartbeat(ctx)
+	if err != nil {
+		checks["ollama"] = err.Error()
+		checks["model"] = "unknown"
+		writeJSON(w, http.StatusServiceUnavailable, checks)
+		return
+	}
+	_, err = s.generator.client.Show(ctx, &api.ShowRequest{Model: s.generator.model})
+	if err != nil {
+		checks["model"] = err.Error()
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, checks)
+}
@@ -0,0 +1,130 @@
+//go:build !minimal
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Colors of the Discord embeds per event
+var discordColors = map[string]int{
+	HookGenerated: 0x2ecc71,
+	HookRejected:  0xe74c3c,
+	HookRetry:     0xf1c40f,
+}
+
+// DiscordHook is the example hook: it posts the events to a Discord channel
+// through its webhook (DISCORD_WEBHOOK_URL), the posts are best effort
+type DiscordHook struct {
+	url    string
+	events []string
+	client *http.Client
+}
+
+func NewDiscordHook(webhookURL string, events []string, transport http.RoundTripper) (*DiscordHook, error) {
+	if !strings.HasPrefix(webhookURL, "https://") && !strings.HasPrefix(webhookURL, "http://") {
+		return nil, fmt.Errorf("invalid Discord webhook %q", webhookURL)
+	}
+	return &DiscordHook{url: webhookURL, events: events, client: &http.Client{Timeout: 10 * time.Second, Transport: transport}}, nil
+}
+
+func (d *DiscordHook) OnGenerated(ctx context.Context, event HookEvent) {
+	d.post(ctx, event)
+}
+
+func (d *DiscordHook) OnRejected(ctx context.Context, event HookEvent) {
+	d.post(ctx, event)
+}
+
+func (d *DiscordHook) OnRetry(ctx context.Context, event HookEvent) {
+	d.post(ctx, event)
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+type discordEmbed struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description,omitempty"`
+	Color       int            `json:"color"`
+	Fields      []discordField `json:"fields,omitempty"`
+	Timestamp   string         `json:"timestamp"`
+}
+
+// newDiscordEmbed renders the event: the character with its kind, class and title,
+// or the reason of the rejection
+func newDiscordEmbed(event HookEvent) discordEmbed {
+	embed := discordEmbed{
+		Title:     fmt.Sprintf("%s %s (slot %d)", event.Event, event.Kind, event.Slot+1),
+		Color:     discordColors[event.Event],
+		Timestamp: event.At.Format(time.RFC3339),
+	}
+	if event.Character != nil {
+		embed = characterEmbed(*event.Character, embed.Color, event.At)
+	}
+	if event.Reason != "" {
+		embed.Fields = append(embed.Fields, discordField{Name: "Reason", Value: event.Reason})
+	}
+	embed.Fields = append(embed.Fields, discordField{Name: "Attempts", Value: fmt.Sprint(event.Attempt), Inline: true})
+	return embed
+}
+
+// characterEmbed renders a character with its kind, class and backstory
+func characterEmbed(character Character, color int, at time.Time) discordEmbed {
+	embed := discordEmbed{
+		Title:       character.DisplayName(),
+		Description: character.Backstory,
+		Color:       color,
+		Fields:      []discordField{{Name: "Kind", Value: character.Kind, Inline: true}},
+		Timestamp:   at.Format(time.RFC3339),
+	}
+	if character.Class != "" {
+		embed.Fields = append(embed.Fields, discordField{Name: "Class", Value: fmt.Sprintf("%s %d", character.Class, character.Level), Inline: true})
+	}
+	return embed
+}
+
+func (d *DiscordHook) post(ctx context.Context, event HookEvent) {
+	if !slices.Contains(d.events, event.Event) {
+		return
+	}
+	payload, err := json.Marshal(map[string]any{"embeds": []discordEmbed{newDiscordEmbed(event)}})
+	if err != nil {
+		fmt.Println("😡 discord:", err)
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.url, bytes.NewReader(payload))
+	if err != nil {
+		fmt.Println("😡 discord:", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := d.client.Do(req)
+	if err != nil {
+		// the error of the client repeats the URL, the token of the webhook is its last part
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		fmt.Println("😡 discord webhook:", err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		fmt.Printf("😡 discord: %s: %s\n", resp.Status, strings.TrimSpace(string(message)))
+	}
+}
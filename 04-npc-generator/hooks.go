@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Events of the hooks
+const (
+	HookGenerated = "generated"
+	HookRejected  = "rejected"
+	HookRetry     = "retry"
+)
+
+// HookEvent is a lifecycle event of a slot of a run
+type HookEvent struct {
+	Event string `json:"event"`
+	Kind  string `json:"kind"`
+	Slot  int    `json:"slot"`
+	// Attempt is the number of attempts of the slot so far
+	Attempt int `json:"attempt"`
+	// Character is the accepted character (generated), or the rejected candidate when it was parsed
+	Character *Character `json:"character,omitempty"`
+	// Reason is the reason of the rejection or of the retry
+	Reason string    `json:"reason,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+// Hook reacts to the lifecycle events of the runs (log, persist, notify...) without changing them:
+// OnGenerated gets a filled slot (before it is stored), OnRejected a slot without a character
+// after all its attempts, OnRetry a failed attempt of a slot attempted again.
+// The workers of a parallel run call the hooks at the same time.
+type Hook interface {
+	OnGenerated(ctx context.Context, event HookEvent)
+	OnRejected(ctx context.Context, event HookEvent)
+	OnRetry(ctx context.Context, event HookEvent)
+}
+
+// HookFuncs is a Hook of functions, the nil ones are skipped
+type HookFuncs struct {
+	Generated func(ctx context.Context, event HookEvent)
+	Rejected  func(ctx context.Context, event HookEvent)
+	Retry     func(ctx context.Context, event HookEvent)
+}
+
+func (h HookFuncs) OnGenerated(ctx context.Context, event HookEvent) {
+	if h.Generated != nil {
+		h.Generated(ctx, event)
+	}
+}
+
+func (h HookFuncs) OnRejected(ctx context.Context, event HookEvent) {
+	if h.Rejected != nil {
+		h.Rejected(ctx, event)
+	}
+}
+
+func (h HookFuncs) OnRetry(ctx context.Context, event HookEvent) {
+	if h.Retry != nil {
+		h.Retry(ctx, event)
+	}
+}
+
+// AddHook registers a hook, the hooks are called in the order they are added
+func (g *Generator) AddHook(hook Hook) {
+	g.hooks = append(slices.Clip(g.hooks), hook)
+}
+
+// ParseHookEvents reads a comma-separated list of events ("": generated only)
+func ParseHookEvents(value string) ([]string, error) {
+	if value == "" {
+		return []string{HookGenerated}, nil
+	}
+	events := []string{}
+	for _, event := range strings.Split(value, ",") {
+		event = strings.TrimSpace(event)
+		if !slices.Contains([]string{HookGenerated, HookRejected, HookRetry}, event) {
+			return nil, fmt.Errorf("unknown hook event %q (generated, rejected, retry)", event)
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// emit calls the hooks of the generator with the event of the slot
+func (r *Run) emit(ctx context.Context, event string, slot Slot, attempt int) {
+	if len(r.generator.hooks) == 0 {
+		return
+	}
+	hookEvent := HookEvent{Event: event, Kind: r.spec.Kind, Slot: slot.Index, Attempt: attempt, Character: slot.Character, Reason: slot.Reason, At: time.Now()}
+	for _, hook := range r.generator.hooks {
+		switch event {
+		case HookGenerated:
+			hook.OnGenerated(ctx, hookEvent)
+		case HookRejected:
+			hook.OnRejected(ctx, hookEvent)
+		case HookRetry:
+			hook.OnRetry(ctx, hookEvent)
+		}
+	}
+}
+
+// retrying emits the retry of the slot after its last failed attempt, when it has attempts left
+func (r *Run) retrying(ctx context.Context, state *slotAttempts) {
+	if state.tries < r.attempts {
+		r.emit(ctx, HookRetry, state.last, state.tries)
+	}
+}
+
+// emitDone emits the final event of a slot: generated or rejected
+func (r *Run) emitDone(ctx context.Context, slot Slot, attempt int) {
+	if slot.Status == SlotOK {
+		r.emit(ctx, HookGenerated, slot, attempt)
+	} else {
+		r.emit(ctx, HookRejected, slot, attempt)
+	}
+}
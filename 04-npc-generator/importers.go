@@ -0,0 +1,415 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Import formats of store import (auto: by the extension of the file)
+const (
+	ImportAuto     = "auto"
+	ImportMarkdown = "md"
+	ImportCSV      = "csv"
+	ImportJSON     = "json"
+)
+
+// Importer reads the Markdown, CSV and JSON exports (and the tables of the old script) back into characters,
+// the columns are matched by name and the unreadable rows are reported as warnings
+type Importer struct {
+	// Genres give the kind terms (Species, Role) and the extras of the columns
+	Genres []Genre
+	// Kind is the kind of the rows without one
+	Kind string
+}
+
+// importFormat returns the format of the file from its extension
+func importFormat(path, format string) (string, error) {
+	if format != ImportAuto && format != "" {
+		if format != ImportMarkdown && format != ImportCSV && format != ImportJSON {
+			return "", fmt.Errorf("unknown import format %q (%s, %s, %s)", format, ImportMarkdown, ImportCSV, ImportJSON)
+		}
+		return format, nil
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".md", ".markdown":
+		return ImportMarkdown, nil
+	case ".csv":
+		return ImportCSV, nil
+	case ".json", ".jsonl":
+		return ImportJSON, nil
+	}
+	return "", fmt.Errorf("%s: unknown format, use --format", path)
+}
+
+// ReadFile returns the characters of an export and the warnings of the skipped rows and columns
+func (i Importer) ReadFile(path, format string) ([]Character, []string, error) {
+	format, err := importFormat(path, format)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	records, warnings := []importRecord{}, []string{}
+	switch format {
+	case ImportMarkdown:
+		records, warnings = i.parseMarkdown(data)
+	case ImportCSV:
+		records, warnings, err = i.parseCSV(data)
+	case ImportJSON:
+		records, warnings, err = parseJSONRecords(data)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	characters := []Character{}
+	for idx, warning := range warnings {
+		warnings[idx] = path + ":" + warning
+	}
+	for _, record := range records {
+		character, err := i.character(record.fields)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("%s:%d: row skipped: %v", path, record.line, err))
+			continue
+		}
+		characters = append(characters, character)
+	}
+	return characters, warnings, nil
+}
+
+// importRecord is a row of an export with the line it starts at
+type importRecord struct {
+	line   int
+	fields map[string]any
+}
+
+// character decodes the fields like a stored character (normalized, the name and the kind are required)
+func (i Importer) character(fields map[string]any) (Character, error) {
+	if kind, _ := fields["kind"].(string); strings.TrimSpace(kind) == "" && i.Kind != "" {
+		fields["kind"] = i.Kind
+	}
+	character := Character{}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return character, err
+	}
+	err = json.Unmarshal(data, &character)
+	return character, err
+}
+
+// column returns the field of a column of the tables: a field of the character, extras:<name>,
+// provenance:<field> or "" for an unknown column; the headers are matched without the case ("Plot hooks" is plot_hooks)
+func (i Importer) column(header string) string {
+	key := strings.ToLower(strings.Join(strings.Fields(header), "_"))
+	switch key {
+	case "index", "id", "grade":
+		return "-"
+	case "", "kind", "race", "species":
+		return "kind"
+	case "code", "name", "ascii_name", "native_name", "title", "aliases", "class", "level", "tags", "notes", "backstory":
+		return key
+	case "model", "model_digest", "prompt_version", "seed", "generated_at":
+		return "provenance:" + key
+	}
+	if _, ok := storyTable(key); ok {
+		return key
+	}
+	for _, genre := range i.Genres {
+		if strings.EqualFold(genre.Terms.Kind, header) {
+			return "kind"
+		}
+		for _, extra := range genre.Extras {
+			if strings.EqualFold(extra.Name, strings.TrimSpace(header)) {
+				return "extras:" + extra.Name
+			}
+		}
+	}
+	return ""
+}
+
+// record converts the cells of a table row to the fields of a character
+func (i Importer) record(columns []string, cells []string) map[string]any {
+	fields := map[string]any{}
+	extras, provenance := map[string]string{}, map[string]any{}
+	for idx, column := range columns {
+		if idx >= len(cells) || column == "" || column == "-" {
+			continue
+		}
+		cell := strings.TrimSpace(cells[idx])
+		if cell == "" {
+			continue
+		}
+		if name, found := strings.CutPrefix(column, "extras:"); found {
+			extras[name] = cell
+			continue
+		}
+		if name, found := strings.CutPrefix(column, "provenance:"); found {
+			provenance[name] = cell
+			continue
+		}
+		_, table := storyTable(column)
+		switch {
+		case column == "aliases" || table:
+			fields[column] = strings.Split(cell, ";")
+		case column == "tags":
+			fields[column] = strings.Fields(cell)
+		case column == "level":
+			// a level that is not a number is dropped
+			if level, err := strconv.Atoi(cell); err == nil {
+				fields[column] = level
+			}
+		default:
+			fields[column] = cell
+		}
+	}
+	if len(extras) > 0 {
+		fields["extras"] = extras
+	}
+	// the provenance is kept when the model is known, the seed and the time are optional
+	if provenance["model"] != nil {
+		if seed, err := strconv.Atoi(fmt.Sprint(provenance["seed"])); err == nil {
+			provenance["seed"] = seed
+		} else {
+			delete(provenance, "seed")
+		}
+		if _, ok := provenance["generated_at"]; !ok {
+			provenance["generated_at"] = "0001-01-01T00:00:00Z"
+		}
+		fields["provenance"] = provenance
+	}
+	return fields
+}
+
+// tableColumns maps the header of a table, the unknown columns are reported
+func (i Importer) tableColumns(header []string, line int) ([]string, []string) {
+	columns, warnings := []string{}, []string{}
+	for _, cell := range header {
+		column := i.column(cell)
+		if column == "" {
+			warnings = append(warnings, fmt.Sprintf("%d: column %q ignored", line, cell))
+		}
+		columns = append(columns, column)
+	}
+	return columns, warnings
+}
+
+var (
+	tableSeparator = regexp.MustCompile(`^\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?$`)
+	detailsSection = regexp.MustCompile(`(?s)<details>\s*<summary>(.*?)</summary>(.*?)</details>`)
+	quotedAlias    = regexp.MustCompile(`,\s*("(?:[^"\\]|\\.)*")`)
+	nativeName     = regexp.MustCompile(`^(.+?)\s+\((.+?)\)(.*)$`)
+)
+
+// markdownUnescaper reverses escapeCell: the escaped characters, the entities and the <br> line breaks
+var markdownUnescaper = strings.NewReplacer(
+	"&amp;", "&", "&lt;", "<", "&gt;", ">", "<br>", "\n", "<br/>", "\n",
+	`\\`, `\`, "\\`", "`", `\*`, `*`, `\_`, `_`, `\[`, `[`, `\]`, `]`, `\|`, `|`,
+)
+
+// splitCells splits a table row on the pipes that are not escaped
+func splitCells(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+	cells, cell := []string{}, strings.Builder{}
+	escaped := false
+	for _, r := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '|':
+			cells = append(cells, cell.String())
+			cell.Reset()
+			continue
+		}
+		cell.WriteRune(r)
+	}
+	return append(cells, cell.String())
+}
+
+// splitDisplayName reads the title line of an export: the quoted aliases and the native name in parentheses
+// are split off (Thorgar (Торгар) the Unbent, "Old Hammer"), a title without a native name stays in the name
+func splitDisplayName(fields map[string]any, display string) {
+	aliases := []string{}
+	for _, match := range quotedAlias.FindAllStringSubmatch(display, -1) {
+		if alias, err := strconv.Unquote(match[1]); err == nil {
+			aliases = append(aliases, alias)
+		}
+	}
+	name := quotedAlias.ReplaceAllString(display, "")
+	if match := nativeName.FindStringSubmatch(name); match != nil {
+		name = match[1]
+		fields["native_name"] = match[2]
+		if title := strings.TrimSpace(match[3]); title != "" {
+			fields["title"] = title
+		}
+	}
+	fields["name"] = name
+	if len(aliases) > 0 {
+		fields["aliases"] = aliases
+	}
+}
+
+// parseMarkdown reads the GFM tables of a Markdown export (every table with a Name column)
+// and the backstories of the <details> sections
+func (i Importer) parseMarkdown(data []byte) ([]importRecord, []string) {
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	backstories := map[string]string{}
+	for _, match := range detailsSection.FindAllStringSubmatch(text, -1) {
+		paragraphs := []string{}
+		for _, paragraph := range strings.Split(match[2], "\n\n") {
+			if paragraph = strings.TrimSpace(paragraph); paragraph != "" {
+				paragraphs = append(paragraphs, markdownUnescaper.Replace(paragraph))
+			}
+		}
+		backstories[markdownUnescaper.Replace(strings.TrimSpace(match[1]))] = strings.Join(paragraphs, "\n\n")
+	}
+
+	records, warnings := []importRecord{}, []string{}
+	lines := strings.Split(text, "\n")
+	for idx := 0; idx+1 < len(lines); idx++ {
+		if !strings.HasPrefix(strings.TrimSpace(lines[idx]), "|") || !tableSeparator.MatchString(strings.TrimSpace(lines[idx+1])) {
+			continue
+		}
+		header := splitCells(lines[idx])
+		for cell := range header {
+			header[cell] = markdownUnescaper.Replace(strings.TrimSpace(header[cell]))
+		}
+		columns, columnWarnings := i.tableColumns(header, idx+1)
+		if !slices.Contains(columns, "name") {
+			// another table (a report, the provenance of a run)
+			idx++
+			continue
+		}
+		warnings = append(warnings, columnWarnings...)
+
+		idx += 2
+		for ; idx < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[idx]), "|"); idx++ {
+			cells := splitCells(lines[idx])
+			for cell := range cells {
+				cells[cell] = markdownUnescaper.Replace(strings.TrimSpace(cells[cell]))
+			}
+			fields := i.record(columns, cells)
+			if display, ok := fields["name"].(string); ok {
+				splitDisplayName(fields, display)
+				if backstory, ok := backstories[display]; ok && fields["backstory"] == nil {
+					fields["backstory"] = backstory
+				}
+			}
+			records = append(records, importRecord{line: idx + 1, fields: fields})
+		}
+	}
+	if len(records) == 0 {
+		warnings = append(warnings, "1: no table with a Name column")
+	}
+	return records, warnings
+}
+
+// parseCSV reads a CSV export (the rows may have missing cells)
+func (i Importer) parseCSV(data []byte) ([]importRecord, []string, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\ufeff"))))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, err
+	}
+	columns, warnings := i.tableColumns(header, 1)
+	if !slices.Contains(columns, "name") {
+		return nil, nil, errors.New("no name column")
+	}
+
+	records := []importRecord{}
+	for {
+		cells, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		line, _ := reader.FieldPos(0)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("%d: row skipped: %v", line, err))
+			continue
+		}
+		records = append(records, importRecord{line: line, fields: i.record(columns, cells)})
+	}
+	return records, warnings, nil
+}
+
+// parseJSONRecords reads the JSON exports: an array of characters, a registry ({"characters": [...]}),
+// the output of a run ({"slots": [{"character": ...}]}), one character, or JSON Lines
+func parseJSONRecords(data []byte) ([]importRecord, []string, error) {
+	document := any(nil)
+	if json.Unmarshal(data, &document) != nil {
+		return parseJSONLines(data)
+	}
+
+	values := []any{}
+	switch document := document.(type) {
+	case []any:
+		values = document
+	case map[string]any:
+		switch {
+		case document["characters"] != nil:
+			values, _ = document["characters"].([]any)
+		case document["slots"] != nil:
+			slots, _ := document["slots"].([]any)
+			for _, slot := range slots {
+				slot, _ := slot.(map[string]any)
+				if slot["status"] == SlotOK && slot["character"] != nil {
+					values = append(values, slot["character"])
+				}
+			}
+		default:
+			values = []any{document}
+		}
+	}
+
+	records, warnings := []importRecord{}, []string{}
+	for idx, value := range values {
+		fields, ok := value.(map[string]any)
+		if !ok {
+			warnings = append(warnings, fmt.Sprintf("1: character %d skipped: not an object", idx+1))
+			continue
+		}
+		records = append(records, importRecord{line: 1, fields: fields})
+	}
+	return records, warnings, nil
+}
+
+// parseJSONLines reads a character per line, the broken lines are reported
+func parseJSONLines(data []byte) ([]importRecord, []string, error) {
+	records, warnings := []importRecord{}, []string{}
+	for idx, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		fields := map[string]any{}
+		err := json.Unmarshal([]byte(line), &fields)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("%d: line skipped: %v", idx+1, err))
+			continue
+		}
+		records = append(records, importRecord{line: idx + 1, fields: fields})
+	}
+	if len(records) == 0 {
+		return nil, nil, errors.New("not a JSON export")
+	}
+	return records, warnings, nil
+}
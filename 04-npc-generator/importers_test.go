@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// imported is the part of a character an export carries back
+type imported struct {
+	Name, Title, Kind, Notes, Backstory string
+	Aliases, Tags                       []string
+}
+
+func TestImportExports(t *testing.T) {
+	genre := builtinGenres[0]
+	characters := []Character{
+		{Code: "THO", Name: "Thorin | Oakenshield", Title: "the Unbent", Aliases: []string{`Old "Hammer"`, "Pipe|Smoker"}, Kind: "Dwarf",
+			Tags: []string{"villain", "a|b"}, Notes: `owes 5 gold, "maybe" more`, Backstory: "Born under the mountain | raised, with his kin"},
+		{Code: "ELR", Name: `Elrond "Half-Elven", the Wise`, Kind: "Elf", Notes: "line one\nline two, with a comma", Backstory: `a \ backslash`},
+		{Code: "BIL", Name: "Bilbo, Baggins", Kind: "Human"},
+	}
+	full := func(character Character) imported {
+		return imported{Name: character.Name, Title: character.Title, Kind: character.Kind, Notes: character.Notes,
+			Backstory: character.Backstory, Aliases: character.Aliases, Tags: character.Tags}
+	}
+	// the title line has no native name, the title stays in the name; the tables have no notes
+	markdown := func(character Character) imported {
+		fields := full(character)
+		fields.Name, fields.Title, fields.Notes = strings.TrimSpace(character.Name+" "+character.Title), "", ""
+		return fields
+	}
+	for _, testCase := range []struct {
+		file   string
+		export func() (string, error)
+		fields func(character Character) imported
+	}{
+		{"characters.md", func() (string, error) {
+			return MarkdownTable(characters, genre, MarkdownOptions{}), nil
+		}, markdown},
+		{"details.md", func() (string, error) {
+			// the backstories in <details> sections
+			return MarkdownTable(characters, genre, MarkdownOptions{Details: true}), nil
+		}, markdown},
+		{"characters.csv", func() (string, error) {
+			return CSVTable(characters, genre)
+		}, func(character Character) imported {
+			// no backstory column
+			fields := full(character)
+			fields.Backstory = ""
+			return fields
+		}},
+		{"characters.json", func() (string, error) {
+			slots := []Slot{}
+			for idx := range characters {
+				slots = append(slots, Slot{Index: idx, Status: SlotOK, Character: &characters[idx]})
+			}
+			data, err := json.MarshalIndent(RunOutput{Campaign: DefaultCampaign, Slots: slots}, "", "  ")
+			return string(data), err
+		}, full},
+	} {
+		exported, err := testCase.export()
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(t.TempDir(), testCase.file)
+		err = os.WriteFile(path, []byte(exported), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, warnings, err := Importer{Genres: []Genre{genre}}.ReadFile(path, ImportAuto)
+		if err != nil {
+			t.Fatalf("%s: %v", testCase.file, err)
+		}
+		if len(warnings) > 0 {
+			t.Errorf("%s: warnings %v", testCase.file, warnings)
+		}
+		if len(got) != len(characters) {
+			t.Fatalf("%s: %d characters, want %d\n%s", testCase.file, len(got), len(characters), exported)
+		}
+		for idx, character := range characters {
+			want, have := testCase.fields(character), full(got[idx])
+			if want.Name != have.Name || want.Title != have.Title || want.Kind != have.Kind || want.Notes != have.Notes ||
+				want.Backstory != have.Backstory || !slices.Equal(want.Aliases, have.Aliases) || !slices.Equal(want.Tags, have.Tags) {
+				t.Errorf("%s: imported %+v, want %+v", testCase.file, have, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"flag"
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+// ImproveCandidates returns the graded characters below the threshold, the worst first
+// (the oldest first for the same score), at most limit of them (0: no limit)
+func ImproveCandidates(characters []Character, threshold float64, limit int) []Character {
+	candidates := []Character{}
+	for _, character := range characters {
+		if character.Grade != nil && character.Grade.Score < threshold && !character.Archived() {
+			candidates = append(candidates, character)
+		}
+	}
+	slices.SortStableFunc(candidates, func(a, b Character) int {
+		return cmp.Compare(a.Grade.Score, b.Grade.Score)
+	})
+	if limit > 0 && len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+	return candidates
+}
+
+// Improve rerolls the character with the next variations and grades them with the rubric of the characters,
+// the best variation is returned when it beats the grade of the character (false otherwise)
+func (g *Generator) Improve(ctx context.Context, registry *Registry, character Character, attempts int) (Character, bool, error) {
+	// the variations are graded here, the review of the pipeline would filter them
+	improver := *g
+	improver.review = false
+	spec := Spec{Kind: character.Kind, Parents: character.Parents}
+
+	best, improved := character, false
+	for attempt := 1; attempt <= attempts; attempt++ {
+		variation := character.Provenance.Variation + attempt
+		variant, err := improver.Reroll(ctx, registry.Deduper(), character, variation)
+		if err != nil {
+			if ctx.Err() != nil {
+				return character, false, err
+			}
+			fmt.Println("😡:", err)
+			continue
+		}
+		grade, err := g.Review(ctx, spec, variant)
+		if err != nil {
+			return character, false, err
+		}
+		variant.Grade = &grade
+		fmt.Printf("🎲 %s variation %d: %.2f\n", variant.Name, variation, grade.Score)
+		if grade.Score > best.Grade.Score {
+			best, improved = variant, true
+		}
+	}
+	return best, improved, nil
+}
+
+// runImprove regenerates the stored characters graded below the threshold, the worst first:
+// improve --limit 10 --threshold 0.6 (--grade-missing grades the characters without a grade before)
+func (a *App) runImprove(ctx context.Context, args []string) error {
+	limit, err := strconv.Atoi(getEnv("IMPROVE_LIMIT", "10"))
+	if err != nil {
+		return err
+	}
+	flags := flag.NewFlagSet("improve", flag.ExitOnError)
+	campaign := flags.String("campaign", getEnv("CAMPAIGN", DefaultCampaign), "campaign of the characters")
+	threshold := flags.Float64("threshold", a.generator.Rubric(RubricCharacter).Threshold, "score below which a character is regenerated (default: the threshold of the rubric)")
+	flags.IntVar(&limit, "limit", limit, "most characters regenerated by the run, the worst first (0: no limit)")
+	attempts := flags.Int("attempts", 3, "variations tried per character")
+	gradeMissing := flags.Bool("grade-missing", false, "grade the characters without a grade first")
+	review := flags.Bool("review", false, "review the changes of every improved character instead of storing them")
+	dryRun := flags.Bool("dry-run", false, "only list the characters that would be regenerated")
+	flags.Parse(args)
+
+	registry, err := a.storage.Registry(*campaign)
+	if err != nil {
+		return err
+	}
+	if *gradeMissing {
+		for _, character := range registry.List() {
+			if character.Grade != nil || character.Archived() {
+				continue
+			}
+			grade, err := a.generator.Review(ctx, Spec{Kind: character.Kind, Parents: character.Parents}, character)
+			if err != nil {
+				return err
+			}
+			_, err = registry.Modify(character.ID, func(stored *Character) { stored.Grade = &grade })
+			if err != nil {
+				return err
+			}
+			fmt.Printf("⚖️ %s %.2f\n", character.Name, grade.Score)
+		}
+	}
+
+	candidates := ImproveCandidates(registry.List(), *threshold, limit)
+	improved, kept, skipped := 0, 0, 0
+	for _, character := range candidates {
+		if *dryRun {
+			fmt.Printf("📉 %d %s %.2f\n", character.ID, character.Name, character.Grade.Score)
+			continue
+		}
+		if character.Provenance == nil {
+			fmt.Printf("⏭️ %s has no provenance, it can't be regenerated\n", character.Name)
+			skipped++
+			continue
+		}
+		best, better, err := a.generator.Improve(ctx, registry, character, max(*attempts, 1))
+		if err != nil {
+			return err
+		}
+		if !better {
+			fmt.Printf("➖ %s kept (%.2f)\n", character.Name, character.Grade.Score)
+			kept++
+			continue
+		}
+		stored, err := a.reviewUpdate(registry, *campaign, "improve", character, best, !*review)
+		if err != nil {
+			return err
+		}
+		if stored.Grade != nil && stored.Grade.Score > character.Grade.Score {
+			fmt.Printf("📈 %s %.2f → %s %.2f\n", character.Name, character.Grade.Score, stored.Name, stored.Grade.Score)
+			improved++
+		}
+	}
+	if *dryRun {
+		fmt.Printf("📉 %d characters below %.2f\n", len(candidates), *threshold)
+		return nil
+	}
+	fmt.Printf("✨ %d improved, %d kept, %d without provenance (%d below %.2f)\n", improved, kept, skipped, len(candidates), *threshold)
+	return nil
+}
@@ -0,0 +1,484 @@
+//go:build !minimal
+
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// Job is a large generation processed in the background
+type Job struct {
+	ID         string     `json:"id"`
+	Campaign   string     `json:"campaign"`
+	Spec       Spec       `json:"spec"`
+	Status     string     `json:"status"`
+	Done       int        `json:"done"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Slots      []Slot     `json:"-"`
+	Metrics    RunMetrics `json:"-"`
+	// Stored is the number of slots stored in the registry, the others are stored when the job resumes
+	Stored int `json:"-"`
+}
+
+// jobRecord is the file of a job, the slots are in its checkpoint log
+// (the files written before the log have the slots, they are still read)
+type jobRecord struct {
+	Job
+	Slots   []Slot      `json:"slots,omitempty"`
+	Metrics *RunMetrics `json:"metrics,omitempty"`
+	Stored  int         `json:"stored,omitempty"`
+}
+
+// slotEntry is a line of the checkpoint log of a job: a generated slot with the metrics
+// of the job, or a stored slot (with the ID or the pending ID of its character)
+type slotEntry struct {
+	Index   int         `json:"index"`
+	Slot    Slot        `json:"slot"`
+	Stored  bool        `json:"stored,omitempty"`
+	Metrics *RunMetrics `json:"metrics,omitempty"`
+}
+
+// JobQueue runs the jobs with a pool of workers, every job is persisted in <dir>/<id>.json
+// when its status changes and its slots are appended to <dir>/<id>.slots.jsonl
+type JobQueue struct {
+	generator *Generator
+	storage   *Storage
+	dir       string
+	mutex     sync.Mutex
+	jobs      map[string]*Job
+	queue     chan *Job
+	// resumed are the jobs of Load which didn't fit in the queue, Start feeds them as it drains
+	resumed []*Job
+	// approval submits the characters to the approval queue (serve --approval)
+	approval bool
+}
+
+func NewJobQueue(generator *Generator, storage *Storage, dir string) *JobQueue {
+	return &JobQueue{
+		generator: generator,
+		storage:   storage,
+		dir:       dir,
+		jobs:      map[string]*Job{},
+		queue:     make(chan *Job, 1000),
+	}
+}
+
+// Load reads the persisted jobs (to call before Start): the queued jobs are queued again
+// and the jobs interrupted by a restart resume after their last generated slot,
+// in the order of their creation (beyond the size of the queue, they wait for Start)
+func (q *JobQueue) Load() error {
+	entries, err := os.ReadDir(q.dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	resumed := []*Job{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(q.dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+		record := jobRecord{}
+		err = json.Unmarshal(data, &record)
+		if err != nil {
+			return fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+		job := record.Job
+		job.Slots, job.Stored = record.Slots, record.Stored
+		if record.Metrics != nil {
+			job.Metrics = *record.Metrics
+		}
+		err = q.replay(&job)
+		if err != nil {
+			return err
+		}
+		q.jobs[job.ID] = &job
+
+		if job.Status == JobQueued || job.Status == JobRunning {
+			// the log is compacted before the resumed job appends to it (and a line cut by a crash is dropped)
+			err = q.compact(&job)
+			if err != nil {
+				return err
+			}
+			fmt.Println("♻️ resuming job", job.ID, "at", job.Done, "/", job.Spec.Count)
+			job.Status = JobQueued
+			resumed = append(resumed, &job)
+		}
+	}
+	slices.SortFunc(resumed, func(a, b *Job) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	for idx, job := range resumed {
+		select {
+		case q.queue <- job:
+		default:
+			q.resumed = resumed[idx:]
+			fmt.Println("♻️", len(q.resumed), "jobs wait for a place in the queue")
+			return nil
+		}
+	}
+	return nil
+}
+
+// Start launches the workers, they stop with the context
+func (q *JobQueue) Start(ctx context.Context, workers int) {
+	// the jobs give way to the interactive requests (GPU_SLOTS)
+	ctx = WithPriority(ctx, PriorityBackground)
+	for range workers {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-q.queue:
+					q.process(ctx, job)
+				}
+			}
+		}()
+	}
+	q.mutex.Lock()
+	resumed := q.resumed
+	q.resumed = nil
+	q.mutex.Unlock()
+	go func() {
+		for _, job := range resumed {
+			select {
+			case <-ctx.Done():
+				return
+			case q.queue <- job:
+			}
+		}
+	}()
+}
+
+// Enqueue registers a new job and returns a copy of it
+func (q *JobQueue) Enqueue(campaign string, spec Spec) (Job, error) {
+	// the registry is opened now to reject an invalid campaign
+	_, err := q.storage.Registry(campaign)
+	if err != nil {
+		return Job{}, err
+	}
+	id, err := newJobID()
+	if err != nil {
+		return Job{}, err
+	}
+
+	job := &Job{
+		ID:        id,
+		Campaign:  campaign,
+		Spec:      spec,
+		Status:    JobQueued,
+		CreatedAt: time.Now(),
+		Slots:     []Slot{},
+	}
+
+	err = q.save(jobRecord{Job: *job})
+	if err != nil {
+		return Job{}, err
+	}
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	select {
+	case q.queue <- job:
+	default:
+		os.Remove(q.path(id))
+		return Job{}, fmt.Errorf("the job queue is full")
+	}
+	q.jobs[id] = job
+	return *job, nil
+}
+
+// Get returns a copy of the job
+func (q *JobQueue) Get(id string) (Job, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	copied := *job
+	copied.Slots = append([]Slot{}, job.Slots...)
+	return copied, true
+}
+
+func (q *JobQueue) process(ctx context.Context, job *Job) {
+	q.update(job, func() {
+		now := time.Now()
+		job.Status, job.StartedAt = JobRunning, &now
+	})
+
+	err := q.generate(ctx, job)
+	// Ollama is restarting: the job resumes after its last slot when it is back
+	for errors.Is(err, ErrBackendDown) && q.generator.backend.Wait(ctx) == nil {
+		err = q.generate(ctx, job)
+	}
+	if ctx.Err() != nil {
+		// stopped by the server shutdown: the job stays running to resume at the next start
+		return
+	}
+
+	q.update(job, func() {
+		now := time.Now()
+		job.FinishedAt = &now
+		if err != nil {
+			job.Status, job.Error = JobFailed, err.Error()
+			return
+		}
+		job.Status = JobDone
+	})
+}
+
+// generate fills the slots one by one so the progress can be polled, every slot is saved
+// in the job before it is stored: a resumed job stores its saved slots again (the registry
+// skips the names it already has) and starts after its last saved slot
+func (q *JobQueue) generate(ctx context.Context, job *Job) error {
+	registry, err := q.storage.Registry(job.Campaign)
+	if err != nil {
+		return err
+	}
+
+	q.mutex.Lock()
+	start, stored, previousMetrics := len(job.Slots), job.Stored, job.Metrics
+	q.mutex.Unlock()
+	for index := stored; index < start; index++ {
+		err = q.store(registry, job, index, true)
+		if err != nil {
+			return err
+		}
+	}
+
+	run := NewRun(q.generator, registry.Deduper(), job.Spec)
+	for index := start; index < job.Spec.Count; index++ {
+		slot, err := run.GenerateSlot(ctx, index)
+		if err != nil {
+			return err
+		}
+		q.mutex.Lock()
+		job.Slots = append(job.Slots, slot)
+		job.Done++
+		job.Metrics = previousMetrics.Add(run.Metrics())
+		metrics := job.Metrics
+		q.mutex.Unlock()
+		q.checkpoint(job, slotEntry{Index: index, Slot: slot, Metrics: &metrics})
+		err = q.store(registry, job, index, false)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// store puts the saved slot in the registry and saves the stored slot (its ID) in the job;
+// a resumed slot may already be in the registry (a crash before its checkpoint), it isn't stored twice
+func (q *JobQueue) store(registry *Registry, job *Job, index int, resumed bool) error {
+	q.mutex.Lock()
+	slots := []Slot{job.Slots[index]}
+	q.mutex.Unlock()
+	previous, found := Slot{}, false
+	if resumed {
+		previous, found = storedSlot(registry, slots[0])
+	}
+	if found {
+		slots[0] = previous
+	} else {
+		err := storeSlots(registry, slots, q.approval)
+		if err != nil {
+			return err
+		}
+	}
+	q.mutex.Lock()
+	job.Slots[index] = slots[0]
+	job.Stored = index + 1
+	q.mutex.Unlock()
+	q.checkpoint(job, slotEntry{Index: index, Slot: slots[0], Stored: true})
+	return nil
+}
+
+// storedSlot returns the slot with the stored or pending character generated by it,
+// the same name generated at the same time
+func storedSlot(registry *Registry, slot Slot) (Slot, bool) {
+	if slot.Status != SlotOK || slot.Character.Provenance == nil {
+		return slot, false
+	}
+	generated := func(character Character) bool {
+		return character.Name == slot.Character.Name && character.Provenance != nil &&
+			character.Provenance.GeneratedAt.Equal(slot.Character.Provenance.GeneratedAt)
+	}
+	if character, ok := registry.FindByName(slot.Character.Name); ok && generated(character) {
+		slot.Character = &character
+		return slot, true
+	}
+	for _, pending := range registry.ListPending() {
+		if generated(pending.Character) {
+			slot.Pending = pending.ID
+			return slot, true
+		}
+	}
+	return slot, false
+}
+
+// update changes the job and saves it, the file is written after the lock is released
+// (a job is only written by its worker)
+func (q *JobQueue) update(job *Job, change func()) {
+	q.mutex.Lock()
+	change()
+	record := jobRecord{Job: *job}
+	q.mutex.Unlock()
+	err := q.save(record)
+	if err != nil {
+		fmt.Println("😡 job", job.ID, err)
+	}
+}
+
+// checkpoint appends the entry to the log of the job, a slot costs a line instead of
+// a rewrite of the whole job
+func (q *JobQueue) checkpoint(job *Job, entry slotEntry) {
+	data, err := json.Marshal(entry)
+	if err == nil {
+		err = os.MkdirAll(q.dir, 0755)
+	}
+	if err == nil {
+		err = appendFile(q.logPath(job.ID), append(data, '\n'))
+	}
+	if err != nil {
+		fmt.Println("😡 job", job.ID, err)
+	}
+}
+
+func appendFile(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// replay applies the log of the job to its slots, a last line without its end
+// was cut by a crash and is skipped
+func (q *JobQueue) replay(job *Job) error {
+	data, err := os.ReadFile(q.logPath(job.ID))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(string(data), "\n")
+	// the last element is empty after a complete line, or the cut line
+	for number, line := range lines[:len(lines)-1] {
+		entry := slotEntry{}
+		err = json.Unmarshal([]byte(line), &entry)
+		if err != nil {
+			return fmt.Errorf("%s line %d: %w", filepath.Base(q.logPath(job.ID)), number+1, err)
+		}
+		switch {
+		case entry.Index == len(job.Slots):
+			job.Slots = append(job.Slots, entry.Slot)
+		case entry.Index < len(job.Slots):
+			job.Slots[entry.Index] = entry.Slot
+		default:
+			return fmt.Errorf("%s line %d: slot %d after %d slots", filepath.Base(q.logPath(job.ID)), number+1, entry.Index, len(job.Slots))
+		}
+		if entry.Stored {
+			job.Stored = max(job.Stored, entry.Index+1)
+		}
+		if entry.Metrics != nil {
+			job.Metrics = *entry.Metrics
+		}
+	}
+	job.Done = len(job.Slots)
+	return nil
+}
+
+// compact rewrites the log of the job with a line per slot, atomically
+func (q *JobQueue) compact(job *Job) error {
+	if len(job.Slots) == 0 {
+		return nil
+	}
+	data := []byte{}
+	for index, slot := range job.Slots {
+		entry := slotEntry{Index: index, Slot: slot, Stored: index < job.Stored}
+		if index == len(job.Slots)-1 {
+			entry.Metrics = &job.Metrics
+		}
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		data = append(append(data, line...), '\n')
+	}
+	return writeAtomic(q.logPath(job.ID), data)
+}
+
+func (q *JobQueue) path(id string) string {
+	return filepath.Join(q.dir, id+".json")
+}
+
+func (q *JobQueue) logPath(id string) string {
+	return filepath.Join(q.dir, id+".slots.jsonl")
+}
+
+// save writes the job file atomically (a crash never leaves a truncated file)
+func (q *JobQueue) save(record jobRecord) error {
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(q.dir, 0755)
+	if err != nil {
+		return err
+	}
+	return writeAtomic(q.path(record.ID), data)
+}
+
+// writeAtomic writes a temporary file and renames it
+func writeAtomic(path string, data []byte) error {
+	tmpPath := path + ".tmp"
+	err := os.WriteFile(tmpPath, data, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func newJobID() (string, error) {
+	bytes := make([]byte, 8)
+	_, err := rand.Read(bytes)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
@@ -0,0 +1,59 @@
+//go:build !minimal
+
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJobCheckpointResume(t *testing.T) {
+	dir := t.TempDir()
+	queue := NewJobQueue(nil, nil, dir)
+	job := &Job{ID: "0123456789abcdef", Spec: Spec{Count: 5}, Status: JobQueued, CreatedAt: time.Now()}
+	err := queue.save(jobRecord{Job: *job})
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue.update(job, func() { job.Status = JobRunning })
+	for index, name := range []string{"Thorgar", "Brunhild", "Dvalin"} {
+		slot := Slot{Index: index, Status: SlotOK, Character: &Character{Name: name, Kind: "Dwarf"}}
+		queue.checkpoint(job, slotEntry{Index: index, Slot: slot, Metrics: &RunMetrics{Attempts: index + 1}})
+		if index < 2 {
+			slot.Character.ID = index + 1
+			queue.checkpoint(job, slotEntry{Index: index, Slot: slot, Stored: true})
+		}
+	}
+	// a crash cuts the last line
+	err = appendFile(queue.logPath(job.ID), []byte(`{"index":3,"slot":{"ind`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resumed := NewJobQueue(nil, nil, dir)
+	err = resumed.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, ok := resumed.Get(job.ID)
+	if !ok {
+		t.Fatal("the job is not loaded")
+	}
+	if loaded.Status != JobQueued || loaded.Done != 3 || len(loaded.Slots) != 3 || loaded.Stored != 2 || loaded.Metrics.Attempts != 3 {
+		t.Fatalf("loaded %+v, %d slots, %d stored, metrics %+v", loaded, len(loaded.Slots), loaded.Stored, loaded.Metrics)
+	}
+	if loaded.Slots[1].Character.ID != 2 || loaded.Slots[2].Character.Name != "Dvalin" {
+		t.Errorf("slots %+v %+v", loaded.Slots[1].Character, loaded.Slots[2].Character)
+	}
+
+	// the compacted log has a line per slot, the resumed job appends to it
+	data, err := os.ReadFile(resumed.logPath(job.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 3 {
+		t.Errorf("%d lines in the compacted log", lines)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// JSONLWriter appends one character per line as soon as it is stored,
+// a long run can be followed with tail -f and a partial file is still valid
+type JSONLWriter struct {
+	mutex sync.Mutex
+	file  *os.File
+	// fsync after every line (slower, but nothing is lost on a crash)
+	fsync bool
+}
+
+// OpenJSONL opens the file in append mode, the lines of the previous runs are kept
+func OpenJSONL(path string, fsync bool) (*JSONLWriter, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONLWriter{file: file, fsync: fsync}, nil
+}
+
+// Write appends the character, the line is written at once so a reader never sees half of it
+func (w *JSONLWriter) Write(character Character) error {
+	data, err := json.Marshal(character)
+	if err != nil {
+		return err
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	_, err = w.file.Write(append(data, '\n'))
+	if err != nil {
+		return err
+	}
+	if w.fsync {
+		return w.file.Sync()
+	}
+	return nil
+}
+
+func (w *JSONLWriter) Close() error {
+	return w.file.Close()
+}
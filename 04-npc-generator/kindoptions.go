@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"strings"
+)
+
+// integerOptions are converted from the float64 of the JSON decoding,
+// the escalation and Ollama expect integers
+var integerOptions = map[string]bool{
+	"top_k": true, "repeat_last_n": true, "num_predict": true, "num_ctx": true, "seed": true, "mirostat": true,
+}
+
+// LoadKindOptions reads the sampling options per kind (KIND_OPTIONS):
+// {"Dwarf": {"top_k": 40}, "Elf": {"temperature": 1.2}}
+func LoadKindOptions(path string) (map[string]map[string]interface{}, error) {
+	kindOptions := map[string]map[string]interface{}{}
+	if path == "" {
+		return kindOptions, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	decoded := map[string]map[string]interface{}{}
+	err = json.Unmarshal(data, &decoded)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for kind, options := range decoded {
+		for key, value := range options {
+			number, ok := value.(float64)
+			if integerOptions[key] && ok {
+				options[key] = int(number)
+			}
+		}
+		// the kinds are matched without the case
+		kindOptions[strings.ToLower(kind)] = options
+	}
+	return kindOptions, nil
+}
+
+// optionsFor merges the overrides of the kind over the global options,
+// a hybrid gets the overrides of its parents then its own
+func (g *Generator) optionsFor(spec Spec) map[string]interface{} {
+	options := maps.Clone(g.options)
+	for _, kind := range append(append([]string{}, spec.Parents...), spec.Kind) {
+		maps.Copy(options, g.kindOptions[strings.ToLower(kind)])
+	}
+	return options
+}
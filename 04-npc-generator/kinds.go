@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// KindDefinition is the naming rules of a kind
+type KindDefinition struct {
+	Name    string   `json:"name"`
+	Plural  string   `json:"plural"`
+	Rules   []string `json:"rules"`
+	Pattern string   `json:"pattern"`
+	Culture string   `json:"culture"`
+	// Prefixes of the coverage mode (default: the prefixes and the letters of the rules)
+	Prefixes []string `json:"prefixes,omitempty"`
+	// Family is the naming custom of the relatives: surname (default), clan or none
+	Family string `json:"family,omitempty"`
+	// Script is the native writing of the names (nil: the names are only romanized)
+	Script *Script `json:"script,omitempty"`
+}
+
+var builtinKinds = []KindDefinition{
+	{
+		Name:   "Dwarf",
+		Plural: "Dwarves",
+		Rules: []string{
+			"Favor hard consonants (k, t, d, g)",
+			"Use short, punchy sounds",
+			"Incorporate references to metals, stones, forging",
+			"Clan names often hyphenated or compound words",
+			"Common suffixes: -in, -or, -ar, -im",
+		},
+		Pattern: "[Hard Consonant] + [Short Vowel] + [Hard Consonant] + [Suffix]",
+		Culture: "Dwarf names often reflect their crafts or achievements",
+		Family:  FamilySurname,
+	},
+	{
+		Name:   "Elf",
+		Plural: "Elves",
+		Rules: []string{
+			"Favor fluid consonants (l, n, r)",
+			"Use many vowels",
+			"Incorporate nature and star references",
+			"Names typically long and melodious",
+			"Common prefixes: El-, Cel-, Gal-",
+			"Common suffixes: -il, -iel, -or, -ion",
+		},
+		Pattern: "[Nature Word] + [Fluid Consonant] + [Long Vowel] + [Melodic Ending]",
+		Culture: "Elf names might change throughout their long lives",
+		Family:  FamilyNone,
+	},
+	{
+		Name:   "Human",
+		Plural: "Humans",
+		Rules: []string{
+			"Greater variety of sounds",
+			"Mix of short and long names",
+			"Can borrow elements from other races",
+			"Family names often descriptive or location-based",
+			"Common suffixes: -or, -wyn, -iel",
+			"Common prefixes: Theo-, El-, Ar-",
+		},
+		Pattern: "[Strong Consonant] + [Vowel] + [Cultural Suffix]",
+		Culture: "Human names vary by region and social status",
+		Family:  FamilySurname,
+	},
+}
+
+// GenerationInstructions renders the naming rules of the kinds
+func GenerationInstructions(kinds []KindDefinition) string {
+	instructions := "\n## Suggested Generation Rules\n\n"
+	instructions += "For generating consistent names, here are some guidelines:\n"
+	for _, kind := range kinds {
+		instructions += "\n### " + kind.Plural + "\n"
+		for _, rule := range kind.Rules {
+			instructions += "- " + rule + "\n"
+		}
+	}
+
+	instructions += "\n## Usage Notes\n"
+	instructions += "Names can be modified or combined to create new variations while maintaining the essence of each race.\n"
+	instructions += "\n### Pattern Examples\n"
+	for _, kind := range kinds {
+		instructions += "- " + kind.Name + ": " + kind.Pattern + "\n"
+	}
+	instructions += "\n### Cultural Considerations\n"
+	for _, kind := range kinds {
+		instructions += "- " + kind.Culture + "\n"
+	}
+	return instructions
+}
+
+// findKind returns the definition of the kind (case insensitive)
+func findKind(kinds []KindDefinition, name string) (KindDefinition, bool) {
+	for _, kind := range kinds {
+		if strings.EqualFold(kind.Name, strings.TrimSpace(name)) {
+			return kind, true
+		}
+	}
+	return KindDefinition{}, false
+}
+
+// ResolveKind returns the kind and the parent kinds of a hybrid:
+// --mix dwarf+human gives Dwarf-Human, --kind Half-Elf gives the Elf and Human parents
+func ResolveKind(kinds []KindDefinition, kind, mix string) (string, []string, error) {
+	names := []string{}
+	switch {
+	case mix != "":
+		names = strings.Split(mix, "+")
+	case strings.HasPrefix(strings.ToLower(kind), "half-") || strings.HasPrefix(strings.ToLower(kind), "half "):
+		names = []string{kind[len("half-"):], "Human"}
+	default:
+		return kind, nil, nil
+	}
+	if len(names) != 2 {
+		return "", nil, fmt.Errorf("a hybrid has 2 parent kinds, got %q", mix)
+	}
+
+	parents := []string{}
+	for _, name := range names {
+		definition, ok := findKind(kinds, name)
+		if !ok {
+			return "", nil, fmt.Errorf("unknown parent kind %q", strings.TrimSpace(name))
+		}
+		parents = append(parents, definition.Name)
+	}
+	if parents[0] == parents[1] {
+		return "", nil, fmt.Errorf("the parent kinds of a hybrid must differ")
+	}
+	if mix != "" {
+		kind = parents[0] + "-" + parents[1]
+	}
+	return kind, parents, nil
+}
+
+// hybridInstructions asks to blend the naming rules of the parent kinds
+func hybridInstructions(kinds []KindDefinition, kind string, parents []string) string {
+	instructions := fmt.Sprintf("\n## %s\n\nA %s is a hybrid of %s and %s: blend their naming rules ", kind, kind, parents[0], parents[1])
+	instructions += "(for instance a given name of one kind with a family name of the other, or a mix of both sounds).\n"
+	for _, parent := range parents {
+		definition, _ := findKind(kinds, parent)
+		instructions += "\n### " + definition.Name + " rules\n"
+		for _, rule := range definition.Rules {
+			instructions += "- " + rule + "\n"
+		}
+		instructions += "- Pattern: " + definition.Pattern + "\n"
+	}
+	return instructions
+}
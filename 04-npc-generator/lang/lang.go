@@ -0,0 +1,149 @@
+// Package lang detects the language of a short text without a model: the script of its letters
+// tells the languages of the other scripts, the most frequent short words tell the languages
+// of the latin script apart
+package lang
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Language is an ISO 639-1 code and its name
+type Language struct {
+	Code string
+	Name string
+}
+
+var languages = []Language{
+	{"en", "English"}, {"fr", "French"}, {"de", "German"}, {"es", "Spanish"}, {"it", "Italian"},
+	{"pt", "Portuguese"}, {"nl", "Dutch"}, {"ru", "Russian"}, {"el", "Greek"}, {"ar", "Arabic"},
+	{"he", "Hebrew"}, {"zh", "Chinese"}, {"ja", "Japanese"}, {"ko", "Korean"},
+}
+
+// Languages returns the languages the detection knows
+func Languages() []Language {
+	return slices.Clone(languages)
+}
+
+// Lookup returns the language of the code (case insensitive)
+func Lookup(code string) (Language, bool) {
+	idx := slices.IndexFunc(languages, func(language Language) bool { return strings.EqualFold(language.Code, code) })
+	if idx < 0 {
+		return Language{}, false
+	}
+	return languages[idx], true
+}
+
+// Below these sizes a text is too short to tell its language
+const (
+	minLetters = 12
+	minWords   = 5
+	minHits    = 2
+)
+
+// stopwords are the most frequent short words of the languages of the latin script,
+// the words shared by two languages count for both
+var stopwords = map[string][]string{
+	"en": {"the", "and", "of", "to", "a", "in", "is", "was", "he", "she", "his", "her", "it", "with", "for", "as", "on", "by", "at", "from", "that", "this", "who", "an", "are", "be", "has", "had", "they", "their", "not", "but", "or", "which", "its", "into", "after", "when"},
+	"fr": {"le", "la", "les", "de", "des", "du", "un", "une", "et", "est", "en", "il", "elle", "dans", "qui", "que", "pour", "par", "sur", "au", "aux", "son", "sa", "ses", "avec", "ne", "pas", "se", "ce", "était", "mais", "ou", "lui", "leur", "après"},
+	"de": {"der", "die", "das", "und", "ist", "ein", "eine", "nicht", "zu", "den", "dem", "des", "mit", "sich", "auf", "für", "er", "sie", "es", "im", "von", "war", "auch", "als", "wie", "aus", "seine", "ihre", "nach", "bei", "wird", "hat"},
+	"es": {"el", "la", "los", "las", "de", "del", "y", "que", "en", "un", "una", "es", "se", "por", "con", "su", "sus", "para", "al", "lo", "como", "pero", "más", "fue", "era", "le", "ha", "sin", "sobre", "tras"},
+	"it": {"il", "lo", "la", "gli", "le", "di", "del", "della", "e", "che", "un", "una", "è", "per", "con", "non", "si", "da", "in", "al", "nel", "sua", "suo", "dei", "ma", "come", "era", "sono", "alla", "dopo"},
+	"pt": {"o", "a", "os", "as", "de", "do", "da", "dos", "das", "e", "que", "em", "um", "uma", "é", "no", "na", "com", "não", "por", "para", "se", "seu", "sua", "ao", "mas", "como", "era", "foi", "após"},
+	"nl": {"de", "het", "een", "en", "van", "is", "in", "dat", "op", "te", "zijn", "met", "voor", "niet", "hij", "zij", "die", "aan", "er", "maar", "om", "ook", "als", "bij", "werd", "was", "naar", "uit", "haar"},
+}
+
+var stopwordSets = map[string]map[string]bool{}
+
+func init() {
+	for code, words := range stopwords {
+		stopwordSets[code] = map[string]bool{}
+		for _, word := range words {
+			stopwordSets[code][word] = true
+		}
+	}
+}
+
+// Detect returns the code of the language of the text, "" when the text is too short
+// or when two languages are as likely (a list of names has no language)
+func Detect(text string) string {
+	scripts := map[string]int{}
+	letters := 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		switch {
+		case unicode.Is(unicode.Latin, r):
+			scripts["latin"]++
+		case unicode.Is(unicode.Cyrillic, r):
+			scripts["ru"]++
+		case unicode.Is(unicode.Greek, r):
+			scripts["el"]++
+		case unicode.Is(unicode.Arabic, r):
+			scripts["ar"]++
+		case unicode.Is(unicode.Hebrew, r):
+			scripts["he"]++
+		case unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r):
+			scripts["ja"]++
+		case unicode.Is(unicode.Han, r):
+			scripts["zh"]++
+		case unicode.Is(unicode.Hangul, r):
+			scripts["ko"]++
+		}
+	}
+	// a few CJK characters carry as much text as a word
+	if letters < minLetters && scripts["latin"] == letters {
+		return ""
+	}
+	script := ""
+	for _, name := range slices.Sorted(maps.Keys(scripts)) {
+		if script == "" || scripts[name] > scripts[script] {
+			script = name
+		}
+	}
+	switch {
+	case script == "":
+		return ""
+	// the japanese texts mix kana and kanji
+	case script == "zh" && scripts["ja"] > 0:
+		return "ja"
+	case script != "latin":
+		return script
+	}
+	return detectLatin(text)
+}
+
+// detectLatin counts the stopwords of every language of the latin script
+func detectLatin(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+	if len(words) < minWords {
+		return ""
+	}
+	hits := map[string]int{}
+	for _, word := range words {
+		for code, set := range stopwordSets {
+			if set[word] {
+				hits[code]++
+			}
+		}
+	}
+	best, second := "", 0
+	for _, code := range slices.Sorted(maps.Keys(hits)) {
+		switch {
+		case best == "" || hits[code] > hits[best]:
+			best, second = code, hits[best]
+		case hits[code] > second:
+			second = hits[code]
+		}
+	}
+	if best == "" || hits[best] < minHits || hits[best] == second {
+		return ""
+	}
+	return best
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"04-npc-generator/lang"
+)
+
+// ErrWrongLanguage flags the texts the model wrote in another language than OUTPUT_LANGUAGE
+var ErrWrongLanguage = errors.New("wrong language")
+
+// checkLanguageCode checks OUTPUT_LANGUAGE ("": no check)
+func checkLanguageCode(code string) error {
+	if code == "" {
+		return nil
+	}
+	_, ok := lang.Lookup(code)
+	if !ok {
+		codes := []string{}
+		for _, language := range lang.Languages() {
+			codes = append(codes, language.Code)
+		}
+		return fmt.Errorf("unknown output language %q (%s)", code, strings.Join(codes, ", "))
+	}
+	return nil
+}
+
+// languageInstructions asks for the texts in the output language, the names keep the style of the kind
+func (g *Generator) languageInstructions() string {
+	language, ok := lang.Lookup(g.language)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("\nWrite the title and the texts in %s (the names keep the style of the kind).", language.Name)
+}
+
+// characterText is the text written by the model: the title, the extras, the story tables,
+// the backstory and the lines, the names have no language
+func characterText(character Character) string {
+	texts := []string{character.Title}
+	for _, name := range slices.Sorted(maps.Keys(character.Extras)) {
+		texts = append(texts, character.Extras[name])
+	}
+	for _, table := range storyTables {
+		texts = append(texts, storyTableTexts(character, table.Name)...)
+	}
+	texts = append(texts, character.Backstory)
+	texts = append(texts, character.Lines...)
+	return strings.Join(texts, ". ")
+}
+
+// checkLanguage returns ErrWrongLanguage when the texts of the character are in another language
+// than OUTPUT_LANGUAGE, a text too short to tell is accepted
+func (g *Generator) checkLanguage(character Character) error {
+	if g.language == "" {
+		return nil
+	}
+	detected := lang.Detect(characterText(character))
+	if detected == "" || strings.EqualFold(detected, g.language) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s instead of %s for %s", ErrWrongLanguage, detected, g.language, character.Name)
+}
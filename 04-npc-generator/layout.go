@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// exportFormats are the files of a run export
+var exportFormats = []string{"json", "md", "csv"}
+
+// OutputFields are the fields of the output template
+type OutputFields struct {
+	Campaign string
+	Kind     string
+	Genre    string
+	Date     string
+	Time     string
+	Format   string
+}
+
+// OutputLayout builds the export paths from a template:
+// --out 'exports/{{.Date}}/{{.Kind}}/characters.{{.Format}}'
+type OutputLayout struct {
+	template *template.Template
+	// without {{.Format}} in the template, the extension of the format is added
+	withFormat bool
+}
+
+func NewOutputLayout(text string) (*OutputLayout, error) {
+	tmpl, err := template.New("out").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("output template: %w", err)
+	}
+	return &OutputLayout{template: tmpl, withFormat: strings.Contains(text, ".Format")}, nil
+}
+
+// Paths returns the path of every export format of the run, the directories are created
+// and a numbered suffix (-1, -2...) keeps the exports of a previous run
+func (l *OutputLayout) Paths(fields OutputFields, now time.Time) (map[string]string, error) {
+	fields.Date, fields.Time = now.Format("2006-01-02"), now.Format("150405")
+	paths := map[string]string{}
+	for _, format := range exportFormats {
+		fields.Format = format
+		buffer := bytes.Buffer{}
+		err := l.template.Execute(&buffer, fields)
+		if err != nil {
+			return nil, fmt.Errorf("output template: %w", err)
+		}
+		path := filepath.Clean(buffer.String())
+		if !l.withFormat {
+			path += "." + format
+		}
+		paths[format] = path
+	}
+
+	for suffix := 0; ; suffix++ {
+		candidates := map[string]string{}
+		taken := false
+		for format, path := range paths {
+			if suffix > 0 {
+				extension := filepath.Ext(path)
+				path = fmt.Sprintf("%s-%d%s", strings.TrimSuffix(path, extension), suffix, extension)
+			}
+			_, err := os.Stat(path)
+			taken = taken || err == nil
+			candidates[format] = path
+		}
+		if !taken {
+			paths = candidates
+			break
+		}
+	}
+
+	for _, path := range paths {
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return paths, nil
+}
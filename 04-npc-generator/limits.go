@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+)
+
+const (
+	DomainCharacter = "character"
+	DomainEquipment = "equipment"
+	DomainFaction   = "faction"
+	DomainBackstory = "backstory"
+	DomainEvents    = "events"
+	DomainJudge     = "judge"
+	DomainVerify    = "verify"
+	DomainName      = "name"
+	DomainDialogue  = "dialogue"
+	DomainCast      = "cast"
+	DomainRiddles   = "riddles"
+	DomainSyllables = "syllables"
+	DomainPortrait  = "portrait"
+	DomainShop      = "shop"
+	DomainMap       = "map"
+)
+
+// DomainLimits prevents the runaway generations of a domain
+// (the structured output can end with an endless stream of blanks)
+type DomainLimits struct {
+	NumPredict int      `json:"num_predict"`
+	Stop       []string `json:"stop,omitempty"`
+}
+
+var defaultDomainLimits = map[string]DomainLimits{
+	DomainCharacter: {NumPredict: 256, Stop: []string{"\n\n\n"}},
+	DomainEquipment: {NumPredict: 256, Stop: []string{"\n\n\n"}},
+	DomainFaction:   {NumPredict: 1024, Stop: []string{"\n\n\n"}},
+	DomainBackstory: {NumPredict: 512, Stop: []string{"\n\n\n"}},
+	DomainEvents:    {NumPredict: 2048, Stop: []string{"\n\n\n"}},
+	DomainJudge:     {NumPredict: 256, Stop: []string{"\n\n\n"}},
+	DomainVerify:    {NumPredict: 512, Stop: []string{"\n\n\n"}},
+	DomainName:      {NumPredict: 48, Stop: []string{"\n\n\n"}},
+	DomainDialogue:  {NumPredict: 1024, Stop: []string{"\n\n\n"}},
+	DomainCast:      {NumPredict: 2048, Stop: []string{"\n\n\n"}},
+	DomainRiddles:   {NumPredict: 1024, Stop: []string{"\n\n\n"}},
+	DomainSyllables: {NumPredict: 1024, Stop: []string{"\n\n\n"}},
+	DomainPortrait:  {NumPredict: 512, Stop: []string{"\n\n\n"}},
+	DomainShop:      {NumPredict: 1024, Stop: []string{"\n\n\n"}},
+	DomainMap:       {NumPredict: 2048, Stop: []string{"\n\n\n"}},
+}
+
+// LoadDomainLimits reads the limits file (DOMAIN_LIMITS),
+// the domains of the file replace the default limits
+func LoadDomainLimits(path string) (map[string]DomainLimits, error) {
+	limits := maps.Clone(defaultDomainLimits)
+	if path == "" {
+		return limits, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	custom := map[string]DomainLimits{}
+	err = json.Unmarshal(data, &custom)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	maps.Copy(limits, custom)
+	return limits, nil
+}
+
+// withLimits returns a copy of the options with the limits of the domain
+func withLimits(options map[string]interface{}, limits DomainLimits) map[string]interface{} {
+	limited := maps.Clone(options)
+	if limited == nil {
+		limited = map[string]interface{}{}
+	}
+	if limits.NumPredict > 0 {
+		limited["num_predict"] = limits.NumPredict
+	}
+	if len(limits.Stop) > 0 {
+		limited["stop"] = limits.Stop
+	}
+	return limited
+}
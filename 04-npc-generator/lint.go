@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Lint checks of a cast
+const (
+	LintPrefix  = "prefix"  // the given names start with the same letters (Thorgar, Thorin, Thorvald)
+	LintSurname = "surname" // the family names are the same
+	LintClass   = "class"   // every character has the same class
+	LintExtra   = "extra"   // an extra of the genre has the same value (gender, alignment, affiliation...)
+)
+
+// minLintCast is the size of the smallest cast worth a lint
+const minLintCast = 4
+
+// LintFinding is a value shared by too many characters of the cast
+type LintFinding struct {
+	Check string `json:"check"`
+	// Field is the name of the extra
+	Field string  `json:"field,omitempty"`
+	Value string  `json:"value"`
+	Count int     `json:"count"`
+	Total int     `json:"total"`
+	Share float64 `json:"share"`
+	IDs   []int   `json:"ids"`
+	// Excess is the number of characters to change to get under the maximum share
+	Excess     int    `json:"excess"`
+	Suggestion string `json:"suggestion"`
+}
+
+// namePrefix is the first 3 letters of the given name (without the case and the accents)
+func namePrefix(name string) string {
+	fields := strings.Fields(collationKey(name))
+	if len(fields) == 0 {
+		return ""
+	}
+	runes := []rune(fields[0])
+	return string(runes[:min(3, len(runes))])
+}
+
+// surname is the last word of a name of 2 words at least
+func surname(name string) string {
+	fields := strings.Fields(collationKey(name))
+	if len(fields) < 2 {
+		return ""
+	}
+	return fields[len(fields)-1]
+}
+
+// LintCast returns the values shared by more than maxShare of the cast:
+// name prefixes and surnames, classes, and the extras of the genre
+// (a gender or an alignment extra is checked like the others)
+func LintCast(characters []Character, maxShare float64) []LintFinding {
+	findings := []LintFinding{}
+	if len(characters) < minLintCast {
+		return findings
+	}
+
+	check := func(name, field string, value func(character Character) string) {
+		groups := map[string][]int{}
+		total := 0
+		for _, character := range characters {
+			key := value(character)
+			if key == "" {
+				continue
+			}
+			total++
+			groups[key] = append(groups[key], character.ID)
+		}
+		if total < minLintCast {
+			return
+		}
+		for _, key := range slices.Sorted(maps.Keys(groups)) {
+			ids := groups[key]
+			share := float64(len(ids)) / float64(total)
+			if share <= maxShare || len(ids) < 2 {
+				continue
+			}
+			finding := LintFinding{
+				Check: name, Field: field, Value: key,
+				Count: len(ids), Total: total, Share: share, IDs: ids,
+				Excess: min(max(len(ids)-int(maxShare*float64(total)), 1), len(ids)),
+			}
+			finding.Suggestion = lintSuggestion(finding)
+			findings = append(findings, finding)
+		}
+	}
+
+	check(LintPrefix, "", func(character Character) string { return namePrefix(character.Name) })
+	check(LintSurname, "", func(character Character) string { return surname(character.Name) })
+	check(LintClass, "", func(character Character) string { return strings.ToLower(character.Class) })
+
+	extras := map[string]bool{}
+	for _, character := range characters {
+		for extra := range character.Extras {
+			extras[extra] = true
+		}
+	}
+	for _, extra := range slices.Sorted(maps.Keys(extras)) {
+		check(LintExtra, extra, func(character Character) string {
+			value := strings.ToLower(strings.TrimSpace(character.Extras[extra]))
+			// the free texts (augmentations, reputation) are not categories
+			if len(strings.Fields(value)) > 3 {
+				return ""
+			}
+			return value
+		})
+	}
+	return findings
+}
+
+func lintSuggestion(finding LintFinding) string {
+	switch finding.Check {
+	case LintPrefix:
+		return fmt.Sprintf("regenerate %d names not starting with %q (lint --fix)", finding.Excess, finding.Value)
+	case LintSurname:
+		return fmt.Sprintf("regenerate %d names without the family name %q (lint --fix)", finding.Excess, finding.Value)
+	case LintClass:
+		return fmt.Sprintf("generate %d characters of another class (generate --class)", finding.Excess)
+	}
+	return fmt.Sprintf("%d characters need another %s than %q", finding.Excess, finding.Field, finding.Value)
+}
+
+// inNameCluster is true when the name is still in the prefix or surname cluster of the finding
+func inNameCluster(character Character, finding LintFinding) bool {
+	switch finding.Check {
+	case LintPrefix:
+		return namePrefix(character.Name) == finding.Value
+	case LintSurname:
+		return surname(character.Name) == finding.Value
+	}
+	return false
+}
+
+// FixName regenerates the name of the character away from the cluster of the finding (3 attempts),
+// the other fields are kept
+func (g *Generator) FixName(ctx context.Context, character Character, finding LintFinding) (Character, error) {
+	hint := fmt.Sprintf("The new name must not start with %q, too many characters of the cast already do.", finding.Value)
+	if finding.Check == LintSurname {
+		hint = fmt.Sprintf("The new name must not use the family name %q, too many characters of the cast already do.", finding.Value)
+	}
+	for attempt := 0; attempt < 3; attempt++ {
+		fixed, err := g.RegenerateFieldWithHint(ctx, character, "name", nil, hint)
+		if err != nil {
+			return character, err
+		}
+		if !inNameCluster(fixed, finding) {
+			return fixed, nil
+		}
+		fmt.Println("🔁 still in the cluster:", fixed.Name)
+	}
+	return character, fmt.Errorf("no name out of the %s %q for %s after 3 attempts", finding.Check, finding.Value, character.Name)
+}
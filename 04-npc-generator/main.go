@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"04-npc-generator/config"
+)
+
+func main() {
+
+	ctx := context.Background()
+
+	// with --stdin, stdout only carries the JSONL results and the logs go to stderr,
+	// like the scripts of the completion and the man page, and the names of quick
+	stdout := os.Stdout
+	quiet := len(os.Args) > 1 && slices.Contains([]string{"completion", "__complete", "man", "quick"}, os.Args[1])
+	if quiet || slices.Contains(os.Args[1:], "--stdin") {
+		os.Stdout = os.Stderr
+	}
+
+	layers, err := config.Load(settings, os.Getenv("CONFIG_DIR"), os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		log.Fatal("😡:", err)
+	}
+	if unknown := layers.Unknown(); len(unknown) > 0 {
+		fmt.Println("⚠️ unknown variables in the configuration files:", strings.Join(unknown, ", "))
+	}
+
+	ollamaUrl := os.Getenv("OLLAMA_HOST")
+	model := os.Getenv("LLM")
+
+	fmt.Println("🌍", ollamaUrl, "📕", model)
+
+	strict, rest := offlineStrict(os.Args[1:])
+	os.Args = append(os.Args[:1], rest...)
+	client, balancer, err := NewClient()
+	if err != nil {
+		log.Fatal("😡:", err)
+	}
+	// the guard wraps the transport of the other requests, the transports of the client are only used for Ollama
+	var offline *OfflineGuard
+	transport := http.DefaultTransport
+	if strict {
+		offline, err = NewOfflineGuard(http.DefaultTransport)
+		if err != nil {
+			log.Fatal("😡:", err)
+		}
+		transport = offline
+		fmt.Println("🔒 offline-strict, only", strings.Join(offline.Hosts(), ", "))
+	}
+	if balancer != nil {
+		fmt.Printf("⚖️ %d Ollama hosts (%s)\n", len(balancer.hosts), balancer.strategy)
+		go balancer.Monitor(ctx, 5*time.Second)
+	}
+
+	generator := NewGenerator(client, model)
+	generator.balancer = balancer
+	generator.equipmentRules, err = LoadEquipmentRules(os.Getenv("EQUIPMENT_RULES"))
+	if err != nil {
+		log.Fatal("😡:", err)
+	}
+	generator.economy, err = LoadEconomy(os.Getenv("SHOP_ECONOMY"))
+	if err != nil {
+		log.Fatal("😡:", err)
+	}
+	packs, err := InstalledPacks(getEnv("PACKS_DIR", "./packs"))
+	if err != nil {
+		log.Fatal("😡:", err)
+	}
+	generator.systems, err = LoadGameSystems(packDirs(packs, "systems", os.Getenv("SYSTEMS_DIR"))...)
+	if err != nil {
+		log.Fatal("😡:", err)
+	}
+	generator.genres, err = LoadGenres(packDirs(packs, "genres", os.Getenv("GENRES_DIR"))...)
+	if err != nil {
+		log.Fatal("😡:", err)
+	}
+	genre, err := FindGenre(generator.genres, getEnv("GENRE", "fantasy"))
+	if err != nil {
+		log.Fatal("😡:", err)
+	}
+	generator.UseGenre(genre)
+	generator.themes, err = LoadThemes(packDirs(packs, "themes", os.Getenv("THEMES_DIR"))...)
+	if err != nil {
+		log.Fatal("😡:", err)
+	}
+	err = generator.UseTheme(os.Getenv("THEME"))
+	if err != nil {
+		log.Fatal("😡:", err)
+	}
+	generator.limits, err = LoadDomainLimits(os.Getenv("DOMAIN_LIMITS"))
+	if err != nil {
+		log.Fatal("😡:", err)
+	}
+	generator.kindOptions, err = LoadKindOptions(os.Getenv("KIND_OPTIONS"))
+	if err != nil {
+		log.Fatal("😡:", err)
+	}
+	generator.escalation, err = LoadEscalation()
+	if err != nil {
+		log.Fatal("😡:", err)
+	}
+	generator.retry, err = LoadRetryPolicy(os.Getenv("RETRY_POLICY"))
+	if err != nil {
+		log.Fatal("😡:", err)
+	}
+	generator.autoAdjust = os.Getenv("AUTO_ADJUST") == "true"
+	generator.toolCalling = os.Getenv("TOOL_CALLING") == "true"
+	generator.strict = os.Getenv("STRICT") == "true"
+	generator.review = os.Getenv("REVIEW") == "true"
+	generator.reviewModel = getEnv("JUDGE_LLM", model)
+	generator.rubrics, err = LoadRubrics(packDirs(packs, "rubrics", os.Getenv("RUBRICS_DIR"))...)
+	if err != nil {
+		log.Fatal("😡:", err)
+	}
+	generator.transliterate = os.Getenv("TRANSLITERATE")
+	generator.language = strings.ToLower(os.Getenv("OUTPUT_LANGUAGE"))
+	generator.storyChances, err = ParseStoryChances(os.Getenv("STORY_TABLES"))
+	if err != nil {
+		log.Fatal("😡:", err)
+	}
+	// a cassette replays the requests of its recording, the runs need the same seeds
+	seedDefault := "0"
+	if os.Getenv("VCR_MODE") != "" {
+		seedDefault = "1"
+	}
+	generator.seed, err = strconv.Atoi(getEnv("SEED", seedDefault))
+	if err != nil {
+		log.Fatal("😡: SEED:", err)
+	}
+	err = checkLanguageCode(generator.language)
+	if err != nil {
+		log.Fatal("😡:", err)
+	}
+	adapters, err := LoadAdapters(packDirs(packs, "adapters", os.Getenv("ADAPTERS_DIR"))...)
+	if err != nil {
+		log.Fatal("😡:", err)
+	}
+	generator.adapters, err = newAdapterCache(adapters, os.Getenv("PROMPT_ADAPTER"))
+	if err != nil {
+		log.Fatal("😡:", err)
+	}
+	storage := NewStorage(getEnv("DATA_DIR", "./data"))
+	vectors, err := vectorOptions()
+	if err != nil {
+		log.Fatal("😡:", err)
+	}
+	embeddingModel := getEnv("EMBEDDING_MODEL", "nomic-embed-text")
+	generator.dedup, err = ParseDedup(os.Getenv("DEDUP"), nameEmbedder(client, embeddingModel), storage.NamesIndexPath(embeddingModel), vectors)
+	if err != nil {
+		log.Fatal("😡:", err)
+	}
+	err = checkTransliterate(generator.transliterate)
+	if err != nil {
+		log.Fatal("😡:", err)
+	}
+	if webhook := os.Getenv("DISCORD_WEBHOOK_URL"); webhook != "" {
+		err = offline.Refuse("discord webhook")
+		if err != nil {
+			log.Fatal("😡:", err)
+		}
+		events, err := ParseHookEvents(os.Getenv("DISCORD_HOOK_EVENTS"))
+		if err != nil {
+			log.Fatal("😡:", err)
+		}
+		hook, err := NewDiscordHook(webhook, events, transport)
+		if err != nil {
+			log.Fatal("😡:", err)
+		}
+		generator.AddHook(hook)
+	}
+	generator.numCtx, generator.contextSizer, err = ParseNumCtx(getEnv("NUM_CTX", "0"))
+	if err != nil {
+		log.Fatal("😡:", err)
+	}
+	// models ensure runs before the model is installed
+	provisioning := len(os.Args) > 1 && os.Args[1] == "models"
+	if getEnv("PROBE_CAPABILITIES", "true") == "true" && !quiet && !provisioning {
+		capabilities, err := ProbeCapabilities(ctx, client, model)
+		if err != nil {
+			fmt.Println("⚠️ the capabilities of the model are unknown:", err)
+		} else {
+			fmt.Printf("🔎 context %d, reasoning %v, tools %v\n", capabilities.ContextLength, capabilities.Reasoning, capabilities.Tools)
+			generator.modelDigest = capabilities.Digest
+			generator.adapters.SetFamily(model, capabilities.Family)
+			fmt.Printf("🧩 prompt adapter %s\n", generator.adapters.For(model).Name)
+			for _, warning := range generator.Adjust(capabilities) {
+				fmt.Println("⚠️", warning)
+			}
+		}
+	}
+	sortOptions, err := NewSortOptions(getEnv("SORT", SortByOrder), getEnv("COLLATION", CollationBinary))
+	if err != nil {
+		log.Fatal("😡:", err)
+	}
+	markdown := MarkdownOptions{Details: os.Getenv("MARKDOWN_DETAILS") == "true", Names: getEnv("NAME_SCRIPT", NamesRomanized)}
+	err = checkNames(markdown.Names)
+	if err != nil {
+		log.Fatal("😡:", err)
+	}
+	app := &App{generator: generator, storage: storage, sortOptions: sortOptions, markdown: markdown, stdout: stdout, offline: offline, transport: transport, config: layers,
+		summaryPath: os.Getenv("RUN_SUMMARY")}
+
+	command, args := "generate", []string{}
+	if len(os.Args) > 1 {
+		command, args = os.Args[1], os.Args[2:]
+	}
+	// go run . --kind Elf is a generation
+	if strings.HasPrefix(command, "-") {
+		command, args = "generate", os.Args[1:]
+	}
+
+	switch command {
+	case "generate":
+		err = app.runGenerate(ctx, args)
+	case "run":
+		err = app.runPipeline(ctx, args)
+	case "quick":
+		err = app.runQuick(ctx, args)
+	case "config":
+		err = app.runConfig(args)
+	case "serve":
+		err = app.runServe(ctx, args)
+	case "schedule":
+		err = app.runSchedule(ctx, args)
+	case "discord":
+		err = app.runDiscord(ctx, args)
+	case "prompt-test":
+		err = app.runPromptTest(ctx, args)
+	case "regen":
+		err = app.runRegen(ctx, args)
+	case "regen-field":
+		err = app.runRegenField(ctx, args)
+	case "pack":
+		err = app.runPack(args)
+	case "backfill":
+		err = app.runBackfill(ctx, args)
+	case "report":
+		err = app.runReport(args)
+	case "cast":
+		err = app.runCast(ctx, args)
+	case "faction":
+		err = app.runFaction(ctx, args)
+	case "world":
+		err = app.runWorld(ctx, args)
+	case "riddles":
+		err = app.runRiddles(ctx, args)
+	case "shop":
+		err = app.runShop(ctx, args)
+	case "map":
+		err = app.runMap(ctx, args)
+	case "syllables":
+		err = app.runSyllables(ctx, args)
+	case "few-shot":
+		err = app.runFewShot(ctx, args)
+	case "bench":
+		err = app.runBench(ctx, args)
+	case "events":
+		err = app.runEvents(ctx, args)
+	case "archive":
+		err = app.runArchive(args)
+	case "tag", "untag", "note":
+		err = app.runAnnotate(command, args)
+	case "export":
+		err = app.runExport(args)
+	case "list":
+		err = app.runList(args)
+	case "browse":
+		err = app.runBrowse(args)
+	case "reserve", "release":
+		err = app.runReservation(command, args)
+	case "store":
+		err = app.runStore(ctx, args)
+	case "lint":
+		err = app.runLint(ctx, args)
+	case "lines":
+		err = app.runLines(ctx, args)
+	case "voice":
+		err = app.runVoice(args)
+	case "improve":
+		err = app.runImprove(ctx, args)
+	case "reroll":
+		err = app.runReroll(ctx, args)
+	case "drift":
+		err = app.runDrift(ctx, args)
+	case "models":
+		err = app.runModels(ctx, args)
+	case "provenance":
+		err = app.runProvenance(args)
+	case "systems":
+		err = app.runSystems()
+	case "completion":
+		err = app.runCompletion(args)
+	case "__complete":
+		err = app.runComplete(ctx, args)
+	case "man":
+		err = app.runMan(args)
+	default:
+		err = fmt.Errorf("unknown command %q (%s)", command, strings.Join(CommandNames(), ", "))
+	}
+	saveErr := generator.SaveIndexes()
+	if saveErr != nil {
+		fmt.Println("😡 vector index:", saveErr)
+	}
+	code := app.finish(command, err)
+	if err != nil {
+		log.Println("😡:", err)
+	}
+	os.Exit(code)
+}
+
+func getEnv(key, defaultValue string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Merge policies of the name conflicts
+const (
+	MergeSkip     = "skip"      // the imported character is not stored
+	MergeRename   = "rename"    // the imported character gets a numbered name (Thorin Oakenshield II)
+	MergeKeepBoth = "keep-both" // a near duplicate is stored as is, an exact duplicate is renamed
+)
+
+// Conflicts of an imported name
+const (
+	ConflictExact = "exact" // same name (case insensitive), or a reserved name
+	ConflictNear  = "near"  // same name without the accents, the spaces and the punctuation, or one letter apart
+)
+
+// MergeEntry is the outcome of an imported character
+type MergeEntry struct {
+	Name     string `json:"name"`
+	Conflict string `json:"conflict,omitempty"`
+	With     string `json:"with,omitempty"`
+	Action   string `json:"action"`
+	Stored   string `json:"stored,omitempty"`
+	ID       int    `json:"id,omitempty"`
+}
+
+// MergeReport lists what happened to every character of the imported registry
+type MergeReport struct {
+	Source   string       `json:"source"`
+	Policy   string       `json:"policy"`
+	DryRun   bool         `json:"dry_run,omitempty"`
+	Imported int          `json:"imported"`
+	Renamed  int          `json:"renamed"`
+	Skipped  int          `json:"skipped"`
+	Entries  []MergeEntry `json:"entries"`
+	// Warnings are the rows and the columns of the imported exports that could not be read
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// nearKey is the name without the case, the accents, the spaces and the punctuation
+func nearKey(name string) string {
+	return strings.Join(strings.Fields(collationKey(name)), "")
+}
+
+// editDistance is the Levenshtein distance of the two strings (in runes)
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
+
+// nameConflict returns the kind of conflict of the name with the stored names (and aliases) and the reserved names,
+// and the conflicting name; the short names must match exactly to be near duplicates
+func (r *Registry) nameConflict(name string) (string, string) {
+	names := []string{}
+	for _, character := range r.Characters {
+		names = append(names, character.Names()...)
+	}
+	for _, reservation := range r.Reservations {
+		names = append(names, reservation.Name)
+	}
+
+	key := nearKey(name)
+	near := ""
+	for _, stored := range names {
+		if strings.EqualFold(strings.TrimSpace(stored), strings.TrimSpace(name)) {
+			return ConflictExact, stored
+		}
+		storedKey := nearKey(stored)
+		if near == "" && (storedKey == key || min(len([]rune(key)), len([]rune(storedKey))) >= 5 && editDistance(key, storedKey) <= 1) {
+			near = stored
+		}
+	}
+	if near != "" {
+		return ConflictNear, near
+	}
+	return "", ""
+}
+
+var romanSuffixes = []string{"II", "III", "IV", "V", "VI", "VII", "VIII", "IX", "X"}
+
+// mergeName numbers the name until it is free (exact conflicts only, the numbered names are near each other)
+func (r *Registry) mergeName(name string) (string, error) {
+	for _, suffix := range romanSuffixes {
+		candidate := strings.TrimSpace(name) + " " + suffix
+		conflict, _ := r.nameConflict(candidate)
+		if conflict != ConflictExact {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("no free name for %q", name)
+}
+
+// Merge imports the characters of another registry with new IDs and table codes,
+// the conflicts are solved with the policy; the dry run only builds the report
+func (r *Registry) Merge(source string, characters []Character, policy string, dryRun bool) (MergeReport, error) {
+	report := MergeReport{Source: source, Policy: policy, DryRun: dryRun, Entries: []MergeEntry{}}
+	if !slices.Contains([]string{MergeSkip, MergeRename, MergeKeepBoth}, policy) {
+		return report, fmt.Errorf("unknown merge policy %q (%s, %s, %s)", policy, MergeSkip, MergeRename, MergeKeepBoth)
+	}
+
+	unlock, err := r.lock()
+	if err != nil {
+		return report, err
+	}
+	defer unlock()
+
+	// the dry run works on a copy, the next imported names are still compared to the previous ones
+	target := r
+	if dryRun {
+		target = &Registry{Characters: slices.Clone(r.Characters), Reservations: r.Reservations, NextID: r.NextID}
+	}
+
+	used := target.usedCodes()
+	for _, character := range characters {
+		entry := MergeEntry{Name: character.Name, Action: "imported"}
+		entry.Conflict, entry.With = target.nameConflict(character.Name)
+
+		switch {
+		case entry.Conflict == "":
+		case policy == MergeSkip:
+			entry.Action = "skipped"
+		case policy == MergeRename || entry.Conflict == ConflictExact:
+			name, err := target.mergeName(character.Name)
+			if err != nil {
+				return report, err
+			}
+			character.Name, entry.Action = name, "renamed"
+		}
+
+		if entry.Action == "skipped" {
+			report.Skipped++
+			report.Entries = append(report.Entries, entry)
+			continue
+		}
+		if entry.Action == "renamed" {
+			report.Renamed++
+		}
+		// the aliases already taken are dropped
+		character.Aliases = slices.DeleteFunc(slices.Clone(character.Aliases), func(alias string) bool {
+			conflict, _ := target.nameConflict(alias)
+			return conflict == ConflictExact
+		})
+		report.Imported++
+
+		// the creation time is kept, the update time makes the differential exports see the character
+		character.Code = TableCode(character.Name, used)
+		used[character.Code] = true
+		now := time.Now()
+		if character.CreatedAt == nil {
+			character.CreatedAt = &now
+		}
+		character.UpdatedAt = &now
+		character.ID = target.NextID
+		target.NextID++
+		target.Characters = append(target.Characters, character)
+		entry.Stored, entry.ID = character.Name, character.ID
+		report.Entries = append(report.Entries, entry)
+	}
+	if dryRun {
+		return report, nil
+	}
+	return report, r.save()
+}
+
+// MergeMarkdown renders the merge report
+func MergeMarkdown(report MergeReport) string {
+	markdown := fmt.Sprintf("# Merge of %s\n\n", report.Source)
+	markdown += fmt.Sprintf("Policy `%s`: %d imported (%d renamed), %d skipped", report.Policy, report.Imported, report.Renamed, report.Skipped)
+	if report.DryRun {
+		markdown += " (dry run, nothing stored)"
+	}
+	markdown += "\n\n"
+	rows := [][]string{}
+	for _, entry := range report.Entries {
+		rows = append(rows, []string{entry.Name, entry.Conflict, entry.With, entry.Action, entry.Stored})
+	}
+	markdown += RenderTable([]string{"Name", "Conflict", "With", "Action", "Stored as"}, rows)
+	if len(report.Warnings) > 0 {
+		markdown += "\n## Warnings\n\n"
+		for _, warning := range report.Warnings {
+			markdown += "- " + escapeMarkdown(warning) + "\n"
+		}
+	}
+	return markdown
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"04-npc-generator/model"
+
+	"github.com/ollama/ollama/api"
+)
+
+// ErrNotMigrated is a character the model couldn't upgrade, the next run tries again
+var ErrNotMigrated = errors.New("not migrated")
+
+// Migration upgrades the stored characters of an older schema version to its version
+type Migration struct {
+	Version     int
+	Description string
+	// Upgrade fills the new fields of the character, with targeted requests to the model when needed
+	// (nil: the decoding of the registry already upgrades the record)
+	Upgrade func(g *Generator, ctx context.Context, character *Character) error
+}
+
+// migrations are the versions of the schema, in order; the last one is model.CurrentSchema
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "table codes and normalized fields (done by the loading of the registry)",
+	},
+	{
+		Version:     2,
+		Description: "extras of the genre (and of the theme) of the character",
+		Upgrade:     (*Generator).fillExtras,
+	},
+}
+
+// pendingMigrations returns the migrations of the character
+func pendingMigrations(character Character) []Migration {
+	return slices.DeleteFunc(slices.Clone(migrations), func(migration Migration) bool {
+		return migration.Version <= character.SchemaVersion
+	})
+}
+
+// characterGenre is the genre (and the theme) of the generation of the character,
+// the current genre for the characters without provenance
+func (g *Generator) characterGenre(character Character) (Genre, error) {
+	if character.Provenance == nil || character.Provenance.Genre == "" ||
+		character.Provenance.Genre == g.genre.Name && character.Provenance.Theme == g.genre.Theme {
+		return g.genre, nil
+	}
+	genre, err := FindGenre(g.genres, character.Provenance.Genre)
+	if err != nil || character.Provenance.Theme == "" {
+		return genre, err
+	}
+	theme, err := FindTheme(g.themes, character.Provenance.Theme)
+	if err != nil {
+		return genre, err
+	}
+	return genre.WithTheme(theme), nil
+}
+
+// fillExtras asks the model for the extras of the genre the character doesn't have,
+// the other fields are given as context and stay unchanged (3 attempts)
+func (g *Generator) fillExtras(ctx context.Context, character *Character) error {
+	genre, err := g.characterGenre(*character)
+	if err != nil {
+		return err
+	}
+	missing := slices.DeleteFunc(slices.Clone(genre.Extras), func(extra GenreExtra) bool {
+		return strings.TrimSpace(character.Extras[extra.Name]) != ""
+	})
+	if len(missing) == 0 {
+		return nil
+	}
+	names := []string{}
+	for _, extra := range missing {
+		names = append(names, extra.Name+" ("+extra.Description+")")
+	}
+	schema := Pack{Extras: missing}.WithExtras(map[string]any{
+		"type":       "object",
+		"properties": map[string]any{},
+		"required":   []string{},
+	})
+	characterContext, err := json.Marshal(character)
+	if err != nil {
+		return err
+	}
+	messages := []api.Message{
+		{Role: "system", Content: genre.Instructions},
+		{Role: "user", Content: fmt.Sprintf("Here is a character: %s\nGive the extras of this character, consistent with all the other fields: %s.",
+			characterContext, strings.Join(names, ", "))},
+	}
+	options := map[string]interface{}{"temperature": 0.8}
+
+	for attempt := 0; attempt < 3; attempt++ {
+		answer, err := g.chat(ctx, DomainCharacter, messages, schema, options)
+		if err != nil {
+			return err
+		}
+		if answer.Truncated {
+			continue
+		}
+		filled := struct {
+			Extras map[string]string `json:"extras"`
+		}{}
+		err = decodeAnswer(answer.Content, &filled)
+		for _, extra := range missing {
+			if err == nil && strings.TrimSpace(filled.Extras[extra.Name]) == "" {
+				err = fmt.Errorf("%w: extras.%s", ErrEmptyAnswer, extra.Name)
+			}
+		}
+		if err != nil {
+			fmt.Println("😡 extras:", err)
+			continue
+		}
+		extras := maps.Clone(character.Extras)
+		if extras == nil {
+			extras = map[string]string{}
+		}
+		for _, extra := range missing {
+			extras[extra.Name] = strings.TrimSpace(filled.Extras[extra.Name])
+		}
+		character.Extras = extras
+		return nil
+	}
+	return fmt.Errorf("%w: no valid extras for %s after 3 attempts", ErrNotMigrated, character.Name)
+}
+
+// runStoreMigrate upgrades the characters of an older schema version, every character
+// is saved after its migrations, so an interrupted migration goes on with the next run
+func (a *App) runStoreMigrate(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("store migrate", flag.ExitOnError)
+	campaign := flags.String("campaign", getEnv("CAMPAIGN", DefaultCampaign), "campaign of the characters")
+	dryRun := flags.Bool("dry-run", false, "only list the pending migrations")
+	flags.Parse(args)
+
+	registry, err := a.storage.Registry(*campaign)
+	if err != nil {
+		return err
+	}
+	migrated, failed := 0, []string{}
+	for _, character := range registry.List() {
+		if character.SchemaVersion > model.CurrentSchema {
+			return fmt.Errorf("%s has the schema version %d, this build knows %d", character.Name, character.SchemaVersion, model.CurrentSchema)
+		}
+		pending := pendingMigrations(character)
+		if len(pending) == 0 {
+			continue
+		}
+		if *dryRun {
+			for _, migration := range pending {
+				fmt.Printf("🧭 %d %s: v%d %s\n", character.ID, character.Name, migration.Version, migration.Description)
+			}
+			migrated++
+			continue
+		}
+
+		upgraded := character
+		for _, migration := range pending {
+			if migration.Upgrade != nil {
+				err = migration.Upgrade(a.generator, ctx, &upgraded)
+				if err != nil {
+					break
+				}
+			}
+			upgraded.SchemaVersion = migration.Version
+		}
+		if err != nil && !errors.Is(err, ErrNotMigrated) {
+			return err
+		}
+		if err != nil {
+			fmt.Println("😡:", err)
+			failed = append(failed, character.Name)
+		}
+		if upgraded.SchemaVersion == character.SchemaVersion {
+			continue
+		}
+		_, err = registry.Modify(character.ID, func(stored *Character) {
+			stored.Extras, stored.SchemaVersion = upgraded.Extras, upgraded.SchemaVersion
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("🧭 %d %s: v%d → v%d\n", character.ID, character.Name, character.SchemaVersion, upgraded.SchemaVersion)
+		migrated++
+	}
+
+	if *dryRun {
+		fmt.Printf("🧭 %d characters to migrate to v%d\n", migrated, model.CurrentSchema)
+		return nil
+	}
+	fmt.Printf("🧭 %d characters migrated to v%d\n", migrated, model.CurrentSchema)
+	if len(failed) > 0 {
+		return fmt.Errorf("%d characters are not migrated yet (run store migrate again): %s", len(failed), strings.Join(failed, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+//go:build minimal
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// The minimal build (go build -tags minimal) is the generation loop only:
+// without the HTTP server, the jobs, the schedule and the message queues,
+// for a small binary embedded in other tools
+
+var errMinimalBuild = errors.New("not in the minimal build (go build without -tags minimal)")
+
+func (a *App) runServe(ctx context.Context, args []string) error {
+	return errMinimalBuild
+}
+
+func (a *App) runSchedule(ctx context.Context, args []string) error {
+	return errMinimalBuild
+}
+
+func (a *App) runDiscord(ctx context.Context, args []string) error {
+	return errMinimalBuild
+}
+
+// DiscordHook is never created in the minimal build
+type DiscordHook struct {
+	HookFuncs
+}
+
+func NewDiscordHook(webhookURL string, events []string, transport http.RoundTripper) (*DiscordHook, error) {
+	return nil, errMinimalBuild
+}
+
+// Sink is never created in the minimal build
+type Sink struct{}
+
+func NewSink(sinkURL, topic string, buffer int, transport http.RoundTripper) (*Sink, error) {
+	return nil, errMinimalBuild
+}
+
+func (s *Sink) Publish(ctx context.Context, campaign string, character Character) error {
+	return errMinimalBuild
+}
+
+func (s *Sink) Close() error {
+	return nil
+}
@@ -0,0 +1,206 @@
+// Package model holds the domain types of the generator and their JSON normalization
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ErrMissingField is returned by the decoding when a required field is empty
+var ErrMissingField = errors.New("missing field")
+
+// CurrentSchema is the schema version of the stored characters, store migrate upgrades the older ones
+const CurrentSchema = 2
+
+type Character struct {
+	// SchemaVersion is the version of the record (0: stored before the versioning)
+	SchemaVersion int `json:"schema_version,omitempty"`
+	// ID and Code (a short table code like THOR) are given by the registry
+	ID   int    `json:"id,omitempty"`
+	Code string `json:"code,omitempty"`
+	Name string `json:"name"`
+	// ASCIIName is the transliterated name for the game engines without diacritics (TRANSLITERATE)
+	ASCIIName string `json:"ascii_name,omitempty"`
+	// NativeName is the name in the script of the kind, Name is its romanization
+	NativeName string `json:"native_name,omitempty"`
+	// Title and Aliases are only generated on request: Thorgar the Unbent, "Old Hammer"
+	Title   string   `json:"title,omitempty"`
+	Aliases []string `json:"aliases,omitempty"`
+	Kind    string   `json:"kind"`
+	// Class and Level are only set when an equipment is requested
+	Class     string     `json:"class,omitempty"`
+	Level     int        `json:"level,omitempty"`
+	Equipment *Equipment `json:"equipment,omitempty"`
+	// Stats are only set with a game system
+	Stats map[string]int `json:"stats,omitempty"`
+	// Parents are the kinds of a hybrid (Half-Elf: Elf and Human)
+	Parents []string `json:"parents,omitempty"`
+	// RelativeOf is the ID of the stored character this one is the child or sibling of
+	RelativeOf int    `json:"relative_of,omitempty"`
+	Relation   string `json:"relation,omitempty"`
+	// Backstory is only written by regen-field
+	Backstory string `json:"backstory,omitempty"`
+	// Lines are spoken by the character and Age is its age group (young, adult, elder),
+	// both are written by the lines command for the voice scripts
+	Lines []string `json:"lines,omitempty"`
+	Age   string   `json:"age,omitempty"`
+	// PortraitPrompt is the text-to-image prompt of the portrait, written by a pipeline
+	PortraitPrompt string `json:"portrait_prompt,omitempty"`
+	// CreatedAt and UpdatedAt are set by the registry
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+	// Region and Settlement are set by a world build (Settlement by a shop too)
+	Region     string `json:"region,omitempty"`
+	Settlement string `json:"settlement,omitempty"`
+	// Home is the district of the settlement map the character lives in (map)
+	Home string `json:"home,omitempty"`
+	// Extras are the additional fields of the genre (augmentations, starship...)
+	Extras map[string]string `json:"extras,omitempty"`
+	// PlotHooks, Secrets, Curses and Boons are the story tables drawn for the character (STORY_TABLES)
+	PlotHooks []string `json:"plot_hooks,omitempty"`
+	Secrets   []string `json:"secrets,omitempty"`
+	Curses    []string `json:"curses,omitempty"`
+	Boons     []string `json:"boons,omitempty"`
+	// Tags and Notes are the annotations of the game master
+	Tags  []string `json:"tags,omitempty"`
+	Notes string   `json:"notes,omitempty"`
+	// ArchivedAt retires the character (killed off, rejected), its names are still taken
+	ArchivedAt    *time.Time `json:"archived_at,omitempty"`
+	ArchiveReason string     `json:"archive_reason,omitempty"`
+	// Provenance is set by the generation (nil for the imported characters)
+	Provenance *Provenance `json:"provenance,omitempty"`
+	// Grade is set by the review of the judge model (REVIEW)
+	Grade *Grade `json:"grade,omitempty"`
+}
+
+// NormalizeTag returns the tag in lower case, without spaces ("Arc 2" is "arc-2")
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.Join(strings.Fields(tag), "-"))
+}
+
+// HasTag is true when the character has the tag (case insensitive)
+func (c Character) HasTag(tag string) bool {
+	return slices.Contains(c.Tags, NormalizeTag(tag))
+}
+
+// Names returns the name, the aliases and the ASCII name when it differs,
+// the dedup covers all of them (Elise and Élise collide once transliterated)
+func (c Character) Names() []string {
+	names := append([]string{c.Name}, c.Aliases...)
+	if c.ASCIIName != "" && !slices.ContainsFunc(names, func(name string) bool { return strings.EqualFold(name, c.ASCIIName) }) {
+		names = append(names, c.ASCIIName)
+	}
+	return names
+}
+
+// Archived is true when the character is retired
+func (c Character) Archived() bool {
+	return c.ArchivedAt != nil
+}
+
+// DisplayName is the name with the title and the aliases: Thorgar the Unbent, "Old Hammer"
+func (c Character) DisplayName() string {
+	name := c.Name
+	if c.Title != "" {
+		name += " " + c.Title
+	}
+	for _, alias := range c.Aliases {
+		name += fmt.Sprintf(", %q", alias)
+	}
+	return name
+}
+
+// UnmarshalJSON normalizes the whitespaces and the casing of the kind ("  dwarf " is "Dwarf"),
+// the name and the kind are required
+func (c *Character) UnmarshalJSON(data []byte) error {
+	type character Character
+	decoded := character{}
+	err := json.Unmarshal(data, &decoded)
+	if err != nil {
+		return err
+	}
+
+	decoded.Name = normalizeSpaces(decoded.Name)
+	decoded.Title = normalizeSpaces(decoded.Title)
+	decoded.ASCIIName = normalizeSpaces(decoded.ASCIIName)
+	// the empty aliases, the name and the repeated aliases are dropped
+	aliases := []string{}
+	for _, alias := range decoded.Aliases {
+		alias = normalizeSpaces(alias)
+		if alias == "" || strings.EqualFold(alias, decoded.Name) || slices.ContainsFunc(aliases, func(a string) bool { return strings.EqualFold(a, alias) }) {
+			continue
+		}
+		aliases = append(aliases, alias)
+	}
+	decoded.Aliases = nil
+	if len(aliases) > 0 {
+		decoded.Aliases = aliases
+	}
+	decoded.Kind = normalizeCasing(normalizeSpaces(decoded.Kind))
+	decoded.Class = normalizeSpaces(decoded.Class)
+	decoded.Backstory = strings.TrimSpace(decoded.Backstory)
+	decoded.Notes = strings.TrimSpace(decoded.Notes)
+	decoded.ArchiveReason = strings.TrimSpace(decoded.ArchiveReason)
+	for idx, tag := range decoded.Tags {
+		decoded.Tags[idx] = NormalizeTag(tag)
+	}
+	for idx, parent := range decoded.Parents {
+		decoded.Parents[idx] = normalizeCasing(normalizeSpaces(parent))
+	}
+	decoded.PlotHooks = normalizeTexts(decoded.PlotHooks)
+	decoded.Secrets = normalizeTexts(decoded.Secrets)
+	decoded.Curses = normalizeTexts(decoded.Curses)
+	decoded.Boons = normalizeTexts(decoded.Boons)
+	if decoded.Name == "" {
+		return fmt.Errorf("%w: name", ErrMissingField)
+	}
+	if decoded.Kind == "" {
+		return fmt.Errorf("%w: kind", ErrMissingField)
+	}
+	*c = Character(decoded)
+	return nil
+}
+
+// normalizeSpaces trims the text and collapses the inner whitespaces
+func normalizeSpaces(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// normalizeTexts trims the texts of a list and drops the empty ones (nil: no text)
+func normalizeTexts(texts []string) []string {
+	normalized := []string{}
+	for _, text := range texts {
+		if text = normalizeSpaces(text); text != "" {
+			normalized = append(normalized, text)
+		}
+	}
+	if len(normalized) == 0 {
+		return nil
+	}
+	return normalized
+}
+
+// normalizeCasing capitalizes every word of an all lower case or all upper case text
+// ("half-elf" and "HALF-ELF" are "Half-Elf"), a mixed case text is kept as is
+func normalizeCasing(text string) string {
+	if text != strings.ToLower(text) && text != strings.ToUpper(text) {
+		return text
+	}
+	words := strings.FieldsFunc(text, func(r rune) bool { return r == ' ' || r == '-' })
+	separators := strings.FieldsFunc(text, func(r rune) bool { return r != ' ' && r != '-' })
+	result := ""
+	for idx, word := range words {
+		first, size := utf8.DecodeRuneInString(word)
+		result += string(unicode.ToUpper(first)) + strings.ToLower(word[size:])
+		if idx < len(separators) {
+			result += separators[idx]
+		}
+	}
+	return result
+}
@@ -0,0 +1,43 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Equipment is the loadout of a character, one item per slot
+type Equipment struct {
+	Weapon   string   `json:"weapon"`
+	Armor    string   `json:"armor"`
+	Trinkets []string `json:"trinkets"`
+}
+
+// UnmarshalJSON trims the items and drops the empty trinkets,
+// the weapon and the armor are required
+func (e *Equipment) UnmarshalJSON(data []byte) error {
+	type equipment Equipment
+	decoded := equipment{}
+	err := json.Unmarshal(data, &decoded)
+	if err != nil {
+		return err
+	}
+
+	decoded.Weapon = normalizeSpaces(decoded.Weapon)
+	decoded.Armor = normalizeSpaces(decoded.Armor)
+	trinkets := []string{}
+	for _, trinket := range decoded.Trinkets {
+		trinket = normalizeSpaces(trinket)
+		if trinket != "" {
+			trinkets = append(trinkets, trinket)
+		}
+	}
+	decoded.Trinkets = trinkets
+	if decoded.Weapon == "" {
+		return fmt.Errorf("%w: weapon", ErrMissingField)
+	}
+	if decoded.Armor == "" {
+		return fmt.Errorf("%w: armor", ErrMissingField)
+	}
+	*e = Equipment(decoded)
+	return nil
+}
@@ -0,0 +1,11 @@
+package model
+
+// Grade is the review of a character by the judge model with the rubric of its domain:
+// the score of every criterion (0 to 10) and the weighted score (0 to 1)
+type Grade struct {
+	Judge  string         `json:"judge"`
+	Scores map[string]int `json:"scores"`
+	Score  float64        `json:"score"`
+	Pass   bool           `json:"pass"`
+	Reason string         `json:"reason,omitempty"`
+}
@@ -0,0 +1,27 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Provenance records how a character was generated, for the reproducibility audits:
+// the same model digest, prompt version, options and seed give the same answer
+type Provenance struct {
+	Model       string `json:"model"`
+	ModelDigest string `json:"model_digest,omitempty"`
+	// Genre and Spec are the request of the run, reroll builds the same prompt with them
+	Genre string          `json:"genre,omitempty"`
+	Spec  json.RawMessage `json:"spec,omitempty"`
+	// Theme is the seasonal pack added to the genre
+	Theme string `json:"theme,omitempty"`
+	// PromptVersion is a digest of the prompt messages (instructions, genre, kinds)
+	PromptVersion string         `json:"prompt_version"`
+	Options       map[string]any `json:"options,omitempty"`
+	Seed          int            `json:"seed"`
+	// Variation is the seed offset of a reroll (0: the original)
+	Variation int `json:"variation,omitempty"`
+	// Grounding is the chunks of the campaign notes given to the model: regions/north.md#2
+	Grounding   []string  `json:"grounding,omitempty"`
+	GeneratedAt time.Time `json:"generated_at"`
+}
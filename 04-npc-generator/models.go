@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+// RequiredModel is a model of the configuration, Digest pins its version (name@sha256:...)
+type RequiredModel struct {
+	Name   string
+	Digest string
+}
+
+// RequiredModels returns the models of MODELS (comma separated), by default the model
+// of the generation (LLM) and the embedding model of the campaign notes (with NOTES_DIR)
+func RequiredModels() []RequiredModel {
+	names := os.Getenv("MODELS")
+	if names == "" {
+		names = os.Getenv("LLM")
+		if os.Getenv("NOTES_DIR") != "" {
+			names += "," + getEnv("EMBEDDING_MODEL", "nomic-embed-text")
+		}
+	}
+	models := []RequiredModel{}
+	for _, name := range strings.Split(names, ",") {
+		name, digest, _ := strings.Cut(strings.TrimSpace(name), "@")
+		if name == "" {
+			continue
+		}
+		models = append(models, RequiredModel{Name: name, Digest: strings.TrimPrefix(digest, "sha256:")})
+	}
+	return models
+}
+
+// sameModel compares the names with their default tag (llama3.2 is llama3.2:latest)
+func sameModel(listed, name string) bool {
+	if !strings.Contains(name, ":") {
+		name += ":latest"
+	}
+	return listed == name
+}
+
+// installedDigest returns the digest of the installed model, empty when it is missing
+func installedDigest(ctx context.Context, client *api.Client, name string) (string, error) {
+	list, err := client.List(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, listed := range list.Models {
+		if sameModel(listed.Name, name) {
+			return listed.Digest, nil
+		}
+	}
+	return "", nil
+}
+
+// pullProgress prints the progress of a pull, once every 10% of a layer
+func pullProgress() api.PullProgressFunc {
+	layer, step := "", int64(-1)
+	return func(progress api.ProgressResponse) error {
+		if progress.Total == 0 {
+			fmt.Println("📥", progress.Status)
+			return nil
+		}
+		percent := progress.Completed * 100 / progress.Total
+		if progress.Digest != layer || percent/10 != step {
+			layer, step = progress.Digest, percent/10
+			fmt.Printf("📥 %s %d%% of %d MB\n", progress.Status, percent, progress.Total/1_000_000)
+		}
+		return nil
+	}
+}
+
+// EnsureModel pulls the model when it is missing (or when its digest isn't the pinned one),
+// a failed pull is tried again: Ollama resumes the layers already downloaded
+func EnsureModel(ctx context.Context, client *api.Client, model RequiredModel, attempts int, offline *OfflineGuard) error {
+	digest, err := installedDigest(ctx, client, model.Name)
+	if err != nil {
+		return err
+	}
+	if digest != "" && (model.Digest == "" || strings.HasPrefix(digest, model.Digest)) {
+		fmt.Printf("✅ %s %.12s\n", model.Name, digest)
+		return nil
+	}
+	if digest != "" {
+		fmt.Printf("🔄 %s is %.12s, the pinned digest is %.12s\n", model.Name, digest, model.Digest)
+	}
+
+	// a pull downloads from the registry, even through the Ollama host
+	err = offline.Refuse("pull " + model.Name)
+	if err != nil {
+		return err
+	}
+	backoff := 2 * time.Second
+	for attempt := 1; ; attempt++ {
+		// the blobs are verified by Ollama (verifying sha256 digest) before the success
+		err = client.Pull(ctx, &api.PullRequest{Model: model.Name}, pullProgress())
+		if err == nil || attempt == attempts || ctx.Err() != nil {
+			break
+		}
+		fmt.Printf("🔌 %s: %s, resume in %s\n", model.Name, err, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+	if err != nil {
+		return fmt.Errorf("pull %s: %w", model.Name, err)
+	}
+
+	digest, err = installedDigest(ctx, client, model.Name)
+	if err != nil {
+		return err
+	}
+	switch {
+	case digest == "":
+		return fmt.Errorf("%s is not installed after the pull", model.Name)
+	case model.Digest != "" && !strings.HasPrefix(digest, model.Digest):
+		return fmt.Errorf("%s has the digest %.12s, not the pinned %.12s", model.Name, digest, model.Digest)
+	}
+	fmt.Printf("✅ %s %.12s pulled\n", model.Name, digest)
+	return nil
+}
+
+// runModels provisions the models of the configuration (models ensure),
+// for the CI images: every model is tried, the command fails when one of them is missing
+func (a *App) runModels(ctx context.Context, args []string) error {
+	if len(args) < 1 || args[0] != "ensure" {
+		return errors.New("usage: models ensure [--attempts 3]")
+	}
+	flags := flag.NewFlagSet("models ensure", flag.ExitOnError)
+	attempts := flags.Int("attempts", 3, "attempts of a pull before it fails")
+	flags.Parse(args[1:])
+
+	models := RequiredModels()
+	if len(models) == 0 {
+		return errors.New("no model in LLM or MODELS")
+	}
+	failed := []string{}
+	for _, model := range models {
+		err := EnsureModel(ctx, a.generator.client, model, max(*attempts, 1), a.offline)
+		if err != nil {
+			fmt.Println("😡:", err)
+			failed = append(failed, model.Name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d models are missing: %s", len(failed), len(models), strings.Join(failed, ", "))
+	}
+	return nil
+}
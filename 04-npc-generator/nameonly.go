@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+// nameSchema is the minimal schema of the name-only mode
+var nameSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"name": map[string]any{"type": "string"},
+	},
+	"required": []string{"name"},
+}
+
+// nameInstructions are the rules of the kind (or of the parents of a hybrid) only,
+// instead of the instructions of the genre and of every kind
+func nameInstructions(kinds []KindDefinition, spec Spec) string {
+	instructions := "You generate random character names. Answer with the name only.\n"
+	for _, name := range append([]string{spec.Kind}, spec.Parents...) {
+		kind, ok := findKind(kinds, name)
+		if !ok {
+			continue
+		}
+		instructions += "\n" + kind.Plural + ":\n"
+		for _, rule := range kind.Rules {
+			instructions += "- " + rule + "\n"
+		}
+		instructions += "- Pattern: " + kind.Pattern + "\n"
+	}
+	return instructions
+}
+
+// GenerateName is the fast path of Generate for the name-only specs: a stripped prompt,
+// the minimal schema, no tools nor notes; the kind of the answer is the kind of the spec
+func (g *Generator) GenerateName(ctx context.Context, spec Spec, options map[string]interface{}) (Answer, error) {
+	if g.syllables != nil && g.syllables.Kind == spec.Kind {
+		return g.syllables.Answer(spec, familyCustom(g.kinds, spec.Kind, spec.Parents), options)
+	}
+	messages := []api.Message{
+		{Role: "system", Content: nameInstructions(g.kinds, spec)},
+		{Role: "user", Content: "Generate a random name for a " + spec.Kind + "."},
+	}
+	if spec.Prefix != "" {
+		messages[1].Content += fmt.Sprintf(" The name must start with %q.", spec.Prefix)
+	}
+	if spec.Relative != nil {
+		messages[1].Content += " " + relativeInstructions(spec.Relative)
+	}
+	answer, err := g.chatWithTools(ctx, DomainName, messages, nameSchema, options, nil)
+	answer.PromptVersion = promptVersion(messages)
+	if err != nil || answer.Truncated {
+		return answer, err
+	}
+
+	// the answer gets the kind, so it is parsed like the full answers
+	name := map[string]any{}
+	if decodeAnswer(answer.Content, &name) == nil {
+		name["kind"] = spec.Kind
+		content, err := json.Marshal(name)
+		if err != nil {
+			return answer, err
+		}
+		answer.Content = string(content)
+	}
+	return answer, nil
+}
+
+// checkNameOnly rejects the options of a name-only spec that need the full character
+func checkNameOnly(spec Spec) error {
+	if !spec.NameOnly {
+		return nil
+	}
+	options := []string{}
+	if spec.Class != "" {
+		options = append(options, "class")
+	}
+	if spec.System != "" {
+		options = append(options, "system")
+	}
+	if spec.Aliases {
+		options = append(options, "aliases")
+	}
+	if len(spec.Tables) > 0 {
+		options = append(options, "story table")
+	}
+	if len(options) > 0 {
+		return errors.New("the name-only mode can't have a " + strings.Join(options, ", "))
+	}
+	return nil
+}
+
+// perItem is the generation time of an accepted character
+func perItem(metrics RunMetrics, accepted int) string {
+	if accepted == 0 {
+		return "-"
+	}
+	return fmt.Sprint((time.Duration(metrics.GenerationMS) * time.Millisecond / time.Duration(accepted)).Round(time.Millisecond))
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"04-npc-generator/vector"
+
+	"github.com/ollama/ollama/api"
+)
+
+// maxChunkSize is the size of a chunk of the notes, the paragraphs are kept whole
+const maxChunkSize = 1000
+
+// NoteChunk is a part of a notes file
+type NoteChunk struct {
+	// Source is the file and the chunk number: regions/north.md#2
+	Source string `json:"source"`
+	Text   string `json:"text"`
+}
+
+// NotesIndex grounds the generation in the campaign notes (NOTES_DIR): the notes are chunked
+// and embedded once, every generation gets the chunks closest to its spec
+type NotesIndex struct {
+	client *api.Client
+	model  string
+	topK   int
+	chunks []NoteChunk
+	// vectors are the embeddings of the chunks by digest (chunkKey), keys the first chunk of a digest
+	vectors *vector.Index
+	keys    map[string]int
+
+	mutex   sync.Mutex
+	queries map[string][]float32
+	// pinned chunks are returned instead of a retrieval (reroll)
+	pinned []NoteChunk
+}
+
+// chunkNotes splits a text on its blank lines and its headings, the paragraphs
+// are gathered up to maxChunkSize
+func chunkNotes(text string) []string {
+	chunks := []string{}
+	current := ""
+	flush := func() {
+		if strings.TrimSpace(current) != "" {
+			chunks = append(chunks, strings.TrimSpace(current))
+		}
+		current = ""
+	}
+	for _, paragraph := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n\n") {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" {
+			continue
+		}
+		if strings.HasPrefix(paragraph, "#") || len(current)+len(paragraph) > maxChunkSize {
+			flush()
+		}
+		current += paragraph + "\n\n"
+	}
+	flush()
+	return chunks
+}
+
+// chunkKey is the digest of a chunk in the vector index, only the new or changed chunks are embedded again
+func chunkKey(model, text string) string {
+	sum := sha256.Sum256([]byte(model + "\x00" + text))
+	return hex.EncodeToString(sum[:])
+}
+
+// LoadNotes reads the .md and .txt files of the directory, and embeds their chunks
+// with the embedding model in the vector index of indexPath (the chunks of the removed
+// or changed notes are removed from it)
+func LoadNotes(ctx context.Context, client *api.Client, dir, model string, topK int, indexPath string, options vector.Options) (*NotesIndex, error) {
+	index := &NotesIndex{client: client, model: model, topK: max(topK, 1), queries: map[string][]float32{}}
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		extension := strings.ToLower(filepath.Ext(path))
+		if extension != ".md" && extension != ".txt" {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		relative, _ := filepath.Rel(dir, path)
+		for idx, text := range chunkNotes(string(data)) {
+			index.chunks = append(index.chunks, NoteChunk{Source: fmt.Sprintf("%s#%d", filepath.ToSlash(relative), idx+1), Text: text})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(index.chunks) == 0 {
+		return nil, fmt.Errorf("%s: no .md or .txt notes", dir)
+	}
+
+	index.vectors, err = vector.Load(indexPath, options)
+	if errors.Is(err, vector.ErrFormat) {
+		fmt.Println("⚠️ the notes index is built again:", err)
+		index.vectors, err = vector.New(options), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	index.keys = map[string]int{}
+	missing := []int{}
+	for idx, chunk := range index.chunks {
+		key := chunkKey(model, chunk.Text)
+		if _, ok := index.keys[key]; ok {
+			continue
+		}
+		index.keys[key] = idx
+		if !index.vectors.Has(key) {
+			missing = append(missing, idx)
+		}
+	}
+	stale := 0
+	for _, key := range index.vectors.IDs() {
+		if _, ok := index.keys[key]; !ok {
+			index.vectors.Remove(key)
+			stale++
+		}
+	}
+	// a batch of chunks per request
+	for batch := range slices.Chunk(missing, 32) {
+		texts := []string{}
+		for _, idx := range batch {
+			texts = append(texts, index.chunks[idx].Text)
+		}
+		embeddings, err := index.embed(ctx, texts)
+		if err != nil {
+			return nil, err
+		}
+		for position, idx := range batch {
+			err = index.vectors.Add(chunkKey(model, index.chunks[idx].Text), embeddings[position])
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	fmt.Printf("📚 %d chunks of notes, %d embedded with %s, %d removed\n", len(index.chunks), len(missing), model, stale)
+
+	if len(missing) > 0 || stale > 0 {
+		// the removed chunks stay in the graph until it is built again
+		if index.vectors.Deleted() > index.vectors.Len()/4 {
+			index.vectors.Compact()
+		}
+		err = index.vectors.Save(indexPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return index, nil
+}
+
+func (n *NotesIndex) embed(ctx context.Context, texts []string) ([][]float32, error) {
+	response, err := n.client.Embed(ctx, &api.EmbedRequest{Model: n.model, Input: texts})
+	if err != nil {
+		return nil, fmt.Errorf("embeddings of the notes (%s): %w", n.model, err)
+	}
+	if len(response.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("%d embeddings for %d chunks", len(response.Embeddings), len(texts))
+	}
+	return response.Embeddings, nil
+}
+
+// Retrieve returns topK chunks among the 2*topK closest to the query (a search of the vector index): the query of a spec
+// is the same for every slot, the draw lets the characters use different parts of the notes
+func (n *NotesIndex) Retrieve(ctx context.Context, query string) ([]NoteChunk, error) {
+	if n.pinned != nil {
+		return n.pinned, nil
+	}
+	n.mutex.Lock()
+	queryEmbedding, ok := n.queries[query]
+	n.mutex.Unlock()
+	if !ok {
+		embeddings, err := n.embed(ctx, []string{query})
+		if err != nil {
+			return nil, err
+		}
+		queryEmbedding = embeddings[0]
+		n.mutex.Lock()
+		n.queries[query] = queryEmbedding
+		n.mutex.Unlock()
+	}
+
+	results, err := n.vectors.Search(queryEmbedding, 2*n.topK)
+	if err != nil {
+		return nil, err
+	}
+	candidates := []NoteChunk{}
+	for _, result := range results {
+		// the same text in two files is one vector, the first chunk is retrieved
+		if idx, ok := n.keys[result.ID]; ok {
+			candidates = append(candidates, n.chunks[idx])
+		}
+	}
+	rand.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+	return candidates[:min(n.topK, len(candidates))], nil
+}
+
+// loadNotes grounds the generator in the notes of the directory ("": no notes),
+// EMBEDDING_MODEL embeds them and NOTES_TOP_K chunks go in every prompt
+func (a *App) loadNotes(ctx context.Context, dir string) error {
+	if dir == "" {
+		return nil
+	}
+	topK, err := strconv.Atoi(getEnv("NOTES_TOP_K", "3"))
+	if err != nil {
+		return err
+	}
+	model := getEnv("EMBEDDING_MODEL", "nomic-embed-text")
+	options, err := vectorOptions()
+	if err != nil {
+		return err
+	}
+	a.generator.notes, err = LoadNotes(ctx, a.generator.client, dir, model, topK, a.storage.NotesIndexPath(model), options)
+	return err
+}
+
+// Pin returns an index always retrieving the chunks of the sources (regions/north.md#2),
+// an error when a source is not in the notes anymore
+func (n *NotesIndex) Pin(sources []string) (*NotesIndex, error) {
+	pinned := []NoteChunk{}
+	for _, source := range sources {
+		idx := slices.IndexFunc(n.chunks, func(chunk NoteChunk) bool { return chunk.Source == source })
+		if idx < 0 {
+			return nil, fmt.Errorf("the chunk %s is not in the notes anymore", source)
+		}
+		pinned = append(pinned, n.chunks[idx])
+	}
+	return &NotesIndex{client: n.client, model: n.model, topK: n.topK, chunks: n.chunks, vectors: n.vectors, keys: n.keys, queries: map[string][]float32{}, pinned: pinned}, nil
+}
+
+// notesInstructions is the system message of the retrieved chunks
+func notesInstructions(chunks []NoteChunk) string {
+	instructions := "Here are notes of the campaign world. When it fits, the character comes from, " +
+		"lives in or took part in the places, people and events of these notes:\n"
+	for _, chunk := range chunks {
+		instructions += "\n---\n" + chunk.Text + "\n"
+	}
+	return instructions
+}
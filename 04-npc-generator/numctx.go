@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/ollama/ollama/api"
+)
+
+// NumCtxAuto sizes num_ctx per request (NUM_CTX=auto)
+const NumCtxAuto = "auto"
+
+// minNumCtx is the smallest context of the auto sizing
+const minNumCtx = 2048
+
+// ContextSizer computes the num_ctx of a request from the length of its prompt and its
+// num_predict: the tokens of the prompt are estimated from its characters, with the ratio
+// measured on the answers (prompt_eval_count); the sizes are powers of 2 because
+// Ollama reloads the model when num_ctx changes
+type ContextSizer struct {
+	mutex sync.Mutex
+	// tokensPerChar starts with 4 characters per token, it only grows with the measures
+	// (a prompt in the KV cache of Ollama is partly evaluated, it measures less)
+	tokensPerChar float64
+	// contextLength is the context length of the model (0: unknown, no clamp)
+	contextLength int
+	warned        map[string]bool
+}
+
+func NewContextSizer() *ContextSizer {
+	return &ContextSizer{tokensPerChar: 0.25, warned: map[string]bool{}}
+}
+
+// ParseNumCtx reads NUM_CTX: a size, 0 for the Ollama default (or the size from the capabilities),
+// auto for the sizing per request
+func ParseNumCtx(value string) (int, *ContextSizer, error) {
+	if value == NumCtxAuto {
+		return 0, NewContextSizer(), nil
+	}
+	numCtx, err := strconv.Atoi(value)
+	if err != nil || numCtx < 0 {
+		return 0, nil, fmt.Errorf("NUM_CTX must be a size or auto, got %q", value)
+	}
+	return numCtx, nil, nil
+}
+
+// promptChars is the length of the messages and the tools of the request
+func promptChars(messages []api.Message, tools api.Tools) int {
+	chars := 0
+	for _, message := range messages {
+		chars += len(message.Content) + len(message.Role)
+	}
+	if len(tools) > 0 {
+		data, _ := json.Marshal(tools)
+		chars += len(data)
+	}
+	return chars
+}
+
+// Size returns the num_ctx of a prompt of chars characters and of its answer (numPredict),
+// clamped to the context length of the model
+func (s *ContextSizer) Size(domain string, chars, numPredict int) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	// 10% for the chat template and the special tokens
+	needed := int(float64(chars)*s.tokensPerChar*1.1) + max(numPredict, 256)
+	size := minNumCtx
+	for size < needed {
+		size *= 2
+	}
+	if s.contextLength > 0 && size > s.contextLength {
+		size = s.contextLength
+		if needed > s.contextLength && !s.warned[domain] {
+			fmt.Printf("⚠️ the %s prompt and its answer (%d tokens) exceed the context length of the model (%d)\n", domain, needed, s.contextLength)
+			s.warned[domain] = true
+		}
+	}
+	return size
+}
+
+// Measure records the prompt tokens evaluated by Ollama for a prompt of chars characters,
+// a prompt filling num_ctx was truncated
+func (s *ContextSizer) Measure(domain string, chars, promptTokens, numCtx int) {
+	if chars == 0 || promptTokens == 0 {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.tokensPerChar = max(s.tokensPerChar, float64(promptTokens)/float64(chars))
+	if promptTokens >= numCtx {
+		fmt.Printf("✂️ the %s prompt was truncated by num_ctx (%d tokens)\n", domain, numCtx)
+	}
+}
+
+// SetContextLength clamps the sizes to the context length of the model
+func (s *ContextSizer) SetContextLength(contextLength int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.contextLength = contextLength
+}
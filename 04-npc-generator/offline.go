@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/ollama/ollama/envconfig"
+)
+
+// ErrOfflineStrict is a network call refused by the offline-strict mode
+var ErrOfflineStrict = errors.New("refused by the offline-strict mode")
+
+// OfflineGuard is the offline-strict mode (OFFLINE_STRICT=true or --offline-strict) of the air-gapped
+// deployments: only the configured Ollama hosts are reached, the pulls and the sinks fail at once,
+// and the other requests (Discord, the portraits) go through the guard and fail instead of leaving the network
+type OfflineGuard struct {
+	hosts     []string
+	transport http.RoundTripper
+}
+
+// NewOfflineGuard allows the hosts of OLLAMA_HOSTS and the host of the client, OLLAMA_HOST
+// as the Ollama client reads it (127.0.0.1 by default)
+func NewOfflineGuard(transport http.RoundTripper) (*OfflineGuard, error) {
+	guard := &OfflineGuard{transport: transport}
+	hosts := strings.Split(os.Getenv("OLLAMA_HOSTS"), ",")
+	for _, host := range append(hosts, envconfig.Host().String()) {
+		host = strings.TrimSpace(host)
+		if host == "" {
+			continue
+		}
+		if !strings.Contains(host, "://") {
+			host = "http://" + host
+		}
+		parsed, err := url.Parse(host)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Ollama host %q: %w", host, err)
+		}
+		guard.hosts = append(guard.hosts, strings.ToLower(parsed.Hostname()))
+	}
+	return guard, nil
+}
+
+// Hosts returns the allowed hosts
+func (o *OfflineGuard) Hosts() []string {
+	return o.hosts
+}
+
+func (o *OfflineGuard) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !slices.Contains(o.hosts, strings.ToLower(req.URL.Hostname())) {
+		return nil, fmt.Errorf("%w: %s %s", ErrOfflineStrict, req.Method, req.URL.Redacted())
+	}
+	return o.transport.RoundTrip(req)
+}
+
+// Refuse fails the action in the offline-strict mode (nil: not offline-strict)
+func (o *OfflineGuard) Refuse(action string) error {
+	if o == nil {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrOfflineStrict, action)
+}
+
+// offlineStrict reads OFFLINE_STRICT and removes the --offline-strict flag of any command from the arguments
+func offlineStrict(args []string) (bool, []string) {
+	enabled := os.Getenv("OFFLINE_STRICT") == "true"
+	index := slices.Index(args, "--offline-strict")
+	if index < 0 {
+		return enabled, args
+	}
+	return true, slices.Delete(slices.Clone(args), index, index+1)
+}
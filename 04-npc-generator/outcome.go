@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"04-npc-generator/parse"
+)
+
+var (
+	ErrEmptyAnswer = errors.New("empty answer")
+	ErrRefusal     = errors.New("refusal")
+)
+
+var refusalPatterns = []string{
+	"i can't",
+	"i cannot",
+	"i'm sorry",
+	"i am sorry",
+	"i'm unable",
+	"i am unable",
+	"as an ai",
+	"i won't",
+}
+
+// classifyAnswer returns ErrEmptyAnswer or ErrRefusal when the model didn't really answer,
+// an answer with a JSON object is never a refusal: the fields of a character quote these
+// phrases ("I won't betray the guild"), classifyText checks them
+func classifyAnswer(answer string) error {
+	trimmed := strings.TrimSpace(answer)
+	if trimmed == "" || trimmed == "{}" || trimmed == `""` {
+		return ErrEmptyAnswer
+	}
+	_, err := parse.Object(trimmed)
+	if err == nil || errors.Is(err, parse.ErrTruncated) {
+		return nil
+	}
+	lower := normalizeRefusal(trimmed)
+	for _, pattern := range refusalPatterns {
+		if strings.Contains(lower, pattern) {
+			return ErrRefusal
+		}
+	}
+	return nil
+}
+
+// classifyText returns ErrEmptyAnswer or ErrRefusal for a text field of the answer (a name,
+// a backstory), the refusal must start the text: the prose of a character can quote it
+func classifyText(text string) error {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return ErrEmptyAnswer
+	}
+	lower := normalizeRefusal(trimmed)
+	for _, pattern := range refusalPatterns {
+		if strings.HasPrefix(lower, pattern) {
+			return ErrRefusal
+		}
+	}
+	return nil
+}
+
+// normalizeRefusal lowers the text and replaces the typographic apostrophes
+func normalizeRefusal(text string) string {
+	return strings.ToLower(strings.ReplaceAll(text, "’", "'"))
+}
+
+// RunMetrics counts the outcomes of the attempts of a run
+type RunMetrics struct {
+	Attempts   int `json:"attempts"`
+	Empty      int `json:"empty"`
+	Refusals   int `json:"refusals"`
+	Invalid    int `json:"invalid"`
+	Duplicates int `json:"duplicates"`
+	Rejected   int `json:"rejected"`
+	Gibberish  int `json:"gibberish"`
+	Truncated  int `json:"truncated"`
+	// answers written in another language than OUTPUT_LANGUAGE
+	WrongLanguage int `json:"wrong_language,omitempty"`
+	// retries with the softened options
+	Adjusted int `json:"adjusted"`
+	// attempts with escalated options after a streak of duplicates
+	Escalated int `json:"escalated"`
+	// names checked by the model with check_name_available
+	ToolCalls int `json:"tool_calls,omitempty"`
+	// characters rejected by the verification of the strict mode
+	Unverified int `json:"unverified,omitempty"`
+	// prompt and eval tokens of the requests (with a token budget)
+	Tokens int `json:"tokens,omitempty"`
+	// GenerationMS is the time of the generation requests (without the equipment and the verification)
+	GenerationMS int64 `json:"generation_ms"`
+}
+
+// Add sums the metrics of two runs (a run and its regeneration)
+func (m RunMetrics) Add(other RunMetrics) RunMetrics {
+	return RunMetrics{
+		Attempts:      m.Attempts + other.Attempts,
+		Empty:         m.Empty + other.Empty,
+		Refusals:      m.Refusals + other.Refusals,
+		Invalid:       m.Invalid + other.Invalid,
+		Duplicates:    m.Duplicates + other.Duplicates,
+		Rejected:      m.Rejected + other.Rejected,
+		Gibberish:     m.Gibberish + other.Gibberish,
+		Truncated:     m.Truncated + other.Truncated,
+		WrongLanguage: m.WrongLanguage + other.WrongLanguage,
+		Adjusted:      m.Adjusted + other.Adjusted,
+		Escalated:     m.Escalated + other.Escalated,
+		ToolCalls:     m.ToolCalls + other.ToolCalls,
+		Tokens:        m.Tokens + other.Tokens,
+		Unverified:    m.Unverified + other.Unverified,
+		GenerationMS:  m.GenerationMS + other.GenerationMS,
+	}
+}
+
+// since returns the metrics added after before (the attempts of a slot)
+func (m RunMetrics) since(before RunMetrics) RunMetrics {
+	return RunMetrics{
+		Attempts:      m.Attempts - before.Attempts,
+		Empty:         m.Empty - before.Empty,
+		Refusals:      m.Refusals - before.Refusals,
+		Invalid:       m.Invalid - before.Invalid,
+		Duplicates:    m.Duplicates - before.Duplicates,
+		Rejected:      m.Rejected - before.Rejected,
+		Gibberish:     m.Gibberish - before.Gibberish,
+		Truncated:     m.Truncated - before.Truncated,
+		WrongLanguage: m.WrongLanguage - before.WrongLanguage,
+		Adjusted:      m.Adjusted - before.Adjusted,
+		Escalated:     m.Escalated - before.Escalated,
+		ToolCalls:     m.ToolCalls - before.ToolCalls,
+		Tokens:        m.Tokens - before.Tokens,
+		Unverified:    m.Unverified - before.Unverified,
+		GenerationMS:  m.GenerationMS - before.GenerationMS,
+	}
+}
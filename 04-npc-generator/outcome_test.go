@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseCharacterRefusal(t *testing.T) {
+	for _, testCase := range []struct {
+		answer string
+		want   error
+	}{
+		{`{"name": "Thorgar", "kind": "Dwarf", "backstory": "I'm sorry, he told the widow, and he never forged again."}`, nil},
+		{`{"name": "Thorgar", "kind": "Dwarf", "secrets": ["I won't betray the guild, he swore, and he sold it the next day."]}`, nil},
+		{`{"name": "I'm sorry, I can't create this character", "kind": "Dwarf"}`, ErrRefusal},
+		{"I'm sorry, but I can't help with that.", ErrRefusal},
+		{"As an AI, I cannot create violent characters.", ErrRefusal},
+		{"  ", ErrEmptyAnswer},
+	} {
+		_, err := ParseCharacter(testCase.answer)
+		if !errors.Is(err, testCase.want) {
+			t.Errorf("ParseCharacter(%q) = %v, want %v", testCase.answer, err, testCase.want)
+		}
+	}
+}
+
+func TestWithFieldRefusal(t *testing.T) {
+	character := Character{Name: "Thorgar", Kind: "Dwarf"}
+	extras := []GenreExtra{{Name: "augmentation", Description: "the cybernetic implants"}}
+	for _, testCase := range []struct {
+		field, answer string
+		want          error
+	}{
+		{"backstory", `{"value": "\"I'm sorry\" were the last words of his brother. Thorgar won't forget them."}`, nil},
+		{"augmentation", `{"value": "A voice box that says \"I cannot lie\" when he does."}`, nil},
+		{"backstory", `{"value": "I'm sorry, but I can't write this backstory."}`, ErrRefusal},
+		{"augmentation", `{"value": "As an AI, I cannot describe implants."}`, ErrRefusal},
+		{"backstory", `{"value": " "}`, ErrEmptyAnswer},
+	} {
+		_, err := withField(character, testCase.field, testCase.answer, nil, extras)
+		if !errors.Is(err, testCase.want) {
+			t.Errorf("withField(%s, %q) = %v, want %v", testCase.field, testCase.answer, err, testCase.want)
+		}
+	}
+}
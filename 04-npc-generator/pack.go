@@ -0,0 +1,359 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// A generation pack (.genpack) is a zip of the content of a setting, shared without touching the code:
+//
+//	genpack.json        the metadata (name, version, title, author...)
+//	genres/*.json       genres: the prompt (instructions), the kinds, the extras of the schema
+//	themes/*.json       themes
+//	rubrics/*.json      judge rubrics (<domain>.json, .yaml or .yml)
+//	systems/*.json      game systems: the stats of the schema
+//	adapters/*.json     prompt adapters of model families
+//
+// The files have the formats of GENRES_DIR, THEMES_DIR, RUBRICS_DIR, SYSTEMS_DIR and ADAPTERS_DIR
+const packManifest = "genpack.json"
+
+// packSections are the directories of a pack, in the order of their loading
+var packSections = []string{"genres", "themes", "rubrics", "systems", "adapters"}
+
+var packNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// Limits of the files of a pack (a pack is a few JSON files, not an archive bomb)
+const (
+	maxPackFileSize = 1 << 20
+	maxPackSize     = 16 << 20
+)
+
+// GenPack is the metadata of a generation pack
+type GenPack struct {
+	Name        string `json:"name"`
+	Version     string `json:"version"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Author      string `json:"author,omitempty"`
+	License     string `json:"license,omitempty"`
+	// Contents are the names of the genres, themes, rubrics, systems and adapters of the pack (written by pack install)
+	Contents    map[string][]string `json:"contents,omitempty"`
+	InstalledAt time.Time           `json:"installed_at"`
+	// dir is the directory of the installed pack
+	dir string
+}
+
+func (p GenPack) check() error {
+	if !packNamePattern.MatchString(p.Name) {
+		return fmt.Errorf("invalid pack name %q (lowercase letters, digits, - and _)", p.Name)
+	}
+	if p.Version == "" {
+		return fmt.Errorf("the pack %s has no version", p.Name)
+	}
+	return nil
+}
+
+// InstalledPacks returns the packs installed in the directory (PACKS_DIR), by name
+func InstalledPacks(dir string) ([]GenPack, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	packs := []GenPack{}
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		pack, err := readPackManifest(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		packs = append(packs, pack)
+	}
+	return packs, nil
+}
+
+func readPackManifest(dir string) (GenPack, error) {
+	pack := GenPack{dir: dir}
+	data, err := os.ReadFile(filepath.Join(dir, packManifest))
+	if err != nil {
+		return pack, err
+	}
+	err = json.Unmarshal(data, &pack)
+	if err != nil {
+		return pack, fmt.Errorf("%s: %w", filepath.Join(dir, packManifest), err)
+	}
+	return pack, nil
+}
+
+// packDirs returns the directories of a section of the installed packs,
+// the custom directory (GENRES_DIR...) comes last so it replaces the content of the packs
+func packDirs(packs []GenPack, section, custom string) []string {
+	dirs := []string{}
+	for _, pack := range packs {
+		dirs = append(dirs, filepath.Join(pack.dir, section))
+	}
+	return append(dirs, custom)
+}
+
+// packFile is true for a JSON file of a section (a rubric may be a YAML file)
+func packFile(name string) bool {
+	section, base, nested := strings.Cut(name, "/")
+	if !nested || !slices.Contains(packSections, section) || strings.Contains(base, "/") {
+		return false
+	}
+	if section == "rubrics" {
+		return slices.Contains(rubricExtensions, path.Ext(base))
+	}
+	return path.Ext(base) == ".json"
+}
+
+// extractPack writes the files of the archive to the directory: the manifest and the JSON
+// files of the sections, anything else (a path out of the pack, a nested directory) is refused
+func extractPack(archive *zip.Reader, dir string) error {
+	total := int64(0)
+	for _, file := range archive.File {
+		name := path.Clean(strings.ReplaceAll(file.Name, `\`, "/"))
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		if name != packManifest && !packFile(name) {
+			return fmt.Errorf("unexpected file %q in the pack (%s and %s/*.json)", file.Name, packManifest, strings.Join(packSections, "/, "))
+		}
+		if file.UncompressedSize64 > maxPackFileSize {
+			return fmt.Errorf("%s: larger than %d bytes", name, maxPackFileSize)
+		}
+		total += int64(file.UncompressedSize64)
+		if total > maxPackSize {
+			return fmt.Errorf("the pack is larger than %d bytes", maxPackSize)
+		}
+		reader, err := file.Open()
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(io.LimitReader(reader, maxPackFileSize+1))
+		reader.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if len(data) > maxPackFileSize {
+			return fmt.Errorf("%s: larger than %d bytes", name, maxPackFileSize)
+		}
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		err = os.MkdirAll(filepath.Dir(target), 0755)
+		if err != nil {
+			return err
+		}
+		err = os.WriteFile(target, data, 0644)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// packContents loads the sections of an extracted pack with the loaders of the CLI,
+// and returns the names of their content (a name of a file replaces the built-in of this name)
+func packContents(dir string) (map[string][]string, error) {
+	_, err := LoadGenres(filepath.Join(dir, "genres"))
+	if err == nil {
+		_, err = LoadThemes(filepath.Join(dir, "themes"))
+	}
+	if err == nil {
+		_, err = LoadRubrics(filepath.Join(dir, "rubrics"))
+	}
+	if err == nil {
+		_, err = LoadGameSystems(filepath.Join(dir, "systems"))
+	}
+	if err == nil {
+		_, err = LoadAdapters(filepath.Join(dir, "adapters"))
+	}
+	if err != nil {
+		return nil, err
+	}
+	contents := map[string][]string{}
+	for _, section := range packSections {
+		entries, err := os.ReadDir(filepath.Join(dir, section))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		for _, entry := range entries {
+			name, err := packFileName(section, filepath.Join(dir, section, entry.Name()))
+			if err != nil {
+				return nil, err
+			}
+			contents[section] = append(contents[section], name)
+		}
+	}
+	return contents, nil
+}
+
+// packFileName is the name of the genre, theme, system or adapter of a file (its name field, or the name
+// of the file like the loaders), a rubric is named after its domain (the file)
+func packFileName(section, file string) (string, error) {
+	name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	if section == "rubrics" {
+		return name, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	named := struct {
+		Name string `json:"name"`
+	}{}
+	err = json.Unmarshal(data, &named)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", file, err)
+	}
+	if named.Name != "" {
+		return named.Name, nil
+	}
+	return name, nil
+}
+
+// installPack validates the archive and installs it in the directory of the packs: it is extracted
+// to a temporary directory, loaded, then renamed, a broken pack is never half installed
+func installPack(file, dir string, force bool) (GenPack, error) {
+	archive, err := zip.OpenReader(file)
+	if err != nil {
+		return GenPack{}, fmt.Errorf("%s: %w", file, err)
+	}
+	defer archive.Close()
+
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return GenPack{}, err
+	}
+	staging, err := os.MkdirTemp(dir, ".install-*")
+	if err != nil {
+		return GenPack{}, err
+	}
+	defer os.RemoveAll(staging)
+	err = os.Chmod(staging, 0755)
+	if err != nil {
+		return GenPack{}, err
+	}
+	err = extractPack(&archive.Reader, staging)
+	if err != nil {
+		return GenPack{}, fmt.Errorf("%s: %w", file, err)
+	}
+	pack, err := readPackManifest(staging)
+	if errors.Is(err, os.ErrNotExist) {
+		return pack, fmt.Errorf("%s: no %s", file, packManifest)
+	}
+	if err != nil {
+		return pack, err
+	}
+	err = pack.check()
+	if err != nil {
+		return pack, fmt.Errorf("%s: %w", file, err)
+	}
+	pack.Contents, err = packContents(staging)
+	if err != nil {
+		// the paths of the errors are the paths in the pack
+		return pack, fmt.Errorf("%s: %s", file, strings.ReplaceAll(err.Error(), staging+string(filepath.Separator), ""))
+	}
+	if len(pack.Contents) == 0 {
+		return pack, fmt.Errorf("%s: the pack has no genre, theme, rubric, system or adapter", file)
+	}
+	pack.InstalledAt = time.Now().UTC()
+	data, err := json.MarshalIndent(pack, "", "  ")
+	if err != nil {
+		return pack, err
+	}
+	err = os.WriteFile(filepath.Join(staging, packManifest), data, 0644)
+	if err != nil {
+		return pack, err
+	}
+
+	target := filepath.Join(dir, pack.Name)
+	installed, err := readPackManifest(target)
+	if err == nil {
+		if !force {
+			return pack, fmt.Errorf("the pack %s %s is installed, --force replaces it with %s", installed.Name, installed.Version, pack.Version)
+		}
+		err = os.RemoveAll(target)
+		if err != nil {
+			return pack, err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return pack, err
+	}
+	pack.dir = target
+	return pack, os.Rename(staging, target)
+}
+
+// runPack installs, lists and removes the generation packs of PACKS_DIR:
+// pack install ./cyberpunk.genpack, pack list, pack remove cyberpunk
+func (a *App) runPack(args []string) error {
+	usage := errors.New("usage: pack install [--force] <file.genpack> | pack list | pack remove <name>")
+	if len(args) < 1 {
+		return usage
+	}
+	flags := flag.NewFlagSet("pack "+args[0], flag.ExitOnError)
+	force := flags.Bool("force", false, "replace the installed pack of the same name (upgrade)")
+	flags.Parse(args[1:])
+	dir := getEnv("PACKS_DIR", "./packs")
+
+	switch {
+	case args[0] == "install" && flags.NArg() == 1:
+		pack, err := installPack(flags.Arg(0), dir, *force)
+		if err != nil {
+			return err
+		}
+		summary := []string{}
+		for _, section := range packSections {
+			if len(pack.Contents[section]) > 0 {
+				summary = append(summary, fmt.Sprintf("%s %s", section, strings.Join(pack.Contents[section], ", ")))
+			}
+		}
+		fmt.Printf("📦 %s %s installed: %s\n", pack.Name, pack.Version, strings.Join(summary, "; "))
+		return nil
+	case args[0] == "list" && flags.NArg() == 0:
+		packs, err := InstalledPacks(dir)
+		if err != nil {
+			return err
+		}
+		for _, pack := range packs {
+			counts := []string{}
+			for _, section := range packSections {
+				if len(pack.Contents[section]) > 0 {
+					counts = append(counts, fmt.Sprintf("%d %s", len(pack.Contents[section]), section))
+				}
+			}
+			fmt.Fprintf(a.stdout, "%-16s %-8s %s (%s)\n", pack.Name, pack.Version, pack.Title, strings.Join(counts, ", "))
+		}
+		return nil
+	case args[0] == "remove" && flags.NArg() == 1:
+		target := filepath.Join(dir, flags.Arg(0))
+		pack, err := readPackManifest(target)
+		if errors.Is(err, os.ErrNotExist) || !packNamePattern.MatchString(flags.Arg(0)) {
+			return fmt.Errorf("the pack %q is not installed", flags.Arg(0))
+		}
+		if err != nil {
+			return err
+		}
+		err = os.RemoveAll(target)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("🗑️ %s %s removed\n", pack.Name, pack.Version)
+		return nil
+	}
+	return usage
+}
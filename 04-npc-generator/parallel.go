@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// GenerateParallel fills the slots of the spec with workers runs at the same time
+// (one run per worker, the deduper is shared), done gets the slots as they come,
+// from one goroutine. The first error stops the workers and is returned.
+// One worker with a validation stage runs the pipeline of GeneratePipelined.
+func GenerateParallel(ctx context.Context, generator *Generator, deduper *Deduper, spec Spec, workers int, done func(slot Slot) error) (RunMetrics, error) {
+	if run := NewRun(generator, deduper, spec); workers <= 1 && spec.Count > 1 && run.hasValidation() {
+		return run.GeneratePipelined(ctx, done)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		slot Slot
+		err  error
+	}
+	indexes, results := make(chan int), make(chan result)
+	go func() {
+		defer close(indexes)
+		for index := range spec.Count {
+			select {
+			case indexes <- index:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	runs := []*Run{}
+	var wg sync.WaitGroup
+	for range max(workers, 1) {
+		run := NewRun(generator, deduper, spec)
+		runs = append(runs, run)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				slot, err := run.GenerateSlot(ctx, index)
+				results <- result{slot, err}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// the slots in progress when an error stops the run are dropped
+	var firstErr error
+	for result := range results {
+		if firstErr != nil {
+			continue
+		}
+		firstErr = result.err
+		if firstErr == nil {
+			firstErr = done(result.slot)
+		}
+		if firstErr != nil {
+			cancel()
+		}
+	}
+
+	metrics := RunMetrics{}
+	for _, run := range runs {
+		metrics = metrics.Add(run.Metrics())
+	}
+	return metrics, firstErr
+}
+
+// GeneratePipelined fills the slots of the run with two stages connected by channels: the generation
+// of the next candidate overlaps the validation (equipment, strict verification) of the previous one,
+// a rejected candidate goes back to the generation stage while its slot has attempts.
+// done gets the slots as they come, from one goroutine. The first error stops both stages and is returned.
+func (r *Run) GeneratePipelined(ctx context.Context, done func(slot Slot) error) (RunMetrics, error) {
+	r.deduper.Use(ctx, r.generator.dedup...)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		slot Slot
+		err  error
+	}
+	type candidate struct {
+		state *slotAttempts
+		slot  Slot
+	}
+	// back returns every validated candidate to the generation stage: its state when the slot
+	// is retried, nil when the slot is done (at most 2 candidates are in the validation stage)
+	candidates, back, results := make(chan candidate, 1), make(chan *slotAttempts, 2), make(chan result)
+	send := func(res result) bool {
+		select {
+		case results <- res:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	// the generation stage owns the metrics of the run, the validation stage has its own
+	go func() {
+		defer wg.Done()
+		defer close(candidates)
+		retries := []*slotAttempts{}
+		next, pending := 0, 0
+		feedback := func(state *slotAttempts) {
+			pending--
+			if state != nil {
+				retries = append(retries, state)
+			}
+		}
+		for next < r.spec.Count || pending > 0 || len(retries) > 0 {
+			var state *slotAttempts
+			switch {
+			case len(retries) > 0:
+				state, retries = retries[0], retries[1:]
+			case next < r.spec.Count:
+				state = r.newSlotAttempts(next)
+				next++
+			default:
+				// the last candidates are in the validation stage
+				select {
+				case retry := <-back:
+					feedback(retry)
+				case <-ctx.Done():
+					return
+				}
+				continue
+			}
+
+			slot := state.last
+			for state.tries < r.attempts {
+				var err error
+				before := r.metrics
+				slot, err = r.generateCandidate(ctx, state)
+				state.metrics = state.metrics.Add(r.metrics.since(before))
+				if err != nil {
+					send(result{slot, err})
+					return
+				}
+				if slot.Status == SlotOK {
+					break
+				}
+				state.last = slot
+				r.retrying(ctx, state)
+			}
+			if slot.Status != SlotOK {
+				r.emitDone(ctx, state.last, state.tries)
+				r.generator.quality.Record(r.generator.model, r.spec.Kind, RunMetrics{}, state.metrics)
+				if !send(result{state.last, nil}) {
+					return
+				}
+				continue
+			}
+			for sent := false; !sent; {
+				select {
+				case candidates <- candidate{state, slot}:
+					sent = true
+					pending++
+				case retry := <-back:
+					feedback(retry)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	validation := RunMetrics{}
+	go func() {
+		defer wg.Done()
+		for candidate := range candidates {
+			err := r.validate(ctx, &candidate.slot, &validation)
+			if err != nil {
+				send(result{candidate.slot, err})
+				return
+			}
+			var retry *slotAttempts
+			if candidate.slot.Status != SlotOK && candidate.state.tries < r.attempts {
+				candidate.state.last, retry = candidate.slot, candidate.state
+				r.emit(ctx, HookRetry, candidate.slot, candidate.state.tries)
+			} else {
+				r.emitDone(ctx, candidate.slot, candidate.state.tries)
+				r.generator.quality.Record(r.generator.model, r.spec.Kind, RunMetrics{}, candidate.state.metrics)
+				if !send(result{candidate.slot, nil}) {
+					return
+				}
+			}
+			select {
+			case back <- retry:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// the slots in progress when an error stops the run are dropped
+	var firstErr error
+	for result := range results {
+		if firstErr != nil {
+			continue
+		}
+		firstErr = result.err
+		if firstErr == nil {
+			firstErr = done(result.slot)
+		}
+		if firstErr != nil {
+			cancel()
+		}
+	}
+	return r.metrics.Add(validation), firstErr
+}
@@ -0,0 +1,285 @@
+// Package parse extracts the JSON object of a model answer: the structured outputs are not
+// always clean (code fences, prose around the object, a BOM, smart quotes, an answer cut off
+// by num_predict, a key repeated by a looping model), every fix is reported
+package parse
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrNoJSON is an answer without a JSON object
+	ErrNoJSON = errors.New("no JSON object in the answer")
+	// ErrTruncated is an object cut off before its end, Result.JSON is closed but incomplete
+	ErrTruncated = errors.New("truncated JSON")
+	// ErrInvalid is an object that can't be repaired
+	ErrInvalid = errors.New("invalid JSON")
+)
+
+// Repairs of the answer
+const (
+	RepairBOM       = "bom"
+	RepairFence     = "code fence"
+	RepairProse     = "prose"
+	RepairQuotes    = "smart quotes"
+	RepairTruncated = "truncated"
+	RepairDuplicate = "duplicate key"
+)
+
+// Result is the extracted object and the repairs it needed
+type Result struct {
+	JSON    string
+	Repairs []string
+}
+
+// smartQuotes are the typographic double quotes used as JSON delimiters
+var smartQuotes = strings.NewReplacer("“", `"`, "”", `"`, "„", `"`, "‟", `"`, "«", `"`, "»", `"`)
+
+// Object returns the first JSON object of the answer. The duplicate keys keep their
+// first value (a looping model repeats the end of its answer), a truncated object is
+// closed and returned with ErrTruncated.
+func Object(answer string) (Result, error) {
+	result := Result{}
+	content := answer
+	if strings.HasPrefix(content, "\uFEFF") {
+		content = strings.TrimLeft(content, "\uFEFF")
+		result.Repairs = append(result.Repairs, RepairBOM)
+	}
+	content = strings.TrimSpace(content)
+
+	if fenced, ok := fence(content); ok {
+		content = fenced
+		result.Repairs = append(result.Repairs, RepairFence)
+	}
+
+	start := strings.IndexByte(content, '{')
+	if start < 0 {
+		return result, ErrNoJSON
+	}
+	object, complete := scanObject(content[start:])
+	if start > 0 || len(strings.TrimSpace(content[start+len(object):])) > 0 {
+		result.Repairs = append(result.Repairs, RepairProse)
+	}
+	if !complete {
+		result.JSON = closeObject(object)
+		result.Repairs = append(result.Repairs, RepairTruncated)
+		return result, ErrTruncated
+	}
+
+	if !json.Valid([]byte(object)) {
+		quoted := smartQuotes.Replace(object)
+		if quoted == object || !json.Valid([]byte(quoted)) {
+			result.JSON = object
+			return result, fmt.Errorf("%w: %w", ErrInvalid, syntaxError(object))
+		}
+		object = quoted
+		result.Repairs = append(result.Repairs, RepairQuotes)
+	}
+
+	deduplicated, duplicates, err := dedupeKeys([]byte(object))
+	if err != nil {
+		result.JSON = object
+		return result, fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+	if duplicates > 0 {
+		object = string(deduplicated)
+		result.Repairs = append(result.Repairs, RepairDuplicate)
+	}
+	result.JSON = object
+	return result, nil
+}
+
+func syntaxError(object string) error {
+	var value any
+	err := json.Unmarshal([]byte(object), &value)
+	if err == nil {
+		return errors.New("invalid object")
+	}
+	return err
+}
+
+// fence returns the content of the first code fence (```json ... ```),
+// an unclosed fence runs to the end of the answer
+func fence(content string) (string, bool) {
+	start := strings.Index(content, "```")
+	if start < 0 {
+		return "", false
+	}
+	body := content[start+3:]
+	// the language of the fence
+	if newline := strings.IndexByte(body, '\n'); newline >= 0 && !strings.Contains(body[:newline], "{") {
+		body = body[newline+1:]
+	}
+	if end := strings.Index(body, "```"); end >= 0 {
+		body = body[:end]
+	}
+	return strings.TrimSpace(body), true
+}
+
+// scanObject returns the object starting at content[0] up to its closing brace,
+// complete is false when the content ends first
+func scanObject(content string) (string, bool) {
+	depth := 0
+	inString, escaped := false, false
+	for idx := 0; idx < len(content); idx++ {
+		char := content[idx]
+		switch {
+		case escaped:
+			escaped = false
+		case inString && char == '\\':
+			escaped = true
+		case char == '"':
+			inString = !inString
+		case inString:
+		case char == '{' || char == '[':
+			depth++
+		case char == '}' || char == ']':
+			depth--
+			if depth == 0 {
+				return content[:idx+1], true
+			}
+		}
+	}
+	return content, false
+}
+
+// closeObject closes the string, the arrays and the objects left open by a truncation,
+// the object is cut at its last comma (or after its last opening) until it is valid
+// (a dangling key or a half number)
+func closeObject(object string) string {
+	closed, cuts := closing(object)
+	for idx := len(cuts) - 1; idx >= 0 && !json.Valid([]byte(closed)); idx-- {
+		closed, _ = closing(object[:cuts[idx]])
+	}
+	return closed
+}
+
+// closing closes what is open at the end of the object, it returns the positions
+// where the object can be cut out of the strings: the commas and after the openings
+func closing(object string) (string, []int) {
+	stack := []byte{}
+	cuts := []int{}
+	inString, escaped := false, false
+	for idx := 0; idx < len(object); idx++ {
+		char := object[idx]
+		switch {
+		case escaped:
+			escaped = false
+		case inString && char == '\\':
+			escaped = true
+		case char == '"':
+			inString = !inString
+		case inString:
+		case char == ',':
+			cuts = append(cuts, idx)
+		case char == '{':
+			stack = append(stack, '}')
+			cuts = append(cuts, idx+1)
+		case char == '[':
+			stack = append(stack, ']')
+			cuts = append(cuts, idx+1)
+		case (char == '}' || char == ']') && len(stack) > 0:
+			stack = stack[:len(stack)-1]
+		}
+	}
+	closed := object
+	if escaped {
+		closed = closed[:len(closed)-1]
+	}
+	if inString {
+		closed += `"`
+	}
+	closed = strings.TrimRight(closed, " \t\r\n")
+	closed = strings.TrimSuffix(closed, ",")
+	builder := strings.Builder{}
+	builder.Grow(len(closed) + len(stack))
+	builder.WriteString(closed)
+	for idx := len(stack) - 1; idx >= 0; idx-- {
+		builder.WriteByte(stack[idx])
+	}
+	return builder.String(), cuts
+}
+
+// dedupeKeys rewrites the objects of the value without their repeated keys (the first value
+// is kept), it returns the number of dropped keys
+func dedupeKeys(data []byte) ([]byte, int, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	buffer := bytes.Buffer{}
+	duplicates, err := rewrite(decoder, &buffer)
+	if err != nil {
+		return nil, 0, err
+	}
+	if duplicates == 0 {
+		return data, 0, nil
+	}
+	return buffer.Bytes(), duplicates, nil
+}
+
+func rewrite(decoder *json.Decoder, buffer *bytes.Buffer) (int, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return 0, err
+	}
+	delimiter, ok := token.(json.Delim)
+	if !ok {
+		data, err := json.Marshal(token)
+		buffer.Write(data)
+		return 0, err
+	}
+
+	duplicates := 0
+	switch delimiter {
+	case '{':
+		buffer.WriteByte('{')
+		seen := map[string]bool{}
+		written := 0
+		for decoder.More() {
+			keyToken, err := decoder.Token()
+			if err != nil {
+				return duplicates, err
+			}
+			key, _ := keyToken.(string)
+			value := bytes.Buffer{}
+			count, err := rewrite(decoder, &value)
+			duplicates += count
+			if err != nil {
+				return duplicates, err
+			}
+			if seen[key] {
+				duplicates++
+				continue
+			}
+			seen[key] = true
+			if written > 0 {
+				buffer.WriteByte(',')
+			}
+			keyData, _ := json.Marshal(key)
+			buffer.Write(keyData)
+			buffer.WriteByte(':')
+			buffer.Write(value.Bytes())
+			written++
+		}
+		buffer.WriteByte('}')
+	case '[':
+		buffer.WriteByte('[')
+		for idx := 0; decoder.More(); idx++ {
+			if idx > 0 {
+				buffer.WriteByte(',')
+			}
+			count, err := rewrite(decoder, buffer)
+			duplicates += count
+			if err != nil {
+				return duplicates, err
+			}
+		}
+		buffer.WriteByte(']')
+	}
+	// the closing delimiter
+	_, err = decoder.Token()
+	return duplicates, err
+}
@@ -0,0 +1,104 @@
+package parse
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+)
+
+var objectCases = []struct {
+	name    string
+	answer  string
+	json    string
+	repairs []string
+	err     error
+}{
+	{"clean", `{"name":"Thorin","kind":"Dwarf"}`, `{"name":"Thorin","kind":"Dwarf"}`, nil, nil},
+	{"fence", "```json\n{\"name\":\"Thorin\"}\n```", `{"name":"Thorin"}`, []string{RepairFence}, nil},
+	{"fence without language", "```\n{\"name\":\"Thorin\"}\n```", `{"name":"Thorin"}`, []string{RepairFence}, nil},
+	{"unclosed fence", "```json\n{\"name\":\"Thorin\"}", `{"name":"Thorin"}`, []string{RepairFence}, nil},
+	{"prose", "Here is your dwarf: {\"name\":\"Thorin\"} Enjoy!", `{"name":"Thorin"}`, []string{RepairProse}, nil},
+	{"fence in prose", "Sure!\n```json\n{\"name\":\"Thorin\"}\n```\nAnything else?", `{"name":"Thorin"}`, []string{RepairFence}, nil},
+	{"bom", "\ufeff{\"name\":\"Thorin\"}", `{"name":"Thorin"}`, []string{RepairBOM}, nil},
+	{"smart quotes", `{“name”: “Thorin”}`, `{"name": "Thorin"}`, []string{RepairQuotes}, nil},
+	{"guillemets", `{«name»: «Thorin»}`, `{"name": "Thorin"}`, []string{RepairQuotes}, nil},
+	{"smart quotes in a value", `{"name": "Thorin “Oakenshield”"}`, `{"name": "Thorin “Oakenshield”"}`, nil, nil},
+	{"braces in a string", `{"name":"Th}or{in"}`, `{"name":"Th}or{in"}`, nil, nil},
+	{"truncated string", `{"name":"Thorin","backstory":"Born under the mount`, `{"name":"Thorin","backstory":"Born under the mount"}`, []string{RepairTruncated}, ErrTruncated},
+	{"truncated key", `{"name":"Thorin","back`, `{"name":"Thorin"}`, []string{RepairTruncated}, ErrTruncated},
+	{"truncated array", `{"name":"Thorin","aliases":["Oakenshield",`, `{"name":"Thorin","aliases":["Oakenshield"]}`, []string{RepairTruncated}, ErrTruncated},
+	{"truncated number", `{"name":"Thorin","age":19`, `{"name":"Thorin","age":19}`, []string{RepairTruncated}, ErrTruncated},
+	{"truncated escape", `{"name":"Thorin \`, `{"name":"Thorin "}`, []string{RepairTruncated}, ErrTruncated},
+	{"duplicate keys", `{"name":"Thorin","kind":"Dwarf","name":"Thorin","kind":"Dwarf"}`, `{"name":"Thorin","kind":"Dwarf"}`, []string{RepairDuplicate}, nil},
+	{"nested duplicate keys", `{"name":"Thorin","stats":{"str":16,"str":17}}`, `{"name":"Thorin","stats":{"str":16}}`, []string{RepairDuplicate}, nil},
+	{"no object", "I can't generate names.", "", nil, ErrNoJSON},
+	{"empty", "", "", nil, ErrNoJSON},
+	{"invalid", `{"name": Thorin}`, `{"name": Thorin}`, nil, ErrInvalid},
+}
+
+func TestObject(t *testing.T) {
+	for _, testCase := range objectCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			result, err := Object(testCase.answer)
+			if !errors.Is(err, testCase.err) || (err != nil) != (testCase.err != nil) {
+				t.Fatalf("error %v, want %v", err, testCase.err)
+			}
+			if result.JSON != testCase.json {
+				t.Errorf("JSON %s, want %s", result.JSON, testCase.json)
+			}
+			if !slices.Equal(result.Repairs, testCase.repairs) {
+				t.Errorf("repairs %q, want %q", result.Repairs, testCase.repairs)
+			}
+		})
+	}
+}
+
+func FuzzObject(f *testing.F) {
+	for _, testCase := range objectCases {
+		f.Add(testCase.answer)
+	}
+	f.Fuzz(func(t *testing.T, answer string) {
+		result, err := Object(answer)
+		switch {
+		case err == nil:
+			var object map[string]any
+			if json.Unmarshal([]byte(result.JSON), &object) != nil {
+				t.Fatalf("Object(%q) = %q, not a JSON object", answer, result.JSON)
+			}
+			_, duplicates, err := dedupeKeys([]byte(result.JSON))
+			if err != nil || duplicates > 0 {
+				t.Fatalf("Object(%q) = %q with %d duplicate keys (%v)", answer, result.JSON, duplicates, err)
+			}
+			// the extracted object needs no repair
+			again, err := Object(result.JSON)
+			if err != nil || again.JSON != result.JSON || len(again.Repairs) > 0 {
+				t.Fatalf("Object(%q) = %q, %q, %v", result.JSON, again.JSON, again.Repairs, err)
+			}
+		case errors.Is(err, ErrTruncated):
+			if !slices.Contains(result.Repairs, RepairTruncated) {
+				t.Fatalf("Object(%q) is truncated without the repair %q", answer, result.Repairs)
+			}
+		case errors.Is(err, ErrNoJSON), errors.Is(err, ErrInvalid):
+		default:
+			t.Fatalf("Object(%q): unexpected error %v", answer, err)
+		}
+	})
+}
+
+func FuzzCloseObject(f *testing.F) {
+	f.Add(`{"name":"Thorin","aliases":["Oakenshield","King"],"stats":{"str":16,"wis":12.5},"alive":true,"notes":"a \"quoted\" \\ word"}`, uint(40))
+	f.Add(`{"a":{"b":[1,2,{"c":"d"}]},"e":null}`, uint(21))
+	f.Add(`{"name":"Þórin “Oakenshield”","age":-1.5e3}`, uint(12))
+	f.Fuzz(func(t *testing.T, object string, cut uint) {
+		// a prefix of a valid object is closed into a valid object
+		if len(object) < 2 || object[0] != '{' || !json.Valid([]byte(object)) {
+			return
+		}
+		truncated := object[:1+int(cut%uint(len(object)-1))]
+		closed := closeObject(truncated)
+		if !json.Valid([]byte(closed)) {
+			t.Fatalf("closeObject(%q) = %q, invalid JSON", truncated, closed)
+		}
+	})
+}
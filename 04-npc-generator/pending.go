@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+var (
+	ErrNotPending = errors.New("no pending character")
+	ErrNameTaken  = errors.New("already taken")
+)
+
+// PendingCharacter is a generated character waiting for a reviewer (serve --approval),
+// it only enters the registry (and the exports) once approved; its name is taken meanwhile
+type PendingCharacter struct {
+	ID          int       `json:"id"`
+	Character   Character `json:"character"`
+	SubmittedAt time.Time `json:"submitted_at"`
+	// EditedAt is the time of the last edit of a reviewer (nil: as generated)
+	EditedAt *time.Time `json:"edited_at,omitempty"`
+}
+
+// Submit adds the characters to the pending queue with a new pending ID and saves the registry,
+// names already stored, pending or reserved are skipped
+func (r *Registry) Submit(characters ...Character) ([]PendingCharacter, error) {
+	unlock, err := r.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	deduper := r.deduper()
+	submitted := []PendingCharacter{}
+	for _, character := range characters {
+		if !deduper.AddNames(context.Background(), character.Names()) {
+			continue
+		}
+		r.NextPendingID = max(r.NextPendingID, 1)
+		pending := PendingCharacter{ID: r.NextPendingID, Character: character, SubmittedAt: time.Now()}
+		r.NextPendingID++
+		r.Pending = append(r.Pending, pending)
+		submitted = append(submitted, pending)
+	}
+	return submitted, r.save()
+}
+
+// ListPending returns a copy of the pending characters, the oldest first
+func (r *Registry) ListPending() []PendingCharacter {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.reload()
+	return append([]PendingCharacter{}, r.Pending...)
+}
+
+func (r *Registry) pendingIndex(id int) (int, error) {
+	idx := slices.IndexFunc(r.Pending, func(pending PendingCharacter) bool {
+		return pending.ID == id
+	})
+	if idx < 0 {
+		return idx, fmt.Errorf("%w with the ID %d", ErrNotPending, id)
+	}
+	return idx, nil
+}
+
+// patchCharacter changes the fields of the patch (null removes a field), the patched character
+// is decoded again so it is normalized and checked like a generated one
+func patchCharacter(character Character, patch map[string]json.RawMessage) (Character, error) {
+	fields, err := characterFields(character)
+	if err != nil {
+		return character, err
+	}
+	for field, value := range patch {
+		if string(value) == "null" {
+			delete(fields, field)
+			continue
+		}
+		fields[field] = value
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return character, err
+	}
+	patched := Character{}
+	err = json.Unmarshal(data, &patched)
+	return patched, err
+}
+
+// EditPending changes the fields of the pending character and saves the registry, the IDs and
+// the timestamps are given by the registry; a new name or alias must not be stored or pending yet
+func (r *Registry) EditPending(id int, patch map[string]json.RawMessage) (PendingCharacter, error) {
+	unlock, err := r.lock()
+	if err != nil {
+		return PendingCharacter{}, err
+	}
+	defer unlock()
+
+	idx, err := r.pendingIndex(id)
+	if err != nil {
+		return PendingCharacter{}, err
+	}
+	pending := r.Pending[idx]
+	pending.Character, err = patchCharacter(pending.Character, patch)
+	if err != nil {
+		return pending, err
+	}
+	pending.Character.ID, pending.Character.Code, pending.Character.CreatedAt, pending.Character.UpdatedAt = 0, "", nil, nil
+	if !r.deduperExcept(0, id).AddNames(context.Background(), pending.Character.Names()) {
+		return pending, fmt.Errorf("the name %q or one of its aliases is %w", pending.Character.Name, ErrNameTaken)
+	}
+	now := time.Now()
+	pending.EditedAt = &now
+	r.Pending[idx] = pending
+	return pending, r.save()
+}
+
+// Approve moves the pending character to the registry, it gets its ID and its table code
+func (r *Registry) Approve(id int) (Character, error) {
+	unlock, err := r.lock()
+	if err != nil {
+		return Character{}, err
+	}
+	defer unlock()
+
+	idx, err := r.pendingIndex(id)
+	if err != nil {
+		return Character{}, err
+	}
+	// the name was taken by the queue, a concurrent merge may have stored it since
+	character := r.Pending[idx].Character
+	if !r.deduperExcept(0, id).AddNames(context.Background(), character.Names()) {
+		return character, fmt.Errorf("the name %q or one of its aliases is %w", character.Name, ErrNameTaken)
+	}
+	r.Pending = slices.Delete(r.Pending, idx, idx+1)
+	character = r.store(character, r.usedCodes())
+	return character, r.save()
+}
+
+// Reject drops the pending character, its name is free again
+func (r *Registry) Reject(id int) (PendingCharacter, error) {
+	unlock, err := r.lock()
+	if err != nil {
+		return PendingCharacter{}, err
+	}
+	defer unlock()
+
+	idx, err := r.pendingIndex(id)
+	if err != nil {
+		return PendingCharacter{}, err
+	}
+	pending := r.Pending[idx]
+	r.Pending = slices.Delete(r.Pending, idx, idx+1)
+	return pending, r.save()
+}
+
+// SubmitSlots is StoreSlots for the approval queue: the successful characters are pending,
+// the slots get their pending ID
+func SubmitSlots(registry *Registry, slots []Slot) error {
+	for idx := range slots {
+		slot := &slots[idx]
+		if slot.Status != SlotOK {
+			continue
+		}
+		submitted, err := registry.Submit(*slot.Character)
+		if err != nil {
+			return err
+		}
+		if len(submitted) == 0 {
+			slot.Status, slot.Reason = SlotFiltered, "duplicate: "+slot.Character.Name
+			slot.Character = nil
+			continue
+		}
+		slot.Pending = submitted[0].ID
+	}
+	return nil
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+// Spec describes a generation
+type Spec struct {
+	Kind string `json:"kind"`
+	// Parents are the kinds of a hybrid, their naming rules are blended
+	Parents []string `json:"parents,omitempty"`
+	// with a class, the equipment stage runs after the dedup
+	Class string `json:"class,omitempty"`
+	Level int    `json:"level,omitempty"`
+	// with a game system, the characters get the stats of the system
+	System string `json:"system,omitempty"`
+	Count  int    `json:"count"`
+	// with aliases, the characters get a title and aliases (nicknames)
+	Aliases bool `json:"aliases,omitempty"`
+	// NameOnly asks for the name only, with a stripped prompt (the fast mode)
+	NameOnly bool `json:"name_only,omitempty"`
+	// Coverage gives every slot a prefix of the kind in turn (the great-list mode)
+	Coverage bool `json:"coverage,omitempty"`
+	// Prefix is the constraint of a slot of the coverage mode
+	Prefix string `json:"prefix,omitempty"`
+	// Relative makes the characters children or siblings of a stored character (family.go)
+	Relative *Relative `json:"relative,omitempty"`
+	// Tables are the story tables of the characters (plot_hooks, secrets, curses, boons),
+	// without them every slot draws its tables with the chances of STORY_TABLES
+	Tables []string `json:"tables,omitempty"`
+}
+
+// GenerateRequest is a spec, the kind of a hybrid can be given with mix ("dwarf+human")
+type GenerateRequest struct {
+	Spec
+	Mix string `json:"mix,omitempty"`
+}
+
+// JobRequest is a spec of a campaign (POST /jobs and the lines of --stdin)
+type JobRequest struct {
+	Campaign string `json:"campaign"`
+	GenerateRequest
+}
+
+const (
+	SlotOK       = "ok"
+	SlotFailed   = "failed"   // the answer can't be parsed or validated
+	SlotFiltered = "filtered" // the name is a duplicate
+)
+
+// Slot is one of the Count characters of a run
+type Slot struct {
+	Index     int        `json:"index"`
+	Status    string     `json:"status"`
+	Reason    string     `json:"reason,omitempty"`
+	Character *Character `json:"character,omitempty"`
+	// Pending is the ID of the character in the approval queue (serve --approval)
+	Pending int `json:"pending,omitempty"`
+}
+
+// Run is one generation: generation -> parse -> dedup (-> equipment) for every slot of the spec
+type Run struct {
+	generator *Generator
+	deduper   *Deduper
+	spec      Spec
+	metrics   RunMetrics
+	// consecutive candidates rejected by the dedup (across the slots)
+	duplicateStreak int
+	// the effective options are logged once per run
+	optionsLogged bool
+	// options replace the options of the kind for a reroll (nil: the options of the kind)
+	options map[string]interface{}
+	// attempts per slot, a reroll has one (its seed gives the same answer again)
+	attempts  int
+	variation int
+	// prefixes of the coverage mode
+	prefixes []string
+	// seed of the run, the seeds of the attempts and the story tables of the slots come from it
+	seed int
+}
+
+func NewRun(generator *Generator, deduper *Deduper, spec Spec) *Run {
+	run := &Run{generator: generator, deduper: deduper, spec: spec, attempts: 3, seed: runSeed(generator.seed)}
+	if spec.Coverage {
+		run.prefixes = coveragePrefixes(generator.kinds, spec)
+	}
+	return run
+}
+
+// Prefixes returns the prefixes of the coverage mode (nil without coverage)
+func (r *Run) Prefixes() []string {
+	return r.prefixes
+}
+
+// slotSpec is the spec of a slot, with its prefix in the coverage mode and its drawn story tables
+// (kept by its attempts, and in the provenance)
+func (r *Run) slotSpec(index int) Spec {
+	spec := r.spec
+	if len(r.prefixes) > 0 {
+		spec.Prefix = r.prefixes[index%len(r.prefixes)]
+	}
+	if len(spec.Tables) == 0 && !spec.NameOnly {
+		spec.Tables = r.generator.storyChances.Draw(rand.New(rand.NewPCG(uint64(r.seed), uint64(index))))
+	}
+	return spec
+}
+
+// Metrics returns the outcomes of the attempts so far
+func (r *Run) Metrics() RunMetrics {
+	return r.metrics
+}
+
+// Generate fills every slot of the spec
+func (r *Run) Generate(ctx context.Context) ([]Slot, error) {
+	slots := []Slot{}
+	for index := range r.spec.Count {
+		slot, err := r.GenerateSlot(ctx, index)
+		if err != nil {
+			return slots, err
+		}
+		slots = append(slots, slot)
+	}
+	return slots, nil
+}
+
+// GenerateSlot tries 3 times to get a new valid character,
+// the error is only returned when the model can't be reached
+func (r *Run) GenerateSlot(ctx context.Context, index int) (Slot, error) {
+	before := r.metrics
+	slot, err := r.generateSlot(ctx, index)
+	if err == nil {
+		r.generator.quality.Record(r.generator.model, r.spec.Kind, before, r.metrics)
+	}
+	return slot, err
+}
+
+func (r *Run) generateSlot(ctx context.Context, index int) (Slot, error) {
+	r.deduper.Use(ctx, r.generator.dedup...)
+	state := r.newSlotAttempts(index)
+	for state.tries < r.attempts {
+		slot, err := r.generateCandidate(ctx, state)
+		if err != nil || slot.Status != SlotOK {
+			state.last = slot
+			if err != nil {
+				return slot, err
+			}
+			r.retrying(ctx, state)
+			continue
+		}
+		err = r.validate(ctx, &slot, &r.metrics)
+		if err != nil {
+			return slot, err
+		}
+		if slot.Status == SlotOK {
+			r.emitDone(ctx, slot, state.tries)
+			return slot, nil
+		}
+		state.last = slot
+		r.retrying(ctx, state)
+	}
+	r.emitDone(ctx, state.last, state.tries)
+	return state.last, nil
+}
+
+// slotAttempts is the state of a slot across its attempts: the options softened
+// by the previous attempts and the last failure
+type slotAttempts struct {
+	index   int
+	spec    Spec
+	options map[string]interface{}
+	base    map[string]interface{}
+	tries   int
+	last    Slot
+	// metrics are the attempts of the slot in the pipeline, the quality monitor records them when the slot is done
+	metrics RunMetrics
+}
+
+func (r *Run) newSlotAttempts(index int) *slotAttempts {
+	options := r.options
+	if options == nil {
+		options = r.generator.optionsFor(r.spec)
+	}
+	if !r.optionsLogged {
+		fmt.Printf("🎛️ %s options: %v\n", r.spec.Kind, options)
+		r.optionsLogged = true
+	}
+	return &slotAttempts{index: index, spec: r.slotSpec(index), options: options, base: options, last: Slot{Index: index}}
+}
+
+// generateCandidate is one attempt of the generation stage: the answer of the model, the parsing,
+// the checks of the name and the dedup; the candidate still has to pass the validation stage
+func (r *Run) generateCandidate(ctx context.Context, state *slotAttempts) (Slot, error) {
+	slot := Slot{Index: state.index}
+	spec, options, base := state.spec, state.options, state.base
+	state.tries++
+	r.metrics.Attempts++
+	attemptOptions := r.generator.escalation.Apply(options, r.duplicateStreak)
+	if r.duplicateStreak >= r.generator.escalation.After && r.generator.escalation.After > 0 {
+		fmt.Printf("🌡️ %d duplicates in a row, temperature %v, top_k %v\n",
+			r.duplicateStreak, attemptOptions["temperature"], attemptOptions["top_k"])
+		r.metrics.Escalated++
+	}
+	// an explicit seed makes the answer reproducible (provenance)
+	attemptOptions, seed := withSeed(attemptOptions, attemptSeed(r.seed, state.index, state.tries))
+	// Generate a random name
+	start := time.Now()
+	var answer Answer
+	var err error
+	if spec.NameOnly {
+		answer, err = r.generator.GenerateName(ctx, spec, attemptOptions)
+	} else {
+		answer, err = r.generator.Generate(ctx, spec, attemptOptions, func(name string) bool {
+			return !r.deduper.Seen(ctx, name)
+		})
+	}
+	r.metrics.GenerationMS += time.Since(start).Milliseconds()
+	if err != nil {
+		return slot, err
+	}
+	r.metrics.ToolCalls += answer.ToolCalls
+	if answer.Truncated {
+		r.metrics.Truncated++
+		slot.Status, slot.Reason = SlotFailed, "truncated answer"
+		return slot, nil
+	}
+
+	character, err := ParseCharacter(answer.Content)
+	if err != nil {
+		fmt.Println("😡:", err)
+		slot.Status, slot.Reason = SlotFailed, err.Error()
+		switch {
+		case errors.Is(err, ErrEmptyAnswer):
+			r.metrics.Empty++
+		case errors.Is(err, ErrRefusal):
+			r.metrics.Refusals++
+		default:
+			r.metrics.Invalid++
+			return slot, nil
+		}
+		// the aggressive options are the usual suspects of empty answers and refusals
+		if r.generator.autoAdjust {
+			state.options = r.generator.softenedOptions(base)
+			r.metrics.Adjusted++
+		}
+		return slot, nil
+	}
+
+	// the kind of a hybrid is not left to the model
+	if len(r.spec.Parents) > 0 {
+		character.Kind, character.Parents = r.spec.Kind, r.spec.Parents
+	}
+
+	system, err := r.generator.System(r.spec.System)
+	if err != nil {
+		return slot, err
+	}
+	if system != nil {
+		err = system.Validate(character)
+		if err != nil {
+			fmt.Println("😡:", err)
+			r.metrics.Invalid++
+			slot.Status, slot.Reason = SlotFailed, err.Error()
+			return slot, nil
+		}
+	}
+
+	err = CheckName(character.Name)
+	if err != nil {
+		fmt.Println("🤪:", err)
+		r.metrics.Gibberish++
+		slot.Status, slot.Reason = SlotFailed, err.Error()
+		// the gibberish comes from the sampling options, the next attempts are softened
+		state.options = r.generator.softenedOptions(base)
+		r.metrics.Adjusted++
+		return slot, nil
+	}
+
+	err = r.generator.checkLanguage(character)
+	if err != nil {
+		fmt.Println("🌐:", err)
+		r.metrics.WrongLanguage++
+		slot.Status, slot.Reason = SlotFailed, err.Error()
+		return slot, nil
+	}
+
+	if spec.Prefix != "" && !hasPrefix(character.Name, spec.Prefix) {
+		fmt.Printf("🔤 %s doesn't start with %s\n", character.Name, spec.Prefix)
+		r.metrics.Invalid++
+		slot.Status, slot.Reason = SlotFailed, "not starting with "+spec.Prefix
+		return slot, nil
+	}
+
+	if spec.Relative != nil && spec.Relative.Family != "" && !hasFamilyName(character.Name, spec.Relative.Family) {
+		fmt.Printf("👪 %s doesn't keep the family name %s\n", character.Name, spec.Relative.Family)
+		r.metrics.Invalid++
+		slot.Status, slot.Reason = SlotFailed, "without the family name "+spec.Relative.Family
+		return slot, nil
+	}
+	if spec.Relative != nil {
+		character.RelativeOf, character.Relation = spec.Relative.ID, spec.Relative.Relation
+	}
+
+	// the ASCII name is generated by the code, not by the model
+	character.ASCIIName = ""
+	character.Provenance = r.generator.provenance(answer, spec, attemptOptions, seed)
+	character.Provenance.Variation = r.variation
+	err = r.generator.retransliterate(&character)
+	if err != nil {
+		fmt.Println("🔤:", err)
+		r.metrics.Invalid++
+		slot.Status, slot.Reason = SlotFailed, err.Error()
+		return slot, nil
+	}
+
+	if !r.deduper.AddNames(ctx, character.Names()) {
+		fmt.Println("🔁 duplicate:", character.Name)
+		r.metrics.Duplicates++
+		r.duplicateStreak++
+		slot.Status, slot.Reason = SlotFiltered, "duplicate: "+character.Name
+		return slot, nil
+	}
+	r.duplicateStreak = 0
+
+	slot.Status, slot.Character = SlotOK, &character
+	return slot, nil
+}
+
+// hasValidation is true when the candidates go through a long validation stage
+// (the equipment request, the strict verification, the review)
+func (r *Run) hasValidation() bool {
+	return r.spec.Class != "" || r.generator.strict || r.generator.review
+}
+
+// validate is the validation stage of a candidate: the equipment, the strict verification and the review,
+// a rejected candidate gives its names back to the deduper; the outcomes go to metrics
+// (not the metrics of the run, the stages of GeneratePipelined run at the same time)
+func (r *Run) validate(ctx context.Context, slot *Slot, metrics *RunMetrics) error {
+	character := *slot.Character
+	reject := func(reason string) {
+		r.deduper.RemoveNames(character.Names())
+		slot.Status, slot.Reason, slot.Character = SlotFailed, reason, nil
+	}
+
+	if r.spec.Class != "" {
+		character.Class = r.spec.Class
+		character.Level = r.spec.Level
+		equipment, err := r.generator.Equip(ctx, r.generator.equipmentRules, character)
+		if err != nil && !errors.Is(err, ErrNoValidEquipment) {
+			return err
+		}
+		if err != nil {
+			fmt.Println("😡:", err)
+			metrics.Rejected++
+			reject(err.Error())
+			return nil
+		}
+		character.Equipment = &equipment
+	}
+
+	if r.generator.strict {
+		verification, err := r.generator.Verify(ctx, r.spec, character)
+		if err != nil {
+			return err
+		}
+		if !verification.Compliant {
+			fmt.Println("🧾 not compliant:", character.Name, "-", verification)
+			metrics.Unverified++
+			reject("not compliant: " + verification.String())
+			return nil
+		}
+	}
+
+	if r.generator.review {
+		grade, err := r.generator.Review(ctx, r.spec, character)
+		if err != nil {
+			return err
+		}
+		if !grade.Pass {
+			fmt.Printf("⚖️ below the rubric: %s %.2f - %s\n", character.Name, grade.Score, grade.Reason)
+			metrics.Rejected++
+			reject(fmt.Sprintf("below the rubric: %.2f", grade.Score))
+			return nil
+		}
+		character.Grade = &grade
+	}
+	fmt.Println(character.Name, character.Kind, character.Class)
+
+	slot.Status, slot.Reason, slot.Character = SlotOK, "", &character
+	return nil
+}
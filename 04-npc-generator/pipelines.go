@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/ollama/ollama/api"
+)
+
+// Stages of the named pipelines, the name stage generates the character and comes first
+const (
+	StageName           = "name"
+	StageStats          = "stats"
+	StageEquipment      = "equipment"
+	StageBackstory      = "backstory"
+	StageDialogue       = "dialogue"
+	StagePortraitPrompt = "portrait-prompt"
+)
+
+// pipelineStage completes the character of a pipeline with one more request
+type pipelineStage func(ctx context.Context, g *Generator, spec Spec, character Character) (Character, error)
+
+var pipelineStages = map[string]pipelineStage{
+	StageStats: func(ctx context.Context, g *Generator, spec Spec, character Character) (Character, error) {
+		system, err := g.System(spec.System)
+		if err != nil {
+			return character, err
+		}
+		return g.GenerateStats(ctx, character, *system)
+	},
+	StageEquipment: func(ctx context.Context, g *Generator, spec Spec, character Character) (Character, error) {
+		character.Class, character.Level = spec.Class, spec.Level
+		equipment, err := g.Equip(ctx, g.equipmentRules, character)
+		character.Equipment = &equipment
+		return character, err
+	},
+	StageBackstory: func(ctx context.Context, g *Generator, spec Spec, character Character) (Character, error) {
+		return g.RegenerateField(ctx, character, "backstory", nil)
+	},
+	StageDialogue: func(ctx context.Context, g *Generator, spec Spec, character Character) (Character, error) {
+		dialogue, err := g.WriteLines(ctx, character, 3)
+		character.Lines, character.Age = dialogue.Lines, dialogue.Age
+		return character, err
+	},
+	StagePortraitPrompt: func(ctx context.Context, g *Generator, spec Spec, character Character) (Character, error) {
+		prompt, err := g.PortraitPrompt(ctx, character)
+		character.PortraitPrompt = prompt.Prompt
+		return character, err
+	},
+}
+
+var builtinPipelines = map[string][]string{
+	"npc-full":   {StageName, StageStats, StageBackstory, StageDialogue, StagePortraitPrompt},
+	"npc-voiced": {StageName, StageBackstory, StageDialogue},
+}
+
+// LoadPipelines returns the built-in pipelines and the ones of the file (PIPELINES),
+// a JSON object of the stages by pipeline name: {"npc-full": ["name", "stats", "backstory"]}
+func LoadPipelines(path string) (map[string][]string, error) {
+	pipelines := maps.Clone(builtinPipelines)
+	if path == "" {
+		return pipelines, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	custom := map[string][]string{}
+	err = json.Unmarshal(data, &custom)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for name, stages := range custom {
+		err = checkPipeline(stages)
+		if err != nil {
+			return nil, fmt.Errorf("%s: pipeline %s: %w", path, name, err)
+		}
+	}
+	maps.Copy(pipelines, custom)
+	return pipelines, nil
+}
+
+// checkPipeline checks that the pipeline starts with the name stage and knows its stages
+func checkPipeline(stages []string) error {
+	if len(stages) == 0 || stages[0] != StageName {
+		return errors.New("the first stage must be name")
+	}
+	for idx, stage := range stages[1:] {
+		if _, ok := pipelineStages[stage]; !ok {
+			return fmt.Errorf("unknown stage %q (%s)", stage, strings.Join(slices.Sorted(maps.Keys(pipelineStages)), ", "))
+		}
+		if slices.Contains(stages[:idx+1], stage) {
+			return fmt.Errorf("the stage %s is repeated", stage)
+		}
+	}
+	return nil
+}
+
+// GenerateStats asks the model for the stats of the system of a character (3 attempts)
+func (g *Generator) GenerateStats(ctx context.Context, character Character, system GameSystem) (Character, error) {
+	characterContext, err := json.Marshal(character)
+	if err != nil {
+		return character, err
+	}
+	schema := map[string]any{
+		"type":       "object",
+		"properties": map[string]any{"stats": system.StatsSchema()},
+		"required":   []string{"stats"},
+	}
+	messages := []api.Message{
+		{Role: "system", Content: g.genre.Instructions},
+		{Role: "user", Content: fmt.Sprintf("Here is a character: %s\nGive the stats of this character for %s, consistent with the other fields. %s",
+			characterContext, system.Title, system.Vocabulary)},
+	}
+	for attempt := 0; attempt < 3; attempt++ {
+		answer, err := g.chat(ctx, DomainCharacter, messages, schema, map[string]interface{}{"temperature": 0.7})
+		if err != nil {
+			return character, err
+		}
+		if answer.Truncated {
+			continue
+		}
+		stats := struct {
+			Stats map[string]int `json:"stats"`
+		}{}
+		err = decodeAnswer(answer.Content, &stats)
+		if err == nil {
+			character.Stats = stats.Stats
+			err = system.Validate(character)
+		}
+		if err != nil {
+			fmt.Println("😡 stats:", err)
+			continue
+		}
+		return character, nil
+	}
+	return character, fmt.Errorf("no valid %s stats for %s after 3 attempts", system.Name, character.Name)
+}
+
+// runPipeline runs a named pipeline for every character, the characters are stored
+// when their last stage is done and exported as pipeline.<name>.json, .md and .csv:
+// run --pipeline npc-full --kind Dwarf --system dnd5e --count 3
+func (a *App) runPipeline(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	campaign := flags.String("campaign", getEnv("CAMPAIGN", DefaultCampaign), "campaign of the characters")
+	name := flags.String("pipeline", os.Getenv("PIPELINE"), "name of the pipeline (npc-full, npc-voiced or one of PIPELINES)")
+	spec := Spec{Level: 1}
+	flags.StringVar(&spec.Kind, "kind", os.Getenv("KIND"), "kind of the characters (default: the first kind of the genre)")
+	flags.StringVar(&spec.System, "system", os.Getenv("SYSTEM"), "game system of the stats stage")
+	flags.StringVar(&spec.Class, "class", os.Getenv("CLASS"), "class of the equipment stage")
+	flags.IntVar(&spec.Level, "level", spec.Level, "level of the equipment stage")
+	flags.IntVar(&spec.Count, "count", 1, "number of characters")
+	flags.StringVar(&a.summaryPath, "summary", a.summaryPath, "write the JSON summary of the run to this file (- for stderr)")
+	flags.Parse(args)
+
+	pipelines, err := LoadPipelines(os.Getenv("PIPELINES"))
+	if err != nil {
+		return err
+	}
+	stages, ok := pipelines[*name]
+	if !ok {
+		return fmt.Errorf("unknown pipeline %q (%s)", *name, strings.Join(slices.Sorted(maps.Keys(pipelines)), ", "))
+	}
+	if slices.Contains(stages, StageStats) && spec.System == "" {
+		return fmt.Errorf("the pipeline %s has a stats stage, it needs --system", *name)
+	}
+	if slices.Contains(stages, StageEquipment) && spec.Class == "" {
+		return fmt.Errorf("the pipeline %s has an equipment stage, it needs --class", *name)
+	}
+	if spec.Kind == "" {
+		spec.Kind = a.generator.kinds[0].Name
+	}
+	_, err = a.generator.System(spec.System)
+	if err != nil {
+		return err
+	}
+	spec.Kind, spec.Parents, err = ResolveKind(a.generator.kinds, spec.Kind, "")
+	if err != nil {
+		return err
+	}
+
+	registry, err := a.storage.Registry(*campaign)
+	if err != nil {
+		return err
+	}
+	// the name stage is a generation without the stats and the equipment, they are stages of their own
+	nameSpec := spec
+	nameSpec.System, nameSpec.Class = "", ""
+	run := NewRun(a.generator, registry.Deduper(), nameSpec)
+	fmt.Printf("🧩 %s: %s\n", *name, strings.Join(stages, " → "))
+	slots := []Slot{}
+	for index := range spec.Count {
+		slot, err := run.GenerateSlot(ctx, index)
+		if err != nil {
+			return err
+		}
+		if slot.Status == SlotOK {
+			character := *slot.Character
+			for _, stage := range stages[1:] {
+				character, err = pipelineStages[stage](ctx, a.generator, spec, character)
+				if err != nil {
+					return fmt.Errorf("%s of %s: %w", stage, character.Name, err)
+				}
+				fmt.Printf("🧩 %s: %s\n", character.Name, stage)
+			}
+			slot.Character = &character
+		}
+		stored := []Slot{slot}
+		err = StoreSlots(registry, stored)
+		if err != nil {
+			return err
+		}
+		slots = append(slots, stored[0])
+	}
+
+	exportPath, err := a.storage.ExportPath(*campaign, "pipeline."+*name+".json")
+	if err != nil {
+		return err
+	}
+	output := RunOutput{Campaign: *campaign, Genre: a.generator.genre.Name, Spec: spec, Slots: slots, Metrics: run.Metrics()}
+	err = output.Write(exportPath, a.sortOptions, a.generator.genre, a.markdown)
+	if err != nil {
+		return err
+	}
+	a.summary = NewRunSummary("run", output, map[string]string{"json": exportPath})
+	fmt.Println("📝", exportPath, len(output.Failed()), "failed or filtered")
+	return nil
+}
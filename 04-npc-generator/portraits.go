@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ollama/ollama/api"
+)
+
+var portraitSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"prompt":          map[string]any{"type": "string", "maxLength": 600},
+		"negative_prompt": map[string]any{"type": "string", "maxLength": 300},
+	},
+	"required": []string{"prompt", "negative_prompt"},
+}
+
+// portraitNegativePrompt goes with the prompts stored by the pipelines
+const portraitNegativePrompt = "text, watermark, signature, extra fingers, deformed hands, blurry"
+
+// PortraitPrompt is the text-to-image prompt of a character, written by the model
+type PortraitPrompt struct {
+	Prompt         string `json:"prompt"`
+	NegativePrompt string `json:"negative_prompt"`
+}
+
+// PortraitPrompt asks the model for the text-to-image prompt of the character
+// (its kind, its class and equipment, the extras of the genre)
+func (g *Generator) PortraitPrompt(ctx context.Context, character Character) (PortraitPrompt, error) {
+	prompt := PortraitPrompt{}
+	characterJSON, err := json.Marshal(character)
+	if err != nil {
+		return prompt, err
+	}
+	messages := []api.Message{
+		{Role: "system", Content: "You write the prompts of a text-to-image model (Stable Diffusion) for the portraits of role playing game characters."},
+		{Role: "user", Content: fmt.Sprintf("Write the prompt of a head and shoulders portrait of this %s character of a %s setting: %s\n"+
+			"Describe the face, the hair, the clothes and the gear in comma-separated keywords, then the style (painted fantasy art, detailed, soft light). "+
+			"The negative prompt lists what to avoid (text, watermark, extra fingers, blurry).", character.Kind, g.genre.Name, characterJSON)},
+	}
+	answer, err := g.chat(ctx, DomainPortrait, messages, portraitSchema, map[string]interface{}{"temperature": 0.7})
+	if err != nil {
+		return prompt, err
+	}
+	err = decodeAnswer(answer.Content, &prompt)
+	if err != nil {
+		return prompt, fmt.Errorf("portrait prompt: %w", err)
+	}
+	return prompt, nil
+}
+
+// PortraitClient calls the txt2img endpoint of an Automatic1111 API (PORTRAIT_URL)
+type PortraitClient struct {
+	url    string
+	width  int
+	height int
+	steps  int
+	client *http.Client
+}
+
+// NewPortraitClient reads PORTRAIT_SIZE (512x512) and PORTRAIT_STEPS (25), nil without PORTRAIT_URL
+func NewPortraitClient(baseURL string, transport http.RoundTripper) (*PortraitClient, error) {
+	if baseURL == "" {
+		return nil, nil
+	}
+	portrait := &PortraitClient{url: strings.TrimSuffix(baseURL, "/") + "/sdapi/v1/txt2img", client: &http.Client{Transport: transport}}
+	size := getEnv("PORTRAIT_SIZE", "512x512")
+	_, err := fmt.Sscanf(size, "%dx%d", &portrait.width, &portrait.height)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PORTRAIT_SIZE %q (width x height, like 512x768)", size)
+	}
+	portrait.steps, err = strconv.Atoi(getEnv("PORTRAIT_STEPS", "25"))
+	if err != nil {
+		return nil, err
+	}
+	return portrait, nil
+}
+
+// Render returns the PNG of the prompt
+func (p *PortraitClient) Render(ctx context.Context, prompt PortraitPrompt) ([]byte, error) {
+	body, err := json.Marshal(map[string]any{
+		"prompt":          prompt.Prompt,
+		"negative_prompt": prompt.NegativePrompt,
+		"width":           p.width,
+		"height":          p.height,
+		"steps":           p.steps,
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("txt2img: %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	result := struct {
+		Images []string `json:"images"`
+	}{}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return nil, fmt.Errorf("txt2img: %w", err)
+	}
+	if len(result.Images) == 0 {
+		return nil, fmt.Errorf("txt2img: no image in the answer")
+	}
+	return base64.StdEncoding.DecodeString(result.Images[0])
+}
+
+// PortraitPath is the PNG of the character in the portraits directory next to the exports
+func PortraitPath(exportDir string, character Character) string {
+	return filepath.Join(exportDir, "portraits", fmt.Sprintf("%d-%s.png", character.ID, Slug(character.Name)))
+}
+
+// GeneratePortraits writes the portrait of every character next to the exports, concurrency
+// portraits at the same time (the image servers have one or two GPUs): a failed portrait is logged
+// and skipped, only a canceled context stops them; it returns the number of saved portraits
+func (g *Generator) GeneratePortraits(ctx context.Context, portraits *PortraitClient, characters []Character, exportDir string, concurrency int) (int, error) {
+	err := os.MkdirAll(filepath.Join(exportDir, "portraits"), 0755)
+	if err != nil {
+		return 0, err
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	saved := 0
+	slots := make(chan struct{}, max(concurrency, 1))
+	for _, character := range characters {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return saved, ctx.Err()
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			// the prompt of a pipeline is reused
+			prompt := PortraitPrompt{Prompt: character.PortraitPrompt, NegativePrompt: portraitNegativePrompt}
+			var err error
+			if prompt.Prompt == "" {
+				prompt, err = g.PortraitPrompt(ctx, character)
+			}
+			var png []byte
+			if err == nil {
+				png, err = portraits.Render(ctx, prompt)
+			}
+			path := PortraitPath(exportDir, character)
+			if err == nil {
+				err = os.WriteFile(path, png, 0644)
+			}
+			if err != nil {
+				fmt.Printf("😡 portrait of %s: %s\n", character.Name, err)
+				return
+			}
+			fmt.Println("🖼️", path)
+			mu.Lock()
+			saved++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return saved, ctx.Err()
+}
+
+// portraitClient is the image endpoint of the --portraits stage of generate,
+// nil when PORTRAIT_URL is not set (the stage is skipped)
+func (a *App) portraitClient() (*PortraitClient, error) {
+	portraits, err := NewPortraitClient(os.Getenv("PORTRAIT_URL"), a.transport)
+	if err != nil {
+		return nil, err
+	}
+	if portraits == nil {
+		fmt.Println("🖼️ no PORTRAIT_URL, the portraits are skipped")
+		return nil, nil
+	}
+	return portraits, a.offline.Refuse("portraits " + portraits.url)
+}
+
+// runPortraits writes the portraits of the stored characters of a run next to its exports
+func (a *App) runPortraits(ctx context.Context, portraits *PortraitClient, characters []Character, exportDir string) error {
+	concurrency, err := strconv.Atoi(getEnv("PORTRAIT_CONCURRENCY", "2"))
+	if err != nil {
+		return err
+	}
+	saved, err := a.generator.GeneratePortraits(ctx, portraits, characters, exportDir, concurrency)
+	fmt.Printf("🖼️ %d of %d portraits\n", saved, len(characters))
+	return err
+}
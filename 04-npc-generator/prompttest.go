@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"strings"
+)
+
+// PromptTestCase is a spec generated with a fixed seed
+type PromptTestCase struct {
+	Name string `json:"name"`
+	Seed int    `json:"seed"`
+	GenerateRequest
+}
+
+// PromptScores are between 0 and 1:
+// style is the judge score, validity the ratio of valid answers, diversity the ratio of new names
+type PromptScores struct {
+	Style     float64 `json:"style"`
+	Validity  float64 `json:"validity"`
+	Diversity float64 `json:"diversity"`
+}
+
+// PromptTestSuite is the cases and the minimum average scores
+type PromptTestSuite struct {
+	Thresholds PromptScores     `json:"thresholds"`
+	Cases      []PromptTestCase `json:"cases"`
+}
+
+var defaultPromptTestSuite = PromptTestSuite{
+	Thresholds: PromptScores{Style: 0.6, Validity: 0.8, Diversity: 0.7},
+	Cases: []PromptTestCase{
+		{Name: "dwarves", Seed: 42, GenerateRequest: GenerateRequest{Spec: Spec{Kind: "Dwarf", Level: 1, Count: 10}}},
+		{Name: "elves", Seed: 42, GenerateRequest: GenerateRequest{Spec: Spec{Kind: "Elf", Level: 1, Count: 10}}},
+		{Name: "humans", Seed: 42, GenerateRequest: GenerateRequest{Spec: Spec{Kind: "Human", Level: 1, Count: 10}}},
+		{Name: "half-elves", Seed: 7, GenerateRequest: GenerateRequest{Spec: Spec{Kind: "Half-Elf", Level: 1, Count: 10}}},
+	},
+}
+
+// LoadPromptTestSuite reads the suite file, the built-in suite is used without file
+func LoadPromptTestSuite(path string) (PromptTestSuite, error) {
+	if path == "" {
+		return defaultPromptTestSuite, nil
+	}
+	suite := PromptTestSuite{Thresholds: defaultPromptTestSuite.Thresholds}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return suite, err
+	}
+	err = json.Unmarshal(data, &suite)
+	if err != nil {
+		return suite, fmt.Errorf("%s: %w", path, err)
+	}
+	return suite, nil
+}
+
+// PromptTestResult is the outcome of a case
+type PromptTestResult struct {
+	Name   string       `json:"name"`
+	Names  []string     `json:"names"`
+	Scores PromptScores `json:"scores"`
+	Reason string       `json:"reason"`
+}
+
+// RunPromptTest generates every case of the suite with its seed (nothing is stored)
+// and scores the names, the judge model grades the style against the naming rules
+func (g *Generator) RunPromptTest(ctx context.Context, suite PromptTestSuite, judgeModel string) ([]PromptTestResult, error) {
+	results := []PromptTestResult{}
+	for _, testCase := range suite.Cases {
+		spec, slots, metrics, err := g.runTestCase(ctx, testCase)
+		if err != nil {
+			return results, err
+		}
+
+		result := PromptTestResult{Name: testCase.Name, Names: []string{}}
+		failed := 0
+		for _, slot := range slots {
+			if slot.Status == SlotOK {
+				result.Names = append(result.Names, slot.Character.Name)
+			}
+			if slot.Status == SlotFailed {
+				failed++
+			}
+		}
+		result.Scores.Validity = 1 - float64(failed)/float64(len(slots))
+		result.Scores.Diversity = 1 - float64(metrics.Duplicates)/float64(max(metrics.Attempts, 1))
+
+		score, reason, err := g.judgeStyle(ctx, judgeModel, spec, result.Names)
+		if err != nil {
+			return results, err
+		}
+		result.Scores.Style, result.Reason = score, reason
+		fmt.Printf("🧪 %-12s style %.2f validity %.2f diversity %.2f\n", testCase.Name, result.Scores.Style, result.Scores.Validity, result.Scores.Diversity)
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// runTestCase generates the case with its seed in a new deduper (nothing is stored)
+func (g *Generator) runTestCase(ctx context.Context, testCase PromptTestCase) (Spec, []Slot, RunMetrics, error) {
+	spec, err := g.CheckSpec(testCase.GenerateRequest, 100)
+	if err != nil {
+		return spec, nil, RunMetrics{}, fmt.Errorf("%s: %w", testCase.Name, err)
+	}
+	seeded := *g
+	seeded.options = maps.Clone(g.options)
+	seeded.options["seed"] = testCase.Seed
+
+	run := NewRun(&seeded, NewDeduper(), spec)
+	slots, err := run.Generate(ctx)
+	return spec, slots, run.Metrics(), err
+}
+
+// judgeStyle grades the names with the rubric of the names (0 to 1)
+func (g *Generator) judgeStyle(ctx context.Context, judgeModel string, spec Spec, names []string) (float64, string, error) {
+	if len(names) == 0 {
+		return 0, "no valid name", nil
+	}
+	rules := GenerationInstructions(g.kinds)
+	if len(spec.Parents) == 2 {
+		rules = hybridInstructions(g.kinds, spec.Kind, spec.Parents)
+	}
+	subject := fmt.Sprintf("these %s names:\n- %s\n", spec.Kind, strings.Join(names, "\n- "))
+	grade, err := g.Judge(ctx, judgeModel, RubricNames, rules, subject)
+	if err != nil {
+		return 0, "", err
+	}
+	return grade.Score, grade.Reason, nil
+}
+
+// CheckThresholds returns an error when an average score is below its threshold
+func CheckThresholds(results []PromptTestResult, thresholds PromptScores) (PromptScores, error) {
+	average := PromptScores{}
+	if len(results) == 0 {
+		return average, nil
+	}
+	for _, result := range results {
+		average.Style += result.Scores.Style / float64(len(results))
+		average.Validity += result.Scores.Validity / float64(len(results))
+		average.Diversity += result.Scores.Diversity / float64(len(results))
+	}
+	failures := []string{}
+	if average.Style < thresholds.Style {
+		failures = append(failures, fmt.Sprintf("style %.2f < %.2f", average.Style, thresholds.Style))
+	}
+	if average.Validity < thresholds.Validity {
+		failures = append(failures, fmt.Sprintf("validity %.2f < %.2f", average.Validity, thresholds.Validity))
+	}
+	if average.Diversity < thresholds.Diversity {
+		failures = append(failures, fmt.Sprintf("diversity %.2f < %.2f", average.Diversity, thresholds.Diversity))
+	}
+	if len(failures) > 0 {
+		return average, fmt.Errorf("prompt test failed: %s", strings.Join(failures, ", "))
+	}
+	return average, nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"math/rand/v2"
+	"time"
+
+	"04-npc-generator/model"
+	"github.com/ollama/ollama/api"
+)
+
+type Provenance = model.Provenance
+
+// promptVersion is the first 12 hex digits of the digest of the prompt messages:
+// a change of the instructions, of the genre or of the kinds is a new version
+func promptVersion(messages []api.Message) string {
+	hash := sha256.New()
+	for _, message := range messages {
+		hash.Write([]byte(message.Role + "\x00" + message.Content + "\x00"))
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:12]
+}
+
+// withSeed returns a copy of the options with the seed of the attempt when they have none,
+// so every answer can be reproduced
+func withSeed(options map[string]interface{}, attemptSeed int) (map[string]interface{}, int) {
+	// the options of a JSON file are float64
+	switch seed := options["seed"].(type) {
+	case int:
+		return options, seed
+	case float64:
+		return options, int(seed)
+	}
+	seeded := maps.Clone(options)
+	if seeded == nil {
+		seeded = map[string]interface{}{}
+	}
+	seeded["seed"] = attemptSeed
+	return seeded, attemptSeed
+}
+
+// runSeed is the seed of a run: SEED, or a random one (0)
+func runSeed(seed int) int {
+	if seed != 0 {
+		return seed
+	}
+	return rand.IntN(1 << 31)
+}
+
+// attemptSeed derives the seed of an attempt of a slot from the seed of the run,
+// the same run seed sends the same requests (the cassettes of VCR_MODE)
+func attemptSeed(runSeed, index, try int) int {
+	hash := fnv.New64a()
+	fmt.Fprintf(hash, "%d/%d/%d", runSeed, index, try)
+	return int(hash.Sum64() % (1 << 31))
+}
+
+// ProvenanceMarkdown lists the models and the prompt versions of the characters under the table
+func ProvenanceMarkdown(characters []Character) string {
+	counts := map[string]int{}
+	lines := []string{}
+	for _, character := range characters {
+		if character.Provenance == nil {
+			continue
+		}
+		line := character.Provenance.Model
+		if digest := character.Provenance.ModelDigest; digest != "" {
+			line += " " + digest[:min(12, len(digest))]
+		}
+		line += ", prompt " + character.Provenance.PromptVersion
+		if counts[line] == 0 {
+			lines = append(lines, line)
+		}
+		counts[line]++
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	markdown := "\nGenerated with:\n\n"
+	for _, line := range lines {
+		markdown += fmt.Sprintf("- %s (%d characters)\n", line, counts[line])
+	}
+	return markdown
+}
+
+// provenance of an answer of the generator
+func (g *Generator) provenance(answer Answer, spec Spec, options map[string]interface{}, seed int) *Provenance {
+	// one character of the spec
+	spec.Count = 1
+	specJSON, _ := json.Marshal(spec)
+	return &Provenance{
+		Model:         g.model,
+		ModelDigest:   g.modelDigest,
+		Genre:         g.genre.Name,
+		Theme:         g.genre.Theme,
+		Spec:          specJSON,
+		PromptVersion: answer.PromptVersion,
+		Options:       options,
+		Seed:          seed,
+		Grounding:     answer.Grounding,
+		GeneratedAt:   time.Now().UTC(),
+	}
+}
@@ -0,0 +1,124 @@
+//go:build !minimal
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 500
+)
+
+// CharacterPage is a page of the public listing
+type CharacterPage struct {
+	Page       int         `json:"page"`
+	Limit      int         `json:"limit"`
+	Total      int         `json:"total"`
+	Pages      int         `json:"pages"`
+	Characters []Character `json:"characters"`
+}
+
+// filterCharacters applies the filters of the query: ?kind=Half-Elf&parent=Elf&tag=villain&tag=arc2,
+// the archived characters are left out unless include_archived=true
+func filterCharacters(characters []Character, query url.Values) []Character {
+	kind, parent := query.Get("kind"), query.Get("parent")
+	filtered := []Character{}
+	characters = FilterArchived(characters, query.Get("include_archived") == "true")
+	for _, character := range FilterByTags(characters, query["tag"]) {
+		if kind != "" && !strings.EqualFold(character.Kind, kind) {
+			continue
+		}
+		if parent != "" && !slices.ContainsFunc(character.Parents, func(p string) bool { return strings.EqualFold(p, parent) }) {
+			continue
+		}
+		filtered = append(filtered, character)
+	}
+	return filtered
+}
+
+// handlePublicList browses the stored characters without generating anything:
+// GET /characters?campaign=default&kind=Dwarf&page=2&limit=50 (the filters of the campaign listing)
+func (s *Server) handlePublicList(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	campaign := DefaultCampaign
+	if query.Has("campaign") {
+		campaign = query.Get("campaign")
+	}
+	registry, err := s.storage.Registry(campaign)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	page, err := queryInt(query, "page", 1)
+	if err == nil && page < 1 {
+		err = fmt.Errorf("page must be 1 or more")
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	limit, err := queryInt(query, "limit", defaultPageLimit)
+	if err == nil && (limit < 1 || limit > maxPageLimit) {
+		err = fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	characters := filterCharacters(registry.List(), query)
+	SortCharacters(characters, s.sortOptions)
+	start, end := min((page-1)*limit, len(characters)), min(page*limit, len(characters))
+	writeJSONWithETag(w, r, CharacterPage{
+		Page:       page,
+		Limit:      limit,
+		Total:      len(characters),
+		Pages:      (len(characters) + limit - 1) / limit,
+		Characters: characters[start:end],
+	})
+}
+
+func queryInt(query url.Values, name string, defaultValue int) (int, error) {
+	if !query.Has(name) {
+		return defaultValue, nil
+	}
+	value, err := strconv.Atoi(query.Get(name))
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q", name, query.Get(name))
+	}
+	return value, nil
+}
+
+// writeJSONWithETag answers 304 Not Modified when the client already has this version of the body
+func writeJSONWithETag(w http.ResponseWriter, r *http.Request, value any) {
+	body := bytes.Buffer{}
+	err := json.NewEncoder(&body).Encode(value)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	hash := sha256.Sum256(body.Bytes())
+	etag := `"` + hex.EncodeToString(hash[:16]) + `"`
+
+	w.Header().Set("ETag", etag)
+	// the clients revalidate every time, an unchanged page costs a 304 only
+	w.Header().Set("Cache-Control", "public, no-cache")
+	if slices.Contains(strings.Split(r.Header.Get("If-None-Match"), ", "), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body.Bytes())
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+	"time"
+)
+
+// qualityBucketSize is the resolution of the series of the dashboard
+const qualityBucketSize = time.Minute
+
+// QualityMonitor keeps the outcomes of the generated slots by model and by kind,
+// in buckets of one minute over a rolling window, so the dashboard of the serve mode
+// shows when a model starts to repeat itself or to break the schema
+type QualityMonitor struct {
+	mutex   sync.Mutex
+	window  time.Duration
+	buckets map[qualityKey][]QualityBucket
+	now     func() time.Time
+}
+
+type qualityKey struct {
+	model string
+	kind  string
+}
+
+// QualityBucket sums the outcomes of the slots generated in one minute:
+// the retries are the attempts after the first of every slot, the schema violations
+// are the answers which don't decode, don't follow the rules, are truncated or in the wrong language
+type QualityBucket struct {
+	Start      time.Time `json:"start"`
+	Slots      int       `json:"slots"`
+	Attempts   int       `json:"attempts"`
+	Duplicates int       `json:"duplicates"`
+	Retries    int       `json:"retries"`
+	Violations int       `json:"schema_violations"`
+}
+
+// QualityRates are the shares of the attempts, 0 without attempts
+type QualityRates struct {
+	Duplicate       float64 `json:"duplicate_rate"`
+	Retry           float64 `json:"retry_rate"`
+	SchemaViolation float64 `json:"schema_violation_rate"`
+}
+
+func (b QualityBucket) Rates() QualityRates {
+	if b.Attempts == 0 {
+		return QualityRates{}
+	}
+	attempts := float64(b.Attempts)
+	return QualityRates{
+		Duplicate:       float64(b.Duplicates) / attempts,
+		Retry:           float64(b.Retries) / attempts,
+		SchemaViolation: float64(b.Violations) / attempts,
+	}
+}
+
+func (b QualityBucket) add(other QualityBucket) QualityBucket {
+	b.Slots += other.Slots
+	b.Attempts += other.Attempts
+	b.Duplicates += other.Duplicates
+	b.Retries += other.Retries
+	b.Violations += other.Violations
+	return b
+}
+
+// QualitySeries is the window of a model and a kind, Total sums its buckets
+type QualitySeries struct {
+	Model   string          `json:"model"`
+	Kind    string          `json:"kind"`
+	Total   QualityBucket   `json:"total"`
+	Rates   QualityRates    `json:"rates"`
+	Buckets []QualityBucket `json:"buckets"`
+}
+
+func NewQualityMonitor(window time.Duration) *QualityMonitor {
+	return &QualityMonitor{window: window, buckets: map[qualityKey][]QualityBucket{}, now: time.Now}
+}
+
+// Record adds the outcomes of a slot, the difference of the metrics of its run before and after it
+func (q *QualityMonitor) Record(model, kind string, before, after RunMetrics) {
+	if q == nil {
+		return
+	}
+	attempts := after.Attempts - before.Attempts
+	outcome := QualityBucket{
+		Slots:      1,
+		Attempts:   attempts,
+		Duplicates: after.Duplicates - before.Duplicates,
+		Retries:    max(attempts-1, 0),
+		Violations: after.Invalid - before.Invalid + after.Truncated - before.Truncated + after.WrongLanguage - before.WrongLanguage,
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	now := q.now()
+	outcome.Start = now.Truncate(qualityBucketSize)
+	key := qualityKey{model: model, kind: kind}
+	buckets := q.expire(q.buckets[key], now)
+	if len(buckets) > 0 && buckets[len(buckets)-1].Start.Equal(outcome.Start) {
+		buckets[len(buckets)-1] = buckets[len(buckets)-1].add(outcome)
+	} else {
+		buckets = append(buckets, outcome)
+	}
+	q.buckets[key] = buckets
+}
+
+// Series returns the window of every model and kind with slots, by model then kind
+func (q *QualityMonitor) Series() []QualitySeries {
+	if q == nil {
+		return []QualitySeries{}
+	}
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	now := q.now()
+	series := []QualitySeries{}
+	for key, buckets := range q.buckets {
+		buckets = q.expire(buckets, now)
+		if len(buckets) == 0 {
+			delete(q.buckets, key)
+			continue
+		}
+		q.buckets[key] = buckets
+		total := QualityBucket{Start: buckets[0].Start}
+		for _, bucket := range buckets {
+			total = total.add(bucket)
+		}
+		series = append(series, QualitySeries{
+			Model:   key.model,
+			Kind:    key.kind,
+			Total:   total,
+			Rates:   total.Rates(),
+			Buckets: slices.Clone(buckets),
+		})
+	}
+	slices.SortFunc(series, func(a, b QualitySeries) int {
+		return cmp.Or(cmp.Compare(a.Model, b.Model), cmp.Compare(a.Kind, b.Kind))
+	})
+	return series
+}
+
+// expire drops the buckets older than the window
+func (q *QualityMonitor) expire(buckets []QualityBucket, now time.Time) []QualityBucket {
+	oldest := now.Add(-q.window).Truncate(qualityBucketSize)
+	index := 0
+	for index < len(buckets) && buckets[index].Start.Before(oldest) {
+		index++
+	}
+	return buckets[index:]
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"strconv"
+	"time"
+)
+
+// runQuick prints a few names as soon as they come, for the game table (quick Elf):
+// name-only prompt and schema, a small num_predict and the requests at the same time,
+// the names are checked against the campaign but not stored (logs on stderr, names on stdout)
+func (a *App) runQuick(ctx context.Context, args []string) error {
+	count, err := strconv.Atoi(getEnv("QUICK_COUNT", "5"))
+	if err != nil {
+		return err
+	}
+	parallel, err := strconv.Atoi(getEnv("QUICK_PARALLEL", "5"))
+	if err != nil {
+		return err
+	}
+	numPredict, err := strconv.Atoi(getEnv("QUICK_NUM_PREDICT", "32"))
+	if err != nil {
+		return err
+	}
+	flags := flag.NewFlagSet("quick", flag.ExitOnError)
+	campaign := flags.String("campaign", getEnv("CAMPAIGN", DefaultCampaign), "campaign the names must be new to")
+	kind := flags.String("kind", os.Getenv("KIND"), "kind of the names (default: the first kind of the genre)")
+	flags.IntVar(&count, "count", count, "number of names")
+	flags.IntVar(&parallel, "parallel", parallel, "requests at the same time (the burst is limited to it)")
+	flags.IntVar(&numPredict, "num-predict", numPredict, "tokens of an answer (a name in JSON), instead of the limit of the name domain")
+	flags.Parse(args)
+	if flags.NArg() > 1 {
+		return errors.New("usage: quick [--count 5] [--parallel 5] [<kind>]")
+	}
+	if flags.NArg() == 1 {
+		*kind = flags.Arg(0)
+	}
+	if *kind == "" {
+		*kind = a.generator.kinds[0].Name
+	}
+
+	spec := Spec{Level: 1, Count: count, NameOnly: true}
+	spec.Kind, spec.Parents, err = ResolveKind(a.generator.kinds, *kind, "")
+	if err != nil {
+		return err
+	}
+	registry, err := a.storage.Registry(*campaign)
+	if err != nil {
+		return err
+	}
+
+	// the checks after the answer (verification, review) are for the full pipeline
+	quick := *a.generator
+	quick.strict, quick.review = false, false
+	quick.limits = maps.Clone(a.generator.limits)
+	limits := quick.limits[DomainName]
+	limits.NumPredict = numPredict
+	quick.limits[DomainName] = limits
+
+	start := time.Now()
+	printed := 0
+	_, err = GenerateParallel(ctx, &quick, registry.Deduper(), spec, min(max(parallel, 1), count), func(slot Slot) error {
+		if slot.Status != SlotOK {
+			return nil
+		}
+		printed++
+		_, err := fmt.Fprintln(a.stdout, slot.Character.Name)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("⚡ %d %s names in %s\n", printed, spec.Kind, time.Since(start).Round(time.Millisecond))
+	return nil
+}
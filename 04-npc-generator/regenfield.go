@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"strings"
+
+	"github.com/ollama/ollama/api"
+)
+
+// fieldSchema returns the schema of the new value of the field:
+// name, backstory, an extra of the genre or a stat of the game system
+func fieldSchema(field string, system *GameSystem, extras []GenreExtra) (map[string]any, string, error) {
+	switch field {
+	case "name":
+		return map[string]any{"type": "string"}, field, nil
+	case "backstory":
+		return map[string]any{"type": "string", "maxLength": 600}, field, nil
+	}
+	if extra, ok := findExtra(extras, field); ok {
+		return map[string]any{"type": "string", "description": extra.Description, "maxLength": 300}, extra.Name, nil
+	}
+	if system == nil {
+		return nil, "", fmt.Errorf("unknown field %q (name, backstory, equipment, an extra of the genre or a stat with --system)", field)
+	}
+	for _, stat := range system.Stats {
+		if strings.EqualFold(stat.Name, field) {
+			return map[string]any{
+				"type":    "integer",
+				"minimum": stat.Min,
+				"maximum": stat.Max,
+			}, stat.Name, nil
+		}
+	}
+	return nil, "", fmt.Errorf("no stat %q in %s", field, system.Name)
+}
+
+// RegenerateField asks the model for another take on one field of the character,
+// the other fields are given as context and stay unchanged (3 attempts)
+func (g *Generator) RegenerateField(ctx context.Context, character Character, field string, system *GameSystem) (Character, error) {
+	return g.RegenerateFieldWithHint(ctx, character, field, system, "")
+}
+
+// RegenerateFieldWithHint is RegenerateField with an additional constraint on the new value
+func (g *Generator) RegenerateFieldWithHint(ctx context.Context, character Character, field string, system *GameSystem, hint string) (Character, error) {
+	if field == "equipment" {
+		equipment, err := g.Equip(ctx, g.equipmentRules, character)
+		if err != nil {
+			return character, err
+		}
+		character.Equipment = &equipment
+		return character, nil
+	}
+
+	valueSchema, field, err := fieldSchema(field, system, g.genre.Extras)
+	if err != nil {
+		return character, err
+	}
+	schema := map[string]any{
+		"type":       "object",
+		"properties": map[string]any{"value": valueSchema},
+		"required":   []string{"value"},
+	}
+	characterContext, err := json.Marshal(character)
+	if err != nil {
+		return character, err
+	}
+	userContent := fmt.Sprintf(
+		"Here is a character: %s\nGive a different %s for this character, consistent with all the other fields.",
+		characterContext, field,
+	)
+	if system != nil {
+		userContent += fmt.Sprintf("\nThe character is for %s. %s", system.Title, system.Vocabulary)
+	}
+	if hint != "" {
+		userContent += "\n" + hint
+	}
+	userContent += g.languageInstructions()
+	messages := []api.Message{
+		{Role: "system", Content: g.genre.Instructions},
+		{Role: "user", Content: userContent},
+	}
+
+	// the name keeps the generation options, the aggressive options are too much for a text
+	domain, options := DomainCharacter, g.options
+	if field == "backstory" {
+		domain, options = DomainBackstory, map[string]interface{}{"temperature": 0.8}
+	}
+
+	for attempt := 0; attempt < 3; attempt++ {
+		answer, err := g.chat(ctx, domain, messages, schema, options)
+		if err != nil {
+			return character, err
+		}
+		if answer.Truncated {
+			continue
+		}
+		err = classifyAnswer(answer.Content)
+		if err != nil {
+			fmt.Println("😡", field+":", err)
+			continue
+		}
+		updated, err := withField(character, field, answer.Content, system, g.genre.Extras)
+		if err == nil && field == "name" {
+			err = g.retransliterate(&updated)
+		}
+		if err == nil {
+			err = g.checkLanguage(updated)
+		}
+		if err != nil {
+			fmt.Println("😡", field+":", err)
+			continue
+		}
+		return updated, nil
+	}
+	return character, fmt.Errorf("no valid %s for %s after 3 attempts", field, character.Name)
+}
+
+// findExtra returns the extra of the genre with the name (case insensitive)
+func findExtra(extras []GenreExtra, name string) (GenreExtra, bool) {
+	for _, extra := range extras {
+		if strings.EqualFold(extra.Name, name) {
+			return extra, true
+		}
+	}
+	return GenreExtra{}, false
+}
+
+// withField returns a copy of the character with the value of the answer
+func withField(character Character, field, content string, system *GameSystem, extras []GenreExtra) (Character, error) {
+	if _, ok := findExtra(extras, field); ok {
+		answer := struct {
+			Value string `json:"value"`
+		}{}
+		err := decodeAnswer(content, &answer)
+		if err == nil {
+			err = classifyText(answer.Value)
+		}
+		if err != nil {
+			return character, err
+		}
+		character.Extras = maps.Clone(character.Extras)
+		if character.Extras == nil {
+			character.Extras = map[string]string{}
+		}
+		character.Extras[field] = strings.TrimSpace(answer.Value)
+		return character, nil
+	}
+	switch field {
+	case "name", "backstory":
+		answer := struct {
+			Value string `json:"value"`
+		}{}
+		err := decodeAnswer(content, &answer)
+		if err != nil {
+			return character, err
+		}
+		err = classifyText(answer.Value)
+		if err != nil {
+			return character, err
+		}
+		if field == "backstory" {
+			character.Backstory = strings.TrimSpace(answer.Value)
+			return character, nil
+		}
+		err = CheckName(answer.Value)
+		if err != nil {
+			return character, err
+		}
+		character.Name = strings.TrimSpace(answer.Value)
+		return character, nil
+	default:
+		answer := struct {
+			Value int `json:"value"`
+		}{}
+		err := decodeAnswer(content, &answer)
+		if err != nil {
+			return character, err
+		}
+		for _, stat := range system.Stats {
+			if stat.Name == field && (answer.Value < stat.Min || answer.Value > stat.Max) {
+				return character, fmt.Errorf("%s %d is out of the range [%d, %d]", field, answer.Value, stat.Min, stat.Max)
+			}
+		}
+		stats := map[string]int{}
+		for name, value := range character.Stats {
+			stats[name] = value
+		}
+		stats[field] = answer.Value
+		character.Stats = stats
+		return character, nil
+	}
+}
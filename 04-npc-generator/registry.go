@@ -0,0 +1,366 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"04-npc-generator/model"
+)
+
+// Registry is the persistent list of the characters of a campaign,
+// it is the dedup scope of the generations
+type Registry struct {
+	mutex        sync.Mutex
+	path         string
+	modTime      time.Time
+	size         int64
+	NextID       int           `json:"next_id"`
+	Characters   []Character   `json:"characters"`
+	Reservations []Reservation `json:"reservations,omitempty"`
+	// Watermarks are the times of the last differential exports, by consumer
+	Watermarks map[string]time.Time `json:"watermarks,omitempty"`
+	// Pending are the characters waiting for a reviewer (serve --approval)
+	Pending       []PendingCharacter `json:"pending,omitempty"`
+	NextPendingID int                `json:"next_pending_id,omitempty"`
+}
+
+// OpenRegistry loads the registry file, a missing file is an empty registry
+func OpenRegistry(path string) (*Registry, error) {
+	registry := &Registry{path: path, NextID: 1, Characters: []Character{}}
+	err := registry.refresh(true)
+	if err != nil {
+		return nil, err
+	}
+	return registry, nil
+}
+
+// refresh loads the registry file again when another process changed it
+// (or always when forced), a missing file keeps the registry as is
+func (r *Registry) refresh(force bool) error {
+	info, err := os.Stat(r.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !force && info.ModTime().Equal(r.modTime) && info.Size() == r.size {
+		return nil
+	}
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return err
+	}
+	loaded := Registry{NextID: 1, Characters: []Character{}}
+	err = json.Unmarshal(data, &loaded)
+	if err != nil {
+		return fmt.Errorf("%s: %w", r.path, err)
+	}
+	r.NextID, r.Characters, r.Reservations, r.Watermarks = loaded.NextID, loaded.Characters, loaded.Reservations, loaded.Watermarks
+	r.Pending, r.NextPendingID = loaded.Pending, loaded.NextPendingID
+	r.modTime, r.size = info.ModTime(), info.Size()
+
+	// the characters stored before the table codes get one
+	used := r.usedCodes()
+	for idx := range r.Characters {
+		character := &r.Characters[idx]
+		if character.Code == "" {
+			character.Code = TableCode(character.Name, used)
+			used[character.Code] = true
+		}
+	}
+	return nil
+}
+
+// reload is the refresh of the reads, they keep the loaded characters when the file can't be read
+func (r *Registry) reload() {
+	err := r.refresh(false)
+	if err != nil {
+		fmt.Println("⚠️ registry:", err)
+	}
+}
+
+// lock takes the registry for a change: the mutex for the goroutines, the advisory lock
+// of the file for the other processes (two terminals on the same campaign),
+// then the changes of the other processes are loaded
+func (r *Registry) lock() (func(), error) {
+	r.mutex.Lock()
+	unlockFile, err := lockFile(r.path + ".lock")
+	if err != nil {
+		r.mutex.Unlock()
+		return nil, err
+	}
+	err = r.refresh(true)
+	if err != nil {
+		unlockFile()
+		r.mutex.Unlock()
+		return nil, err
+	}
+	return func() {
+		unlockFile()
+		r.mutex.Unlock()
+	}, nil
+}
+
+// Deduper returns a deduper already aware of the stored and reserved names
+func (r *Registry) Deduper() *Deduper {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.reload()
+	return r.deduper()
+}
+
+func (r *Registry) deduper() *Deduper {
+	return r.deduperWithout(0)
+}
+
+// deduperWithout leaves the character with this ID out (it is updated)
+func (r *Registry) deduperWithout(id int) *Deduper {
+	return r.deduperExcept(id, 0)
+}
+
+// deduperExcept leaves the character with this ID and the pending character with this pending ID out,
+// the pending names are taken like the stored ones (the exact match only, nothing is embedded)
+func (r *Registry) deduperExcept(id, pendingID int) *Deduper {
+	deduper := NewDeduper()
+	for _, character := range r.Characters {
+		if id == 0 || character.ID != id {
+			deduper.AddNames(context.Background(), character.Names())
+		}
+	}
+	for _, pending := range r.Pending {
+		if pendingID == 0 || pending.ID != pendingID {
+			deduper.AddNames(context.Background(), pending.Character.Names())
+		}
+	}
+	for _, reservation := range r.Reservations {
+		deduper.Add(context.Background(), reservation.Name)
+	}
+	return deduper
+}
+
+// Add stores the characters with a new ID and saves the registry,
+// names already stored (by a concurrent generation) or reserved are skipped
+func (r *Registry) Add(characters ...Character) ([]Character, error) {
+	unlock, err := r.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	deduper := r.deduper()
+
+	used := r.usedCodes()
+	added := []Character{}
+	for _, character := range characters {
+		if !deduper.AddNames(context.Background(), character.Names()) {
+			continue
+		}
+		added = append(added, r.store(character, used))
+	}
+	return added, r.save()
+}
+
+// store appends the character with its ID, its table code and its timestamps (the registry is locked)
+func (r *Registry) store(character Character, used map[string]bool) Character {
+	character.Code = TableCode(character.Name, used)
+	used[character.Code] = true
+	character.SchemaVersion = model.CurrentSchema
+	now := time.Now()
+	character.CreatedAt, character.UpdatedAt = &now, &now
+	character.ID = r.NextID
+	r.NextID++
+	r.Characters = append(r.Characters, character)
+	return character
+}
+
+// List returns a copy of the stored characters
+func (r *Registry) List() []Character {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.reload()
+
+	characters := make([]Character, len(r.Characters))
+	copy(characters, r.Characters)
+	return characters
+}
+
+func (r *Registry) usedCodes() map[string]bool {
+	used := map[string]bool{}
+	for _, character := range r.Characters {
+		used[character.Code] = true
+	}
+	return used
+}
+
+// save writes a temporary file then renames it, a crash (or a reader) never sees half a registry
+func (r *Registry) save() error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(r.path), 0755)
+	if err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(r.path), ".registry-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	err = os.Rename(file.Name(), r.path)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return err
+	}
+	r.modTime, r.size = info.ModTime(), info.Size()
+	return nil
+}
+
+// FindByName returns the stored character with this name or alias (case insensitive)
+func (r *Registry) FindByName(name string) (Character, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.reload()
+
+	key := strings.ToLower(strings.TrimSpace(name))
+	for _, character := range r.Characters {
+		for _, name := range character.Names() {
+			if strings.ToLower(strings.TrimSpace(name)) == key {
+				return character, true
+			}
+		}
+	}
+	return Character{}, false
+}
+
+// Get returns the stored character with this ID
+func (r *Registry) Get(id int) (Character, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.reload()
+
+	for _, character := range r.Characters {
+		if character.ID == id {
+			return character, true
+		}
+	}
+	return Character{}, false
+}
+
+// Update replaces the stored character with the same ID and saves the registry,
+// a new name or alias must not be stored or reserved yet, a new name gets a new table code
+func (r *Registry) Update(character Character) (Character, error) {
+	unlock, err := r.lock()
+	if err != nil {
+		return character, err
+	}
+	defer unlock()
+
+	idx := slices.IndexFunc(r.Characters, func(stored Character) bool {
+		return stored.ID == character.ID
+	})
+	if idx < 0 {
+		return character, fmt.Errorf("no character with the ID %d", character.ID)
+	}
+	stored := r.Characters[idx]
+
+	if !r.deduperWithout(stored.ID).AddNames(context.Background(), character.Names()) {
+		return character, fmt.Errorf("the name %q or one of its aliases is %w", character.Name, ErrNameTaken)
+	}
+	if !strings.EqualFold(strings.TrimSpace(stored.Name), strings.TrimSpace(character.Name)) {
+		used := r.usedCodes()
+		delete(used, stored.Code)
+		character.Code = TableCode(character.Name, used)
+	}
+	now := time.Now()
+	character.UpdatedAt = &now
+	r.Characters[idx] = character
+	return character, r.save()
+}
+
+// Modify changes the stored character with this ID and saves the registry,
+// the change can't rename the character nor change its aliases (see Update)
+func (r *Registry) Modify(id int, change func(character *Character)) (Character, error) {
+	unlock, err := r.lock()
+	if err != nil {
+		return Character{}, err
+	}
+	defer unlock()
+
+	idx := slices.IndexFunc(r.Characters, func(stored Character) bool {
+		return stored.ID == id
+	})
+	if idx < 0 {
+		return Character{}, fmt.Errorf("no character with the ID %d", id)
+	}
+	character := r.Characters[idx]
+	character.Tags = slices.Clone(character.Tags)
+	change(&character)
+	character.Name, character.Aliases, character.ASCIIName = r.Characters[idx].Name, r.Characters[idx].Aliases, r.Characters[idx].ASCIIName
+	now := time.Now()
+	character.UpdatedAt = &now
+	r.Characters[idx] = character
+	return character, r.save()
+}
+
+// Since returns the characters added or changed after the time
+func (r *Registry) Since(since time.Time) []Character {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.reload()
+
+	characters := []Character{}
+	for _, character := range r.Characters {
+		// the characters stored before the timestamps are only in the first export
+		if character.UpdatedAt == nil && since.IsZero() || character.UpdatedAt != nil && character.UpdatedAt.After(since) {
+			characters = append(characters, character)
+		}
+	}
+	return characters
+}
+
+// Watermark returns the time of the last differential export of the consumer (zero the first time)
+func (r *Registry) Watermark(consumer string) time.Time {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.reload()
+	return r.Watermarks[consumer]
+}
+
+// SetWatermark saves the time of the differential export of the consumer
+func (r *Registry) SetWatermark(consumer string, watermark time.Time) error {
+	unlock, err := r.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if r.Watermarks == nil {
+		r.Watermarks = map[string]time.Time{}
+	}
+	r.Watermarks[consumer] = watermark
+	return r.save()
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	_ "embed"
+	"html/template"
+	"os"
+)
+
+//go:embed templates/report.html
+var reportTemplate string
+
+type reportData struct {
+	Title string
+	Names []string
+	Kinds []string
+}
+
+// WriteHTMLReport renders the diversity charts (first letters, lengths, kinds) of the characters,
+// the charts are drawn by the embedded JavaScript, the file has no dependency
+func WriteHTMLReport(path, title string, characters []Character) error {
+	tpl, err := template.New("report").Parse(reportTemplate)
+	if err != nil {
+		return err
+	}
+
+	data := reportData{Title: title, Names: []string{}, Kinds: []string{}}
+	for _, character := range characters {
+		data.Names = append(data.Names, character.Name)
+		data.Kinds = append(data.Kinds, character.Kind)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return tpl.Execute(file, data)
+}
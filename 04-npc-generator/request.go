@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"maps"
+	"slices"
+
+	"github.com/ollama/ollama/api"
+)
+
+// ChatRequestBuilder builds the chat requests of the generator: a builder is never modified,
+// every method returns a new one and Build returns a fresh request, so the workers
+// and the rounds of the tool calling never share the messages, the options or the tools
+type ChatRequestBuilder struct {
+	model    string
+	messages []api.Message
+	options  map[string]interface{}
+	format   json.RawMessage
+	tools    api.Tools
+}
+
+func NewChatRequest(model string) ChatRequestBuilder {
+	return ChatRequestBuilder{model: model}
+}
+
+// Messages appends the messages to the conversation
+func (b ChatRequestBuilder) Messages(messages ...api.Message) ChatRequestBuilder {
+	b.messages = append(slices.Clip(b.messages), messages...)
+	return b
+}
+
+// Options replaces the options (limits and num_ctx included)
+func (b ChatRequestBuilder) Options(options map[string]interface{}) ChatRequestBuilder {
+	b.options = maps.Clone(options)
+	return b
+}
+
+// Option sets one option
+func (b ChatRequestBuilder) Option(key string, value interface{}) ChatRequestBuilder {
+	options := maps.Clone(b.options)
+	if options == nil {
+		options = map[string]interface{}{}
+	}
+	options[key] = value
+	b.options = options
+	return b
+}
+
+// Format is the JSON schema of the structured answer
+func (b ChatRequestBuilder) Format(schema map[string]any) (ChatRequestBuilder, error) {
+	format, err := json.Marshal(schema)
+	b.format = format
+	return b, err
+}
+
+// Tools offers the tools to the model (nil: no tools)
+func (b ChatRequestBuilder) Tools(tools api.Tools) ChatRequestBuilder {
+	b.tools = slices.Clip(tools)
+	return b
+}
+
+// Build returns a new non-streamed request, it doesn't share its slices and maps with the builder
+func (b ChatRequestBuilder) Build() *api.ChatRequest {
+	noStream := false
+	return &api.ChatRequest{
+		Model:    b.model,
+		Messages: slices.Clone(b.messages),
+		Options:  maps.Clone(b.options),
+		Format:   slices.Clone(b.format),
+		Tools:    slices.Clone(b.tools),
+		Stream:   &noStream,
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+func TestChatRequestBuilderConcurrent(t *testing.T) {
+	base, err := NewChatRequest("qwen2.5:0.5b").
+		Messages(api.Message{Role: "system", Content: "instructions"}).
+		Options(map[string]interface{}{"temperature": 1.7}).
+		Format(map[string]any{"type": "object"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	base = base.Tools(api.Tools{{Type: "function"}})
+
+	var wg sync.WaitGroup
+	for worker := range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			builder := base
+			for round := range 20 {
+				// every round derives a new builder and changes its request, like the workers and the tool rounds
+				builder = builder.Messages(api.Message{Role: "user", Content: "round"}).Option("seed", worker*100+round)
+				if round%2 == 0 {
+					builder = builder.Tools(nil)
+				}
+				req := builder.Build()
+				req.Messages[0].Content = "changed"
+				req.Options["num_ctx"] = 4096
+				req.Format[0] = ' '
+				if len(req.Tools) > 0 {
+					req.Tools[0].Type = "changed"
+				}
+				if len(req.Messages) != round+2 || req.Options["seed"] != worker*100+round {
+					t.Errorf("worker %d round %d: %d messages, seed %v", worker, round, len(req.Messages), req.Options["seed"])
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	req := base.Build()
+	if len(req.Messages) != 1 || req.Messages[0].Content != "instructions" || len(req.Options) != 1 ||
+		string(req.Format) != `{"type":"object"}` || req.Tools[0].Type != "function" {
+		t.Errorf("the base builder changed: %+v", req)
+	}
+}
+
+// fakeOllama answers the chat requests with new names, and with a valid loadout for the equipment schema
+func fakeOllama(t *testing.T) (*api.Client, *atomic.Int32) {
+	t.Helper()
+	requests := atomic.Int32{}
+	syllables := []string{"bor", "dur", "gim", "thra", "kal", "mor", "vin", "dal"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			http.NotFound(w, r)
+			return
+		}
+		request := api.ChatRequest{}
+		err := json.NewDecoder(r.Body).Decode(&request)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		count := int(requests.Add(1))
+		content := ""
+		if strings.Contains(string(request.Format), `"weapon"`) {
+			content = `{"weapon":"Longsword","armor":"Chain Mail","trinkets":["a brass key"]}`
+		} else {
+			name := ""
+			for value := count; value > 0; value /= len(syllables) {
+				name += syllables[value%len(syllables)]
+			}
+			content = `{"name":"` + strings.ToUpper(name[:1]) + name[1:] + `","kind":"Dwarf"}`
+		}
+		json.NewEncoder(w).Encode(api.ChatResponse{
+			Model:   request.Model,
+			Message: api.Message{Role: "assistant", Content: content},
+			Done:    true,
+		})
+	}))
+	t.Cleanup(server.Close)
+	base, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return api.NewClient(base, server.Client()), &requests
+}
+
+// checkSlots checks that every slot has a character with a name of its own
+func checkSlots(t *testing.T, slots []Slot, count int) {
+	t.Helper()
+	if len(slots) != count {
+		t.Fatalf("%d slots, want %d", len(slots), count)
+	}
+	names, indexes := map[string]bool{}, map[int]bool{}
+	for _, slot := range slots {
+		if slot.Status != SlotOK {
+			t.Errorf("slot %d: %s %s", slot.Index, slot.Status, slot.Reason)
+			continue
+		}
+		if names[slot.Character.Name] || indexes[slot.Index] {
+			t.Errorf("slot %d: %s is generated twice", slot.Index, slot.Character.Name)
+		}
+		names[slot.Character.Name], indexes[slot.Index] = true, true
+	}
+}
+
+func TestGenerateParallelRace(t *testing.T) {
+	client, requests := fakeOllama(t)
+	generator := NewGenerator(client, "fake")
+	deduper := NewDeduper()
+	// the names of another campaign run share nothing, the names of the same deduper are taken
+	deduper.Add(context.Background(), "Bor")
+
+	slots := []Slot{}
+	metrics, err := GenerateParallel(context.Background(), generator, deduper, Spec{Kind: "Dwarf", Level: 1, Count: 24}, 6, func(slot Slot) error {
+		slots = append(slots, slot)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSlots(t, slots, 24)
+	if metrics.Attempts != int(requests.Load()) {
+		t.Errorf("%d attempts for %d requests", metrics.Attempts, requests.Load())
+	}
+}
+
+func TestGeneratePipelinedRace(t *testing.T) {
+	client, _ := fakeOllama(t)
+	generator := NewGenerator(client, "fake")
+	generator.quality = NewQualityMonitor(time.Hour)
+	spec := Spec{Kind: "Dwarf", Class: "Fighter", Level: 3, Count: 12}
+
+	slots := []Slot{}
+	// one worker with a validation stage runs the pipeline
+	metrics, err := GenerateParallel(context.Background(), generator, NewDeduper(), spec, 1, func(slot Slot) error {
+		slots = append(slots, slot)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSlots(t, slots, 12)
+	for _, slot := range slots {
+		if slot.Character != nil && (slot.Character.Equipment == nil || slot.Character.Equipment.Weapon != "Longsword") {
+			t.Errorf("slot %d: %s has no equipment", slot.Index, slot.Character.Name)
+		}
+	}
+	// every slot of the pipeline is recorded once for the dashboard
+	series := generator.quality.Series()
+	if len(series) != 1 || series[0].Total.Slots != 12 || series[0].Total.Attempts != metrics.Attempts {
+		t.Errorf("quality %+v, want 12 slots and %d attempts", series, metrics.Attempts)
+	}
+}
+
+func TestGenerateParallelCanceled(t *testing.T) {
+	client, _ := fakeOllama(t)
+	generator := NewGenerator(client, "fake")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := 0
+	_, err := GenerateParallel(ctx, generator, NewDeduper(), Spec{Kind: "Dwarf", Level: 1, Count: 50}, 4, func(slot Slot) error {
+		done++
+		if done == 5 {
+			cancel()
+		}
+		return nil
+	})
+	if err == nil && done == 50 {
+		t.Error("the canceled run generated every slot")
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+)
+
+// Reroll regenerates a variation of the stored character with its recorded genre, spec, options
+// and chunks of notes, the seed shifted by the variation (0 reproduces the character when
+// the model and the prompt are the same)
+func (g *Generator) Reroll(ctx context.Context, deduper *Deduper, character Character, variation int) (Character, error) {
+	provenance := character.Provenance
+	if provenance == nil {
+		return character, fmt.Errorf("%s has no provenance, it can't be rerolled", character.Name)
+	}
+	spec := Spec{Kind: character.Kind, Parents: character.Parents}
+	if len(provenance.Spec) > 0 {
+		err := json.Unmarshal(provenance.Spec, &spec)
+		if err != nil {
+			return character, err
+		}
+	}
+	// the prefix of the slot is kept, not drawn again
+	spec.Count, spec.Coverage = 1, false
+
+	rerolled := *g
+	if provenance.Genre != "" && (provenance.Genre != g.genre.Name || provenance.Theme != g.genre.Theme) {
+		genre, err := FindGenre(g.genres, provenance.Genre)
+		if err != nil {
+			return character, err
+		}
+		rerolled.UseGenre(genre)
+		err = rerolled.UseTheme(provenance.Theme)
+		if err != nil {
+			return character, err
+		}
+	}
+	rerolled.notes = nil
+	if len(provenance.Grounding) > 0 {
+		if g.notes == nil {
+			return character, fmt.Errorf("%s was grounded in campaign notes, reroll it with NOTES_DIR", character.Name)
+		}
+		var err error
+		rerolled.notes, err = g.notes.Pin(provenance.Grounding)
+		if err != nil {
+			return character, err
+		}
+	}
+	if provenance.Model != g.model {
+		fmt.Printf("⚠️ generated with %s, rerolled with %s\n", provenance.Model, g.model)
+	} else if provenance.ModelDigest != "" && g.modelDigest != "" && provenance.ModelDigest != g.modelDigest {
+		fmt.Println("⚠️ the model was updated since the generation (another digest)")
+	}
+
+	options := maps.Clone(provenance.Options)
+	if options == nil {
+		options = rerolled.optionsFor(spec)
+	}
+	options["seed"] = provenance.Seed - provenance.Variation + variation
+
+	// the character doesn't collide with itself
+	deduper.RemoveNames(character.Names())
+	run := NewRun(&rerolled, deduper, spec)
+	run.options, run.attempts, run.variation = options, 1, variation
+	slot, err := run.GenerateSlot(ctx, 0)
+	if err != nil {
+		return character, err
+	}
+	if slot.Status != SlotOK {
+		return character, fmt.Errorf("the variation %d is %s (%s), try another variation", variation, slot.Status, slot.Reason)
+	}
+	if slot.Character.Provenance.PromptVersion != provenance.PromptVersion {
+		fmt.Printf("⚠️ the prompt changed since the generation (%s, now %s), the variations are not the same anymore\n",
+			provenance.PromptVersion, slot.Character.Provenance.PromptVersion)
+	}
+
+	// the annotations of the game master are kept
+	variant := *slot.Character
+	variant.ID, variant.Code, variant.CreatedAt = character.ID, character.Code, character.CreatedAt
+	variant.Tags, variant.Notes = character.Tags, character.Notes
+	return variant, nil
+}
+
+// runReroll prints a deterministic variation of a stored character (reroll <id> --variation 2),
+// --replace stores it in place of the character
+func (a *App) runReroll(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("reroll", flag.ExitOnError)
+	campaign := flags.String("campaign", getEnv("CAMPAIGN", DefaultCampaign), "campaign of the character")
+	variation := flags.Int("variation", 1, "variation of the character (0: the original)")
+	replace := flags.Bool("replace", false, "store the variation in place of the character, after the review of the changes")
+	yes := flags.Bool("yes", false, "replace the character without the review")
+	// the ID can come before the flags
+	idArg := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		idArg, args = args[0], args[1:]
+	}
+	flags.Parse(args)
+	if idArg == "" && flags.NArg() == 1 {
+		idArg = flags.Arg(0)
+	}
+	if idArg == "" {
+		return errors.New("usage: reroll <id> [--variation 1] [--replace]")
+	}
+	id, err := strconv.Atoi(idArg)
+	if err != nil {
+		return fmt.Errorf("invalid ID %q", idArg)
+	}
+	if *variation < 0 {
+		return errors.New("the variation can't be negative")
+	}
+
+	registry, err := a.storage.Registry(*campaign)
+	if err != nil {
+		return err
+	}
+	character, ok := registry.Get(id)
+	if !ok {
+		return fmt.Errorf("no character with the ID %d in %s", id, *campaign)
+	}
+	variant, err := a.generator.Reroll(ctx, registry.Deduper(), character, *variation)
+	if err != nil {
+		return err
+	}
+	if *replace {
+		variant, err = a.reviewUpdate(registry, *campaign, "reroll", character, variant, *yes)
+		if err != nil {
+			return err
+		}
+	}
+	data, err := json.MarshalIndent(variant, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
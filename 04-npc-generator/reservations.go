@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrReserved    = errors.New("reserved by someone else")
+	ErrNotReserved = errors.New("not reserved")
+)
+
+// Reservation marks a name as taken by a player (or a campaign tool),
+// the reserved names are never generated
+type Reservation struct {
+	Name       string    `json:"name"`
+	Holder     string    `json:"holder"`
+	ReservedAt time.Time `json:"reserved_at"`
+}
+
+// Reserve takes the name for the holder, reserving again is a no-op for the same holder
+func (r *Registry) Reserve(name, holder string) (Reservation, error) {
+	name, holder = strings.TrimSpace(name), strings.TrimSpace(holder)
+	if name == "" || holder == "" {
+		return Reservation{}, fmt.Errorf("the name and the holder are required")
+	}
+
+	unlock, err := r.lock()
+	if err != nil {
+		return Reservation{}, err
+	}
+	defer unlock()
+
+	for _, reservation := range r.Reservations {
+		if !strings.EqualFold(reservation.Name, name) {
+			continue
+		}
+		if reservation.Holder != holder {
+			return reservation, fmt.Errorf("%s: %w (%s)", name, ErrReserved, reservation.Holder)
+		}
+		return reservation, nil
+	}
+
+	reservation := Reservation{Name: name, Holder: holder, ReservedAt: time.Now()}
+	r.Reservations = append(r.Reservations, reservation)
+	return reservation, r.save()
+}
+
+// Release frees the name, only its holder can release it
+func (r *Registry) Release(name, holder string) error {
+	unlock, err := r.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	for idx, reservation := range r.Reservations {
+		if !strings.EqualFold(reservation.Name, strings.TrimSpace(name)) {
+			continue
+		}
+		if reservation.Holder != strings.TrimSpace(holder) {
+			return fmt.Errorf("%s: %w (%s)", name, ErrReserved, reservation.Holder)
+		}
+		r.Reservations = append(r.Reservations[:idx], r.Reservations[idx+1:]...)
+		return r.save()
+	}
+	return fmt.Errorf("%s: %w", name, ErrNotReserved)
+}
+
+// ListReservations returns a copy of the reservations
+func (r *Registry) ListReservations() []Reservation {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.reload()
+	return append([]Reservation{}, r.Reservations...)
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ollama/ollama/api"
+)
+
+// Error classes of the Ollama requests
+const (
+	ErrorConnection  = "connection"   // refused, reset, closed (Ollama restarts)
+	ErrorTimeout     = "timeout"      // a network timeout (not the deadline of the context)
+	ErrorUnavailable = "unavailable"  // 503, a model is loading or Ollama is stopping
+	ErrorBadGateway  = "bad_gateway"  // 502 and 504 of a reverse proxy
+	ErrorRateLimited = "rate_limited" // 429 of a reverse proxy
+	ErrorServer      = "server"       // the other 5xx
+	ErrorClient      = "client"       // the 4xx: unknown model, invalid options
+	ErrorOther       = "other"
+)
+
+// Duration is a time.Duration written as a string in the JSON files ("500ms")
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	text := ""
+	err := json.Unmarshal(data, &text)
+	if err != nil {
+		return err
+	}
+	duration, err := time.ParseDuration(text)
+	*d = Duration(duration)
+	return err
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// RetryClass is the behavior of an error class: retried or permanent, the attempts,
+// the exponential backoff with its jitter (a share of the backoff), and whether
+// the error counts for the circuit breaker of the serve mode
+type RetryClass struct {
+	Retry      bool     `json:"retry"`
+	Attempts   int      `json:"attempts"`
+	Backoff    Duration `json:"backoff"`
+	MaxBackoff Duration `json:"max_backoff"`
+	Multiplier float64  `json:"multiplier"`
+	Jitter     float64  `json:"jitter"`
+	Breaker    bool     `json:"breaker"`
+}
+
+// RetryPolicy is the behavior of every error class
+type RetryPolicy map[string]RetryClass
+
+var defaultRetryPolicy = RetryPolicy{
+	ErrorConnection:  {Retry: true, Attempts: 3, Backoff: Duration(500 * time.Millisecond), MaxBackoff: Duration(5 * time.Second), Multiplier: 2, Breaker: true},
+	ErrorTimeout:     {Retry: true, Attempts: 3, Backoff: Duration(500 * time.Millisecond), MaxBackoff: Duration(5 * time.Second), Multiplier: 2, Breaker: true},
+	ErrorUnavailable: {Retry: true, Attempts: 3, Backoff: Duration(500 * time.Millisecond), MaxBackoff: Duration(5 * time.Second), Multiplier: 2, Breaker: true},
+	ErrorBadGateway:  {Retry: true, Attempts: 3, Backoff: Duration(500 * time.Millisecond), MaxBackoff: Duration(5 * time.Second), Multiplier: 2, Breaker: true},
+	ErrorRateLimited: {Retry: true, Attempts: 5, Backoff: Duration(time.Second), MaxBackoff: Duration(30 * time.Second), Multiplier: 2, Jitter: 0.2},
+	ErrorServer:      {},
+	ErrorClient:      {},
+	ErrorOther:       {},
+}
+
+// LoadRetryPolicy reads the policy file (RETRY_POLICY),
+// the classes of the file replace the default ones
+func LoadRetryPolicy(path string) (RetryPolicy, error) {
+	policy := maps.Clone(defaultRetryPolicy)
+	if path == "" {
+		return policy, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	custom := RetryPolicy{}
+	err = json.Unmarshal(data, &custom)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for class, behavior := range custom {
+		if _, ok := defaultRetryPolicy[class]; !ok {
+			return nil, fmt.Errorf("%s: unknown error class %q (%s)", path, class, strings.Join(slices.Sorted(maps.Keys(defaultRetryPolicy)), ", "))
+		}
+		if behavior.Retry && behavior.Attempts < 2 {
+			return nil, fmt.Errorf("%s: a retried %s error needs 2 attempts or more", path, class)
+		}
+		if behavior.Jitter < 0 || behavior.Jitter > 1 {
+			return nil, fmt.Errorf("%s: the jitter of %s is a share of the backoff (0 to 1)", path, class)
+		}
+	}
+	maps.Copy(policy, custom)
+	return policy, nil
+}
+
+// ClassifyError returns the class of an error of an Ollama request,
+// "" for a canceled context and a request refused by the offline-strict mode (never retried)
+func ClassifyError(err error) string {
+	var netErr net.Error
+	var statusErr api.StatusError
+	switch {
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		return ""
+	// the refusal is wrapped in a url.Error, a net.Error
+	case errors.Is(err, ErrOfflineStrict):
+		return ""
+	case errors.As(err, &statusErr):
+		switch code := statusErr.StatusCode; {
+		case code == http.StatusServiceUnavailable:
+			return ErrorUnavailable
+		case code == http.StatusBadGateway || code == http.StatusGatewayTimeout:
+			return ErrorBadGateway
+		case code == http.StatusTooManyRequests:
+			return ErrorRateLimited
+		case code >= 500:
+			return ErrorServer
+		case code >= 400:
+			return ErrorClient
+		}
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return ErrorTimeout
+	case errors.As(err, &netErr):
+		return ErrorConnection
+	case errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF):
+		return ErrorConnection
+	}
+	return ErrorOther
+}
+
+// delay is the backoff of the attempt (from 0), with its jitter
+func (c RetryClass) delay(attempt int) time.Duration {
+	backoff := float64(c.Backoff)
+	for range attempt {
+		backoff *= max(c.Multiplier, 1)
+	}
+	if c.MaxBackoff > 0 {
+		backoff = min(backoff, float64(c.MaxBackoff))
+	}
+	if c.Jitter > 0 {
+		backoff += backoff * c.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(backoff)
+}
+
+// Do calls until the call succeeds or its error is permanent (or out of attempts)
+func (p RetryPolicy) Do(ctx context.Context, call func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := call()
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+		name := ClassifyError(err)
+		class := p[name]
+		if name == "" || !class.Retry || attempt+1 >= class.Attempts {
+			return err
+		}
+		delay := class.delay(attempt)
+		fmt.Printf("🔌 %s (%s), retry in %s\n", err, name, delay.Round(time.Millisecond))
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Review decisions of a regenerated character
+const (
+	ReviewAccept = "accept"
+	ReviewReject = "reject"
+	ReviewMerge  = "merge"
+)
+
+// FieldChange is a field of the stored character changed by a regeneration (JSON values)
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// reviewIgnored are the fields given by the registry or derived from the name, they are never reviewed
+var reviewIgnored = []string{"id", "code", "created_at", "updated_at", "provenance", "ascii_name"}
+
+func characterFields(character Character) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(character)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]json.RawMessage{}
+	return fields, json.Unmarshal(data, &fields)
+}
+
+// DiffCharacters returns the changed fields, sorted by name
+func DiffCharacters(old, regenerated Character) ([]FieldChange, error) {
+	oldFields, err := characterFields(old)
+	if err != nil {
+		return nil, err
+	}
+	newFields, err := characterFields(regenerated)
+	if err != nil {
+		return nil, err
+	}
+	names := slices.Collect(maps.Keys(oldFields))
+	for name := range newFields {
+		if _, ok := oldFields[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	changes := []FieldChange{}
+	for _, name := range names {
+		if slices.Contains(reviewIgnored, name) || string(oldFields[name]) == string(newFields[name]) {
+			continue
+		}
+		changes = append(changes, FieldChange{Field: name, Old: string(oldFields[name]), New: string(newFields[name])})
+	}
+	return changes, nil
+}
+
+// MergeCharacters returns the stored character with the accepted fields of the regenerated one,
+// the provenance of the regeneration (and the ASCII form of an accepted name) comes with them
+func MergeCharacters(old, regenerated Character, accepted []string) (Character, error) {
+	if len(accepted) == 0 {
+		return old, nil
+	}
+	fields, err := characterFields(old)
+	if err != nil {
+		return old, err
+	}
+	newFields, err := characterFields(regenerated)
+	if err != nil {
+		return old, err
+	}
+	derived := []string{"provenance"}
+	if slices.Contains(accepted, "name") {
+		derived = append(derived, "ascii_name")
+	}
+	for _, name := range append(slices.Clone(accepted), derived...) {
+		value, ok := newFields[name]
+		if ok {
+			fields[name] = value
+		} else {
+			delete(fields, name)
+		}
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return old, err
+	}
+	merged := Character{}
+	return merged, json.Unmarshal(data, &merged)
+}
+
+// sideBySide renders the changes in two columns
+func sideBySide(changes []FieldChange) string {
+	cell := func(value string) string {
+		runes := []rune(value)
+		if len(runes) > 40 {
+			return string(runes[:39]) + "…"
+		}
+		return value
+	}
+	text := fmt.Sprintf("%-12s %-40s   %s\n", "field", "stored", "regenerated")
+	for _, change := range changes {
+		text += fmt.Sprintf("%-12s %-40s → %s\n", change.Field, cell(change.Old), cell(change.New))
+	}
+	return text
+}
+
+// Reviewer asks the game master what to do with a regenerated character
+type Reviewer struct {
+	input  *bufio.Reader
+	output io.Writer
+}
+
+func NewReviewer(input io.Reader, output io.Writer) *Reviewer {
+	return &Reviewer{input: bufio.NewReader(input), output: output}
+}
+
+// ask prints the question and returns the first letter of the answer (the default on an empty line)
+func (r *Reviewer) ask(question string, choices string) (byte, error) {
+	for {
+		fmt.Fprintf(r.output, "%s [%s] ", question, choices)
+		line, err := r.input.ReadString('\n')
+		answer := strings.ToLower(strings.TrimSpace(line))
+		if answer == "" && err != nil {
+			return 0, errors.New("no answer, the stored character is kept")
+		}
+		if answer == "" {
+			answer = choices[:1]
+		}
+		if strings.IndexByte(choices, answer[0]) >= 0 {
+			return answer[0], nil
+		}
+	}
+}
+
+// Review shows the diff and returns the decision and the accepted fields
+func (r *Reviewer) Review(changes []FieldChange) (string, []string, error) {
+	fmt.Fprint(r.output, sideBySide(changes))
+	choice, err := r.ask("accept, reject or merge field by field?", "arm")
+	if err != nil {
+		return ReviewReject, nil, err
+	}
+	accepted := []string{}
+	switch choice {
+	case 'r':
+		return ReviewReject, accepted, nil
+	case 'a':
+		for _, change := range changes {
+			accepted = append(accepted, change.Field)
+		}
+		return ReviewAccept, accepted, nil
+	}
+	for _, change := range changes {
+		choice, err := r.ask(fmt.Sprintf("%s: %s → %s, take the regenerated value?", change.Field, change.Old, change.New), "yn")
+		if err != nil {
+			return ReviewReject, nil, err
+		}
+		if choice == 'y' {
+			accepted = append(accepted, change.Field)
+		}
+	}
+	return ReviewMerge, accepted, nil
+}
+
+// ReviewEntry is a decision of the review log of the campaign (reviews.jsonl)
+type ReviewEntry struct {
+	ID       int           `json:"id"`
+	Command  string        `json:"command"`
+	Decision string        `json:"decision"`
+	Accepted []string      `json:"accepted,omitempty"`
+	Changes  []FieldChange `json:"changes"`
+	At       time.Time     `json:"at"`
+}
+
+func appendReview(path string, entry ReviewEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+// reviewUpdate stores the regenerated character after the review of its changes
+// (every change is accepted with yes), the decision is logged in reviews.jsonl of the campaign
+func (a *App) reviewUpdate(registry *Registry, campaign, command string, old, regenerated Character, yes bool) (Character, error) {
+	changes, err := DiffCharacters(old, regenerated)
+	if err != nil {
+		return old, err
+	}
+	if len(changes) == 0 {
+		fmt.Println("🟰 nothing changed")
+		return old, nil
+	}
+
+	decision, accepted := ReviewAccept, []string{}
+	for _, change := range changes {
+		accepted = append(accepted, change.Field)
+	}
+	if !yes {
+		decision, accepted, err = NewReviewer(os.Stdin, os.Stdout).Review(changes)
+		if err != nil {
+			return old, err
+		}
+	}
+	path, err := a.storage.ExportPath(campaign, "reviews.jsonl")
+	if err != nil {
+		return old, err
+	}
+	err = appendReview(path, ReviewEntry{ID: old.ID, Command: command, Decision: decision, Accepted: accepted, Changes: changes, At: time.Now()})
+	if err != nil {
+		return old, err
+	}
+	if len(accepted) == 0 {
+		fmt.Println("↩️ rejected, the stored character is kept")
+		return old, nil
+	}
+
+	merged, err := MergeCharacters(old, regenerated, accepted)
+	if err != nil {
+		return old, err
+	}
+	fmt.Printf("✅ %s: %s\n", decision, strings.Join(accepted, ", "))
+	return registry.Update(merged)
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/ollama/ollama/api"
+)
+
+// Difficulties of the riddles
+var riddleDifficulties = []string{"easy", "medium", "hard"}
+
+// Riddle is a riddle of the campaign, Solved is set by the solver pass
+type Riddle struct {
+	Theme      string   `json:"theme"`
+	Difficulty string   `json:"difficulty"`
+	Riddle     string   `json:"riddle"`
+	Answer     string   `json:"answer"`
+	Hints      []string `json:"hints"`
+	// the answer of the solver model, and whether it matches (with or without the hints)
+	SolverAnswer string `json:"solver_answer,omitempty"`
+	Solved       bool   `json:"solved"`
+	SolvedWith   int    `json:"solved_with_hints,omitempty"`
+}
+
+var riddleSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"riddles": map[string]any{
+			"type": "array",
+			"items": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"theme":      map[string]any{"type": "string"},
+					"difficulty": map[string]any{"type": "string", "enum": riddleDifficulties},
+					"riddle":     map[string]any{"type": "string"},
+					"answer":     map[string]any{"type": "string"},
+					"hints": map[string]any{
+						"type":     "array",
+						"items":    map[string]any{"type": "string"},
+						"minItems": 1,
+						"maxItems": 3,
+					},
+				},
+				"required": []string{"theme", "difficulty", "riddle", "answer", "hints"},
+			},
+		},
+	},
+	"required": []string{"riddles"},
+}
+
+var solutionSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"answer": map[string]any{"type": "string"},
+	},
+	"required": []string{"answer"},
+}
+
+// Validate checks that a riddle doesn't give its answer away
+func (r Riddle) Validate() error {
+	if strings.TrimSpace(r.Riddle) == "" || strings.TrimSpace(r.Answer) == "" {
+		return ErrEmptyAnswer
+	}
+	if strings.Contains(collationKey(r.Riddle), collationKey(r.Answer)) {
+		return fmt.Errorf("the riddle %q contains its answer %q", r.Riddle, r.Answer)
+	}
+	return nil
+}
+
+// GenerateRiddles asks for count riddles of the theme and the difficulty (3 attempts)
+func (g *Generator) GenerateRiddles(ctx context.Context, theme, difficulty string, count int) ([]Riddle, error) {
+	userContent := fmt.Sprintf("Generate %d riddles a character of the world could ask the players, with their answer (one or two words), their difficulty and 1 to 3 hints from the vaguest to the clearest.", count)
+	if theme != "" {
+		userContent += fmt.Sprintf("\nThe theme of the riddles is %s.", theme)
+	}
+	if difficulty != "" {
+		userContent += fmt.Sprintf("\nThe riddles are %s.", difficulty)
+	}
+	messages := []api.Message{
+		{Role: "system", Content: g.genre.Instructions},
+		{Role: "user", Content: userContent},
+	}
+	options := map[string]interface{}{"temperature": 0.9}
+
+	for attempt := 0; attempt < 3; attempt++ {
+		answer, err := g.chat(ctx, DomainRiddles, messages, riddleSchema, options)
+		if err != nil {
+			return nil, err
+		}
+		if answer.Truncated {
+			continue
+		}
+		answered := struct {
+			Riddles []Riddle `json:"riddles"`
+		}{}
+		err = decodeAnswer(answer.Content, &answered)
+		if err == nil && len(answered.Riddles) == 0 {
+			err = ErrEmptyAnswer
+		}
+		if err != nil {
+			fmt.Println("😡 riddles:", err)
+			continue
+		}
+		riddles := []Riddle{}
+		for _, riddle := range answered.Riddles {
+			err = riddle.Validate()
+			if err != nil {
+				fmt.Println("😡 riddle:", err)
+				continue
+			}
+			riddles = append(riddles, riddle)
+		}
+		return riddles, nil
+	}
+	return nil, fmt.Errorf("no valid riddles after 3 attempts")
+}
+
+// sameAnswer compares the answers without the case, the accents and the articles
+func sameAnswer(expected, given string) bool {
+	normalize := func(answer string) string {
+		words := []string{}
+		for _, word := range strings.Fields(collationKey(answer)) {
+			if word != "a" && word != "an" && word != "the" {
+				words = append(words, word)
+			}
+		}
+		return strings.Join(words, " ")
+	}
+	expected, given = normalize(expected), normalize(given)
+	return expected != "" && given != "" && (expected == given || strings.Contains(given, expected))
+}
+
+// SolveRiddle is the solver pass: the solver model answers the riddle, then again
+// with one more hint at a time; a riddle nobody solves is flagged as unsolvable
+func (g *Generator) SolveRiddle(ctx context.Context, solverModel string, riddle *Riddle) error {
+	solver := *g
+	solver.model = solverModel
+	for hints := 0; hints <= len(riddle.Hints); hints++ {
+		userContent := "Solve this riddle, answer with one or two words.\n\n" + riddle.Riddle
+		if hints > 0 {
+			userContent += "\n\nHints:\n- " + strings.Join(riddle.Hints[:hints], "\n- ")
+		}
+		messages := []api.Message{{Role: "user", Content: userContent}}
+		answer, err := solver.chat(ctx, DomainRiddles, messages, solutionSchema, map[string]interface{}{"temperature": 0.0, "seed": 1})
+		if err != nil {
+			return err
+		}
+		solution := struct {
+			Answer string `json:"answer"`
+		}{}
+		err = decodeAnswer(answer.Content, &solution)
+		if err != nil {
+			return fmt.Errorf("solver: %w", err)
+		}
+		riddle.SolverAnswer = solution.Answer
+		if sameAnswer(riddle.Answer, solution.Answer) {
+			riddle.Solved, riddle.SolvedWith = true, hints
+			return nil
+		}
+	}
+	return nil
+}
+
+// RiddlesMarkdown renders the riddles with their hints and answers
+func RiddlesMarkdown(riddles []Riddle) string {
+	markdown := "# Riddles\n\n"
+	for idx, riddle := range riddles {
+		markdown += fmt.Sprintf("## %d. %s (%s)\n\n", idx+1, escapeMarkdown(riddle.Theme), riddle.Difficulty)
+		for _, line := range strings.Split(riddle.Riddle, "\n") {
+			markdown += "> " + escapeMarkdown(line) + "\n"
+		}
+		markdown += "\n"
+		for _, hint := range riddle.Hints {
+			markdown += "- hint: " + escapeMarkdown(hint) + "\n"
+		}
+		markdown += "\n**Answer**: " + escapeMarkdown(riddle.Answer)
+		switch {
+		case !riddle.Solved:
+			markdown += fmt.Sprintf(" (⚠️ unsolved, the solver answered %q)", riddle.SolverAnswer)
+		case riddle.SolvedWith > 0:
+			markdown += fmt.Sprintf(" (solved with %d hints)", riddle.SolvedWith)
+		}
+		markdown += "\n\n"
+	}
+	return markdown
+}
+
+// runRiddles generates riddles and checks them with the solver model:
+// riddles --theme dragons --difficulty hard --count 5
+func (a *App) runRiddles(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("riddles", flag.ExitOnError)
+	campaign := flags.String("campaign", getEnv("CAMPAIGN", DefaultCampaign), "campaign of the riddles")
+	theme := flags.String("theme", "", "theme of the riddles")
+	difficulty := flags.String("difficulty", "", "difficulty of the riddles: easy, medium or hard (default: mixed)")
+	count := flags.Int("count", 5, "number of riddles")
+	solverModel := flags.String("solver", getEnv("SOLVER_LLM", a.generator.model), "model solving the riddles")
+	keepUnsolved := flags.Bool("keep-unsolved", false, "keep the riddles the solver can't solve")
+	flags.Parse(args)
+	if *difficulty != "" && !slices.Contains(riddleDifficulties, *difficulty) {
+		return fmt.Errorf("unknown difficulty %q (%s)", *difficulty, strings.Join(riddleDifficulties, ", "))
+	}
+	if *count < 1 {
+		return errors.New("count must be 1 or more")
+	}
+
+	riddles, err := a.generator.GenerateRiddles(ctx, *theme, *difficulty, *count)
+	if err != nil {
+		return err
+	}
+	kept := []Riddle{}
+	for _, riddle := range riddles {
+		err = a.generator.SolveRiddle(ctx, *solverModel, &riddle)
+		if err != nil {
+			return err
+		}
+		if !riddle.Solved {
+			fmt.Printf("🧩 unsolved: %q (%s, the solver answered %q)\n", riddle.Riddle, riddle.Answer, riddle.SolverAnswer)
+			if !*keepUnsolved {
+				continue
+			}
+		}
+		kept = append(kept, riddle)
+	}
+
+	exportPath, err := a.storage.ExportPath(*campaign, "riddles.json")
+	if err != nil {
+		return err
+	}
+	err = writeExport(exportPath, kept, RiddlesMarkdown(kept))
+	if err != nil {
+		return err
+	}
+	fmt.Println("🧩", len(kept), "of", len(riddles), "riddles solved by", *solverModel, exportPath)
+	if len(kept) == 0 {
+		return errors.New("no solvable riddle")
+	}
+	return nil
+}
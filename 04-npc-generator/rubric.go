@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"04-npc-generator/model"
+
+	"github.com/ollama/ollama/api"
+)
+
+// Grade is the review of a character by the judge model
+type Grade = model.Grade
+
+// Domains of the rubrics: the review of the generated characters (REVIEW)
+// and the grade of the names (prompt-test, few-shot)
+const (
+	RubricCharacter = "character"
+	RubricNames     = "names"
+)
+
+// RubricCriterion is graded from 0 to 10, its weight counts in the score
+type RubricCriterion struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Weight      float64 `json:"weight"`
+}
+
+// Rubric is the prompt of the judge model, the criteria and the pass threshold (0 to 1)
+// of the weighted score
+type Rubric struct {
+	Prompt    string            `json:"prompt"`
+	Criteria  []RubricCriterion `json:"criteria"`
+	Threshold float64           `json:"threshold"`
+}
+
+var defaultRubrics = map[string]Rubric{
+	RubricCharacter: {
+		Prompt: "You are a strict reviewer of generated characters for role playing games.",
+		Criteria: []RubricCriterion{
+			{Name: "naming", Description: "the name follows the naming rules of the kind", Weight: 2},
+			{Name: "originality", Description: "the name is memorable and not a famous name", Weight: 1},
+			{Name: "coherence", Description: "the fields fit the kind and each other", Weight: 1},
+		},
+		Threshold: 0.6,
+	},
+	RubricNames: {
+		Prompt: "You are a strict reviewer of generated names for role playing games.",
+		Criteria: []RubricCriterion{
+			{Name: "style", Description: "the names follow the naming rules of the kind and sound good", Weight: 1},
+		},
+		Threshold: 0.6,
+	},
+}
+
+// rubricExtensions are the rubric files of a domain (<domain>.json, .yaml or .yml)
+var rubricExtensions = append([]string{".json"}, yamlExtensions...)
+
+// LoadRubrics reads the rubric files of the directories (the installed packs, then RUBRICS_DIR),
+// a file replaces the rubric of its domain registered before
+func LoadRubrics(dirs ...string) (map[string]Rubric, error) {
+	rubrics := maps.Clone(defaultRubrics)
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		entries, err := os.ReadDir(dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			extension := filepath.Ext(entry.Name())
+			if entry.IsDir() || !slices.Contains(rubricExtensions, extension) {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			rubric := Rubric{}
+			err = decodeConfigFile(path, data, &rubric)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			err = rubric.check()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			rubrics[strings.TrimSuffix(entry.Name(), extension)] = rubric
+		}
+	}
+	return rubrics, nil
+}
+
+// check refuses a rubric without criteria, a criterion without weight and a threshold out of 0-1
+func (r Rubric) check() error {
+	if len(r.Criteria) == 0 {
+		return errors.New("the rubric has no criterion")
+	}
+	names := map[string]bool{}
+	for _, criterion := range r.Criteria {
+		if criterion.Name == "" || names[criterion.Name] {
+			return fmt.Errorf("the criterion %q is empty or repeated", criterion.Name)
+		}
+		if criterion.Weight <= 0 {
+			return fmt.Errorf("the weight of %s must be positive", criterion.Name)
+		}
+		names[criterion.Name] = true
+	}
+	if r.Threshold < 0 || r.Threshold > 1 {
+		return fmt.Errorf("the threshold %.2f is not between 0 and 1", r.Threshold)
+	}
+	return nil
+}
+
+// Rubric returns the rubric of the domain
+func (g *Generator) Rubric(domain string) Rubric {
+	rubric, ok := g.rubrics[domain]
+	if !ok {
+		return defaultRubrics[domain]
+	}
+	return rubric
+}
+
+// instructions lists the criteria for the user message of the judge model
+func (r Rubric) instructions() string {
+	lines := []string{}
+	for _, criterion := range r.Criteria {
+		lines = append(lines, fmt.Sprintf("- %s: %s", criterion.Name, criterion.Description))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// schema asks for a score from 0 to 10 per criterion and the reason
+func (r Rubric) schema() map[string]any {
+	properties := map[string]any{}
+	required := []string{}
+	for _, criterion := range r.Criteria {
+		properties[criterion.Name] = map[string]any{"type": "integer", "minimum": 0, "maximum": 10}
+		required = append(required, criterion.Name)
+	}
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"scores": map[string]any{
+				"type":       "object",
+				"properties": properties,
+				"required":   required,
+			},
+			"reason": map[string]any{"type": "string", "maxLength": 300},
+		},
+		"required": []string{"scores", "reason"},
+	}
+}
+
+// Score returns the weighted score (0 to 1) of the scores of the criteria (0 to 10)
+func (r Rubric) Score(scores map[string]int) float64 {
+	total, weights := 0.0, 0.0
+	for _, criterion := range r.Criteria {
+		total += criterion.Weight * float64(min(max(scores[criterion.Name], 0), 10))
+		weights += criterion.Weight
+	}
+	if weights == 0 {
+		return 0
+	}
+	return total / weights / 10
+}
+
+// Judge asks the judge model to grade the subject with the rubric of the domain
+// (3 attempts), the rules are the context of the grade
+func (g *Generator) Judge(ctx context.Context, judgeModel, domain, rules, subject string) (Grade, error) {
+	rubric := g.Rubric(domain)
+	userContent := fmt.Sprintf(
+		"Here are the rules:\n%s\nGrade from 0 to 10 each criterion of %s, and give the reason:\n%s",
+		rules, subject, rubric.instructions(),
+	)
+	messages := []api.Message{
+		{Role: "system", Content: rubric.Prompt},
+		{Role: "user", Content: userContent},
+	}
+	judge := *g
+	judge.model = judgeModel
+	for attempt := 0; attempt < 3; attempt++ {
+		answer, err := judge.chat(ctx, DomainJudge, messages, rubric.schema(), map[string]interface{}{"temperature": 0.0, "seed": 1 + attempt})
+		if err != nil {
+			return Grade{}, err
+		}
+		grade := Grade{Judge: judgeModel}
+		err = decodeAnswer(answer.Content, &grade)
+		if err == nil && len(grade.Scores) == 0 {
+			err = ErrEmptyAnswer
+		}
+		if err != nil {
+			fmt.Println("😡 judge:", err)
+			continue
+		}
+		grade.Score = rubric.Score(grade.Scores)
+		grade.Pass = grade.Score >= rubric.Threshold
+		return grade, nil
+	}
+	return Grade{}, fmt.Errorf("no valid %s grade after 3 attempts", domain)
+}
+
+// Review grades the character with the rubric of the characters
+func (g *Generator) Review(ctx context.Context, spec Spec, character Character) (Grade, error) {
+	characterJSON, err := json.Marshal(character)
+	if err != nil {
+		return Grade{}, err
+	}
+	rules := GenerationInstructions(g.kinds)
+	if len(spec.Parents) == 2 {
+		rules = hybridInstructions(g.kinds, spec.Kind, spec.Parents)
+	}
+	return g.Judge(ctx, g.reviewModel, RubricCharacter, rules, fmt.Sprintf("this %s: %s", spec.Kind, characterJSON))
+}
+
+// gradeColumn is the CSV column of the grade ("" for the characters without review)
+func gradeColumn(grade *Grade) string {
+	if grade == nil {
+		return ""
+	}
+	return fmt.Sprintf("%.2f", grade.Score)
+}
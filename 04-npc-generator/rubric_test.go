@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadRubricsYAML(t *testing.T) {
+	dir := t.TempDir()
+	rubric := `# a grim dark campaign
+prompt: You are a strict reviewer of generated characters for a grim dark campaign.
+criteria:
+  - name: naming
+    description: the name follows the naming rules of the kind
+    weight: 2
+  - name: grimness
+    description: the name sounds harsh and old
+    weight: 1
+threshold: 0.7
+`
+	err := os.WriteFile(filepath.Join(dir, "character.yaml"), []byte(rubric), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "names.yml"), []byte("criteria: [{name: style, weight: 1}]\nthreshold: 0.5\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rubrics, err := LoadRubrics(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	character := rubrics[RubricCharacter]
+	if len(character.Criteria) != 2 || character.Criteria[1].Name != "grimness" || character.Criteria[0].Weight != 2 || character.Threshold != 0.7 {
+		t.Errorf("character rubric %+v", character)
+	}
+	if names := rubrics[RubricNames]; len(names.Criteria) != 1 || names.Threshold != 0.5 {
+		t.Errorf("names rubric %+v", names)
+	}
+
+	err = os.WriteFile(filepath.Join(dir, "character.yaml"), []byte("criteria:\n  - name: naming\n    weight: -1\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = LoadRubrics(dir)
+	if err == nil {
+		t.Error("a rubric with a negative weight is loaded")
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"slices"
+	"strings"
+)
+
+// RunOutput is the JSON export of a run, the slots are sorted like the tables (SORT),
+// Slot.Index is their position in the generation
+type RunOutput struct {
+	Campaign string     `json:"campaign"`
+	Genre    string     `json:"genre,omitempty"`
+	Spec     Spec       `json:"spec"`
+	Slots    []Slot     `json:"slots"`
+	Metrics  RunMetrics `json:"metrics"`
+	// Stopped is the reason of a run stopped before its last slot (token budget)
+	Stopped string `json:"stopped,omitempty"`
+}
+
+func ReadRunOutput(path string) (RunOutput, error) {
+	output := RunOutput{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return output, err
+	}
+	err = json.Unmarshal(data, &output)
+	return output, err
+}
+
+// Characters returns the characters of the successful slots
+func (o RunOutput) Characters() []Character {
+	characters := []Character{}
+	for _, slot := range o.Slots {
+		if slot.Status == SlotOK {
+			characters = append(characters, *slot.Character)
+		}
+	}
+	return characters
+}
+
+// Failed returns the Slot.Index of the failed or filtered slots (not their position in Slots)
+func (o RunOutput) Failed() []int {
+	indexes := []int{}
+	for _, slot := range o.Slots {
+		if slot.Status != SlotOK {
+			indexes = append(indexes, slot.Index)
+		}
+	}
+	return indexes
+}
+
+// slot returns the position in Slots of the slot with this Slot.Index, -1 without one
+func (o RunOutput) slot(index int) int {
+	return slices.IndexFunc(o.Slots, func(slot Slot) bool { return slot.Index == index })
+}
+
+// Write saves the JSON export, and the Markdown and CSV tables next to it
+func (o RunOutput) Write(jsonPath string, sortOptions SortOptions, genre Genre, markdown MarkdownOptions) error {
+	basePath := strings.TrimSuffix(jsonPath, ".json")
+	return o.WriteFormats(map[string]string{"json": jsonPath, "md": basePath + ".md", "csv": basePath + ".csv"}, sortOptions, genre, markdown)
+}
+
+// WriteFormats saves the exports (json, md and csv) at their path,
+// the three exports are sorted the same way and use the terms of the genre
+func (o RunOutput) WriteFormats(paths map[string]string, sortOptions SortOptions, genre Genre, markdown MarkdownOptions) error {
+	o.Slots = slices.Clone(o.Slots)
+	SortSlots(o.Slots, sortOptions)
+
+	data, err := json.MarshalIndent(o, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(paths["json"], data, 0644)
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(paths["md"], []byte(MarkdownTable(o.Characters(), genre, markdown)+ProvenanceMarkdown(o.Characters())), 0644)
+	if err != nil {
+		return err
+	}
+	csvTable, err := CSVTable(o.Characters(), genre)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(paths["csv"], []byte(csvTable), 0644)
+}
+
+// StoreSlots adds the successful characters to the registry and gives them their ID,
+// a name stored meanwhile by another generation filters the slot
+func StoreSlots(registry *Registry, slots []Slot) error {
+	for idx := range slots {
+		slot := &slots[idx]
+		if slot.Status != SlotOK {
+			continue
+		}
+		added, err := registry.Add(*slot.Character)
+		if err != nil {
+			return err
+		}
+		if len(added) == 0 {
+			slot.Status, slot.Reason = SlotFiltered, "duplicate: "+slot.Character.Name
+			slot.Character = nil
+			continue
+		}
+		slot.Character = &added[0]
+	}
+	return nil
+}
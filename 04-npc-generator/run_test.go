@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestWriteFormatsSorted(t *testing.T) {
+	output := RunOutput{Campaign: "test"}
+	for index, name := range []string{"Thorin", "", "Balin", "Dwalin"} {
+		slot := Slot{Index: index, Status: SlotOK, Character: &Character{Name: name, Kind: "Dwarf"}}
+		if name == "" {
+			slot = Slot{Index: index, Status: SlotFailed, Reason: "invalid answer"}
+		}
+		output.Slots = append(output.Slots, slot)
+	}
+	sortOptions, err := NewSortOptions(SortByName, CollationBinary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	err = output.Write(filepath.Join(dir, "run.json"), sortOptions, Genre{}, MarkdownOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	written, err := ReadRunOutput(filepath.Join(dir, "run.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the failed slots come last
+	names, indexes := []string{}, []int{}
+	for _, slot := range written.Slots {
+		if slot.Character != nil {
+			names = append(names, slot.Character.Name)
+		}
+		indexes = append(indexes, slot.Index)
+	}
+	if !slices.Equal(names, []string{"Balin", "Dwalin", "Thorin"}) || !slices.Equal(indexes, []int{2, 3, 0, 1}) {
+		t.Errorf("the JSON slots are %v %v, want sorted by name with their generation index", names, indexes)
+	}
+	for _, path := range []string{"run.md", "run.csv"} {
+		data, err := os.ReadFile(filepath.Join(dir, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		table := string(data)
+		balin, dwalin, thorin := strings.Index(table, "Balin"), strings.Index(table, "Dwalin"), strings.Index(table, "Thorin")
+		if balin < 0 || !(balin < dwalin && dwalin < thorin) {
+			t.Errorf("%s is not sorted by name:\n%s", path, table)
+		}
+	}
+
+	// the failed slots are found by their index, not by their position
+	failed := written.Failed()
+	if !slices.Equal(failed, []int{1}) {
+		t.Fatalf("Failed() = %v, want [1]", failed)
+	}
+	if position := written.slot(failed[0]); position != 3 || written.Slots[position].Status != SlotFailed {
+		t.Errorf("the slot of index 1 is at %d, want 3", position)
+	}
+	if position := written.slot(7); position != -1 {
+		t.Errorf("the slot of index 7 is at %d, want -1", position)
+	}
+	// the caller's slots are not sorted
+	if output.Slots[0].Character.Name != "Thorin" {
+		t.Errorf("the slots of the output were sorted: %q first", output.Slots[0].Character.Name)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// ErrGibberish flags the names mangled by the aggressive sampling options
+// (repeat_penalty 2.2 and repeat_last_n 2)
+var ErrGibberish = errors.New("gibberish")
+
+const (
+	minNameLength = 2
+	maxNameLength = 40
+)
+
+// CheckName applies the sanity rules: length bounds, character class ratios,
+// consonant clusters and repeated substrings
+func CheckName(name string) error {
+	runes := []rune(strings.TrimSpace(name))
+	if len(runes) < minNameLength || len(runes) > maxNameLength {
+		return fmt.Errorf("%w: %d characters in %q", ErrGibberish, len(runes), name)
+	}
+
+	letters, vowels, latin := 0, 0, 0
+	consonantStreak, sameStreak := 0, 0
+	for idx, r := range runes {
+		if unicode.IsLetter(r) {
+			letters++
+		} else if !unicode.IsSpace(r) && r != '-' && r != '\'' && r != '’' {
+			// digits, punctuation, symbols
+			continue
+		}
+
+		if idx > 0 && unicode.ToLower(r) == unicode.ToLower(runes[idx-1]) {
+			sameStreak++
+		} else {
+			sameStreak = 1
+		}
+		if sameStreak >= 3 {
+			return fmt.Errorf("%w: %q repeats %q", ErrGibberish, name, string(r))
+		}
+
+		lower := collationKey(string(r))
+		switch {
+		case lower == "":
+			consonantStreak = 0
+		case strings.ContainsAny(lower, "aeiouy"):
+			latin++
+			vowels++
+			consonantStreak = 0
+		case lower[0] >= 'a' && lower[0] <= 'z':
+			latin++
+			consonantStreak++
+		default:
+			consonantStreak = 0
+		}
+		if consonantStreak > 4 {
+			return fmt.Errorf("%w: too many consonants in a row in %q", ErrGibberish, name)
+		}
+	}
+
+	if float64(letters) < 0.8*float64(len(runes)) {
+		return fmt.Errorf("%w: not enough letters in %q", ErrGibberish, name)
+	}
+	if latin >= 4 && float64(vowels) < 0.15*float64(latin) {
+		return fmt.Errorf("%w: not enough vowels in %q", ErrGibberish, name)
+	}
+	if repeated := repeatedSubstring(strings.ToLower(string(runes))); repeated != "" {
+		return fmt.Errorf("%w: %q repeats %q", ErrGibberish, name, repeated)
+	}
+	return nil
+}
+
+// repeatedSubstring returns a substring (2 or 3 runes) repeated 3 times in a row,
+// like "rarara" or "thothotho"
+func repeatedSubstring(name string) string {
+	runes := []rune(name)
+	for size := 2; size <= 3; size++ {
+		for start := 0; start+3*size <= len(runes); start++ {
+			chunk := string(runes[start : start+size])
+			if strings.TrimSpace(chunk) == "" {
+				continue
+			}
+			if string(runes[start+size:start+2*size]) == chunk && string(runes[start+2*size:start+3*size]) == chunk {
+				return chunk
+			}
+		}
+	}
+	return ""
+}
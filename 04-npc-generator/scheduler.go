@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// Priority orders the requests waiting for the GPU: the interactive requests (the CLI,
+// the routes of the server, the bot) are served before the background ones (jobs, backfill, schedule)
+type Priority int
+
+const (
+	PriorityInteractive Priority = iota
+	PriorityBackground
+)
+
+type priorityKey struct{}
+
+// WithPriority returns the context of the requests of this priority
+func WithPriority(ctx context.Context, priority Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+// requestPriority returns the priority of the context, interactive by default
+func requestPriority(ctx context.Context) Priority {
+	priority, _ := ctx.Value(priorityKey{}).(Priority)
+	return priority
+}
+
+// heavyPaths are the requests that run the model on the GPU (generation, judging, embedding),
+// the other requests (version, show, list, ps) are never held
+var heavyPaths = []string{"/api/chat", "/api/generate", "/api/embed", "/api/embeddings"}
+
+// GPUScheduler is the transport limiting the heavy requests in flight to the slots of the GPU
+// (GPU_SLOTS, like OLLAMA_NUM_PARALLEL): the requests beyond it wait, the interactive ones first,
+// then in their order of arrival; a slot is held until the streamed answer is read
+type GPUScheduler struct {
+	transport http.RoundTripper
+	slots     int
+	mutex     sync.Mutex
+	inFlight  int
+	// waiting are the requests waiting for a slot, by priority
+	waiting [PriorityBackground + 1][]chan struct{}
+}
+
+func NewGPUScheduler(transport http.RoundTripper, slots int) *GPUScheduler {
+	return &GPUScheduler{transport: transport, slots: slots}
+}
+
+// ParseGPUSlots reads GPU_SLOTS (0: no limit)
+func ParseGPUSlots(value string) (int, error) {
+	slots, err := strconv.Atoi(value)
+	if err != nil || slots < 0 {
+		return 0, fmt.Errorf("invalid GPU_SLOTS %q (a number of requests, 0: no limit)", value)
+	}
+	return slots, nil
+}
+
+func (s *GPUScheduler) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !slices.Contains(heavyPaths, req.URL.Path) {
+		return s.transport.RoundTrip(req)
+	}
+	err := s.acquire(req.Context(), requestPriority(req.Context()))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.transport.RoundTrip(req)
+	if err != nil {
+		s.release()
+		return nil, err
+	}
+	resp.Body = newReleasingBody(resp.Body, s.release)
+	return resp, nil
+}
+
+// acquire takes a slot, or waits for a request in flight to give its slot
+func (s *GPUScheduler) acquire(ctx context.Context, priority Priority) error {
+	s.mutex.Lock()
+	if s.inFlight < s.slots {
+		s.inFlight++
+		s.mutex.Unlock()
+		return nil
+	}
+	ready := make(chan struct{})
+	s.waiting[priority] = append(s.waiting[priority], ready)
+	s.mutex.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		idx := slices.Index(s.waiting[priority], ready)
+		if idx >= 0 {
+			s.waiting[priority] = slices.Delete(s.waiting[priority], idx, idx+1)
+		} else {
+			// the slot was given meanwhile, it goes to the next request
+			s.releaseLocked()
+		}
+		return ctx.Err()
+	}
+}
+
+// release gives the slot to the first waiting request of the highest priority
+func (s *GPUScheduler) release() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.releaseLocked()
+}
+
+func (s *GPUScheduler) releaseLocked() {
+	for priority := range s.waiting {
+		if len(s.waiting[priority]) > 0 {
+			ready := s.waiting[priority][0]
+			s.waiting[priority] = s.waiting[priority][1:]
+			close(ready)
+			return
+		}
+	}
+	s.inFlight--
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// Representations of the names in the Markdown exports (NAME_SCRIPT)
+const (
+	NamesRomanized = "romanized" // the name (the romanization)
+	NamesNative    = "native"    // the native_name, the name without one
+	NamesBoth      = "both"      // Thorin (ᚦᚩᚱᛁᚾ)
+)
+
+// Script is the native writing of the names of a kind (the runes of the dwarves): the model writes
+// the names in their romanization, Letters maps every native letter to its romanized spelling
+// ("ᚦ": "th") and gives the native_name of the characters
+type Script struct {
+	Name    string            `json:"name"`
+	Letters map[string]string `json:"letters"`
+	// Separator replaces the spaces of the native names (the runic ᛫), default a space
+	Separator string `json:"separator,omitempty"`
+}
+
+// check refuses a script without letters or with two letters of the same spelling
+func (s *Script) check() error {
+	if len(s.Letters) == 0 {
+		return errors.New("the script has no letters")
+	}
+	spellings := map[string]string{}
+	for _, native := range slices.Sorted(maps.Keys(s.Letters)) {
+		spelling := strings.ToLower(s.Letters[native])
+		if spelling == "" {
+			return fmt.Errorf("the letter %s has no romanization", native)
+		}
+		if other, ok := spellings[spelling]; ok {
+			return fmt.Errorf("the letters %s and %s are both romanized %q", other, native, spelling)
+		}
+		spellings[spelling] = native
+	}
+	return nil
+}
+
+// Render writes the romanized name in the script, the longest spellings first (th before t);
+// the letters with diacritics are folded when the romanization doesn't use them (ó is o),
+// a letter without a native form is kept
+func (s *Script) Render(name string) string {
+	spellings := map[string]string{}
+	romanized := ""
+	for native, spelling := range s.Letters {
+		spellings[strings.ToLower(spelling)] = native
+		romanized += strings.ToLower(spelling)
+	}
+	keys := slices.SortedFunc(maps.Keys(spellings), func(a, b string) int {
+		return cmp.Compare(utf8.RuneCountInString(b), utf8.RuneCountInString(a))
+	})
+
+	folded := strings.Builder{}
+	for _, r := range strings.ToLower(name) {
+		if ascii, ok := asciiLetter(r); ok && !strings.ContainsRune(romanized, r) {
+			folded.WriteString(strings.ToLower(ascii))
+			continue
+		}
+		folded.WriteRune(r)
+	}
+
+	words := []string{}
+	for _, word := range strings.Fields(folded.String()) {
+		native := strings.Builder{}
+		for word != "" {
+			index := slices.IndexFunc(keys, func(spelling string) bool { return strings.HasPrefix(word, spelling) })
+			if index < 0 {
+				r, size := utf8.DecodeRuneInString(word)
+				native.WriteRune(r)
+				word = word[size:]
+				continue
+			}
+			native.WriteString(spellings[keys[index]])
+			word = word[len(keys[index]):]
+		}
+		words = append(words, native.String())
+	}
+	return strings.Join(words, cmp.Or(s.Separator, " "))
+}
+
+// kindScript returns the script of the kind of the character, the first parent with one for a hybrid
+func (g *Generator) kindScript(character Character) *Script {
+	for _, name := range append([]string{character.Kind}, character.Parents...) {
+		kind, ok := findKind(g.kinds, name)
+		if ok && kind.Script != nil {
+			return kind.Script
+		}
+	}
+	return nil
+}
+
+// checkNames checks the representation of NAME_SCRIPT and --names
+func checkNames(names string) error {
+	switch names {
+	case NamesRomanized, NamesNative, NamesBoth:
+		return nil
+	}
+	return fmt.Errorf("unknown names %q (%s, %s, %s)", names, NamesRomanized, NamesNative, NamesBoth)
+}
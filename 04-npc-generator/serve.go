@@ -0,0 +1,179 @@
+//go:build !minimal
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// runServe starts the HTTP server, with --read-only (READ_ONLY=true) only the
+// stored content can be browsed and the generation routes are not registered,
+// with --approval (APPROVAL=true) the generated characters wait for a reviewer
+func (a *App) runServe(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	readOnly := flags.Bool("read-only", os.Getenv("READ_ONLY") == "true", "only serve the stored content")
+	approval := flags.Bool("approval", os.Getenv("APPROVAL") == "true", "submit the generated characters to the approval queue")
+	flags.Parse(args)
+
+	// SIGTERM (the pod is stopped) lets the in-flight requests finish,
+	// the interrupted jobs resume at the next start
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	workers, err := strconv.Atoi(getEnv("JOB_WORKERS", "1"))
+	if err != nil {
+		return err
+	}
+	server := NewServer(a.generator, a.storage, a.sortOptions)
+	server.readOnly = *readOnly
+	server.approval, server.jobs.approval = *approval, *approval
+	server.reviewerToken = os.Getenv("REVIEWER_TOKEN")
+	if server.approval && server.reviewerToken == "" {
+		return fmt.Errorf("--approval needs REVIEWER_TOKEN, the reviewers approve the characters with it")
+	}
+	server.markdown = a.markdown
+	if !server.readOnly {
+		err = a.loadNotes(ctx, os.Getenv("NOTES_DIR"))
+		if err != nil {
+			return err
+		}
+		err = a.startBackend(ctx)
+		if err != nil {
+			return err
+		}
+
+		err = server.jobs.Load()
+		if err != nil {
+			return err
+		}
+		server.jobs.Start(ctx, workers)
+	}
+
+	httpPort := getEnv("HTTP_PORT", "8080")
+	httpServer := &http.Server{Addr: ":" + httpPort, Handler: server.Handler()}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Println("🚀 listening on", httpPort)
+	err = httpServer.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		fmt.Println("👋 stopped")
+		return nil
+	}
+	return err
+}
+
+// startBackend monitors Ollama (the generations wait for it while it is down)
+// and the quality of the generations, for the long-running commands (serve, discord)
+func (a *App) startBackend(ctx context.Context) error {
+	interval, err := time.ParseDuration(getEnv("OLLAMA_CHECK_INTERVAL", "5s"))
+	if err != nil {
+		return err
+	}
+	failures, err := strconv.Atoi(getEnv("OLLAMA_MAX_FAILURES", "3"))
+	if err != nil {
+		return err
+	}
+	a.generator.backend = NewBackend(a.generator.client, interval, failures)
+	window, err := time.ParseDuration(getEnv("QUALITY_WINDOW", "1h"))
+	if err != nil {
+		return err
+	}
+	a.generator.quality = NewQualityMonitor(window)
+	go a.generator.backend.Monitor(ctx)
+	return nil
+}
+
+// runSchedule is a daemon generating a few characters on a cron expression,
+// the characters are added to the registry so the world slowly grows
+func (a *App) runSchedule(ctx context.Context, args []string) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx = WithPriority(ctx, PriorityBackground)
+
+	count, err := strconv.Atoi(getEnv("SCHEDULE_COUNT", "5"))
+	if err != nil {
+		return err
+	}
+	pause, err := time.ParseDuration(getEnv("SCHEDULE_PAUSE", "10s"))
+	if err != nil {
+		return err
+	}
+	flags := flag.NewFlagSet("schedule", flag.ExitOnError)
+	campaign := flags.String("campaign", getEnv("CAMPAIGN", DefaultCampaign), "campaign of the characters")
+	expression := flags.String("cron", getEnv("SCHEDULE", "@nightly"), "cron expression of the generations (minute hour day month weekday)")
+	spec := Spec{}
+	flags.StringVar(&spec.Kind, "kind", getEnv("KIND", a.generator.kinds[0].Name), "kind of the characters")
+	flags.IntVar(&spec.Count, "count", count, "number of characters per generation")
+	flags.DurationVar(&pause, "pause", pause, "pause between two characters (throttling)")
+	flags.Parse(args)
+
+	schedule, err := ParseCron(*expression)
+	if err != nil {
+		return err
+	}
+	spec.Level = 1
+	spec.Kind, spec.Parents, err = ResolveKind(a.generator.kinds, spec.Kind, "")
+	if err != nil {
+		return err
+	}
+	registry, err := a.storage.Registry(*campaign)
+	if err != nil {
+		return err
+	}
+
+	for {
+		next := schedule.Next(time.Now())
+		if next.IsZero() {
+			return fmt.Errorf("the cron expression %q never matches", *expression)
+		}
+		fmt.Println("⏰ next generation", next.Format(time.RFC3339))
+		select {
+		case <-ctx.Done():
+			fmt.Println("👋 stopped")
+			return nil
+		case <-time.After(time.Until(next)):
+		}
+
+		run := NewRun(a.generator, registry.Deduper(), spec)
+		stored := 0
+		for index := range spec.Count {
+			slot, err := run.GenerateSlot(ctx, index)
+			if ctx.Err() != nil {
+				break
+			}
+			if err != nil {
+				// Ollama may be down for the night, the next generation will try again
+				fmt.Println("😡:", err)
+				break
+			}
+			slots := []Slot{slot}
+			err = StoreSlots(registry, slots)
+			if err != nil {
+				return err
+			}
+			if slots[0].Status == SlotOK {
+				stored++
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(pause):
+			}
+		}
+		fmt.Println("🌱", stored, "new characters in", *campaign)
+	}
+}
@@ -0,0 +1,292 @@
+//go:build !minimal
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// Server exposes the generator over HTTP, every route is scoped by a campaign:
+//   - POST /campaigns/{campaign}/characters {"kind": "Elf", "class": "Ranger", "level": 3, "count": 5}
+//   - GET  /campaigns/{campaign}/characters?kind=Half-Elf&parent=Elf&tag=villain
+//
+// The browsers and the dashboards can follow a generation with Server-Sent Events:
+//   - GET /events/generate?campaign=default&kind=Elf&count=5
+//
+// The names can be reserved by a player (they are never generated):
+//   - POST   /campaigns/{campaign}/reservations {"name": "Thorgar", "holder": "alice"}
+//   - DELETE /campaigns/{campaign}/reservations/{name}?holder=alice
+//   - GET    /campaigns/{campaign}/reservations
+//
+// The large generations are jobs processed in the background:
+//   - POST /jobs {"campaign": "default", "kind": "Elf", "count": 500}
+//   - GET  /jobs/{id} (status and progress)
+//   - GET  /jobs/{id}/result
+//
+// The companion apps browse the stored characters by page (with an ETag):
+//   - GET /characters?campaign=default&kind=Dwarf&page=2&limit=50
+//
+// In read-only mode (serve --read-only) only the stored content and the probes are served:
+// GET /characters, GET /campaigns/{campaign}/characters, GET /campaigns/{campaign}/reservations,
+// GET /healthz and GET /readyz
+//
+// With serve --approval the generated characters wait for a reviewer, only the approved ones
+// are stored and exported (GET /admin/approvals is the page of the reviewers); these routes
+// need the reviewer token (REVIEWER_TOKEN):
+//   - GET   /campaigns/{campaign}/pending
+//   - PATCH /campaigns/{campaign}/pending/{id} {"name": "Thorgar"}
+//   - POST  /campaigns/{campaign}/pending/{id}/approve
+//   - POST  /campaigns/{campaign}/pending/{id}/reject
+//
+// The operators follow the duplicate, retry and schema violation rates by model and kind
+// over the last hour (QUALITY_WINDOW) on GET /admin/dashboard (GET /admin/quality in JSON).
+//
+// And the probes: GET /healthz (liveness) and GET /readyz (Ollama and the model are available).
+// While Ollama is down (restarting), the generation routes answer 503 with a Retry-After
+// and the jobs wait for it to come back
+type Server struct {
+	generator   *Generator
+	storage     *Storage
+	sortOptions SortOptions
+	markdown    MarkdownOptions
+	jobs        *JobQueue
+	// readOnly only registers the GET routes of the stored content (no generation)
+	readOnly bool
+	// approval submits the generated characters to the approval queue instead of the registry
+	approval bool
+	// reviewerToken protects the routes of the approval queue ("": the routes are refused)
+	reviewerToken string
+}
+
+func NewServer(generator *Generator, storage *Storage, sortOptions SortOptions) *Server {
+	return &Server{
+		generator:   generator,
+		storage:     storage,
+		sortOptions: sortOptions,
+		jobs:        NewJobQueue(generator, storage, storage.JobsDir()),
+	}
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /characters", s.handlePublicList)
+	mux.HandleFunc("GET /campaigns/{campaign}/characters", s.handleList)
+	mux.HandleFunc("GET /campaigns/{campaign}/reservations", s.handleListReservations)
+	mux.HandleFunc("GET /healthz", s.handleHealthz)
+	mux.HandleFunc("GET /readyz", s.handleReadyz)
+	if s.readOnly {
+		return mux
+	}
+	mux.HandleFunc("POST /campaigns/{campaign}/characters", s.handleGenerate)
+	mux.HandleFunc("POST /campaigns/{campaign}/reservations", s.handleReserve)
+	mux.HandleFunc("DELETE /campaigns/{campaign}/reservations/{name}", s.handleRelease)
+	mux.HandleFunc("GET /events/generate", s.handleGenerateEvents)
+	mux.HandleFunc("POST /jobs", s.handleCreateJob)
+	mux.HandleFunc("GET /jobs/{id}", s.handleGetJob)
+	mux.HandleFunc("GET /jobs/{id}/result", s.handleGetJobResult)
+	mux.HandleFunc("GET /admin/quality", s.handleQuality)
+	mux.HandleFunc("GET /admin/dashboard", s.handleDashboard)
+	mux.HandleFunc("GET /campaigns/{campaign}/pending", s.reviewer(s.handleListPending))
+	mux.HandleFunc("PATCH /campaigns/{campaign}/pending/{id}", s.reviewer(s.handleEditPending))
+	mux.HandleFunc("POST /campaigns/{campaign}/pending/{id}/approve", s.reviewer(s.handleApprove))
+	mux.HandleFunc("POST /campaigns/{campaign}/pending/{id}/reject", s.reviewer(s.handleReject))
+	mux.HandleFunc("GET /admin/approvals", s.reviewer(s.handleApprovals))
+	return mux
+}
+
+func (s *Server) handleGenerate(w http.ResponseWriter, r *http.Request) {
+	campaign := r.PathValue("campaign")
+	registry, err := s.storage.Registry(campaign)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	body := GenerateRequest{Spec: s.generator.DefaultSpec()}
+	err = json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	request, err := s.generator.CheckSpec(body, 100)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if !s.generator.backend.Status().Up {
+		writeUnavailable(w, s.generator.backend)
+		return
+	}
+
+	run := NewRun(s.generator, registry.Deduper(), request)
+	slots, err := run.Generate(r.Context())
+	if errors.Is(err, ErrBackendDown) {
+		writeUnavailable(w, s.generator.backend)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	err = storeSlots(registry, slots, s.approval)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	err = s.export(campaign, registry, request.Kind)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, RunOutput{Campaign: campaign, Spec: request, Slots: slots, Metrics: run.Metrics()})
+}
+
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	registry, err := s.storage.Registry(r.PathValue("campaign"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	characters := filterCharacters(registry.List(), r.URL.Query())
+	SortCharacters(characters, s.sortOptions)
+	writeJSON(w, http.StatusOK, characters)
+}
+
+// export rewrites the Markdown table of all the stored characters of this kind
+func (s *Server) export(campaign string, registry *Registry, kind string) error {
+	err := checkKind(kind)
+	if err != nil {
+		return err
+	}
+	characters := []Character{}
+	for _, character := range registry.List() {
+		if character.Kind == kind && !character.Archived() {
+			characters = append(characters, character)
+		}
+	}
+	SortCharacters(characters, s.sortOptions)
+	exportPath, err := s.storage.ExportPath(campaign, "characters."+kind+".md")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(exportPath, []byte(MarkdownTable(characters, s.generator.genre, s.markdown)), 0644)
+}
+
+func (s *Server) handleCreateJob(w http.ResponseWriter, r *http.Request) {
+	request := JobRequest{Campaign: DefaultCampaign, GenerateRequest: GenerateRequest{Spec: s.generator.DefaultSpec()}}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	spec, err := s.generator.CheckSpec(request.GenerateRequest, 10000)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	job, err := s.jobs.Enqueue(request.Campaign, spec)
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	w.Header().Set("Location", "/jobs/"+job.ID)
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+func (s *Server) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.jobs.Get(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown job"))
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+func (s *Server) handleGetJobResult(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.jobs.Get(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown job"))
+		return
+	}
+	if job.Status != JobDone {
+		writeError(w, http.StatusConflict, fmt.Errorf("the job is %s", job.Status))
+		return
+	}
+
+	slots := append([]Slot{}, job.Slots...)
+	SortSlots(slots, s.sortOptions)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"job-%s.json\"", job.ID))
+	writeJSON(w, http.StatusOK, RunOutput{Campaign: job.Campaign, Spec: job.Spec, Slots: slots, Metrics: job.Metrics})
+}
+
+func (s *Server) handleListReservations(w http.ResponseWriter, r *http.Request) {
+	registry, err := s.storage.Registry(r.PathValue("campaign"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, registry.ListReservations())
+}
+
+func (s *Server) handleReserve(w http.ResponseWriter, r *http.Request) {
+	registry, err := s.storage.Registry(r.PathValue("campaign"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	request := Reservation{}
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	reservation, err := registry.Reserve(request.Name, request.Holder)
+	switch {
+	case errors.Is(err, ErrReserved):
+		writeError(w, http.StatusConflict, err)
+	case err != nil:
+		writeError(w, http.StatusBadRequest, err)
+	default:
+		writeJSON(w, http.StatusCreated, reservation)
+	}
+}
+
+func (s *Server) handleRelease(w http.ResponseWriter, r *http.Request) {
+	registry, err := s.storage.Registry(r.PathValue("campaign"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	err = registry.Release(r.PathValue("name"), r.URL.Query().Get("holder"))
+	switch {
+	case errors.Is(err, ErrNotReserved):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, ErrReserved):
+		writeError(w, http.StatusForbidden, err)
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// writeUnavailable answers 503 with a Retry-After of a heartbeat interval
+func writeUnavailable(w http.ResponseWriter, backend *Backend) {
+	w.Header().Set("Retry-After", backend.retryAfter())
+	writeError(w, http.StatusServiceUnavailable, ErrBackendDown)
+}
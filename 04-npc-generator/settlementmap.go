@@ -0,0 +1,482 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ollama/ollama/api"
+)
+
+// MapDistrict is a rectangle of the settlement map, in cells
+type MapDistrict struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	X           int    `json:"x"`
+	Y           int    `json:"y"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+}
+
+// contains is true when the cell is in the district
+func (d MapDistrict) contains(x, y int) bool {
+	return x >= d.X && x < d.X+d.Width && y >= d.Y && y < d.Y+d.Height
+}
+
+// MapLandmark is a notable place of the map (a temple, a market), District is the district it is in
+type MapLandmark struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	X        int    `json:"x"`
+	Y        int    `json:"y"`
+	District string `json:"district,omitempty"`
+}
+
+// MapHome is the home of a stored character of the settlement
+type MapHome struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	District string `json:"district"`
+	X        int    `json:"x"`
+	Y        int    `json:"y"`
+}
+
+// SettlementMap is the layout of a settlement: the districts, the landmarks and the homes of its inhabitants
+type SettlementMap struct {
+	Settlement string        `json:"settlement"`
+	Width      int           `json:"width"`
+	Height     int           `json:"height"`
+	Districts  []MapDistrict `json:"districts"`
+	Landmarks  []MapLandmark `json:"landmarks"`
+	Homes      []MapHome     `json:"homes"`
+}
+
+// mapSchema bounds the coordinates to the grid
+func mapSchema(width, height, districts int) map[string]any {
+	coordinate := func(maximum int) map[string]any {
+		return map[string]any{"type": "integer", "minimum": 0, "maximum": maximum}
+	}
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"districts": map[string]any{
+				"type": "array",
+				"items": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"name":        map[string]any{"type": "string"},
+						"description": map[string]any{"type": "string"},
+						"x":           coordinate(width - 1),
+						"y":           coordinate(height - 1),
+						"width":       coordinate(width),
+						"height":      coordinate(height),
+					},
+					"required": []string{"name", "description", "x", "y", "width", "height"},
+				},
+				"minItems": 1,
+				"maxItems": districts,
+			},
+			"landmarks": map[string]any{
+				"type": "array",
+				"items": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"name": map[string]any{"type": "string"},
+						"type": map[string]any{"type": "string"},
+						"x":    coordinate(width - 1),
+						"y":    coordinate(height - 1),
+					},
+					"required": []string{"name", "type", "x", "y"},
+				},
+			},
+		},
+		"required": []string{"districts", "landmarks"},
+	}
+}
+
+// checkLayout keeps the districts and the landmarks of the answer that fit in the grid:
+// the districts are clipped, a landmark must be in a free cell and gets the district it is in
+func (m *SettlementMap) checkLayout(districts []MapDistrict, landmarks []MapLandmark) error {
+	m.Districts, m.Landmarks = []MapDistrict{}, []MapLandmark{}
+	names := map[string]bool{}
+	for _, district := range districts {
+		district.Name = strings.TrimSpace(district.Name)
+		district.X, district.Y = max(district.X, 0), max(district.Y, 0)
+		district.Width = min(district.Width, m.Width-district.X)
+		district.Height = min(district.Height, m.Height-district.Y)
+		key := strings.ToLower(district.Name)
+		if district.Name == "" || names[key] || district.Width < 2 || district.Height < 2 {
+			fmt.Printf("🚫 district %q dropped\n", district.Name)
+			continue
+		}
+		names[key] = true
+		m.Districts = append(m.Districts, district)
+	}
+	if len(m.Districts) == 0 {
+		return errors.New("no district in the map")
+	}
+
+	taken := map[[2]int]bool{}
+	for _, landmark := range landmarks {
+		landmark.Name = strings.TrimSpace(landmark.Name)
+		cell := [2]int{landmark.X, landmark.Y}
+		if landmark.Name == "" || landmark.X < 0 || landmark.X >= m.Width || landmark.Y < 0 || landmark.Y >= m.Height || taken[cell] {
+			fmt.Printf("🚫 landmark %q dropped\n", landmark.Name)
+			continue
+		}
+		taken[cell] = true
+		landmark.District = m.districtAt(landmark.X, landmark.Y)
+		m.Landmarks = append(m.Landmarks, landmark)
+	}
+	return nil
+}
+
+// districtAt returns the first district with the cell ("" outside the districts)
+func (m SettlementMap) districtAt(x, y int) string {
+	for _, district := range m.Districts {
+		if district.contains(x, y) {
+			return district.Name
+		}
+	}
+	return ""
+}
+
+// GenerateMap asks for the districts and the landmarks of the settlement on a grid (3 attempts)
+func (g *Generator) GenerateMap(ctx context.Context, settlement string, width, height, districts int, inhabitants []Character) (SettlementMap, error) {
+	settlementMap := SettlementMap{Settlement: settlement, Width: width, Height: height, Homes: []MapHome{}}
+
+	userContent := fmt.Sprintf("Generate the layout of the settlement %s on a grid of %d columns (x from 0 to %d) and %d rows (y from 0 to %d).", settlement, width, width-1, height, height-1)
+	userContent += fmt.Sprintf("\nThe settlement has 1 to %d districts, every district is a rectangle (x and y of its top left cell, width and height in cells) that doesn't overlap the others.", districts)
+	userContent += "\nAdd the landmarks of the settlement (temple, market, tavern, gate, well...), every landmark on its own cell."
+	if len(inhabitants) > 0 {
+		kinds := map[string]int{}
+		for _, character := range inhabitants {
+			kinds[character.Kind]++
+		}
+		described := []string{}
+		for kind, count := range kinds {
+			described = append(described, fmt.Sprintf("%d %s", count, kind))
+		}
+		userContent += "\nThe inhabitants are " + strings.Join(described, ", ") + "."
+	}
+	messages := []api.Message{
+		{Role: "system", Content: g.genre.Instructions},
+		{Role: "user", Content: userContent},
+	}
+	options := map[string]interface{}{"temperature": 0.8}
+
+	for attempt := 0; attempt < 3; attempt++ {
+		answer, err := g.chat(ctx, DomainMap, messages, mapSchema(width, height, districts), options)
+		if err != nil {
+			return settlementMap, err
+		}
+		if answer.Truncated {
+			continue
+		}
+		answered := struct {
+			Districts []MapDistrict `json:"districts"`
+			Landmarks []MapLandmark `json:"landmarks"`
+		}{}
+		err = decodeAnswer(answer.Content, &answered)
+		if err == nil {
+			err = settlementMap.checkLayout(answered.Districts, answered.Landmarks)
+		}
+		if err != nil {
+			fmt.Println("😡 map:", err)
+			continue
+		}
+		return settlementMap, nil
+	}
+	return settlementMap, fmt.Errorf("no valid layout for %s after 3 attempts", settlement)
+}
+
+// PlaceHomes gives every inhabitant a free cell of a district, the districts in turn;
+// the cells are shuffled with a seed of the settlement, so the same map places the homes the same way
+func (m *SettlementMap) PlaceHomes(inhabitants []Character) {
+	hash := fnv.New64a()
+	hash.Write([]byte(m.Settlement))
+	random := rand.New(rand.NewPCG(hash.Sum64(), uint64(len(inhabitants))))
+
+	taken := map[[2]int]bool{}
+	for _, landmark := range m.Landmarks {
+		taken[[2]int{landmark.X, landmark.Y}] = true
+	}
+	free := make([][][2]int, len(m.Districts))
+	for idx, district := range m.Districts {
+		for y := district.Y; y < district.Y+district.Height; y++ {
+			for x := district.X; x < district.X+district.Width; x++ {
+				// the overlapping cells belong to the first district
+				if !taken[[2]int{x, y}] && m.districtAt(x, y) == district.Name {
+					free[idx] = append(free[idx], [2]int{x, y})
+				}
+			}
+		}
+		random.Shuffle(len(free[idx]), func(i, j int) { free[idx][i], free[idx][j] = free[idx][j], free[idx][i] })
+	}
+
+	m.Homes = []MapHome{}
+	for number, character := range inhabitants {
+		for offset := range m.Districts {
+			idx := (number + offset) % len(m.Districts)
+			if len(free[idx]) == 0 {
+				continue
+			}
+			cell := free[idx][0]
+			free[idx] = free[idx][1:]
+			m.Homes = append(m.Homes, MapHome{ID: character.ID, Name: character.Name, District: m.Districts[idx].Name, X: cell[0], Y: cell[1]})
+			break
+		}
+	}
+	if len(m.Homes) < len(inhabitants) {
+		fmt.Printf("🏚️ no free cell for %d inhabitants\n", len(inhabitants)-len(m.Homes))
+	}
+}
+
+// landmarkSymbol is the symbol of the nth landmark: 1 to 9, then A to Z
+func landmarkSymbol(idx int) byte {
+	if idx < 9 {
+		return byte('1' + idx)
+	}
+	if idx < 9+26 {
+		return byte('A' + idx - 9)
+	}
+	return '*'
+}
+
+// ASCII draws the map: the districts with their lower case letter, the landmarks with their number,
+// the homes with @ and the cells outside the districts with dots, then the legend
+func (m SettlementMap) ASCII() string {
+	grid := make([][]byte, m.Height)
+	for y := range grid {
+		grid[y] = []byte(strings.Repeat(".", m.Width))
+		for x := range grid[y] {
+			for idx, district := range m.Districts {
+				if district.contains(x, y) {
+					grid[y][x] = byte('a' + idx%26)
+					break
+				}
+			}
+		}
+	}
+	for _, home := range m.Homes {
+		grid[home.Y][home.X] = '@'
+	}
+	for idx, landmark := range m.Landmarks {
+		grid[landmark.Y][landmark.X] = landmarkSymbol(idx)
+	}
+
+	builder := strings.Builder{}
+	builder.WriteString("+" + strings.Repeat("-", m.Width) + "+\n")
+	for _, row := range grid {
+		builder.WriteString("|" + string(row) + "|\n")
+	}
+	builder.WriteString("+" + strings.Repeat("-", m.Width) + "+\n\n")
+	for idx, district := range m.Districts {
+		fmt.Fprintf(&builder, "%c %s\n", 'a'+idx%26, district.Name)
+	}
+	for idx, landmark := range m.Landmarks {
+		fmt.Fprintf(&builder, "%c %s (%s)\n", landmarkSymbol(idx), landmark.Name, landmark.Type)
+	}
+	if len(m.Homes) > 0 {
+		fmt.Fprintf(&builder, "@ %d homes\n", len(m.Homes))
+	}
+	return builder.String()
+}
+
+// MapMarkdown renders the ASCII map, the districts and the inhabitants by district
+func MapMarkdown(settlementMap SettlementMap) string {
+	markdown := "# " + escapeMarkdown(settlementMap.Settlement) + "\n\n```\n" + settlementMap.ASCII() + "```\n"
+	for _, district := range settlementMap.Districts {
+		markdown += "\n## " + escapeMarkdown(district.Name) + "\n\n"
+		if district.Description != "" {
+			markdown += escapeMarkdown(district.Description) + "\n\n"
+		}
+		for _, landmark := range settlementMap.Landmarks {
+			if landmark.District == district.Name {
+				markdown += fmt.Sprintf("- **%s** (%s) at %d,%d\n", escapeMarkdown(landmark.Name), escapeMarkdown(landmark.Type), landmark.X, landmark.Y)
+			}
+		}
+		for _, home := range settlementMap.Homes {
+			if home.District == district.Name {
+				markdown += fmt.Sprintf("- %s lives at %d,%d\n", escapeMarkdown(home.Name), home.X, home.Y)
+			}
+		}
+	}
+	return markdown
+}
+
+// Tiled map format (JSON, .tmj): the districts, the landmarks and the homes are object layers,
+// so the map needs no tileset
+type tiledProperty struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Value any    `json:"value"`
+}
+
+type tiledObject struct {
+	ID         int             `json:"id"`
+	Name       string          `json:"name"`
+	Type       string          `json:"type"`
+	X          int             `json:"x"`
+	Y          int             `json:"y"`
+	Width      int             `json:"width"`
+	Height     int             `json:"height"`
+	Rotation   int             `json:"rotation"`
+	Point      bool            `json:"point,omitempty"`
+	Visible    bool            `json:"visible"`
+	Properties []tiledProperty `json:"properties,omitempty"`
+}
+
+type tiledLayer struct {
+	ID        int           `json:"id"`
+	Name      string        `json:"name"`
+	Type      string        `json:"type"`
+	DrawOrder string        `json:"draworder"`
+	Objects   []tiledObject `json:"objects"`
+	Opacity   int           `json:"opacity"`
+	Visible   bool          `json:"visible"`
+	X         int           `json:"x"`
+	Y         int           `json:"y"`
+}
+
+type tiledMap struct {
+	Type         string       `json:"type"`
+	Version      string       `json:"version"`
+	TiledVersion string       `json:"tiledversion"`
+	Orientation  string       `json:"orientation"`
+	RenderOrder  string       `json:"renderorder"`
+	Width        int          `json:"width"`
+	Height       int          `json:"height"`
+	TileWidth    int          `json:"tilewidth"`
+	TileHeight   int          `json:"tileheight"`
+	Infinite     bool         `json:"infinite"`
+	Layers       []tiledLayer `json:"layers"`
+	NextLayerID  int          `json:"nextlayerid"`
+	NextObjectID int          `json:"nextobjectid"`
+	Tilesets     []any        `json:"tilesets"`
+}
+
+// tiledTileSize is the size of a cell in the Tiled map, in pixels
+const tiledTileSize = 32
+
+// Tiled returns the map in the JSON format of Tiled: the coordinates are in pixels,
+// the landmarks and the homes are points at the center of their cell
+func (m SettlementMap) Tiled() tiledMap {
+	nextID := 1
+	layer := func(id int, name string) tiledLayer {
+		return tiledLayer{ID: id, Name: name, Type: "objectgroup", DrawOrder: "topdown", Objects: []tiledObject{}, Opacity: 1, Visible: true}
+	}
+	point := func(name, objectType string, x, y int, properties ...tiledProperty) tiledObject {
+		nextID++
+		return tiledObject{ID: nextID - 1, Name: name, Type: objectType, X: x*tiledTileSize + tiledTileSize/2, Y: y*tiledTileSize + tiledTileSize/2,
+			Point: true, Visible: true, Properties: properties}
+	}
+
+	districts, landmarks, homes := layer(1, "districts"), layer(2, "landmarks"), layer(3, "homes")
+	for _, district := range m.Districts {
+		districts.Objects = append(districts.Objects, tiledObject{ID: nextID, Name: district.Name, Type: "district",
+			X: district.X * tiledTileSize, Y: district.Y * tiledTileSize, Width: district.Width * tiledTileSize, Height: district.Height * tiledTileSize, Visible: true,
+			Properties: []tiledProperty{{Name: "description", Type: "string", Value: district.Description}}})
+		nextID++
+	}
+	for _, landmark := range m.Landmarks {
+		landmarks.Objects = append(landmarks.Objects, point(landmark.Name, landmark.Type, landmark.X, landmark.Y,
+			tiledProperty{Name: "district", Type: "string", Value: landmark.District}))
+	}
+	for _, home := range m.Homes {
+		homes.Objects = append(homes.Objects, point(home.Name, "home", home.X, home.Y,
+			tiledProperty{Name: "character_id", Type: "int", Value: home.ID},
+			tiledProperty{Name: "district", Type: "string", Value: home.District}))
+	}
+	return tiledMap{Type: "map", Version: "1.10", TiledVersion: "1.10.2", Orientation: "orthogonal", RenderOrder: "right-down",
+		Width: m.Width, Height: m.Height, TileWidth: tiledTileSize, TileHeight: tiledTileSize,
+		Layers: []tiledLayer{districts, landmarks, homes}, NextLayerID: 4, NextObjectID: nextID, Tilesets: []any{}}
+}
+
+// runMap generates the layout of a settlement and places the homes of its stored inhabitants:
+// map --settlement Ironhold --width 48 --height 20 --districts 4
+func (a *App) runMap(ctx context.Context, args []string) error {
+	width, err := strconv.Atoi(getEnv("MAP_WIDTH", "48"))
+	if err != nil {
+		return err
+	}
+	height, err := strconv.Atoi(getEnv("MAP_HEIGHT", "20"))
+	if err != nil {
+		return err
+	}
+	flags := flag.NewFlagSet("map", flag.ExitOnError)
+	campaign := flags.String("campaign", getEnv("CAMPAIGN", DefaultCampaign), "campaign of the settlement")
+	settlement := flags.String("settlement", "", "settlement of the map, its stored inhabitants get a home")
+	flags.IntVar(&width, "width", width, "columns of the grid")
+	flags.IntVar(&height, "height", height, "rows of the grid")
+	districts := flags.Int("districts", 4, "maximum number of districts")
+	flags.Parse(args)
+	if strings.TrimSpace(*settlement) == "" {
+		return errors.New("usage: map --settlement <name> [--width 48] [--height 20] [--districts 4]")
+	}
+	if width < 8 || width > 200 || height < 8 || height > 200 {
+		return errors.New("the grid must be between 8 and 200 cells wide and high")
+	}
+	registry, err := a.storage.Registry(*campaign)
+	if err != nil {
+		return err
+	}
+	inhabitants := []Character{}
+	for _, character := range registry.List() {
+		if strings.EqualFold(character.Settlement, *settlement) && !character.Archived() {
+			inhabitants = append(inhabitants, character)
+		}
+	}
+
+	settlementMap, err := a.generator.GenerateMap(ctx, *settlement, width, height, max(*districts, 1), inhabitants)
+	if err != nil {
+		return err
+	}
+	settlementMap.PlaceHomes(inhabitants)
+	// the registry links the inhabitants to the district of their home
+	for _, home := range settlementMap.Homes {
+		_, err = registry.Modify(home.ID, func(character *Character) {
+			character.Home = home.District
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	slug := Slug(*settlement)
+	if slug == "" {
+		slug = "settlement"
+	}
+	exportPath, err := a.storage.ExportPath(*campaign, "maps", slug+".json")
+	if err != nil {
+		return err
+	}
+	err = writeExport(exportPath, settlementMap, MapMarkdown(settlementMap))
+	if err != nil {
+		return err
+	}
+	tiledPath := strings.TrimSuffix(exportPath, ".json") + ".tmj"
+	err = writeJSONFile(tiledPath, settlementMap.Tiled())
+	if err != nil {
+		return err
+	}
+	fmt.Print(settlementMap.ASCII())
+	fmt.Println("🗺️", *settlement, len(settlementMap.Districts), "districts", len(settlementMap.Landmarks), "landmarks", len(settlementMap.Homes), "homes", exportPath, tiledPath)
+	return nil
+}
+
+// writeJSONFile writes the indented JSON of the value
+func writeJSONFile(path string, value any) error {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ollama/ollama/api"
+)
+
+// PriceRange is the price range of a rarity, in the currency of the economy
+type PriceRange struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+}
+
+// SettlementSize is the trade of the settlements up to a population:
+// the rarities the shops can sell, the number of items and the stock of an item
+type SettlementSize struct {
+	Name          string   `json:"name"`
+	MaxPopulation int      `json:"max_population"`
+	Rarities      []string `json:"rarities"`
+	Items         int      `json:"items"`
+	MaxStock      int      `json:"max_stock"`
+}
+
+// Economy is the economy table (SHOP_ECONOMY): the prices per rarity
+// and the settlement sizes, from the smallest to the largest
+type Economy struct {
+	Currency string                `json:"currency"`
+	Prices   map[string]PriceRange `json:"prices"`
+	Sizes    []SettlementSize      `json:"sizes"`
+}
+
+var defaultEconomy = Economy{
+	Currency: "gp",
+	Prices: map[string]PriceRange{
+		"common":    {Min: 1, Max: 50},
+		"uncommon":  {Min: 50, Max: 500},
+		"rare":      {Min: 500, Max: 5000},
+		"very rare": {Min: 5000, Max: 50000},
+	},
+	Sizes: []SettlementSize{
+		{Name: "hamlet", MaxPopulation: 50, Rarities: []string{"common"}, Items: 6, MaxStock: 5},
+		{Name: "village", MaxPopulation: 200, Rarities: []string{"common", "uncommon"}, Items: 8, MaxStock: 10},
+		{Name: "town", MaxPopulation: 600, Rarities: []string{"common", "uncommon", "rare"}, Items: 10, MaxStock: 20},
+		{Name: "city", Rarities: []string{"common", "uncommon", "rare", "very rare"}, Items: 12, MaxStock: 50},
+	},
+}
+
+// LoadEconomy reads the economy table (SHOP_ECONOMY),
+// the built-in table is used when there is no file
+func LoadEconomy(path string) (Economy, error) {
+	if path == "" {
+		return defaultEconomy, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return defaultEconomy, nil
+	}
+	if err != nil {
+		return Economy{}, err
+	}
+	economy := Economy{}
+	err = json.Unmarshal(data, &economy)
+	if err != nil {
+		return economy, fmt.Errorf("%s: %w", path, err)
+	}
+	err = economy.check()
+	if err != nil {
+		return economy, fmt.Errorf("%s: %w", path, err)
+	}
+	return economy, nil
+}
+
+// check refuses the empty price ranges and the sizes selling an unknown rarity,
+// the last size has no population limit
+func (e Economy) check() error {
+	for rarity, prices := range e.Prices {
+		if prices.Min < 0 || prices.Max < prices.Min {
+			return fmt.Errorf("the price range of %s is %d-%d", rarity, prices.Min, prices.Max)
+		}
+	}
+	if len(e.Sizes) == 0 {
+		return errors.New("the economy has no settlement size")
+	}
+	for idx, size := range e.Sizes {
+		if size.Items < 1 || size.MaxStock < 1 {
+			return fmt.Errorf("the %s shops need items and stock", size.Name)
+		}
+		if idx < len(e.Sizes)-1 && size.MaxPopulation <= 0 {
+			return fmt.Errorf("the %s size has no max_population", size.Name)
+		}
+		for _, rarity := range size.Rarities {
+			if _, ok := e.Prices[rarity]; !ok {
+				return fmt.Errorf("the %s shops sell the unknown rarity %q", size.Name, rarity)
+			}
+		}
+	}
+	return nil
+}
+
+// Size returns the settlement size of a population
+func (e Economy) Size(population int) SettlementSize {
+	for _, size := range e.Sizes {
+		if size.MaxPopulation <= 0 || population <= size.MaxPopulation {
+			return size
+		}
+	}
+	return e.Sizes[len(e.Sizes)-1]
+}
+
+// FindSize returns the settlement size by its name
+func (e Economy) FindSize(name string) (SettlementSize, error) {
+	names := []string{}
+	for _, size := range e.Sizes {
+		if strings.EqualFold(size.Name, name) {
+			return size, nil
+		}
+		names = append(names, size.Name)
+	}
+	return SettlementSize{}, fmt.Errorf("unknown settlement size %q (%s)", name, strings.Join(names, ", "))
+}
+
+// ShopItem is an item of the inventory, Equipment is the slot (weapon or armor)
+// of an item of the equipment allow-lists
+type ShopItem struct {
+	Name      string `json:"name"`
+	Category  string `json:"category"`
+	Rarity    string `json:"rarity"`
+	Price     int    `json:"price"`
+	Stock     int    `json:"stock"`
+	Equipment string `json:"equipment,omitempty"`
+}
+
+// Shop is a merchant of a settlement and the inventory of the shop
+type Shop struct {
+	Name       string     `json:"name"`
+	Settlement string     `json:"settlement,omitempty"`
+	Size       string     `json:"size"`
+	Currency   string     `json:"currency"`
+	Merchant   string     `json:"merchant"`
+	MerchantID int        `json:"merchant_id,omitempty"`
+	Inventory  []ShopItem `json:"inventory"`
+}
+
+// Validate checks an item against the economy and the settlement size
+func (e Economy) Validate(size SettlementSize, item ShopItem) error {
+	if strings.TrimSpace(item.Name) == "" {
+		return ErrEmptyAnswer
+	}
+	if !slices.Contains(size.Rarities, item.Rarity) {
+		return fmt.Errorf("a %s shop can't sell the %s item %q", size.Name, item.Rarity, item.Name)
+	}
+	prices := e.Prices[item.Rarity]
+	if item.Price < prices.Min || item.Price > prices.Max {
+		return fmt.Errorf("the price of the %s item %q is %d %s, expected %d-%d", item.Rarity, item.Name, item.Price, e.Currency, prices.Min, prices.Max)
+	}
+	if item.Stock < 1 || item.Stock > size.MaxStock {
+		return fmt.Errorf("the stock of %q is %d, expected 1-%d", item.Name, item.Stock, size.MaxStock)
+	}
+	return nil
+}
+
+// equipmentSlot links an item to the equipment allow-lists: "weapon", "armor" or ""
+func equipmentSlot(rules EquipmentRules, name string) string {
+	for _, allowList := range rules {
+		if slices.ContainsFunc(allowList.Weapons, func(weapon string) bool { return strings.EqualFold(weapon, name) }) {
+			return "weapon"
+		}
+		if slices.ContainsFunc(allowList.Armors, func(armor string) bool { return strings.EqualFold(armor, name) }) {
+			return "armor"
+		}
+	}
+	return ""
+}
+
+// shopSchema restricts the rarities to the ones of the settlement size
+func shopSchema(size SettlementSize) map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"name": map[string]any{"type": "string"},
+			"inventory": map[string]any{
+				"type": "array",
+				"items": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"name":     map[string]any{"type": "string"},
+						"category": map[string]any{"type": "string"},
+						"rarity":   map[string]any{"type": "string", "enum": size.Rarities},
+						"price":    map[string]any{"type": "integer"},
+						"stock":    map[string]any{"type": "integer"},
+					},
+					"required": []string{"name", "category", "rarity", "price", "stock"},
+				},
+				"minItems": 1,
+				"maxItems": size.Items,
+			},
+		},
+		"required": []string{"name", "inventory"},
+	}
+}
+
+// GenerateShop asks for the name and the inventory of the shop of the merchant (3 attempts),
+// the items out of the economy are dropped
+func (g *Generator) GenerateShop(ctx context.Context, economy Economy, size SettlementSize, merchant Character, trade string) (Shop, error) {
+	shop := Shop{Settlement: merchant.Settlement, Size: size.Name, Currency: economy.Currency, Merchant: merchant.Name, MerchantID: merchant.ID}
+
+	userContent := fmt.Sprintf("Generate the name of the shop of %s, a %s merchant of a %s, and its inventory of up to %d items.", merchant.Name, merchant.Kind, size.Name, size.Items)
+	if trade != "" {
+		userContent += fmt.Sprintf("\nThe shop sells %s.", trade)
+	}
+	userContent += fmt.Sprintf("\nThe prices are in %s:", economy.Currency)
+	for _, rarity := range size.Rarities {
+		prices := economy.Prices[rarity]
+		userContent += fmt.Sprintf("\n- %s items: %d to %d", rarity, prices.Min, prices.Max)
+	}
+	userContent += fmt.Sprintf("\nThe stock of an item is 1 to %d, the rarer the item, the lower the stock.", size.MaxStock)
+	allowList := []string{}
+	for _, class := range g.equipmentRules {
+		allowList = append(allowList, class.Weapons...)
+		allowList = append(allowList, class.Armors...)
+	}
+	if len(allowList) > 0 {
+		slices.Sort(allowList)
+		userContent += "\nThe weapons and armors are named like these ones: " + strings.Join(slices.Compact(allowList), ", ") + "."
+	}
+	messages := []api.Message{
+		{Role: "system", Content: g.genre.Instructions},
+		{Role: "user", Content: userContent},
+	}
+	options := map[string]interface{}{"temperature": 0.8}
+
+	for attempt := 0; attempt < 3; attempt++ {
+		answer, err := g.chat(ctx, DomainShop, messages, shopSchema(size), options)
+		if err != nil {
+			return shop, err
+		}
+		if answer.Truncated {
+			continue
+		}
+		answered := struct {
+			Name      string     `json:"name"`
+			Inventory []ShopItem `json:"inventory"`
+		}{}
+		err = decodeAnswer(answer.Content, &answered)
+		if err == nil && len(answered.Inventory) == 0 {
+			err = ErrEmptyAnswer
+		}
+		if err != nil {
+			fmt.Println("😡 shop:", err)
+			continue
+		}
+		shop.Name = strings.TrimSpace(answered.Name)
+		shop.Inventory = []ShopItem{}
+		for _, item := range answered.Inventory {
+			item.Name = strings.TrimSpace(item.Name)
+			err = economy.Validate(size, item)
+			if err != nil {
+				fmt.Println("🚫 item:", err)
+				continue
+			}
+			item.Equipment = equipmentSlot(g.equipmentRules, item.Name)
+			shop.Inventory = append(shop.Inventory, item)
+		}
+		if len(shop.Inventory) == 0 {
+			fmt.Println("🚫 shop: no item in the economy")
+			continue
+		}
+		return shop, nil
+	}
+	return shop, fmt.Errorf("no valid inventory for %s after 3 attempts", merchant.Name)
+}
+
+// ShopMarkdown renders the merchant and the inventory of the shop
+func ShopMarkdown(shop Shop) string {
+	markdown := "# " + escapeMarkdown(shop.Name) + "\n\n"
+	markdown += "**Merchant**: " + escapeMarkdown(shop.Merchant)
+	if shop.Settlement != "" {
+		markdown += " (" + escapeMarkdown(shop.Settlement) + ", " + shop.Size + ")"
+	} else {
+		markdown += " (" + shop.Size + ")"
+	}
+	markdown += "\n\n| Item | Category | Rarity | Price | Stock |\n|---|---|---|---|---|\n"
+	for _, item := range shop.Inventory {
+		name := escapeMarkdown(item.Name)
+		if item.Equipment != "" {
+			name += " (" + item.Equipment + ")"
+		}
+		markdown += fmt.Sprintf("| %s | %s | %s | %d %s | %d |\n", name, escapeMarkdown(item.Category), item.Rarity, item.Price, shop.Currency, item.Stock)
+	}
+	return markdown
+}
+
+// runShop generates a merchant of the settlement and the inventory of the shop:
+// shop --kind dwarf --settlement Ironhold --population 300 --trade "weapons and armors"
+func (a *App) runShop(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("shop", flag.ExitOnError)
+	campaign := flags.String("campaign", getEnv("CAMPAIGN", DefaultCampaign), "campaign of the merchant")
+	kind := flags.String("kind", getEnv("KIND", "human"), "kind of the merchant")
+	settlement := flags.String("settlement", "", "settlement of the shop")
+	population := flags.Int("population", 0, "population of the settlement, gives its size")
+	sizeName := flags.String("size", "", "settlement size, instead of the population (hamlet, village, town, city)")
+	trade := flags.String("trade", "", "goods of the shop (default: general store)")
+	flags.Parse(args)
+
+	economy := a.generator.economy
+	size := economy.Size(*population)
+	if *sizeName != "" {
+		var err error
+		size, err = economy.FindSize(*sizeName)
+		if err != nil {
+			return err
+		}
+	}
+	registry, err := a.storage.Registry(*campaign)
+	if err != nil {
+		return err
+	}
+
+	run := NewRun(a.generator, registry.Deduper(), Spec{Kind: *kind, Level: 1, Count: 1})
+	slots, err := run.Generate(ctx)
+	if err != nil {
+		return err
+	}
+	if slots[0].Status == SlotOK {
+		slots[0].Character.Settlement = *settlement
+	}
+	err = StoreSlots(registry, slots)
+	if err != nil {
+		return err
+	}
+	if slots[0].Status != SlotOK {
+		return fmt.Errorf("no merchant: %s", slots[0].Reason)
+	}
+	merchant := *slots[0].Character
+
+	shop, err := a.generator.GenerateShop(ctx, economy, size, merchant, *trade)
+	if err != nil {
+		return err
+	}
+	slug := Slug(shop.Name)
+	if slug == "" {
+		slug = "shop-" + strconv.Itoa(merchant.ID)
+	}
+	exportPath, err := a.storage.ExportPath(*campaign, "shops", slug+".json")
+	if err != nil {
+		return err
+	}
+	err = writeExport(exportPath, shop, ShopMarkdown(shop))
+	if err != nil {
+		return err
+	}
+	fmt.Println("🛒", shop.Name, "of", merchant.Name, len(shop.Inventory), "items", exportPath)
+	return nil
+}
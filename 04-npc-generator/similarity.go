@@ -0,0 +1,340 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"unicode"
+
+	"04-npc-generator/vector"
+
+	"github.com/ollama/ollama/api"
+)
+
+// Strategies of the dedup (DEDUP, comma-separated and stacked: folded,levenshtein:1)
+const (
+	DedupExact       = "exact"       // the same name, ignoring the case (always checked)
+	DedupFolded      = "folded"      // the same name, ignoring the case and the diacritics (Þórin is Thorin)
+	DedupLevenshtein = "levenshtein" // at most n edits between the folded names (levenshtein:2)
+	DedupEmbedding   = "embedding"   // a cosine similarity of the embeddings of at least t (embedding:0.95)
+)
+
+// DedupStrategy creates the deduplicator of a strategy for every deduper
+type DedupStrategy struct {
+	Name string
+	New  func() Deduplicator
+	// Save persists the state shared by the deduplicators (nil: nothing to save)
+	Save func() error
+}
+
+// embedFunc returns the embeddings of the texts (EMBEDDING_MODEL)
+type embedFunc func(ctx context.Context, texts []string) ([][]float32, error)
+
+// ParseDedup returns the strategies of DEDUP, the exact match is always checked
+// so it is not a strategy of the list; embed is only called by the embedding strategy,
+// its index of the names is saved in indexPath ("": kept in memory)
+func ParseDedup(value string, embed embedFunc, indexPath string, options vector.Options) ([]DedupStrategy, error) {
+	strategies := []DedupStrategy{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		kind, setting, _ := strings.Cut(entry, ":")
+		var strategy DedupStrategy
+		switch kind {
+		case "", DedupExact:
+			continue
+		case DedupFolded:
+			strategy = DedupStrategy{Name: DedupFolded, New: func() Deduplicator { return &foldedDedup{seen: map[string]string{}} }}
+		case DedupLevenshtein:
+			distance, err := strconv.Atoi(cmp.Or(setting, "1"))
+			if err != nil || distance < 1 {
+				return nil, fmt.Errorf("invalid dedup %q (levenshtein:<edits>, at least 1)", entry)
+			}
+			strategy = DedupStrategy{Name: DedupLevenshtein + ":" + strconv.Itoa(distance), New: func() Deduplicator {
+				return &levenshteinDedup{distance: distance}
+			}}
+		case DedupEmbedding:
+			threshold, err := strconv.ParseFloat(cmp.Or(setting, "0.95"), 64)
+			if err != nil || threshold <= 0 || threshold > 1 {
+				return nil, fmt.Errorf("invalid dedup %q (embedding:<cosine similarity>, from 0 to 1)", entry)
+			}
+			cache := newEmbeddingCache(embed, indexPath, options)
+			strategy = DedupStrategy{Name: DedupEmbedding + ":" + strconv.FormatFloat(threshold, 'f', -1, 64), New: func() Deduplicator {
+				return &embeddingDedup{cache: cache, threshold: threshold, names: map[string]string{}, index: vector.New(options)}
+			}, Save: cache.Save}
+		default:
+			return nil, fmt.Errorf("unknown dedup %q (%s, %s, %s:<edits>, %s:<similarity>)", entry, DedupExact, DedupFolded, DedupLevenshtein, DedupEmbedding)
+		}
+		if slices.ContainsFunc(strategies, func(other DedupStrategy) bool { return other.Name == strategy.Name }) {
+			continue
+		}
+		strategies = append(strategies, strategy)
+	}
+	return strategies, nil
+}
+
+// foldName is the lowercase ASCII form of the name for the comparisons (the letters without one are kept)
+func foldName(name string) string {
+	builder := strings.Builder{}
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		if ascii, ok := asciiLetter(r); ok && !unicode.IsSpace(r) {
+			builder.WriteString(strings.ToLower(ascii))
+			continue
+		}
+		builder.WriteRune(r)
+	}
+	return strings.Join(strings.Fields(builder.String()), " ")
+}
+
+// foldedDedup matches the same name ignoring the case and the diacritics
+type foldedDedup struct {
+	seen map[string]string
+}
+
+func (f *foldedDedup) Name() string {
+	return DedupFolded
+}
+
+func (f *foldedDedup) Match(ctx context.Context, name string) string {
+	return f.seen[foldName(name)]
+}
+
+func (f *foldedDedup) Add(ctx context.Context, name string) {
+	f.seen[foldName(name)] = name
+}
+
+func (f *foldedDedup) Remove(name string) {
+	delete(f.seen, foldName(name))
+}
+
+// levenshteinDedup matches the names at most distance edits away from the name (the folded forms),
+// every name is compared: a match costs a pass over the remembered names
+type levenshteinDedup struct {
+	distance int
+	names    []string
+	folded   [][]rune
+}
+
+func (l *levenshteinDedup) Name() string {
+	return DedupLevenshtein + ":" + strconv.Itoa(l.distance)
+}
+
+func (l *levenshteinDedup) Match(ctx context.Context, name string) string {
+	target := []rune(foldName(name))
+	for idx, folded := range l.folded {
+		if levenshtein(target, folded, l.distance) <= l.distance {
+			return l.names[idx]
+		}
+	}
+	return ""
+}
+
+func (l *levenshteinDedup) Add(ctx context.Context, name string) {
+	l.names = append(l.names, name)
+	l.folded = append(l.folded, []rune(foldName(name)))
+}
+
+func (l *levenshteinDedup) Remove(name string) {
+	idx := slices.Index(l.names, name)
+	if idx >= 0 {
+		l.names = slices.Delete(l.names, idx, idx+1)
+		l.folded = slices.Delete(l.folded, idx, idx+1)
+	}
+}
+
+// levenshtein returns the edit distance of a and b, or limit+1 as soon as it is above limit
+func levenshtein(a, b []rune, limit int) int {
+	if abs(len(a)-len(b)) > limit {
+		return limit + 1
+	}
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		lowest := current[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+			lowest = min(lowest, current[j])
+		}
+		if lowest > limit {
+			return limit + 1
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+func abs(value int) int {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
+
+// embeddingCache keeps the embeddings of the names in a vector index shared by the dedupers
+// of the runs; the index is saved in DATA_DIR so the names are embedded once
+// (no lock is held during the requests, the runs of the other users don't wait for them)
+type embeddingCache struct {
+	embed embedFunc
+	index *vector.Index
+	// path is the file of the index ("": not saved)
+	path    string
+	changed atomic.Bool
+}
+
+// newEmbeddingCache loads the index of the names, a broken file is built again
+func newEmbeddingCache(embed embedFunc, path string, options vector.Options) *embeddingCache {
+	cache := &embeddingCache{embed: embed, index: vector.New(options), path: path}
+	if path == "" {
+		return cache
+	}
+	index, err := vector.Load(path, options)
+	if err != nil {
+		fmt.Println("⚠️ the names index is built again:", err)
+		return cache
+	}
+	cache.index = index
+	return cache
+}
+
+// Save writes the index when names were embedded since the last save
+func (c *embeddingCache) Save() error {
+	if c.path == "" || !c.changed.Swap(false) {
+		return nil
+	}
+	return c.index.Save(c.path)
+}
+
+// lookup returns the embeddings of the names, the missing ones are asked by batches of 64
+// (cacheOnly: only the index is read, the missing names get no embedding); an error is logged
+// and the names without an embedding are left out (the dedup is best effort)
+func (c *embeddingCache) lookup(ctx context.Context, names []string, cacheOnly bool) [][]float32 {
+	missing := []string{}
+	for _, name := range names {
+		if !cacheOnly && !c.index.Has(foldName(name)) && !slices.Contains(missing, foldName(name)) {
+			missing = append(missing, foldName(name))
+		}
+	}
+
+	for batch := range slices.Chunk(missing, 64) {
+		if ctx.Err() != nil {
+			break
+		}
+		embeddings, err := c.embed(ctx, batch)
+		if err == nil && len(embeddings) != len(batch) {
+			err = fmt.Errorf("%d embeddings for %d names", len(embeddings), len(batch))
+		}
+		if err != nil {
+			fmt.Println("😡 embedding dedup:", err)
+			break
+		}
+		for idx, name := range batch {
+			err = c.index.Add(name, embeddings[idx])
+			if err != nil {
+				fmt.Println("😡 embedding dedup:", err)
+				break
+			}
+			c.changed.Store(true)
+		}
+	}
+
+	vectors := make([][]float32, len(names))
+	for idx, name := range names {
+		vectors[idx], _ = c.index.Get(foldName(name))
+	}
+	return vectors
+}
+
+// embeddingDedup matches the names with a cosine similarity of at least threshold,
+// a match costs an embedding of the name (cached) and a search of the closest remembered name
+type embeddingDedup struct {
+	cache     *embeddingCache
+	threshold float64
+	// names are the remembered names by folded name
+	names map[string]string
+	// index holds the embeddings of the remembered names only: the cache has the names of every
+	// campaign, they would take the places of the closest names of this one in a search
+	index *vector.Index
+}
+
+func (e *embeddingDedup) Name() string {
+	return DedupEmbedding + ":" + strconv.FormatFloat(e.threshold, 'f', -1, 64)
+}
+
+// Prepare embeds the names before the lock of the deduper
+func (e *embeddingDedup) Prepare(ctx context.Context, names []string) {
+	e.cache.lookup(ctx, names, false)
+}
+
+// Match only reads the embeddings of Prepare, a name without one is new
+func (e *embeddingDedup) Match(ctx context.Context, name string) string {
+	embedding := e.cache.lookup(ctx, []string{name}, true)[0]
+	if embedding == nil {
+		return ""
+	}
+	results, err := e.index.Search(embedding, 1)
+	if err != nil {
+		fmt.Println("😡 embedding dedup:", err)
+		return ""
+	}
+	if len(results) == 0 || results[0].Score < e.threshold {
+		return ""
+	}
+	return e.names[results[0].ID]
+}
+
+// Add only reads the embedding of Prepare, a name without one is not remembered
+func (e *embeddingDedup) Add(ctx context.Context, name string) {
+	e.remember([]string{name}, e.cache.lookup(ctx, []string{name}, true))
+}
+
+// AddAll embeds the names (without the lock of the deduper, Use remembers the names of a new strategy)
+func (e *embeddingDedup) AddAll(ctx context.Context, names []string) {
+	e.remember(names, e.cache.lookup(ctx, names, false))
+}
+
+func (e *embeddingDedup) remember(names []string, embeddings [][]float32) {
+	for idx, embedding := range embeddings {
+		if embedding == nil {
+			continue
+		}
+		err := e.index.Add(foldName(names[idx]), embedding)
+		if err != nil {
+			fmt.Println("😡 embedding dedup:", err)
+			continue
+		}
+		e.names[foldName(names[idx])] = names[idx]
+	}
+}
+
+// Remove forgets the name, its embedding stays in the cache
+func (e *embeddingDedup) Remove(name string) {
+	if e.names[foldName(name)] == name {
+		delete(e.names, foldName(name))
+		e.index.Remove(foldName(name))
+		if e.index.Deleted() > e.index.Len()/4 {
+			e.index.Compact()
+		}
+	}
+}
+
+// nameEmbedder embeds the names with the embedding model
+func nameEmbedder(client *api.Client, model string) embedFunc {
+	return func(ctx context.Context, texts []string) ([][]float32, error) {
+		response, err := client.Embed(ctx, &api.EmbedRequest{Model: model, Input: texts})
+		if err != nil {
+			return nil, fmt.Errorf("embeddings of the names (%s): %w", model, err)
+		}
+		return response.Embeddings, nil
+	}
+}
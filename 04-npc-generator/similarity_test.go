@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"04-npc-generator/vector"
+)
+
+// syntheticNames returns count distinct names combined from syllables, the names of the benchmarks
+func syntheticNames(count int, random *rand.Rand) []string {
+	starts := []string{"Bal", "Dur", "Thor", "Kor", "El", "Ar", "Gim", "Fal", "Mor", "Ser", "Val", "Ith", "Bran", "Cal", "Dag", "Hal"}
+	middles := []string{"", "a", "e", "i", "o", "ra", "li", "nd", "gr", "th"}
+	ends := []string{"in", "or", "ar", "im", "wen", "iel", "ric", "ulf", "gar", "dor", "mir", "ros", "ak", "eth"}
+	seen := map[string]bool{}
+	names := []string{}
+	for len(names) < count {
+		name := starts[random.IntN(len(starts))] + middles[random.IntN(len(middles))] + ends[random.IntN(len(ends))]
+		family := starts[random.IntN(len(starts))] + ends[random.IntN(len(ends))]
+		name += " " + family + strconv.Itoa(random.IntN(1000))
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+var (
+	benchSizes      = []int{10000, 50000}
+	benchStrategies = []string{"exact", "folded", "levenshtein:1", "levenshtein:2", "embedding:0.95"}
+)
+
+// benchDeduper remembers the names with the strategy, the embeddings are bigrams computed locally
+func benchDeduper(b *testing.B, strategy string, names []string) *Deduper {
+	b.Helper()
+	strategies, err := ParseDedup(strategy, bigramEmbed(&atomic.Int32{}, nil), "", vector.DefaultOptions)
+	if err != nil {
+		b.Fatal(err)
+	}
+	ctx := context.Background()
+	deduper := NewDeduper()
+	for _, name := range names {
+		deduper.Add(ctx, name)
+	}
+	deduper.Use(ctx, strategies...)
+	return deduper
+}
+
+// BenchmarkDedupRemember is the cost of a new run: the stored names are loaded in the strategy
+func BenchmarkDedupRemember(b *testing.B) {
+	for _, size := range benchSizes {
+		names := syntheticNames(size, rand.New(rand.NewPCG(42, 0)))
+		for _, strategy := range benchStrategies {
+			if strategy == "embedding:0.95" && size > 10000 {
+				continue
+			}
+			b.Run(fmt.Sprintf("%s/%d", strategy, size), func(b *testing.B) {
+				for range b.N {
+					benchDeduper(b, strategy, names)
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkDedupCheck is the cost of the dedup of a generated name
+func BenchmarkDedupCheck(b *testing.B) {
+	ctx := context.Background()
+	for _, size := range benchSizes {
+		names := syntheticNames(size+1000, rand.New(rand.NewPCG(42, 0)))
+		stored, candidates := names[:size], names[size:]
+		for _, strategy := range benchStrategies {
+			b.Run(fmt.Sprintf("%s/%d", strategy, size), func(b *testing.B) {
+				deduper := benchDeduper(b, strategy, stored)
+				// the candidates are embedded once, like the names of a run
+				for _, name := range candidates {
+					deduper.Seen(ctx, name)
+				}
+				b.ResetTimer()
+				for idx := range b.N {
+					deduper.Seen(ctx, candidates[idx%len(candidates)])
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,237 @@
+//go:build !minimal
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"04-npc-generator/model"
+)
+
+// Publisher sends a message to a broker (NATS subject or Kafka topic)
+type Publisher interface {
+	Publish(ctx context.Context, topic, key string, payload []byte) error
+	Close() error
+}
+
+// permanentError is a publication the sink doesn't retry (a refused payload)
+type permanentError struct {
+	error
+}
+
+func (e permanentError) Unwrap() error {
+	return e.error
+}
+
+// NewPublisher returns the publisher of the sink url: nats://[user:password@]host:4222 (nats+tls:// for TLS),
+// kafka://host:8082 (the Kafka REST proxy) or webhook://host/path (signed with SINK_WEBHOOK_SECRET)
+func NewPublisher(sinkURL string, transport http.RoundTripper) (Publisher, error) {
+	parsed, err := url.Parse(sinkURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sink %q: %w", sinkURL, err)
+	}
+	switch parsed.Scheme {
+	case "nats", "nats+tls":
+		return NewNATSPublisher(parsed), nil
+	case "kafka", "kafka+https":
+		return NewKafkaPublisher(parsed, transport), nil
+	case "webhook", "webhook+https":
+		return NewWebhookPublisher(parsed, os.Getenv("SINK_WEBHOOK_SECRET"), transport), nil
+	}
+	return nil, fmt.Errorf("unknown sink %q (nats://, nats+tls://, kafka://, kafka+https://, webhook://, webhook+https://)", sinkURL)
+}
+
+// SinkFields are the fields of the subject or topic template
+type SinkFields struct {
+	Campaign string
+	Kind     string
+}
+
+type sinkMessage struct {
+	topic   string
+	key     string
+	payload []byte
+}
+
+// Sink publishes the stored characters in the background: the queue holds buffer messages,
+// when it is full the generation waits for the broker (backpressure), and every message
+// is retried with a backoff before it counts as lost (and goes to the dead-letter file)
+type Sink struct {
+	publisher Publisher
+	topic     *template.Template
+	queue     chan sinkMessage
+	done      chan struct{}
+	// retry is the backoff of the publications (SINK_RETRY_*)
+	retry RetryClass
+	// deadLetter is the JSONL file of the lost messages (SINK_DEAD_LETTER, "": none)
+	deadLetter string
+
+	mutex     sync.Mutex
+	published int
+	lost      int
+	lastError error
+}
+
+// NewSink starts the publication of the sink url, topic is a template of the subject or topic
+func NewSink(sinkURL, topic string, buffer int, transport http.RoundTripper) (*Sink, error) {
+	publisher, err := NewPublisher(sinkURL, transport)
+	if err != nil {
+		return nil, err
+	}
+	topicTemplate, err := template.New("topic").Option("missingkey=error").Parse(topic)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sink topic %q: %w", topic, err)
+	}
+	retry, err := sinkRetry()
+	if err != nil {
+		return nil, err
+	}
+	sink := &Sink{
+		publisher:  publisher,
+		topic:      topicTemplate,
+		queue:      make(chan sinkMessage, max(buffer, 1)),
+		done:       make(chan struct{}),
+		retry:      retry,
+		deadLetter: os.Getenv("SINK_DEAD_LETTER"),
+	}
+	go sink.run()
+	return sink, nil
+}
+
+// Publish queues the character, it blocks while the queue is full
+func (s *Sink) Publish(ctx context.Context, campaign string, character Character) error {
+	topic := strings.Builder{}
+	// the subjects and the topics have no spaces: Street Samurai is street-samurai
+	err := s.topic.Execute(&topic, SinkFields{Campaign: campaign, Kind: model.NormalizeTag(character.Kind)})
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(character)
+	if err != nil {
+		return err
+	}
+	message := sinkMessage{topic: topic.String(), key: character.Code, payload: payload}
+
+	select {
+	case s.queue <- message:
+		return nil
+	default:
+	}
+	fmt.Println("⏳ the sink is behind, the generation waits")
+	select {
+	case s.queue <- message:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// sinkRetry is the backoff of the publications: SINK_RETRY_ATTEMPTS (5),
+// SINK_RETRY_BACKOFF (0.5s, doubled at every attempt) and SINK_RETRY_MAX_BACKOFF (30s)
+func sinkRetry() (RetryClass, error) {
+	attempts, err := strconv.Atoi(getEnv("SINK_RETRY_ATTEMPTS", "5"))
+	if err != nil || attempts < 1 {
+		return RetryClass{}, fmt.Errorf("SINK_RETRY_ATTEMPTS must be 1 or more")
+	}
+	backoff, err := time.ParseDuration(getEnv("SINK_RETRY_BACKOFF", "500ms"))
+	if err != nil {
+		return RetryClass{}, fmt.Errorf("SINK_RETRY_BACKOFF: %w", err)
+	}
+	maxBackoff, err := time.ParseDuration(getEnv("SINK_RETRY_MAX_BACKOFF", "30s"))
+	if err != nil {
+		return RetryClass{}, fmt.Errorf("SINK_RETRY_MAX_BACKOFF: %w", err)
+	}
+	return RetryClass{Retry: true, Attempts: attempts, Backoff: Duration(backoff), MaxBackoff: Duration(maxBackoff), Multiplier: 2}, nil
+}
+
+// run publishes the queued messages with the backoff of the sink,
+// a permanent error (a refused payload) is not retried
+func (s *Sink) run() {
+	defer close(s.done)
+	for message := range s.queue {
+		var err error
+		for attempt := 0; ; attempt++ {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			err = s.publisher.Publish(ctx, message.topic, message.key, message.payload)
+			cancel()
+			if err == nil || errors.As(err, &permanentError{}) || attempt+1 >= s.retry.Attempts {
+				break
+			}
+			delay := s.retry.delay(attempt)
+			fmt.Printf("📮 %s, retry in %s\n", err, delay)
+			time.Sleep(delay)
+		}
+		s.mutex.Lock()
+		if err == nil {
+			s.published++
+		} else {
+			fmt.Println("😡 sink:", err)
+			s.lost++
+			s.lastError = err
+			deadErr := s.writeDeadLetter(message, err)
+			if deadErr != nil {
+				fmt.Println("😡 dead letter:", deadErr)
+			}
+		}
+		s.mutex.Unlock()
+	}
+}
+
+// deadLetter is a lost message, it can be published again from the file
+type deadLetter struct {
+	Topic   string          `json:"topic"`
+	Key     string          `json:"key"`
+	Payload json.RawMessage `json:"payload"`
+	Error   string          `json:"error"`
+	At      time.Time       `json:"at"`
+}
+
+// writeDeadLetter appends the lost message to the dead-letter file
+func (s *Sink) writeDeadLetter(message sinkMessage, lost error) error {
+	if s.deadLetter == "" {
+		return nil
+	}
+	line, err := json.Marshal(deadLetter{Topic: message.topic, Key: message.key, Payload: message.payload, Error: lost.Error(), At: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(s.deadLetter, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(line, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Close publishes the queued messages and closes the connection,
+// the lost messages are an error
+func (s *Sink) Close() error {
+	close(s.queue)
+	<-s.done
+	err := s.publisher.Close()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	fmt.Printf("📮 %d characters published\n", s.published)
+	if s.lost > 0 && s.deadLetter != "" {
+		return fmt.Errorf("%d characters not published (in %s): %w", s.lost, s.deadLetter, s.lastError)
+	}
+	if s.lost > 0 {
+		return fmt.Errorf("%d characters not published: %w", s.lost, s.lastError)
+	}
+	return err
+}
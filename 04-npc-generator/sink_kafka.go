@@ -0,0 +1,88 @@
+//go:build !minimal
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// KafkaPublisher produces the records through the Kafka REST proxy (v2 API),
+// the generator has no Kafka client
+type KafkaPublisher struct {
+	base   string
+	client *http.Client
+}
+
+func NewKafkaPublisher(kafkaURL *url.URL, transport http.RoundTripper) *KafkaPublisher {
+	scheme := "http"
+	if kafkaURL.Scheme == "kafka+https" {
+		scheme = "https"
+	}
+	base := url.URL{Scheme: scheme, Host: kafkaURL.Host, Path: kafkaURL.Path, User: kafkaURL.User}
+	return &KafkaPublisher{base: strings.TrimSuffix(base.String(), "/"), client: &http.Client{Transport: transport}}
+}
+
+type kafkaRecords struct {
+	Records []kafkaRecord `json:"records"`
+}
+
+type kafkaRecord struct {
+	Key   string          `json:"key,omitempty"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Publish produces a record keyed by the table code (the records of a character keep their order),
+// a 408, a 429 or a 5xx of the proxy is retried by the sink, the other 4xx are permanent (a refused record)
+func (p *KafkaPublisher) Publish(ctx context.Context, topic, key string, payload []byte) error {
+	body, err := json.Marshal(kafkaRecords{Records: []kafkaRecord{{Key: key, Value: payload}}})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.base+"/topics/"+url.PathEscape(topic), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		err = fmt.Errorf("kafka: %s: %s", resp.Status, strings.TrimSpace(string(message)))
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+			return permanentError{err}
+		}
+		return err
+	}
+	// a record can fail in a successful response
+	produced := struct {
+		Offsets []struct {
+			ErrorCode *int   `json:"error_code"`
+			Error     string `json:"error"`
+		} `json:"offsets"`
+	}{}
+	err = json.NewDecoder(resp.Body).Decode(&produced)
+	if err != nil {
+		return fmt.Errorf("kafka: %w", err)
+	}
+	for _, offset := range produced.Offsets {
+		if offset.ErrorCode != nil && *offset.ErrorCode != 0 {
+			return fmt.Errorf("kafka: %s (%d)", offset.Error, *offset.ErrorCode)
+		}
+	}
+	return nil
+}
+
+func (p *KafkaPublisher) Close() error {
+	return nil
+}
@@ -0,0 +1,157 @@
+//go:build !minimal
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// natsTransientErrors are the -ERR of the server worth a new connection, the others
+// (a payload over the maximum, a permissions or an authorization violation) are permanent
+var natsTransientErrors = []string{"stale connection", "maximum connections exceeded", "slow consumer"}
+
+// NATSPublisher speaks the text protocol of NATS: every PUB is followed by a PING,
+// the PONG means the server has processed the message; the connection is upgraded
+// to TLS with nats+tls:// or when the server requires it
+type NATSPublisher struct {
+	url    *url.URL
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func NewNATSPublisher(natsURL *url.URL) *NATSPublisher {
+	return &NATSPublisher{url: natsURL}
+}
+
+func (p *NATSPublisher) connect(ctx context.Context) error {
+	host := p.url.Host
+	if p.url.Port() == "" {
+		host = net.JoinHostPort(p.url.Hostname(), "4222")
+	}
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return err
+	}
+	p.conn, p.reader = conn, bufio.NewReader(conn)
+
+	// the server starts with its INFO
+	line, err := p.readLine(ctx)
+	if err != nil {
+		p.Close()
+		return err
+	}
+	info := struct {
+		TLSRequired bool `json:"tls_required"`
+	}{}
+	if !strings.HasPrefix(line, "INFO ") || json.Unmarshal([]byte(strings.TrimPrefix(line, "INFO ")), &info) != nil {
+		p.Close()
+		return fmt.Errorf("nats: unexpected %q", line)
+	}
+	if info.TLSRequired || p.url.Scheme == "nats+tls" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: p.url.Hostname(), MinVersion: tls.VersionTLS12})
+		err = tlsConn.HandshakeContext(ctx)
+		if err != nil {
+			p.Close()
+			return fmt.Errorf("nats: TLS handshake (the server requires TLS: %v): %w", info.TLSRequired, err)
+		}
+		p.conn, p.reader = tlsConn, bufio.NewReader(tlsConn)
+	}
+	options := map[string]any{"verbose": false, "pedantic": false, "name": "npc-generator", "lang": "go"}
+	if p.url.User != nil {
+		options["user"] = p.url.User.Username()
+		options["pass"], _ = p.url.User.Password()
+	}
+	data, err := json.Marshal(options)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(p.conn, "CONNECT %s\r\nPING\r\n", data)
+	if err == nil {
+		err = p.waitPong(ctx)
+	}
+	if err != nil {
+		p.Close()
+	}
+	return err
+}
+
+func (p *NATSPublisher) readLine(ctx context.Context) (string, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(10 * time.Second)
+	}
+	p.conn.SetReadDeadline(deadline)
+	line, err := p.reader.ReadString('\n')
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+// waitPong reads until the PONG, answering the PINGs of the server
+func (p *NATSPublisher) waitPong(ctx context.Context) error {
+	for {
+		line, err := p.readLine(ctx)
+		if err != nil {
+			return err
+		}
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			_, err = p.conn.Write([]byte("PONG\r\n"))
+			if err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			message := strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "-ERR")), "'")
+			err = fmt.Errorf("nats: %s", message)
+			if !slices.ContainsFunc(natsTransientErrors, func(transient string) bool {
+				return strings.HasPrefix(strings.ToLower(message), transient)
+			}) {
+				err = permanentError{err}
+			}
+			return err
+		}
+	}
+}
+
+// Publish sends the payload to the subject (the key is not used by NATS),
+// a broken connection is opened again by the next attempt
+func (p *NATSPublisher) Publish(ctx context.Context, subject, key string, payload []byte) error {
+	// a space or a line break in the subject would change the PUB command
+	if subject == "" || strings.ContainsFunc(subject, unicode.IsSpace) {
+		return permanentError{fmt.Errorf("nats: invalid subject %q", subject)}
+	}
+	if p.conn == nil {
+		err := p.connect(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(p.conn, "PUB %s %d\r\n%s\r\nPING\r\n", subject, len(payload), payload)
+	if err == nil {
+		err = p.waitPong(ctx)
+	}
+	if err != nil {
+		p.Close()
+	}
+	return err
+}
+
+func (p *NATSPublisher) Close() error {
+	if p.conn == nil {
+		return nil
+	}
+	err := p.conn.Close()
+	p.conn, p.reader = nil, nil
+	return err
+}
@@ -0,0 +1,77 @@
+//go:build !minimal
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// fakeNATS accepts one connection and answers the PING after a PUB with the error
+func fakeNATS(t *testing.T, pubError string) *url.URL {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fmt.Fprint(conn, "INFO {\"server_id\":\"fake\",\"max_payload\":1048576}\r\n")
+		reader := bufio.NewReader(conn)
+		published := false
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch {
+			case strings.HasPrefix(line, "PUB "):
+				published = true
+				reader.ReadString('\n')
+			case strings.HasPrefix(line, "PING"):
+				if published && pubError != "" {
+					fmt.Fprintf(conn, "-ERR '%s'\r\n", pubError)
+					continue
+				}
+				fmt.Fprint(conn, "PONG\r\n")
+			}
+		}
+	}()
+	return &url.URL{Scheme: "nats", Host: listener.Addr().String()}
+}
+
+func TestNATSPublisherErrors(t *testing.T) {
+	ctx := context.Background()
+	for _, testCase := range []struct {
+		pubError, subject string
+		permanent         bool
+	}{
+		{"", "npc.default.dwarf", false},
+		{"Maximum Payload Violation", "npc.default.dwarf", true},
+		{"Permissions Violation for Publish to npc.default.dwarf", "npc.default.dwarf", true},
+		{"Stale Connection", "npc.default.dwarf", false},
+		{"", "npc.default.half elf", true},
+		{"", "npc.default.dwarf\r\nSUB >", true},
+	} {
+		publisher := NewNATSPublisher(fakeNATS(t, testCase.pubError))
+		err := publisher.Publish(ctx, testCase.subject, "THOR", []byte(`{"name":"Thorgar"}`))
+		publisher.Close()
+		if (err == nil) != (testCase.pubError == "" && !testCase.permanent) {
+			t.Errorf("%q %q: %v", testCase.pubError, testCase.subject, err)
+		}
+		if errors.As(err, &permanentError{}) != testCase.permanent {
+			t.Errorf("%q %q: permanent %v, want %v (%v)", testCase.pubError, testCase.subject, !testCase.permanent, testCase.permanent, err)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+//go:build !minimal
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WebhookPublisher posts every character to an HTTP endpoint: webhook://host/path (http)
+// or webhook+https://host/path; with a secret (SINK_WEBHOOK_SECRET) the requests are signed
+type WebhookPublisher struct {
+	url    string
+	secret []byte
+	client *http.Client
+}
+
+func NewWebhookPublisher(webhookURL *url.URL, secret string, transport http.RoundTripper) *WebhookPublisher {
+	scheme := "http"
+	if webhookURL.Scheme == "webhook+https" {
+		scheme = "https"
+	}
+	endpoint := url.URL{Scheme: scheme, Host: webhookURL.Host, Path: webhookURL.Path, RawQuery: webhookURL.RawQuery, User: webhookURL.User}
+	return &WebhookPublisher{url: endpoint.String(), secret: []byte(secret), client: &http.Client{Transport: transport}}
+}
+
+// signWebhook is the HMAC-SHA256 of "<timestamp>.<body>" in hex, the timestamp
+// lets the receiver refuse the replayed requests
+func signWebhook(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Publish posts the character with its topic and its table code in the headers,
+// a 429 or a 5xx is retried by the sink, the other statuses are permanent
+func (p *WebhookPublisher) Publish(ctx context.Context, topic, key string, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-NPC-Topic", topic)
+	req.Header.Set("X-NPC-Key", key)
+	req.Header.Set("X-NPC-Timestamp", timestamp)
+	if len(p.secret) > 0 {
+		req.Header.Set("X-NPC-Signature", signWebhook(p.secret, timestamp, payload))
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("webhook: %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return err
+	}
+	return permanentError{err}
+}
+
+func (p *WebhookPublisher) Close() error {
+	return nil
+}
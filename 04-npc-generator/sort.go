@@ -0,0 +1,101 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+const (
+	SortByOrder = "order" // generation order
+	SortByName  = "name"
+	SortByKind  = "kind" // kind then name
+
+	CollationBinary = "binary"
+	CollationLocale = "locale" // case and accent insensitive
+)
+
+// SortOptions is the order of the characters in every export
+type SortOptions struct {
+	By        string
+	Collation string
+}
+
+func NewSortOptions(by, collation string) (SortOptions, error) {
+	options := SortOptions{By: by, Collation: collation}
+	if !slices.Contains([]string{SortByOrder, SortByName, SortByKind}, by) {
+		return options, fmt.Errorf("unknown sort %q (order, name, kind)", by)
+	}
+	if !slices.Contains([]string{CollationBinary, CollationLocale}, collation) {
+		return options, fmt.Errorf("unknown collation %q (binary, locale)", collation)
+	}
+	return options, nil
+}
+
+// SortCharacters sorts the characters in place, the sort is stable:
+// equal characters keep the generation order
+func SortCharacters(characters []Character, options SortOptions) {
+	slices.SortStableFunc(characters, options.compare)
+}
+
+// SortSlots sorts the slots in place by character,
+// the slots without character stay at the end in the generation order
+func SortSlots(slots []Slot, options SortOptions) {
+	slices.SortStableFunc(slots, func(a, b Slot) int {
+		switch {
+		case a.Character == nil && b.Character == nil:
+			return cmp.Compare(a.Index, b.Index)
+		case a.Character == nil:
+			return 1
+		case b.Character == nil:
+			return -1
+		}
+		return options.compare(*a.Character, *b.Character)
+	})
+}
+
+func (o SortOptions) compare(a, b Character) int {
+	switch o.By {
+	case SortByName:
+		return o.compareStrings(a.Name, b.Name)
+	case SortByKind:
+		return cmp.Or(o.compareStrings(a.Kind, b.Kind), o.compareStrings(a.Name, b.Name))
+	default:
+		return 0
+	}
+}
+
+func (o SortOptions) compareStrings(a, b string) int {
+	if o.Collation != CollationLocale {
+		return strings.Compare(a, b)
+	}
+	// the folded keys decide, the raw strings break the ties (Élise after Elise)
+	return cmp.Or(strings.Compare(collationKey(a), collationKey(b)), strings.Compare(a, b))
+}
+
+var foldedLetters = map[rune]string{
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'æ': "ae",
+	'ç': "c", 'è': "e", 'é': "e", 'ê': "e", 'ë': "e",
+	'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ñ': "n",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'œ': "oe",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ý': "y", 'ÿ': "y",
+	'ß': "ss", 'ð': "d", 'þ': "th",
+}
+
+// collationKey folds the case and the accents of the Latin letters,
+// the punctuation (hyphens, apostrophes) is ignored like in a dictionary
+func collationKey(value string) string {
+	key := strings.Builder{}
+	for _, r := range strings.ToLower(value) {
+		folded, ok := foldedLetters[r]
+		switch {
+		case ok:
+			key.WriteString(folded)
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsSpace(r):
+			key.WriteRune(r)
+		}
+	}
+	return key.String()
+}
@@ -0,0 +1,118 @@
+//go:build !minimal
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// SSESummary is the last event of a streamed generation
+type SSESummary struct {
+	Campaign string     `json:"campaign"`
+	Spec     Spec       `json:"spec"`
+	Stored   int        `json:"stored"`
+	Failed   int        `json:"failed"`
+	Metrics  RunMetrics `json:"metrics"`
+}
+
+// handleGenerateEvents streams the generation with Server-Sent Events (an EventSource only sends GET requests):
+// GET /events/generate?campaign=default&kind=Elf&count=5 sends a "character" event per slot and a final "summary" event
+func (s *Server) handleGenerateEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	campaign := DefaultCampaign
+	if query.Has("campaign") {
+		campaign = query.Get("campaign")
+	}
+	registry, err := s.storage.Registry(campaign)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	request := GenerateRequest{Spec: s.generator.DefaultSpec(), Mix: query.Get("mix")}
+	if query.Has("kind") {
+		request.Kind = query.Get("kind")
+	}
+	request.Class, request.System = query.Get("class"), query.Get("system")
+	request.Aliases = query.Get("aliases") == "true"
+	request.NameOnly = query.Get("name_only") == "true"
+	request.Coverage = query.Get("coverage") == "true"
+	if query.Has("tables") {
+		request.Tables = strings.Split(query.Get("tables"), ",")
+	}
+	for name, value := range map[string]*int{"level": &request.Level, "count": &request.Count} {
+		if !query.Has(name) {
+			continue
+		}
+		*value, err = strconv.Atoi(query.Get(name))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid %s %q", name, query.Get(name)))
+			return
+		}
+	}
+	spec, err := s.generator.CheckSpec(request, 100)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if !s.generator.backend.Status().Up {
+		writeUnavailable(w, s.generator.backend)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming is not supported"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// nginx buffers the responses by default
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	run := NewRun(s.generator, registry.Deduper(), spec)
+	summary := SSESummary{Campaign: campaign, Spec: spec}
+	for index := range spec.Count {
+		slot, err := run.GenerateSlot(r.Context(), index)
+		if err == nil {
+			slots := []Slot{slot}
+			err = storeSlots(registry, slots, s.approval)
+			slot = slots[0]
+		}
+		if err != nil {
+			writeEvent(w, "error", map[string]string{"error": err.Error()})
+			flusher.Flush()
+			return
+		}
+		if slot.Status == SlotOK {
+			summary.Stored++
+		} else {
+			summary.Failed++
+		}
+		writeEvent(w, "character", slot)
+		flusher.Flush()
+	}
+
+	err = s.export(campaign, registry, spec.Kind)
+	if err != nil {
+		writeEvent(w, "error", map[string]string{"error": err.Error()})
+	}
+	summary.Metrics = run.Metrics()
+	writeEvent(w, "summary", summary)
+	flusher.Flush()
+}
+
+// writeEvent writes a Server-Sent Event, the data is a single line of JSON
+func writeEvent(w http.ResponseWriter, event string, value any) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		data, _ = json.Marshal(map[string]string{"error": err.Error()})
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+const DefaultCampaign = "default"
+
+var campaignPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// kindPattern allows the kinds of the genres (Dark Elf, Half-Orc, Elf-Dwarf) but no path
+var kindPattern = regexp.MustCompile(`^[\p{L}\p{N}][\p{L}\p{N} '_-]{0,63}$`)
+
+// Storage keeps the data of every campaign (tenant) in its own directory:
+// <dir>/<campaign>/registry.json and the exports next to it
+type Storage struct {
+	dir        string
+	mutex      sync.Mutex
+	registries map[string]*Registry
+}
+
+func NewStorage(dir string) *Storage {
+	return &Storage{dir: dir, registries: map[string]*Registry{}}
+}
+
+// Registry returns the registry of the campaign (opened once)
+func (s *Storage) Registry(campaign string) (*Registry, error) {
+	err := checkCampaign(campaign)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	registry, ok := s.registries[campaign]
+	if ok {
+		return registry, nil
+	}
+	registry, err = OpenRegistry(filepath.Join(s.dir, campaign, "registry.json"))
+	if err != nil {
+		return nil, err
+	}
+	s.registries[campaign] = registry
+	return registry, nil
+}
+
+// JobsDir returns the directory of the persisted jobs,
+// the dot keeps it apart from the campaigns
+func (s *Storage) JobsDir() string {
+	return filepath.Join(s.dir, ".jobs")
+}
+
+// NotesIndexPath returns the path of the vector index of the campaign notes embedded by the model,
+// shared by the campaigns (the chunks are keyed by their digest)
+func (s *Storage) NotesIndexPath(model string) string {
+	return filepath.Join(s.dir, ".notes", modelFileName(model)+".hnsw")
+}
+
+// NamesIndexPath returns the path of the vector index of the names embedded by the model (DEDUP=embedding)
+func (s *Storage) NamesIndexPath(model string) string {
+	return filepath.Join(s.dir, ".embeddings", "names."+modelFileName(model)+".hnsw")
+}
+
+// modelFileName is the model in a file name: nomic-embed-text:v1.5 is nomic-embed-text-v1.5
+func modelFileName(model string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' || r == '-' || r == '_' {
+			return r
+		}
+		return '-'
+	}, model)
+}
+
+// ExportPath returns the path of an export file of the campaign, the names are the directories
+// then the file (ExportPath(campaign, "shops", "the-rusty-anvil.json")), none can leave the campaign
+func (s *Storage) ExportPath(campaign string, names ...string) (string, error) {
+	err := checkCampaign(campaign)
+	if err != nil {
+		return "", err
+	}
+	for _, name := range names {
+		if name == "" || strings.ContainsAny(name, `/\`) || strings.Contains(name, "..") {
+			return "", fmt.Errorf("invalid export file name %q", name)
+		}
+	}
+	campaignDir := filepath.Join(s.dir, campaign)
+	exportPath := filepath.Join(append([]string{campaignDir}, names...)...)
+	relative, err := filepath.Rel(campaignDir, exportPath)
+	if err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("export file %q is outside of the campaign %s", filepath.Join(names...), campaign)
+	}
+	return exportPath, nil
+}
+
+// the campaign is used as a directory name
+func checkCampaign(campaign string) error {
+	if !campaignPattern.MatchString(campaign) {
+		return fmt.Errorf("invalid campaign %q (letters, digits, - and _ only)", campaign)
+	}
+	return nil
+}
+
+// the kind is used in the names of the exports
+func checkKind(kind string) error {
+	if !kindPattern.MatchString(kind) {
+		return fmt.Errorf("invalid kind %q (letters, digits, spaces, ', - and _ only)", kind)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// StoryTable is an optional section of the characters, drawn per character with its chance
+// (STORY_TABLES): the schema gets its array and the prompt its instruction
+type StoryTable struct {
+	// Name is the field of the character
+	Name        string
+	Instruction string
+	MaxItems    int
+}
+
+const (
+	TablePlotHooks = "plot_hooks"
+	TableSecrets   = "secrets"
+	TableCurses    = "curses"
+	TableBoons     = "boons"
+)
+
+var storyTables = []StoryTable{
+	{Name: TablePlotHooks, Instruction: "one to three plot hooks (leads for an adventure involving the character)", MaxItems: 3},
+	{Name: TableSecrets, Instruction: "one or two secrets the character hides", MaxItems: 2},
+	{Name: TableCurses, Instruction: "a curse afflicting the character (its origin and its effect)", MaxItems: 1},
+	{Name: TableBoons, Instruction: "a boon the character was granted (a blessing, a gift, a debt owed)", MaxItems: 1},
+}
+
+func storyTable(name string) (StoryTable, bool) {
+	idx := slices.IndexFunc(storyTables, func(table StoryTable) bool { return table.Name == name })
+	if idx < 0 {
+		return StoryTable{}, false
+	}
+	return storyTables[idx], true
+}
+
+func storyTableNames() string {
+	names := []string{}
+	for _, table := range storyTables {
+		names = append(names, table.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// StoryChances are the chances of the story tables, from 0 to 1
+type StoryChances map[string]float64
+
+// ParseStoryChances reads STORY_TABLES: secrets=20%,curses=0.1,plot_hooks (a table without a chance is always drawn)
+func ParseStoryChances(value string) (StoryChances, error) {
+	chances := StoryChances{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, setting, found := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if _, ok := storyTable(name); !ok {
+			return nil, fmt.Errorf("unknown story table %q (%s)", name, storyTableNames())
+		}
+		chance := 1.0
+		if found {
+			setting = strings.TrimSpace(setting)
+			percent := strings.HasSuffix(setting, "%")
+			var err error
+			chance, err = strconv.ParseFloat(strings.TrimSuffix(setting, "%"), 64)
+			if percent {
+				chance /= 100
+			}
+			if err != nil || chance < 0 || chance > 1 {
+				return nil, fmt.Errorf("invalid chance of the story table %q (from 0 to 1, or a percentage)", entry)
+			}
+		}
+		chances[name] = chance
+	}
+	return chances, nil
+}
+
+// Draw returns the tables of a character, in the order of the tables
+func (c StoryChances) Draw(random *rand.Rand) []string {
+	tables := []string{}
+	for _, table := range storyTables {
+		chance, ok := c[table.Name]
+		if ok && random.Float64() < chance {
+			tables = append(tables, table.Name)
+		}
+	}
+	return tables
+}
+
+// checkStoryTables checks the tables requested by a spec
+func checkStoryTables(tables []string) error {
+	for _, name := range tables {
+		if _, ok := storyTable(name); !ok {
+			return fmt.Errorf("unknown story table %q (%s)", name, storyTableNames())
+		}
+	}
+	return nil
+}
+
+// storyInstructions asks for the tables of the spec
+func storyInstructions(tables []string) string {
+	instructions := []string{}
+	for _, name := range tables {
+		table, _ := storyTable(name)
+		instructions = append(instructions, table.Name+" ("+table.Instruction+")")
+	}
+	return "\nAlso give the character " + strings.Join(instructions, ", ") + "."
+}
+
+// withStoryTables returns a copy of the schema with an array per table
+func withStoryTables(schema map[string]any, tables []string) map[string]any {
+	properties := maps.Clone(schema["properties"].(map[string]any))
+	required := slices.Clone(schema["required"].([]string))
+	for _, name := range tables {
+		table, _ := storyTable(name)
+		properties[name] = map[string]any{
+			"type":     "array",
+			"items":    map[string]any{"type": "string"},
+			"minItems": 1,
+			"maxItems": table.MaxItems,
+		}
+		required = append(required, name)
+	}
+	return map[string]any{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+}
+
+// storyTableTexts returns the texts of the table of the character
+func storyTableTexts(character Character, name string) []string {
+	switch name {
+	case TablePlotHooks:
+		return character.PlotHooks
+	case TableSecrets:
+		return character.Secrets
+	case TableCurses:
+		return character.Curses
+	case TableBoons:
+		return character.Boons
+	}
+	return nil
+}
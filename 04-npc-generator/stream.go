@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// StreamResult is a line of the --stdin output: a generated slot,
+// or the error of an invalid spec line
+type StreamResult struct {
+	Line     int    `json:"line"`
+	Campaign string `json:"campaign,omitempty"`
+	*Slot
+	Error string `json:"error,omitempty"`
+}
+
+// runStream reads one spec per line (JSONL, the fields of POST /jobs)
+// and writes every slot as soon as it is generated, one JSON object per line:
+//
+//	echo '{"kind":"Elf","count":3}' | go run . --stdin | jq -r .character.name
+func (a *App) runStream(ctx context.Context, input io.Reader, output io.Writer, campaign string) error {
+	encoder := json.NewEncoder(output)
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		request := JobRequest{Campaign: campaign, GenerateRequest: GenerateRequest{Spec: a.generator.DefaultSpec()}}
+		err := json.Unmarshal(scanner.Bytes(), &request)
+		if err != nil {
+			encoder.Encode(StreamResult{Line: line, Error: err.Error()})
+			continue
+		}
+		spec, err := a.generator.CheckSpec(request.GenerateRequest, 10000)
+		if err != nil {
+			encoder.Encode(StreamResult{Line: line, Error: err.Error()})
+			continue
+		}
+		registry, err := a.storage.Registry(request.Campaign)
+		if err != nil {
+			encoder.Encode(StreamResult{Line: line, Error: err.Error()})
+			continue
+		}
+
+		run := NewRun(a.generator, registry.Deduper(), spec)
+		for index := range spec.Count {
+			slot, err := run.GenerateSlot(ctx, index)
+			if err != nil {
+				return err
+			}
+			slots := []Slot{slot}
+			err = StoreSlots(registry, slots)
+			if err != nil {
+				return err
+			}
+			err = encoder.Encode(StreamResult{Line: line, Campaign: request.Campaign, Slot: &slots[0]})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return scanner.Err()
+}
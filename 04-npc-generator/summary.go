@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// Exit codes of the commands for the scripts and the CI,
+// 2 is the usage error of the flags (flag.ExitOnError)
+const (
+	ExitOK      = 0
+	ExitFailure = 1 // an error, or no character of the run is stored
+	ExitPartial = 3 // some slots of the run failed or were filtered
+)
+
+// Statuses of the run summaries
+const (
+	RunOK      = "ok"
+	RunPartial = "partial"
+	RunFailed  = "failed"
+)
+
+// summaryCommands are the commands with a run summary
+var summaryCommands = []string{"generate", "run", "regen"}
+
+// RunSummary is the machine-readable outcome of a generation (generate, run, regen),
+// written with --summary (RUN_SUMMARY) to a file, or to stderr with -
+type RunSummary struct {
+	Command   string            `json:"command"`
+	Status    string            `json:"status"`
+	ExitCode  int               `json:"exit_code"`
+	Campaign  string            `json:"campaign,omitempty"`
+	Kind      string            `json:"kind,omitempty"`
+	Requested int               `json:"requested"`
+	Stored    int               `json:"stored"`
+	Failed    int               `json:"failed"`
+	Filtered  int               `json:"filtered"`
+	Stopped   string            `json:"stopped,omitempty"`
+	Exports   map[string]string `json:"exports,omitempty"`
+	Metrics   *RunMetrics       `json:"metrics,omitempty"`
+	Error     string            `json:"error,omitempty"`
+}
+
+// NewRunSummary counts the slots of the output: every slot stored is ok,
+// none is a failure (a run stopped by the token budget misses slots, it is partial)
+func NewRunSummary(command string, output RunOutput, exports map[string]string) *RunSummary {
+	summary := &RunSummary{
+		Command:   command,
+		Campaign:  output.Campaign,
+		Kind:      output.Spec.Kind,
+		Requested: max(output.Spec.Count, len(output.Slots)),
+		Stopped:   output.Stopped,
+		Exports:   exports,
+		Metrics:   &output.Metrics,
+	}
+	for _, slot := range output.Slots {
+		switch slot.Status {
+		case SlotOK:
+			summary.Stored++
+		case SlotFiltered:
+			summary.Filtered++
+		default:
+			summary.Failed++
+		}
+	}
+	switch {
+	case summary.Stored == summary.Requested:
+		summary.Status, summary.ExitCode = RunOK, ExitOK
+	case summary.Stored == 0:
+		summary.Status, summary.ExitCode = RunFailed, ExitFailure
+	default:
+		summary.Status, summary.ExitCode = RunPartial, ExitPartial
+	}
+	return summary
+}
+
+// finish returns the exit code of the command and writes the summary of its run
+// (a failed summary with the error when the command failed before it)
+func (a *App) finish(command string, err error) int {
+	summary := a.summary
+	if err != nil && summary == nil && slices.Contains(summaryCommands, command) {
+		summary = &RunSummary{Command: command}
+	}
+	if summary == nil {
+		if err != nil {
+			return ExitFailure
+		}
+		return ExitOK
+	}
+	if err != nil {
+		summary.Status, summary.ExitCode, summary.Error = RunFailed, ExitFailure, err.Error()
+	}
+	if err == nil && summary.Status != RunOK {
+		fmt.Printf("⚠️ %s run: %d of %d characters stored, %d failed, %d filtered\n",
+			summary.Status, summary.Stored, summary.Requested, summary.Failed, summary.Filtered)
+	}
+	if a.summaryPath != "" {
+		writeErr := writeRunSummary(a.summaryPath, summary)
+		if writeErr != nil {
+			fmt.Fprintln(os.Stderr, "😡 summary:", writeErr)
+		}
+	}
+	return summary.ExitCode
+}
+
+// writeRunSummary writes the summary as a JSON line on stderr (-) or as a JSON file
+func writeRunSummary(path string, summary *RunSummary) error {
+	if path == "-" {
+		return json.NewEncoder(os.Stderr).Encode(summary)
+	}
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ollama/ollama/api"
+)
+
+// SyllableTable is the components of the names of a kind, asked once to the model:
+// a name is a start, zero or one middle and an end (then a family name with the custom of the kind)
+type SyllableTable struct {
+	Kind     string    `json:"kind"`
+	Parents  []string  `json:"parents,omitempty"`
+	Model    string    `json:"model"`
+	Starts   []string  `json:"starts"`
+	Middles  []string  `json:"middles"`
+	Ends     []string  `json:"ends"`
+	Families []string  `json:"families,omitempty"`
+	At       time.Time `json:"at"`
+}
+
+var syllableSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"starts":   map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "minItems": 10},
+		"middles":  map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "minItems": 5},
+		"ends":     map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "minItems": 10},
+		"families": map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+	},
+	"required": []string{"starts", "middles", "ends", "families"},
+}
+
+// SyllablesPath returns the path of the syllable table of the kind, shared by the campaigns
+// (the kind is checked like the kinds of the exports, it can't leave the directory)
+func (s *Storage) SyllablesPath(kind string) (string, error) {
+	err := checkKind(kind)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(s.dir, ".syllables", strings.ToLower(kind)+".json"), nil
+}
+
+// LoadSyllableTable reads a saved table, nil when the kind has none
+func LoadSyllableTable(path string) (*SyllableTable, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	table := &SyllableTable{}
+	err = json.Unmarshal(data, table)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return table, table.Validate()
+}
+
+func (t *SyllableTable) Save(path string) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Validate checks that the table can combine names
+func (t *SyllableTable) Validate() error {
+	if len(t.Starts) == 0 || len(t.Ends) == 0 {
+		return fmt.Errorf("the syllable table of %s has no starts or no ends", t.Kind)
+	}
+	return nil
+}
+
+// Stale is true when the table is older than maxAge (0: never stale)
+func (t *SyllableTable) Stale(maxAge time.Duration, now time.Time) bool {
+	return maxAge > 0 && now.Sub(t.At) > maxAge
+}
+
+// Version is the digest of the components, the prompt version of the combined names
+func (t *SyllableTable) Version() string {
+	data, _ := json.Marshal([][]string{t.Starts, t.Middles, t.Ends, t.Families})
+	hash := sha256.Sum256(data)
+	return "syllables-" + hex.EncodeToString(hash[:])[:12]
+}
+
+// cleanSyllables trims the components and drops the empty ones and the duplicates
+func cleanSyllables(components []string) []string {
+	cleaned := []string{}
+	seen := map[string]bool{}
+	for _, component := range components {
+		component = strings.Trim(strings.TrimSpace(component), "-")
+		key := strings.ToLower(component)
+		if component == "" || seen[key] || strings.ContainsFunc(component, unicode.IsSpace) {
+			continue
+		}
+		seen[key] = true
+		cleaned = append(cleaned, component)
+	}
+	return cleaned
+}
+
+// capitalize upper-cases the first letter of a combined name
+func capitalize(name string) string {
+	first, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToUpper(first)) + strings.ToLower(name[size:])
+}
+
+// Name combines a name of the spec with the random source: the start follows the prefix
+// of the coverage mode, the family name of a relative is kept
+func (t *SyllableTable) Name(spec Spec, custom string, random *rand.Rand) string {
+	starts := t.Starts
+	if spec.Prefix != "" {
+		starts = []string{}
+		for _, start := range t.Starts {
+			if hasPrefix(start, spec.Prefix) {
+				starts = append(starts, start)
+			}
+		}
+		if len(starts) == 0 {
+			starts = []string{spec.Prefix}
+		}
+	}
+	name := starts[random.IntN(len(starts))]
+	if len(t.Middles) > 0 && random.IntN(2) == 0 {
+		name += t.Middles[random.IntN(len(t.Middles))]
+	}
+	name = capitalize(name + t.Ends[random.IntN(len(t.Ends))])
+
+	family := ""
+	switch {
+	case spec.Relative != nil:
+		family = spec.Relative.Family
+	case custom != FamilyNone && len(t.Families) > 0:
+		family = t.Families[random.IntN(len(t.Families))]
+	}
+	switch {
+	case family == "":
+		return name
+	case custom == FamilyClan && spec.Relative == nil:
+		return name + " of " + family
+	}
+	return name + " " + family
+}
+
+// Answer is the JSON answer of a combined name, like the answers of GenerateName:
+// the seed of the options makes it reproducible
+func (t *SyllableTable) Answer(spec Spec, custom string, options map[string]interface{}) (Answer, error) {
+	_, seed := withSeed(options, 0)
+	random := rand.New(rand.NewPCG(uint64(seed), 0))
+	content, err := json.Marshal(map[string]string{"name": t.Name(spec, custom, random), "kind": spec.Kind})
+	return Answer{Content: string(content), PromptVersion: t.Version()}, err
+}
+
+// BuildSyllableTable asks the model once for the components of the names of the kind
+// (with the rules of the parents of a hybrid), 3 attempts
+func (g *Generator) BuildSyllableTable(ctx context.Context, spec Spec) (*SyllableTable, error) {
+	messages := []api.Message{
+		{Role: "system", Content: nameInstructions(g.kinds, spec)},
+		{Role: "user", Content: "List the components of the " + spec.Kind + " names, so a program can combine them into new names: " +
+			"about 30 starts (the first syllables), 15 middles and 30 ends (the last syllables), lower case without spaces, " +
+			"and about 20 family names when the " + spec.Kind + " names have one (else none)."},
+	}
+	options := map[string]interface{}{"temperature": 0.8}
+
+	for attempt := 0; attempt < 3; attempt++ {
+		answer, err := g.chat(ctx, DomainSyllables, messages, syllableSchema, options)
+		if err != nil {
+			return nil, err
+		}
+		if answer.Truncated {
+			continue
+		}
+		table := &SyllableTable{}
+		err = decodeAnswer(answer.Content, table)
+		if err == nil {
+			table.Kind, table.Parents, table.Model, table.At = spec.Kind, spec.Parents, g.model, time.Now().UTC()
+			table.Starts, table.Middles, table.Ends = cleanSyllables(table.Starts), cleanSyllables(table.Middles), cleanSyllables(table.Ends)
+			table.Families = cleanSyllables(table.Families)
+			err = table.Validate()
+		}
+		if err != nil {
+			fmt.Println("😡 syllables:", err)
+			continue
+		}
+		return table, nil
+	}
+	return nil, fmt.Errorf("no valid syllable table of %s after 3 attempts", spec.Kind)
+}
+
+// syllableTable returns the saved table of the kind, it is asked to the model
+// when there is none or when it is older than maxAge (refresh)
+func (a *App) syllableTable(ctx context.Context, spec Spec, maxAge time.Duration, refresh bool) (*SyllableTable, error) {
+	path, err := a.storage.SyllablesPath(spec.Kind)
+	if err != nil {
+		return nil, err
+	}
+	table, err := LoadSyllableTable(path)
+	if err != nil {
+		return nil, err
+	}
+	if table != nil && !refresh && !table.Stale(maxAge, time.Now()) {
+		return table, nil
+	}
+	if table != nil {
+		fmt.Printf("🔄 the syllable table of %s is from %s, refreshing it\n", spec.Kind, table.At.Format(time.DateOnly))
+	}
+	table, err = a.generator.BuildSyllableTable(ctx, spec)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("🧱 %s: %d starts, %d middles, %d ends, %d family names %s\n",
+		spec.Kind, len(table.Starts), len(table.Middles), len(table.Ends), len(table.Families), path)
+	return table, table.Save(path)
+}
+
+// runSyllables asks for the syllable table of the kinds (all the kinds of the genre by default),
+// saves them for the generations with --syllables and prints a few combined names:
+// syllables --kind Dwarf --refresh
+func (a *App) runSyllables(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("syllables", flag.ExitOnError)
+	kind := flags.String("kind", "", "kind of the table (default: every kind of the genre)")
+	mix := flags.String("mix", "", "parent kinds of a hybrid (dwarf+human)")
+	refresh := flags.Bool("refresh", false, "ask the model again for the saved tables")
+	samples := flags.Int("samples", 5, "number of combined names printed per kind")
+	flags.Parse(args)
+
+	kinds := []string{*kind}
+	if *kind == "" {
+		kinds = []string{}
+		for _, definition := range a.generator.kinds {
+			kinds = append(kinds, definition.Name)
+		}
+	}
+	for _, name := range kinds {
+		spec := Spec{Kind: name, Count: 1}
+		var err error
+		spec.Kind, spec.Parents, err = ResolveKind(a.generator.kinds, name, *mix)
+		if err != nil {
+			return err
+		}
+		table, err := a.syllableTable(ctx, spec, 0, *refresh)
+		if err != nil {
+			return err
+		}
+		custom := familyCustom(a.generator.kinds, spec.Kind, spec.Parents)
+		random := rand.New(rand.NewPCG(rand.Uint64(), 0))
+		names := []string{}
+		for range *samples {
+			names = append(names, table.Name(spec, custom, random))
+		}
+		fmt.Printf("🎲 %s (%s, %s): %s\n", spec.Kind, table.Model, table.At.Format(time.DateOnly), strings.Join(names, ", "))
+	}
+	return nil
+}
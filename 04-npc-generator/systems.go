@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// StatDefinition is a stat of a game system and its range
+type StatDefinition struct {
+	Name string `json:"name"`
+	Min  int    `json:"min"`
+	Max  int    `json:"max"`
+}
+
+// GameSystem is a schema and prompt preset for a tabletop system
+type GameSystem struct {
+	Name  string `json:"name"`
+	Title string `json:"title"`
+	// Vocabulary is added to the prompt
+	Vocabulary string           `json:"vocabulary"`
+	Stats      []StatDefinition `json:"stats"`
+}
+
+var builtinSystems = []GameSystem{
+	{
+		Name:       "dnd5e",
+		Title:      "Dungeons & Dragons 5th edition",
+		Vocabulary: "Use the D&D 5e vocabulary: race, class, ability scores, hit points, armor class.",
+		Stats: []StatDefinition{
+			{"STR", 3, 20}, {"DEX", 3, 20}, {"CON", 3, 20},
+			{"INT", 3, 20}, {"WIS", 3, 20}, {"CHA", 3, 20},
+		},
+	},
+	{
+		Name:       "pf2e",
+		Title:      "Pathfinder 2nd edition",
+		Vocabulary: "Use the Pathfinder 2e vocabulary: ancestry and heritage (not race), class, attribute modifiers, hit points.",
+		Stats: []StatDefinition{
+			{"Str", -2, 7}, {"Dex", -2, 7}, {"Con", -2, 7},
+			{"Int", -2, 7}, {"Wis", -2, 7}, {"Cha", -2, 7},
+		},
+	},
+	{
+		Name:       "osr",
+		Title:      "Old School Renaissance (B/X)",
+		Vocabulary: "Use the old school vocabulary: hit dice, saving throws, morale, no skills and no feats.",
+		Stats: []StatDefinition{
+			{"STR", 3, 18}, {"INT", 3, 18}, {"WIS", 3, 18},
+			{"DEX", 3, 18}, {"CON", 3, 18}, {"CHA", 3, 18},
+		},
+	},
+}
+
+// LoadGameSystems returns the built-in systems and the custom ones, every JSON file of the directories
+// (the installed packs, then SYSTEMS_DIR) registers a system (or replaces a system registered before)
+func LoadGameSystems(dirs ...string) (map[string]GameSystem, error) {
+	systems := map[string]GameSystem{}
+	for _, system := range builtinSystems {
+		systems[system.Name] = system
+	}
+
+	err := readPacks(dirs, func(path string, data []byte) error {
+		system := GameSystem{}
+		err := json.Unmarshal(data, &system)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if system.Name == "" {
+			system.Name = strings.TrimSuffix(filepath.Base(path), ".json")
+		}
+		for _, stat := range system.Stats {
+			if stat.Min > stat.Max {
+				return fmt.Errorf("%s: the range of %s is empty", path, stat.Name)
+			}
+		}
+		systems[system.Name] = system
+		return nil
+	})
+	return systems, err
+}
+
+// SystemNames returns the sorted names of the systems
+func SystemNames(systems map[string]GameSystem) []string {
+	return slices.Sorted(maps.Keys(systems))
+}
+
+// StatsSchema returns the schema of the stats of the system
+func (s GameSystem) StatsSchema() map[string]any {
+	statProperties := map[string]any{}
+	statNames := []string{}
+	for _, stat := range s.Stats {
+		statProperties[stat.Name] = map[string]any{
+			"type":    "integer",
+			"minimum": stat.Min,
+			"maximum": stat.Max,
+		}
+		statNames = append(statNames, stat.Name)
+	}
+	return map[string]any{
+		"type":       "object",
+		"properties": statProperties,
+		"required":   statNames,
+	}
+}
+
+// Schema returns the character schema with the stats of the system
+func (s GameSystem) Schema() map[string]any {
+	properties := map[string]any{}
+	maps.Copy(properties, characterSchema["properties"].(map[string]any))
+	properties["stats"] = s.StatsSchema()
+	return map[string]any{
+		"type":       "object",
+		"properties": properties,
+		"required":   append(slices.Clone(characterSchema["required"].([]string)), "stats"),
+	}
+}
+
+// Validate checks that the character has every stat of the system, in range
+func (s GameSystem) Validate(character Character) error {
+	for _, stat := range s.Stats {
+		value, ok := character.Stats[stat.Name]
+		if !ok {
+			return fmt.Errorf("%s has no %s", character.Name, stat.Name)
+		}
+		if value < stat.Min || value > stat.Max {
+			return fmt.Errorf("the %s of %s (%d) is out of the %s range [%d, %d]", stat.Name, character.Name, value, s.Name, stat.Min, stat.Max)
+		}
+	}
+	return nil
+}
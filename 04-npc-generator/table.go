@@ -0,0 +1,105 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// RenderTable renders a GFM table: the cells are escaped (escapeCell),
+// the line breaks become <br> and the columns are padded to be aligned in the source
+func RenderTable(header []string, rows [][]string) string {
+	cells := make([][]string, 0, len(rows)+1)
+	for _, row := range append([][]string{header}, rows...) {
+		escaped := make([]string, len(header))
+		for idx := range header {
+			if idx < len(row) {
+				escaped[idx] = escapeCell(row[idx])
+			}
+		}
+		cells = append(cells, escaped)
+	}
+
+	widths := make([]int, len(header))
+	for _, row := range cells {
+		for idx, cell := range row {
+			// the separator needs 3 dashes
+			widths[idx] = max(widths[idx], displayWidth(cell), 3)
+		}
+	}
+
+	builder := strings.Builder{}
+	writeRow := func(row []string) {
+		builder.WriteString("|")
+		for idx, cell := range row {
+			builder.WriteString(" " + cell + strings.Repeat(" ", widths[idx]-displayWidth(cell)) + " |")
+		}
+		builder.WriteString("\n")
+	}
+	writeRow(cells[0])
+	builder.WriteString("|")
+	for _, width := range widths {
+		builder.WriteString(strings.Repeat("-", width+2) + "|")
+	}
+	builder.WriteString("\n")
+	for _, row := range cells[1:] {
+		writeRow(row)
+	}
+	return builder.String()
+}
+
+// markdownEscaper escapes the characters GitHub would read as HTML or as Markdown
+// (emphasis, code, links); the pipes are escaped in the cells only
+var markdownEscaper = strings.NewReplacer(
+	`&`, "&amp;", `<`, "&lt;", `>`, "&gt;",
+	`\`, `\\`, "`", "\\`", `*`, `\*`, `_`, `\_`, `[`, `\[`, `]`, `\]`,
+)
+
+// escapeMarkdown escapes an inline text of the Markdown exports, the blanks are collapsed
+func escapeMarkdown(text string) string {
+	return markdownEscaper.Replace(strings.Join(strings.Fields(text), " "))
+}
+
+// escapeCell escapes a cell of a table, the lines of a multi-line cell are joined with <br>
+// (a table row is one line in GFM) and the blank lines are dropped
+func escapeCell(cell string) string {
+	lines := []string{}
+	for _, line := range strings.Split(cell, "\n") {
+		if line = escapeMarkdown(line); line != "" {
+			lines = append(lines, strings.ReplaceAll(line, "|", `\|`))
+		}
+	}
+	return strings.Join(lines, "<br>")
+}
+
+// displayWidth is the number of columns of the text in a monospace font:
+// the combining marks take no column, the wide characters (CJK, fullwidth, emoji) take 2
+func displayWidth(text string) int {
+	width := 0
+	for _, r := range text {
+		switch {
+		case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf):
+		case isWide(r):
+			width += 2
+		default:
+			width++
+		}
+	}
+	return width
+}
+
+func isWide(r rune) bool {
+	return r >= 0x1100 && r <= 0x115F || // Hangul Jamo
+		r >= 0x2E80 && r <= 0x303E || // CJK radicals and punctuation
+		r >= 0x3041 && r <= 0x33FF || // Hiragana, Katakana, CJK symbols
+		r >= 0x3400 && r <= 0x4DBF || // CJK extension A
+		r >= 0x4E00 && r <= 0x9FFF || // CJK unified ideographs
+		r >= 0xA000 && r <= 0xA4CF || // Yi
+		r >= 0xAC00 && r <= 0xD7A3 || // Hangul syllables
+		r >= 0xF900 && r <= 0xFAFF || // CJK compatibility ideographs
+		r >= 0xFE30 && r <= 0xFE4F || // CJK compatibility forms
+		r >= 0xFF00 && r <= 0xFF60 || // fullwidth forms
+		r >= 0xFFE0 && r <= 0xFFE6 ||
+		r >= 0x1F300 && r <= 0x1F64F || // emoji
+		r >= 0x1F900 && r <= 0x1F9FF ||
+		r >= 0x20000 && r <= 0x3FFFD // CJK extensions B and more
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEscapeCell(t *testing.T) {
+	for _, testCase := range []struct {
+		cell, want string
+	}{
+		{"Thorin", "Thorin"},
+		{"Thorin | Oakenshield", `Thorin \| Oakenshield`},
+		{"||", `\|\|`},
+		{"first line\nsecond line", "first line<br>second line"},
+		{"first line\r\n\r\n\nsecond line\n", "first line<br>second line"},
+		{`C:\dwarves`, `C:\\dwarves`},
+		{`a\|b`, `a\\\|b`},
+		{`trailing \`, `trailing \\`},
+		{"*bold* _it_ `code` [link]", "\\*bold\\* \\_it\\_ \\`code\\` \\[link\\]"},
+		{"<script>&", "&lt;script&gt;&amp;"},
+		{"  spaced \t out  ", "spaced out"},
+		{"", ""},
+	} {
+		if got := escapeCell(testCase.cell); got != testCase.want {
+			t.Errorf("escapeCell(%q) = %q, want %q", testCase.cell, got, testCase.want)
+		}
+	}
+}
+
+func TestDisplayWidth(t *testing.T) {
+	for _, testCase := range []struct {
+		text  string
+		width int
+	}{
+		{"Thorin", 6},
+		{"Þórin", 5},
+		// o and a combining acute accent
+		{"Tho\u0301rin", 6},
+		{"山田太郎", 8},
+		{"김민준", 6},
+		{"ｶﾀｶﾅ", 4},
+		{"Ｆｕｌｌ", 8},
+		{"👑 King", 7},
+		// a zero width joiner
+		{"a\u200db", 2},
+		{"", 0},
+	} {
+		if got := displayWidth(testCase.text); got != testCase.width {
+			t.Errorf("displayWidth(%q) = %d, want %d", testCase.text, got, testCase.width)
+		}
+	}
+}
+
+func TestRenderTable(t *testing.T) {
+	table := RenderTable([]string{"Name", "Kind"}, [][]string{
+		{"山田", "Human"},
+		{"Tho\u0301rin | II", "Dwarf"},
+		{"Bo", "Half-Elf\nrogue"},
+		// a short row gets empty cells
+		{"Kim"},
+	})
+	want := strings.Join([]string{
+		"| Name         | Kind              |",
+		"|--------------|-------------------|",
+		"| 山田         | Human             |",
+		"| Tho\u0301rin \\| II | Dwarf             |",
+		"| Bo           | Half-Elf<br>rogue |",
+		"| Kim          |                   |",
+	}, "\n") + "\n"
+	if table != want {
+		t.Errorf("RenderTable:\n%s\nwant:\n%s", table, want)
+	}
+
+	// every line takes the same columns in a monospace font
+	lines := strings.Split(strings.TrimSuffix(table, "\n"), "\n")
+	for _, line := range lines {
+		if displayWidth(line) != displayWidth(lines[0]) {
+			t.Errorf("%q is %d columns wide, the header %d", line, displayWidth(line), displayWidth(lines[0]))
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"slices"
+
+	"04-npc-generator/model"
+)
+
+// Tag adds the tags to the stored character (the tags are kept sorted)
+func (r *Registry) Tag(id int, tags ...string) (Character, error) {
+	return r.Modify(id, func(character *Character) {
+		for _, tag := range tags {
+			tag = model.NormalizeTag(tag)
+			if tag != "" && !slices.Contains(character.Tags, tag) {
+				character.Tags = append(character.Tags, tag)
+			}
+		}
+		slices.Sort(character.Tags)
+	})
+}
+
+// Untag removes the tags from the stored character
+func (r *Registry) Untag(id int, tags ...string) (Character, error) {
+	return r.Modify(id, func(character *Character) {
+		character.Tags = slices.DeleteFunc(character.Tags, func(tag string) bool {
+			return slices.ContainsFunc(tags, func(removed string) bool { return model.NormalizeTag(removed) == tag })
+		})
+	})
+}
+
+// FilterByTags keeps the characters having all the tags
+func FilterByTags(characters []Character, tags []string) []Character {
+	return slices.DeleteFunc(slices.Clone(characters), func(character Character) bool {
+		return slices.ContainsFunc(tags, func(tag string) bool { return !character.HasTag(tag) })
+	})
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// builtinThemes are the seasonal packs added to any genre (--theme): more instructions
+// and more extras, in the format of the genre packs
+var builtinThemes = []Pack{
+	{
+		Name:         "halloween",
+		Title:        "Halloween",
+		Instructions: "The characters take part in the night of the dead: masks, lanterns, ghost stories and old superstitions. Their names may carry a spooky touch, without being a joke.",
+		Extras: []GenreExtra{
+			{Name: "festival_role", Description: "role of the character in the night of the dead (mask maker, storyteller, lantern keeper...)"},
+			{Name: "seasonal_item", Description: "item of the season the character carries (a carved lantern, a bone charm...)"},
+		},
+	},
+	{
+		Name:         "winterfest",
+		Title:        "Winterfest",
+		Instructions: "The characters take part in the midwinter festival: the longest night, bonfires, gifts, feasts and snow. Their names may carry a touch of the cold season.",
+		Extras: []GenreExtra{
+			{Name: "festival_role", Description: "role of the character in the midwinter festival (bonfire keeper, gift bringer, feast cook...)"},
+			{Name: "seasonal_item", Description: "item of the season the character carries (a holly crown, a spiced cake...)"},
+		},
+	},
+}
+
+// LoadThemes returns the built-in themes and the custom ones, every JSON file of the directories
+// (the installed packs, then THEMES_DIR) is a pack registering a theme (or replacing a theme registered before)
+func LoadThemes(dirs ...string) (map[string]Pack, error) {
+	themes := map[string]Pack{}
+	for _, theme := range builtinThemes {
+		themes[theme.Name] = theme
+	}
+	err := readPacks(dirs, func(path string, data []byte) error {
+		theme := Pack{}
+		err := decodePack(path, data, &theme, &theme)
+		if err != nil {
+			return err
+		}
+		if theme.Instructions == "" && len(theme.Extras) == 0 {
+			return fmt.Errorf("%s: the theme has no instructions and no extras", path)
+		}
+		themes[theme.Name] = theme
+		return nil
+	})
+	return themes, err
+}
+
+// FindTheme returns the theme by name
+func FindTheme(themes map[string]Pack, name string) (Pack, error) {
+	theme, ok := themes[name]
+	if !ok {
+		return theme, fmt.Errorf("unknown theme %q (%s)", name, strings.Join(slices.Sorted(maps.Keys(themes)), ", "))
+	}
+	return theme, nil
+}
+
+// WithTheme returns the genre with the instructions and the extras of the theme,
+// an extra of the genre is not replaced by an extra of the theme with the same name
+func (g Genre) WithTheme(theme Pack) Genre {
+	themed := g
+	themed.Theme = theme.Name
+	if theme.Instructions != "" {
+		themed.Instructions = strings.TrimRight(g.Instructions, " \t\n") + "\n" + theme.Instructions + "\n"
+	}
+	themed.Extras = slices.Clone(g.Extras)
+	for _, extra := range theme.Extras {
+		if !slices.ContainsFunc(themed.Extras, func(other GenreExtra) bool { return other.Name == extra.Name }) {
+			themed.Extras = append(themed.Extras, extra)
+		}
+	}
+	return themed
+}
+
+// UseTheme adds the theme to the genre of the generator ("": no theme),
+// it replaces the theme already added
+func (g *Generator) UseTheme(name string) error {
+	if name == "" {
+		return nil
+	}
+	theme, err := FindTheme(g.themes, name)
+	if err != nil {
+		return err
+	}
+	genre := g.genre
+	if genre.Theme != "" {
+		genre, err = FindGenre(g.genres, genre.Name)
+		if err != nil {
+			return err
+		}
+	}
+	g.UseGenre(genre.WithTheme(theme))
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ollama/ollama/api"
+)
+
+// maxToolRounds is the number of tool call rounds before the model must answer
+const maxToolRounds = 3
+
+// Toolbox is the tools offered to the model and the function answering their calls
+type Toolbox struct {
+	Tools api.Tools
+	Call  func(call api.ToolCallFunction) string
+}
+
+// the parameters are decoded from JSON, their Go type changes between the Ollama versions
+var checkNameTool = mustTool(`{
+	"type": "function",
+	"function": {
+		"name": "check_name_available",
+		"description": "Check that a character name is not already used in the campaign, call it before answering",
+		"parameters": {
+			"type": "object",
+			"required": ["name"],
+			"properties": {
+				"name": {"type": "string", "description": "the full name of the character"}
+			}
+		}
+	}
+}`)
+
+func mustTool(definition string) api.Tool {
+	tool := api.Tool{}
+	err := json.Unmarshal([]byte(definition), &tool)
+	if err != nil {
+		panic(err)
+	}
+	return tool
+}
+
+// NameToolbox answers check_name_available with the dedup of the run
+// (the stored, reserved and already generated names)
+func NameToolbox(available func(name string) bool) *Toolbox {
+	return &Toolbox{
+		Tools: api.Tools{checkNameTool},
+		Call: func(call api.ToolCallFunction) string {
+			if call.Name != checkNameTool.Function.Name {
+				return fmt.Sprintf(`{"error": "unknown tool %q"}`, call.Name)
+			}
+			name, _ := call.Arguments["name"].(string)
+			if name == "" {
+				return `{"error": "the name is required"}`
+			}
+			// the check may ask the embeddings of the name, it runs once
+			free := available(name)
+			result := map[string]any{"name": name, "available": free}
+			if !free {
+				result["hint"] = "this name is taken, choose another one"
+			}
+			fmt.Printf("🔧 %s(%s): %v\n", call.Name, name, free)
+			data, _ := json.Marshal(result)
+			return string(data)
+		},
+	}
+}
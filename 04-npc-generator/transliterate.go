@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Transliteration modes of the ascii_name (TRANSLITERATE)
+const (
+	TransliterateOff    = ""
+	TransliterateLoose  = "loose"  // the letters without an ASCII form are dropped
+	TransliterateStrict = "strict" // a name with a letter without an ASCII form is rejected
+)
+
+// ErrNoASCIIForm rejects a name that can't be transliterated
+var ErrNoASCIIForm = errors.New("no ASCII form")
+
+// asciiLetters completes the folded letters of the collation
+// (the macrons and the carons of the fantasy names, the Central European letters)
+var asciiLetters = map[rune]string{
+	'ā': "a", 'ă': "a", 'ą': "a", 'ć': "c", 'č': "c", 'ď': "d", 'đ': "d",
+	'ē': "e", 'ė': "e", 'ę': "e", 'ě': "e", 'ğ': "g", 'ī': "i", 'į': "i", 'ı': "i",
+	'ľ': "l", 'ł': "l", 'ń': "n", 'ň': "n", 'ō': "o", 'ő': "o", 'ŕ': "r", 'ř': "r",
+	'ś': "s", 'ş': "s", 'š': "s", 'ș': "s", 'ţ': "t", 'ť': "t", 'ț': "t",
+	'ū': "u", 'ů': "u", 'ű': "u", 'ų': "u", 'ź': "z", 'ż': "z", 'ž': "z",
+	'’': "'", '‘': "'", 'ʼ': "'", '‐': "-", '–': "-",
+}
+
+// asciiLetter returns the ASCII form of a rune, the case is kept (Æ is Ae)
+func asciiLetter(r rune) (string, bool) {
+	if r < unicode.MaxASCII {
+		return string(r), true
+	}
+	lower := unicode.ToLower(r)
+	folded, ok := foldedLetters[lower]
+	if !ok {
+		folded, ok = asciiLetters[lower]
+	}
+	if !ok {
+		return "", false
+	}
+	if lower != r {
+		folded = strings.ToUpper(folded[:1]) + folded[1:]
+	}
+	return folded, true
+}
+
+// Transliterate returns the ASCII form of the name: Þórunn Ævarsdóttir is Thorunn Aevarsdottir.
+// The strict mode rejects a letter without an ASCII form, the loose mode drops it;
+// an empty result is an error in both modes
+func Transliterate(name, mode string) (string, error) {
+	builder := strings.Builder{}
+	unknown := []string{}
+	for _, r := range name {
+		ascii, ok := asciiLetter(r)
+		switch {
+		case ok:
+			builder.WriteString(ascii)
+		case unicode.IsSpace(r):
+			builder.WriteRune(' ')
+		default:
+			unknown = append(unknown, string(r))
+		}
+	}
+	if mode == TransliterateStrict && len(unknown) > 0 {
+		return "", fmt.Errorf("%w for %q in %s", ErrNoASCIIForm, strings.Join(unknown, ""), name)
+	}
+	ascii := strings.Join(strings.Fields(builder.String()), " ")
+	if strings.Trim(ascii, " '-") == "" {
+		return "", fmt.Errorf("%w for %s", ErrNoASCIIForm, name)
+	}
+	return ascii, nil
+}
+
+// retransliterate updates the native name and the ASCII name after a new name,
+// a character with an ASCII name keeps one even when TRANSLITERATE is not set
+func (g *Generator) retransliterate(character *Character) error {
+	character.NativeName = ""
+	if script := g.kindScript(*character); script != nil {
+		character.NativeName = script.Render(character.Name)
+	}
+	mode := g.transliterate
+	if mode == TransliterateOff && character.ASCIIName != "" {
+		mode = TransliterateLoose
+	}
+	if mode == TransliterateOff {
+		return nil
+	}
+	ascii, err := Transliterate(character.Name, mode)
+	if err != nil {
+		return err
+	}
+	character.ASCIIName = ascii
+	return nil
+}
+
+// checkTransliterate checks the mode of TRANSLITERATE and --transliterate
+func checkTransliterate(mode string) error {
+	switch mode {
+	case TransliterateOff, TransliterateLoose, TransliterateStrict:
+		return nil
+	}
+	return fmt.Errorf("unknown transliteration %q (%s, %s)", mode, TransliterateLoose, TransliterateStrict)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// VCR-style recorder for the Ollama HTTP API:
+// - VCR_MODE=record: forward the requests to Ollama and save every exchange in the cassette
+// - VCR_MODE=replay: answer the requests from the cassette, Ollama is never called
+// The cassette path is given by VCR_CASSETTE.
+
+type Interaction struct {
+	Method       string          `json:"method"`
+	Path         string          `json:"path"`
+	RequestBody  json.RawMessage `json:"request_body,omitempty"`
+	StatusCode   int             `json:"status_code"`
+	ResponseBody string          `json:"response_body"`
+}
+
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+type VCRTransport struct {
+	mode     string
+	path     string
+	next     http.RoundTripper
+	mutex    sync.Mutex
+	cassette Cassette
+	// replayed interactions are not served twice,
+	// the generation loop sends the same request several times
+	replayed []bool
+}
+
+func NewVCRTransport(mode, path string, next http.RoundTripper) (*VCRTransport, error) {
+	if path == "" {
+		return nil, fmt.Errorf("vcr: VCR_CASSETTE is required with VCR_MODE=%s", mode)
+	}
+	transport := &VCRTransport{mode: mode, path: path, next: next}
+
+	switch mode {
+	case "record":
+		return transport, nil
+	case "replay":
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal(data, &transport.cassette)
+		if err != nil {
+			return nil, err
+		}
+		// the saved cassette is indented, the bodies are compared in the canonical form of the live requests
+		for idx, interaction := range transport.cassette.Interactions {
+			if len(interaction.RequestBody) == 0 {
+				continue
+			}
+			transport.cassette.Interactions[idx].RequestBody, err = canonicalJSON(interaction.RequestBody)
+			if err != nil {
+				return nil, fmt.Errorf("vcr: interaction %d: %w", idx, err)
+			}
+		}
+		transport.replayed = make([]bool, len(transport.cassette.Interactions))
+		return transport, nil
+	default:
+		return nil, fmt.Errorf("vcr: unknown mode %q (record or replay)", mode)
+	}
+}
+
+func (t *VCRTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	requestBody, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.mode == "replay" {
+		return t.replay(req, requestBody)
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	responseBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(responseBody))
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.cassette.Interactions = append(t.cassette.Interactions, Interaction{
+		Method:       req.Method,
+		Path:         req.URL.Path,
+		RequestBody:  requestBody,
+		StatusCode:   resp.StatusCode,
+		ResponseBody: string(responseBody),
+	})
+	// save after every exchange so an interrupted run keeps what was recorded
+	err = t.save()
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (t *VCRTransport) replay(req *http.Request, requestBody json.RawMessage) (*http.Response, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for idx, interaction := range t.cassette.Interactions {
+		if t.replayed[idx] || interaction.Method != req.Method || interaction.Path != req.URL.Path {
+			continue
+		}
+		if !bytes.Equal(interaction.RequestBody, requestBody) {
+			continue
+		}
+		t.replayed[idx] = true
+		return &http.Response{
+			Status:     fmt.Sprintf("%d %s", interaction.StatusCode, http.StatusText(interaction.StatusCode)),
+			StatusCode: interaction.StatusCode,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       io.NopCloser(bytes.NewBufferString(interaction.ResponseBody)),
+			Request:    req,
+		}, nil
+	}
+	return nil, fmt.Errorf("vcr: no recorded interaction left for %s %s in %s", req.Method, req.URL.Path, t.path)
+}
+
+func (t *VCRTransport) save() error {
+	data, err := json.MarshalIndent(t.cassette, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(t.path), 0755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(t.path, data, 0644)
+}
+
+// readRequestBody returns the body in a canonical form (the keys are sorted)
+// and puts it back on the request for the real transport
+func readRequestBody(req *http.Request) (json.RawMessage, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	if len(body) == 0 {
+		return nil, nil
+	}
+	return canonicalJSON(body)
+}
+
+// canonicalJSON returns the compact JSON with the keys sorted
+func canonicalJSON(data []byte) (json.RawMessage, error) {
+	var value any
+	err := json.Unmarshal(data, &value)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ollama/ollama/api"
+	"github.com/ollama/ollama/envconfig"
+)
+
+// go test -run TestVCRReplayRun -record records the cassette again (OLLAMA_HOST, with qwen2.5:0.5b)
+var record = flag.Bool("record", false, "record the cassettes of testdata against Ollama")
+
+func vcrPost(t *testing.T, client *http.Client, url, body string) (string, error) {
+	t.Helper()
+	resp, err := client.Post(url+"/api/chat", "application/json", strings.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data), nil
+}
+
+func TestVCRRecordReplay(t *testing.T) {
+	calls := 0
+	ollama := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := io.ReadAll(r.Body)
+		w.Write([]byte(`{"echo":` + string(body) + `}`))
+	}))
+	defer ollama.Close()
+	cassette := filepath.Join(t.TempDir(), "cassettes", "chat.json")
+	body := `{"model":"qwen2.5:0.5b","messages":[{"role":"user","content":"Generate a name"}],"options":{"temperature":1.5,"seed":42}}`
+
+	recorder, err := NewVCRTransport("record", cassette, http.DefaultTransport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded, err := vcrPost(t, &http.Client{Transport: recorder}, ollama.URL, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	player, err := NewVCRTransport("replay", cassette, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: player}
+	// the keys in another order and another spacing are the same request
+	replayed, err := vcrPost(t, client, ollama.URL, `{"options": {"seed": 42, "temperature": 1.5}, "model": "qwen2.5:0.5b", "messages": [{"role": "user", "content": "Generate a name"}]}`)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if replayed != recorded {
+		t.Errorf("replayed %s, recorded %s", replayed, recorded)
+	}
+	if calls != 1 {
+		t.Errorf("Ollama called %d times, want 1", calls)
+	}
+
+	// an interaction is served once
+	_, err = vcrPost(t, client, ollama.URL, body)
+	if err == nil {
+		t.Error("the interaction was replayed twice")
+	}
+	player, err = NewVCRTransport("replay", cassette, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = vcrPost(t, &http.Client{Transport: player}, ollama.URL, strings.Replace(body, "Generate a name", "Generate a place", 1))
+	if err == nil {
+		t.Error("another request was replayed")
+	}
+}
+
+// TestVCRReplayRun replays a whole run from testdata/cassettes: generation -> parse -> dedup -> store -> export
+func TestVCRReplayRun(t *testing.T) {
+	cassette := filepath.Join("testdata", "cassettes", "run.Dwarf.json")
+	golden := strings.TrimSuffix(cassette, ".json") + ".md"
+	transport, err := NewVCRTransport("replay", cassette, nil)
+	if *record {
+		os.Remove(cassette)
+		transport, err = NewVCRTransport("record", cassette, http.DefaultTransport)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	generator := NewGenerator(api.NewClient(envconfig.Host(), &http.Client{Transport: transport}), "qwen2.5:0.5b")
+	generator.seed = 1
+	storage := NewStorage(t.TempDir())
+	registry, err := storage.Registry(DefaultCampaign)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spec := Spec{Kind: "Dwarf", Count: 5}
+	slots := []Slot{}
+	metrics, err := GenerateParallel(context.Background(), generator, registry.Deduper(), spec, 1, func(slot Slot) error {
+		stored := []Slot{slot}
+		err := StoreSlots(registry, stored)
+		slots = append(slots, stored[0])
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.SortFunc(slots, func(a, b Slot) int { return a.Index - b.Index })
+	exportPath, err := storage.ExportPath(DefaultCampaign, "characters.Dwarf.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := RunOutput{Campaign: DefaultCampaign, Genre: generator.genre.Name, Spec: spec, Slots: slots, Metrics: metrics}
+	sortOptions, _ := NewSortOptions(SortByOrder, CollationBinary)
+	err = output.Write(exportPath, sortOptions, generator.genre, MarkdownOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the stored names are the names of the run, without duplicates
+	stored := []string{}
+	for _, character := range registry.List() {
+		stored = append(stored, character.Name)
+	}
+	generated := []string{}
+	for _, character := range output.Characters() {
+		generated = append(generated, character.Name)
+	}
+	slices.Sort(stored)
+	slices.Sort(generated)
+	if len(stored) == 0 || !slices.Equal(stored, generated) || len(slices.Compact(slices.Clone(stored))) != len(stored) {
+		t.Errorf("stored %v, generated %v", stored, generated)
+	}
+
+	exported, err := os.ReadFile(strings.TrimSuffix(exportPath, ".json") + ".md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range stored {
+		if !strings.Contains(string(exported), name) {
+			t.Errorf("%s is not exported", name)
+		}
+	}
+	if *record {
+		err = os.WriteFile(golden, exported, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	expected, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(exported) != string(expected) {
+		t.Errorf("the export differs from %s:\n%s", golden, exported)
+	}
+}
@@ -0,0 +1,174 @@
+package vector
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+)
+
+// magic starts the files of the indexes, with the version of the format
+const magic = "NPCHNSW1"
+
+// ErrFormat is a file that isn't an index (or of another version), the index is built again
+var ErrFormat = errors.New("not a vector index file")
+
+// WriteTo writes the graph: the options, then every node with its vector and its friends (little endian)
+func (x *Index) WriteTo(w io.Writer) (int64, error) {
+	x.mutex.RLock()
+	defer x.mutex.RUnlock()
+	writer := &countingWriter{w: bufio.NewWriter(w)}
+	writer.write([]byte(magic))
+	writer.write(uint32(x.options.M), uint32(x.options.EfConstruction), uint32(x.options.EfSearch))
+	writer.write(uint32(x.dimensions), x.entry, uint32(len(x.nodes)))
+	for _, node := range x.nodes {
+		writer.write(uint32(len(node.id)), []byte(node.id), node.deleted, node.vector)
+		writer.write(uint32(len(node.friends)))
+		for _, friends := range node.friends {
+			writer.write(uint32(len(friends)), friends)
+		}
+	}
+	if writer.err == nil {
+		writer.err = writer.w.Flush()
+	}
+	return writer.n, writer.err
+}
+
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) write(values ...any) {
+	for _, value := range values {
+		if c.err != nil {
+			return
+		}
+		c.err = binary.Write(c.w, binary.LittleEndian, value)
+		c.n += int64(binary.Size(value))
+	}
+}
+
+// Read reads a graph written by WriteTo
+func Read(r io.Reader) (*Index, error) {
+	reader := bufio.NewReader(r)
+	header := make([]byte, len(magic))
+	_, err := io.ReadFull(reader, header)
+	if err != nil || string(header) != magic {
+		return nil, ErrFormat
+	}
+	var m, efConstruction, efSearch, dimensions, count uint32
+	var entry int32
+	for _, value := range []any{&m, &efConstruction, &efSearch, &dimensions, &entry, &count} {
+		err = binary.Read(reader, binary.LittleEndian, value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrFormat, err)
+		}
+	}
+	x := New(Options{M: int(m), EfConstruction: int(efConstruction), EfSearch: int(efSearch)})
+	x.dimensions, x.entry = int(dimensions), entry
+	x.nodes = make([]node, count)
+	for idx := range x.nodes {
+		err = x.readNode(reader, &x.nodes[idx])
+		if err != nil {
+			return nil, fmt.Errorf("%w: node %d: %w", ErrFormat, idx, err)
+		}
+		if x.nodes[idx].deleted {
+			x.deleted++
+		} else {
+			x.ids[x.nodes[idx].id] = int32(idx)
+		}
+	}
+	if entry >= int32(count) || (count > 0 && entry < 0) {
+		return nil, fmt.Errorf("%w: entry %d of %d nodes", ErrFormat, entry, count)
+	}
+	// the next levels don't repeat the levels drawn before the save
+	x.random = rand.New(rand.NewPCG(42, uint64(count)))
+	return x, nil
+}
+
+func (x *Index) readNode(reader io.Reader, node *node) error {
+	var length uint32
+	err := binary.Read(reader, binary.LittleEndian, &length)
+	if err != nil {
+		return err
+	}
+	id := make([]byte, length)
+	node.vector = make([]float32, x.dimensions)
+	for _, value := range []any{id, &node.deleted, node.vector, &length} {
+		err = binary.Read(reader, binary.LittleEndian, value)
+		if err != nil {
+			return err
+		}
+	}
+	node.id = string(id)
+	node.friends = make([][]int32, length)
+	for layer := range node.friends {
+		err = binary.Read(reader, binary.LittleEndian, &length)
+		if err != nil {
+			return err
+		}
+		node.friends[layer] = make([]int32, length)
+		err = binary.Read(reader, binary.LittleEndian, node.friends[layer])
+		if err != nil {
+			return err
+		}
+		for _, friend := range node.friends[layer] {
+			if friend < 0 || int(friend) >= len(x.nodes) {
+				return fmt.Errorf("friend %d of %d nodes", friend, len(x.nodes))
+			}
+		}
+	}
+	return nil
+}
+
+// Load reads the index of the file, a missing file is an empty index
+func Load(path string, options Options) (*Index, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return New(options), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	x, err := Read(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	// the searches use the current EfSearch, the graph keeps the options it was built with
+	x.options.EfSearch = max(options.EfSearch, 1)
+	return x, nil
+}
+
+// Save writes the index to the file through a temporary file, a crash never leaves half an index
+func (x *Index) Save(path string) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), ".index-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	_, err = x.WriteTo(file)
+	if err == nil {
+		err = file.Chmod(0644)
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
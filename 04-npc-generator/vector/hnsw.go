@@ -0,0 +1,430 @@
+// Package vector is the index of the embeddings (the campaign notes, the names of the dedup):
+// a Hierarchical Navigable Small World graph (HNSW, Malkov and Yashunin) of cosine similarities.
+// A search visits a few hundred vectors instead of all of them, the results are approximate
+// (the recall grows with EfSearch). The vectors are added one by one, the removed ones are
+// skipped until Compact, and the graph is saved to a file so it isn't built again at every start
+package vector
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sync"
+)
+
+// ErrDimensions is a vector of another size than the vectors of the index (another embedding model)
+var ErrDimensions = errors.New("vector dimensions mismatch")
+
+// Options are the parameters of the graph
+type Options struct {
+	// M is the number of neighbors of a node (2*M on the bottom layer)
+	M int
+	// EfConstruction is the number of candidates of an insertion, the quality of the graph
+	EfConstruction int
+	// EfSearch is the number of candidates of a search, the recall of the searches
+	EfSearch int
+}
+
+// DefaultOptions are good for a few hundred thousand vectors
+var DefaultOptions = Options{M: 16, EfConstruction: 100, EfSearch: 64}
+
+// Result is a vector found by a search, Score is its cosine similarity with the query
+type Result struct {
+	ID    string
+	Score float64
+}
+
+type node struct {
+	id      string
+	vector  []float32
+	deleted bool
+	// friends are the neighbors of the node on every layer, from the bottom one
+	friends [][]int32
+}
+
+// Index is a HNSW graph of normalized vectors identified by a string, safe for concurrent use
+type Index struct {
+	mutex      sync.RWMutex
+	options    Options
+	dimensions int
+	nodes      []node
+	ids        map[string]int32
+	entry      int32
+	deleted    int
+	random     *rand.Rand
+}
+
+func New(options Options) *Index {
+	if options.M < 2 {
+		options.M = DefaultOptions.M
+	}
+	options.EfConstruction = max(options.EfConstruction, options.M)
+	options.EfSearch = max(options.EfSearch, 1)
+	return &Index{options: options, ids: map[string]int32{}, entry: -1, random: rand.New(rand.NewPCG(42, 0))}
+}
+
+// Len is the number of vectors of the index, without the removed ones
+func (x *Index) Len() int {
+	x.mutex.RLock()
+	defer x.mutex.RUnlock()
+	return len(x.ids)
+}
+
+// Deleted is the number of removed vectors still in the graph (until Compact)
+func (x *Index) Deleted() int {
+	x.mutex.RLock()
+	defer x.mutex.RUnlock()
+	return x.deleted
+}
+
+// Has is true when a vector of the index has this id
+func (x *Index) Has(id string) bool {
+	x.mutex.RLock()
+	defer x.mutex.RUnlock()
+	_, ok := x.ids[id]
+	return ok
+}
+
+// IDs returns the ids of the vectors of the index
+func (x *Index) IDs() []string {
+	x.mutex.RLock()
+	defer x.mutex.RUnlock()
+	ids := make([]string, 0, len(x.ids))
+	for id := range x.ids {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// Get returns the normalized vector of the id
+func (x *Index) Get(id string) ([]float32, bool) {
+	x.mutex.RLock()
+	defer x.mutex.RUnlock()
+	idx, ok := x.ids[id]
+	if !ok {
+		return nil, false
+	}
+	return x.nodes[idx].vector, true
+}
+
+func normalize(vector []float32) []float32 {
+	var norm float64
+	for _, value := range vector {
+		norm += float64(value) * float64(value)
+	}
+	normalized := make([]float32, len(vector))
+	if norm == 0 {
+		return normalized
+	}
+	norm = math.Sqrt(norm)
+	for idx, value := range vector {
+		normalized[idx] = float32(float64(value) / norm)
+	}
+	return normalized
+}
+
+// similarity is the cosine similarity of two normalized vectors
+func similarity(a, b []float32) float64 {
+	var dot float32
+	for idx := range a {
+		dot += a[idx] * b[idx]
+	}
+	return float64(dot)
+}
+
+// Add inserts the vector, a vector with the same id is replaced
+func (x *Index) Add(id string, vector []float32) error {
+	if len(vector) == 0 {
+		return fmt.Errorf("%s: %w: empty vector", id, ErrDimensions)
+	}
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	if x.dimensions == 0 {
+		x.dimensions = len(vector)
+	}
+	if len(vector) != x.dimensions {
+		return fmt.Errorf("%s: %w: %d, the index has %d", id, ErrDimensions, len(vector), x.dimensions)
+	}
+	if previous, ok := x.ids[id]; ok {
+		x.remove(previous)
+	}
+	x.insert(id, normalize(vector))
+	return nil
+}
+
+// Remove takes the vector out of the results, it stays in the graph until Compact
+func (x *Index) Remove(id string) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	if idx, ok := x.ids[id]; ok {
+		x.remove(idx)
+	}
+}
+
+func (x *Index) remove(idx int32) {
+	delete(x.ids, x.nodes[idx].id)
+	x.nodes[idx].deleted = true
+	x.deleted++
+}
+
+// randomLevel draws the top layer of a new node, every layer has 1/M of the nodes of the layer below
+func (x *Index) randomLevel() int {
+	level := int(-math.Log(1-x.random.Float64()) / math.Log(float64(x.options.M)))
+	return min(level, 16)
+}
+
+func (x *Index) maxFriends(layer int) int {
+	if layer == 0 {
+		return 2 * x.options.M
+	}
+	return x.options.M
+}
+
+func (x *Index) insert(id string, vector []float32) {
+	idx := int32(len(x.nodes))
+	level := x.randomLevel()
+	x.nodes = append(x.nodes, node{id: id, vector: vector, friends: make([][]int32, level+1)})
+	x.ids[id] = idx
+	if x.entry < 0 {
+		x.entry = idx
+		return
+	}
+
+	entry := x.entry
+	top := len(x.nodes[entry].friends) - 1
+	for layer := top; layer > level; layer-- {
+		entry = x.greedy(vector, entry, layer)
+	}
+	entries := []int32{entry}
+	for layer := min(level, top); layer >= 0; layer-- {
+		candidates := x.searchLayer(vector, entries, x.options.EfConstruction, layer)
+		friends := x.selectFriends(candidates, x.options.M)
+		x.nodes[idx].friends[layer] = friends
+		for _, friend := range friends {
+			x.connect(friend, idx, layer)
+		}
+		entries = entries[:0]
+		for _, candidate := range candidates {
+			entries = append(entries, candidate.node)
+		}
+	}
+	if level > top {
+		x.entry = idx
+	}
+}
+
+// connect adds the link from to the node to, the farthest friend is dropped beyond the maximum
+func (x *Index) connect(from, to int32, layer int) {
+	friends := append(x.nodes[from].friends[layer], to)
+	if len(friends) > x.maxFriends(layer) {
+		candidates := make([]candidate, len(friends))
+		for idx, friend := range friends {
+			candidates[idx] = candidate{friend, similarity(x.nodes[from].vector, x.nodes[friend].vector)}
+		}
+		slices.SortFunc(candidates, func(a, b candidate) int { return compareScores(b.score, a.score) })
+		friends = friends[:0]
+		for _, candidate := range candidates[:x.maxFriends(layer)] {
+			friends = append(friends, candidate.node)
+		}
+	}
+	x.nodes[from].friends[layer] = friends
+}
+
+// selectFriends keeps the m closest candidates (the candidates are sorted by decreasing score)
+func (x *Index) selectFriends(candidates []candidate, m int) []int32 {
+	friends := make([]int32, 0, m)
+	for _, candidate := range candidates[:min(m, len(candidates))] {
+		friends = append(friends, candidate.node)
+	}
+	return friends
+}
+
+// greedy moves from the entry to the closest node of the layer
+func (x *Index) greedy(vector []float32, entry int32, layer int) int32 {
+	best := similarity(vector, x.nodes[entry].vector)
+	for changed := true; changed; {
+		changed = false
+		for _, friend := range x.nodes[entry].friends[layer] {
+			if score := similarity(vector, x.nodes[friend].vector); score > best {
+				best, entry, changed = score, friend, true
+			}
+		}
+	}
+	return entry
+}
+
+type candidate struct {
+	node  int32
+	score float64
+}
+
+func compareScores(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// candidates is a binary heap of the closest candidates first (best) or the farthest first (!best)
+type candidates struct {
+	items []candidate
+	best  bool
+}
+
+func (c *candidates) before(i, j int) bool {
+	if c.best {
+		return c.items[i].score > c.items[j].score
+	}
+	return c.items[i].score < c.items[j].score
+}
+
+func (c *candidates) push(item candidate) {
+	c.items = append(c.items, item)
+	for idx := len(c.items) - 1; idx > 0; {
+		parent := (idx - 1) / 2
+		if !c.before(idx, parent) {
+			break
+		}
+		c.items[idx], c.items[parent] = c.items[parent], c.items[idx]
+		idx = parent
+	}
+}
+
+func (c *candidates) pop() candidate {
+	top := c.items[0]
+	last := len(c.items) - 1
+	c.items[0] = c.items[last]
+	c.items = c.items[:last]
+	for idx := 0; ; {
+		child := 2*idx + 1
+		if child >= last {
+			break
+		}
+		if child+1 < last && c.before(child+1, child) {
+			child++
+		}
+		if !c.before(child, idx) {
+			break
+		}
+		c.items[idx], c.items[child] = c.items[child], c.items[idx]
+		idx = child
+	}
+	return top
+}
+
+// visitedSet is the set of the nodes visited by a search, reset by the list of its nodes
+type visitedSet struct {
+	marks   []bool
+	visited []int32
+}
+
+var visitedSets = sync.Pool{New: func() any { return &visitedSet{} }}
+
+func (v *visitedSet) visit(node int32) bool {
+	if v.marks[node] {
+		return false
+	}
+	v.marks[node] = true
+	v.visited = append(v.visited, node)
+	return true
+}
+
+func (v *visitedSet) reset() {
+	for _, node := range v.visited {
+		v.marks[node] = false
+	}
+	v.visited = v.visited[:0]
+}
+
+// searchLayer returns the ef closest nodes of the layer, by decreasing score;
+// the removed nodes are still visited (they link the graph) and returned
+func (x *Index) searchLayer(vector []float32, entries []int32, ef, layer int) []candidate {
+	visited := visitedSets.Get().(*visitedSet)
+	defer visitedSets.Put(visited)
+	defer visited.reset()
+	if len(visited.marks) < len(x.nodes) {
+		visited.marks = make([]bool, len(x.nodes)*2)
+	}
+	toVisit := &candidates{best: true}
+	found := &candidates{items: make([]candidate, 0, ef+1)}
+	for _, entry := range entries {
+		visited.visit(entry)
+		item := candidate{entry, similarity(vector, x.nodes[entry].vector)}
+		toVisit.push(item)
+		found.push(item)
+	}
+	for len(toVisit.items) > 0 {
+		current := toVisit.pop()
+		if len(found.items) >= ef && current.score < found.items[0].score {
+			break
+		}
+		for _, friend := range x.nodes[current.node].friends[layer] {
+			if !visited.visit(friend) {
+				continue
+			}
+			score := similarity(vector, x.nodes[friend].vector)
+			if len(found.items) < ef || score > found.items[0].score {
+				toVisit.push(candidate{friend, score})
+				found.push(candidate{friend, score})
+				if len(found.items) > ef {
+					found.pop()
+				}
+			}
+		}
+	}
+	slices.SortFunc(found.items, func(a, b candidate) int { return compareScores(b.score, a.score) })
+	return found.items
+}
+
+// Search returns the k vectors closest to the query, by decreasing similarity
+func (x *Index) Search(query []float32, k int) ([]Result, error) {
+	x.mutex.RLock()
+	defer x.mutex.RUnlock()
+	if len(x.ids) == 0 || k < 1 {
+		return nil, nil
+	}
+	if len(query) != x.dimensions {
+		return nil, fmt.Errorf("query: %w: %d, the index has %d", ErrDimensions, len(query), x.dimensions)
+	}
+	vector := normalize(query)
+	entry := x.entry
+	for layer := len(x.nodes[entry].friends) - 1; layer > 0; layer-- {
+		entry = x.greedy(vector, entry, layer)
+	}
+	// the removed nodes take places among the candidates
+	ef := max(x.options.EfSearch, k) + min(x.deleted, k)
+	results := []Result{}
+	for _, candidate := range x.searchLayer(vector, []int32{entry}, ef, 0) {
+		if x.nodes[candidate.node].deleted {
+			continue
+		}
+		results = append(results, Result{ID: x.nodes[candidate.node].id, Score: candidate.score})
+		if len(results) == k {
+			break
+		}
+	}
+	return results, nil
+}
+
+// Compact builds the graph again without the removed vectors
+func (x *Index) Compact() {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	if x.deleted == 0 {
+		return
+	}
+	nodes := x.nodes
+	x.nodes, x.ids, x.entry, x.deleted = nil, map[string]int32{}, -1, 0
+	x.random = rand.New(rand.NewPCG(42, 0))
+	for _, node := range nodes {
+		if !node.deleted {
+			x.insert(node.id, node.vector)
+		}
+	}
+}
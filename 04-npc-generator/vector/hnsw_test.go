@@ -0,0 +1,161 @@
+package vector
+
+import (
+	"math/rand/v2"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+// randomVectors returns count seeded vectors of the dimensions
+func randomVectors(count, dimensions int) [][]float32 {
+	random := rand.New(rand.NewPCG(7, 0))
+	vectors := make([][]float32, count)
+	for idx := range vectors {
+		vectors[idx] = make([]float32, dimensions)
+		for d := range vectors[idx] {
+			vectors[idx][d] = float32(random.NormFloat64())
+		}
+	}
+	return vectors
+}
+
+// bruteForce returns the IDs of the k vectors closest to the query
+func bruteForce(vectors [][]float32, query []float32, k int) []string {
+	results := []Result{}
+	for idx, vector := range vectors {
+		results = append(results, Result{ID: strconv.Itoa(idx), Score: similarity(normalize(query), normalize(vector))})
+	}
+	slices.SortFunc(results, func(a, b Result) int { return compareScores(b.Score, a.Score) })
+	ids := []string{}
+	for _, result := range results[:k] {
+		ids = append(ids, result.ID)
+	}
+	return ids
+}
+
+func newIndex(t *testing.T, vectors [][]float32) *Index {
+	t.Helper()
+	index := New(DefaultOptions)
+	for idx, vector := range vectors {
+		err := index.Add(strconv.Itoa(idx), vector)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return index
+}
+
+func TestSearchRecall(t *testing.T) {
+	vectors := randomVectors(2000, 32)
+	index := newIndex(t, vectors)
+	queries := randomVectors(2050, 32)[2000:]
+
+	const k = 10
+	found := 0
+	for _, query := range queries {
+		results, err := index.Search(query, k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != k {
+			t.Fatalf("%d results, want %d", len(results), k)
+		}
+		if !slices.IsSortedFunc(results, func(a, b Result) int { return compareScores(b.Score, a.Score) }) {
+			t.Errorf("the results are not sorted by decreasing similarity: %v", results)
+		}
+		exact := bruteForce(vectors, query, k)
+		for _, result := range results {
+			if slices.Contains(exact, result.ID) {
+				found++
+			}
+		}
+	}
+	if recall := float64(found) / float64(len(queries)*k); recall < 0.9 {
+		t.Errorf("recall %.2f against the brute force, want at least 0.9", recall)
+	}
+
+	// a vector of the index is its own closest vector
+	results, _ := index.Search(vectors[123], 1)
+	if len(results) != 1 || results[0].ID != "123" {
+		t.Errorf("search of the vector 123: %v", results)
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	vectors := randomVectors(500, 16)
+	index := newIndex(t, vectors)
+	index.Remove("42")
+	path := filepath.Join(t.TempDir(), "names.hnsw")
+	err := index.Save(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(path, DefaultOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Len() != index.Len() || loaded.Deleted() != 1 || loaded.Has("42") {
+		t.Errorf("loaded %d vectors (%d removed), saved %d", loaded.Len(), loaded.Deleted(), index.Len())
+	}
+	for _, query := range randomVectors(520, 16)[500:] {
+		saved, _ := index.Search(query, 5)
+		found, err := loaded.Search(query, 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(saved, found) {
+			t.Errorf("loaded index found %v, the saved one %v", found, saved)
+		}
+	}
+	// the same graph gets the same insertions
+	err = loaded.Add("new", vectors[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results, _ := loaded.Search(vectors[0], 2); len(results) != 2 || !slices.ContainsFunc(results, func(result Result) bool { return result.ID == "new" }) {
+		t.Errorf("search after an insertion in the loaded index: %v", results)
+	}
+}
+
+func TestEmptyIndex(t *testing.T) {
+	index := New(DefaultOptions)
+	results, err := index.Search([]float32{1, 0, 0}, 5)
+	if err != nil || len(results) != 0 {
+		t.Errorf("search of an empty index: %v, %v", results, err)
+	}
+	if index.Len() != 0 || index.Has("a") || len(index.IDs()) != 0 {
+		t.Error("the empty index has vectors")
+	}
+	if _, ok := index.Get("a"); ok {
+		t.Error("the empty index has a vector")
+	}
+	index.Remove("a")
+	index.Compact()
+
+	// an empty index is saved and loaded, a missing file is an empty index
+	dir := t.TempDir()
+	path := filepath.Join(dir, "empty.hnsw")
+	err = index.Save(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{path, filepath.Join(dir, "missing.hnsw")} {
+		loaded, err := Load(path, DefaultOptions)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if loaded.Len() != 0 {
+			t.Errorf("%s: %d vectors", path, loaded.Len())
+		}
+		// the first vector sets the dimensions
+		err = loaded.Add("a", []float32{1, 0, 0})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loaded.Search([]float32{1, 0}, 1); err == nil {
+			t.Errorf("%s: a query of another size was accepted", path)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"04-npc-generator/vector"
+)
+
+// vectorOptions are the options of the vector indexes of the embeddings,
+// VECTOR_EF_SEARCH trades the speed of the searches for their recall
+func vectorOptions() (vector.Options, error) {
+	options := vector.DefaultOptions
+	efSearch, err := strconv.Atoi(getEnv("VECTOR_EF_SEARCH", strconv.Itoa(options.EfSearch)))
+	if err != nil || efSearch < 1 {
+		return options, fmt.Errorf("VECTOR_EF_SEARCH must be a positive number, got %q", getEnv("VECTOR_EF_SEARCH", ""))
+	}
+	options.EfSearch = efSearch
+	return options, nil
+}
+
+// SaveIndexes writes the vector indexes changed by the command (the embeddings of the names)
+func (g *Generator) SaveIndexes() error {
+	errs := []error{}
+	for _, strategy := range g.dedup {
+		if strategy.Save != nil {
+			errs = append(errs, strategy.Save())
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ollama/ollama/api"
+)
+
+var verificationSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"compliant": map[string]any{"type": "boolean"},
+		"reasons": map[string]any{
+			"type":     "array",
+			"items":    map[string]any{"type": "string", "maxLength": 200},
+			"maxItems": 5,
+		},
+	},
+	"required": []string{"compliant", "reasons"},
+}
+
+// Verification is the second pass of the strict mode
+type Verification struct {
+	Compliant bool     `json:"compliant"`
+	Reasons   []string `json:"reasons"`
+}
+
+// Verify sends the accepted character back to the model with the rules of the spec
+// (the naming rules of the kind, the game system, the equipment), the model tells whether
+// the character complies: the rules a JSON schema can't express are checked this way
+func (g *Generator) Verify(ctx context.Context, spec Spec, character Character) (Verification, error) {
+	verification := Verification{}
+	characterJSON, err := json.Marshal(character)
+	if err != nil {
+		return verification, err
+	}
+
+	rules := GenerationInstructions(g.kinds)
+	if len(spec.Parents) == 2 {
+		rules = hybridInstructions(g.kinds, spec.Kind, spec.Parents)
+	}
+	system, err := g.System(spec.System)
+	if err != nil {
+		return verification, err
+	}
+	if system != nil {
+		rules += fmt.Sprintf("\nThe character is for %s. %s\n", system.Title, system.Vocabulary)
+	}
+	if character.Equipment != nil {
+		rules += fmt.Sprintf("\nThe equipment must suit a level %d %s.\n", character.Level, character.Class)
+	}
+
+	userContent := fmt.Sprintf(
+		"Here are the rules:\n%s\nVerify that this %s complies with the rules and the kind (%s): %s\n"+
+			"Answer compliant true or false, with the reasons of a false.",
+		rules, spec.Kind, spec.Kind, characterJSON,
+	)
+	messages := []api.Message{
+		{Role: "system", Content: "You are a strict reviewer of generated characters for role playing games."},
+		{Role: "user", Content: userContent},
+	}
+	answer, err := g.chat(ctx, DomainVerify, messages, verificationSchema, map[string]interface{}{"temperature": 0.0, "seed": 1})
+	if err != nil {
+		return verification, err
+	}
+	err = decodeAnswer(answer.Content, &verification)
+	if err != nil {
+		return verification, fmt.Errorf("verification: %w", err)
+	}
+	return verification, nil
+}
+
+// String is the log of a failed verification
+func (v Verification) String() string {
+	if len(v.Reasons) == 0 {
+		return "no reason given"
+	}
+	return strings.Join(v.Reasons, "; ")
+}
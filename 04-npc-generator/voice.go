@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Formats of the voice scripts
+const (
+	VoiceSSML       = "ssml"       // a .ssml file per character
+	VoiceElevenLabs = "elevenlabs" // a JSON script with the voice settings and a voice description
+	VoiceCoqui      = "coqui"      // a JSON Lines script with the speaker and the speed
+)
+
+// VoiceHint is the prosody of a character: Pitch in percent (SSML relative pitch),
+// Rate as a factor of the normal pace
+type VoiceHint struct {
+	Pitch       int     `json:"pitch"`
+	Rate        float64 `json:"rate"`
+	Description string  `json:"description"`
+}
+
+// kindVoices are the hints of the built-in kinds and of the genre packs,
+// the other kinds get a neutral voice
+var kindVoices = map[string]VoiceHint{
+	"dwarf":          {Pitch: -20, Rate: 0.9, Description: "deep, gravelly and deliberate"},
+	"elf":            {Pitch: 10, Rate: 0.92, Description: "clear, airy and measured"},
+	"human":          {Pitch: 0, Rate: 1.0, Description: "natural"},
+	"android":        {Pitch: -5, Rate: 0.95, Description: "even, precise and slightly synthetic"},
+	"alien":          {Pitch: 15, Rate: 0.9, Description: "unusual, with a foreign cadence"},
+	"spacer":         {Pitch: 0, Rate: 1.05, Description: "brisk and practical"},
+	"netrunner":      {Pitch: 5, Rate: 1.15, Description: "fast and wired"},
+	"corpo":          {Pitch: 0, Rate: 0.95, Description: "smooth and controlled"},
+	"street samurai": {Pitch: -10, Rate: 0.95, Description: "low and clipped"},
+	"outlaw":         {Pitch: -10, Rate: 0.95, Description: "rough drawl"},
+	"lawman":         {Pitch: -5, Rate: 0.9, Description: "slow, steady drawl"},
+	"homesteader":    {Pitch: 0, Rate: 1.0, Description: "warm and plain"},
+}
+
+// VoiceFor derives the hint from the kind (the parents of a hybrid are averaged)
+// and the age group: the young speak higher and faster, the elders lower and slower
+func VoiceFor(character Character) VoiceHint {
+	kinds := character.Parents
+	if len(kinds) == 0 {
+		kinds = []string{character.Kind}
+	}
+	hint := VoiceHint{}
+	descriptions := []string{}
+	for _, kind := range kinds {
+		kindHint, ok := kindVoices[strings.ToLower(kind)]
+		if !ok {
+			kindHint = kindVoices["human"]
+		}
+		hint.Pitch += kindHint.Pitch
+		hint.Rate += kindHint.Rate
+		descriptions = append(descriptions, kindHint.Description)
+	}
+	hint.Pitch /= len(kinds)
+	hint.Rate /= float64(len(kinds))
+
+	age := character.Age
+	switch age {
+	case AgeYoung:
+		hint.Pitch, hint.Rate = hint.Pitch+10, hint.Rate+0.08
+	case AgeElder:
+		hint.Pitch, hint.Rate = hint.Pitch-10, hint.Rate-0.1
+	default:
+		age = AgeAdult
+	}
+	hint.Rate = math.Round(hint.Rate*100) / 100
+	hint.Description = fmt.Sprintf("%s %s voice, %s", age, character.Kind, strings.Join(descriptions, " and "))
+	return hint
+}
+
+// ssmlEscape escapes the text of an SSML element
+func ssmlEscape(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;", "'", "&apos;").Replace(text)
+}
+
+// CharacterSSML is the SSML document of the lines of the character, with its prosody
+func CharacterSSML(character Character) string {
+	hint := VoiceFor(character)
+	builder := strings.Builder{}
+	builder.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	builder.WriteString(`<speak version="1.1" xmlns="http://www.w3.org/2001/10/synthesis" xml:lang="en-US">` + "\n")
+	fmt.Fprintf(&builder, "  <!-- %s: %s -->\n", ssmlEscape(character.Name), ssmlEscape(hint.Description))
+	fmt.Fprintf(&builder, "  <prosody pitch=\"%+d%%\" rate=\"%d%%\">\n", hint.Pitch, int(hint.Rate*100))
+	for idx, line := range character.Lines {
+		fmt.Fprintf(&builder, "    <mark name=\"%s-%d\"/>\n", ssmlEscape(character.Code), idx+1)
+		fmt.Fprintf(&builder, "    <p>%s</p>\n", ssmlEscape(line))
+		if idx < len(character.Lines)-1 {
+			builder.WriteString("    <break time=\"700ms\"/>\n")
+		}
+	}
+	builder.WriteString("  </prosody>\n</speak>\n")
+	return builder.String()
+}
+
+// ElevenLabsLine is a line of the ElevenLabs script: the voice description designs the voice
+// of the speaker once, the settings go with every text-to-speech request
+type ElevenLabsLine struct {
+	Speaker          string             `json:"speaker"`
+	VoiceDescription string             `json:"voice_description"`
+	VoiceSettings    ElevenLabsSettings `json:"voice_settings"`
+	Text             string             `json:"text"`
+}
+
+// ElevenLabsSettings are the voice settings of the text-to-speech API (speed: 0.7 to 1.2)
+type ElevenLabsSettings struct {
+	Stability       float64 `json:"stability"`
+	SimilarityBoost float64 `json:"similarity_boost"`
+	Speed           float64 `json:"speed"`
+}
+
+// CoquiLine is a line of the Coqui TTS script
+type CoquiLine struct {
+	Speaker  string  `json:"speaker"`
+	Language string  `json:"language"`
+	Speed    float64 `json:"speed"`
+	Text     string  `json:"text"`
+}
+
+// WriteVoiceScripts writes the scripts of the characters with lines in dir,
+// it returns the paths of the written files
+func WriteVoiceScripts(characters []Character, format, dir string) ([]string, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	paths := []string{}
+	elevenLabs := []ElevenLabsLine{}
+	coqui := strings.Builder{}
+	for _, character := range characters {
+		if len(character.Lines) == 0 {
+			continue
+		}
+		hint := VoiceFor(character)
+		speaker := character.Code + " " + character.Name
+		for _, line := range character.Lines {
+			elevenLabs = append(elevenLabs, ElevenLabsLine{
+				Speaker: speaker, VoiceDescription: hint.Description, Text: line,
+				VoiceSettings: ElevenLabsSettings{Stability: 0.5, SimilarityBoost: 0.75, Speed: min(max(hint.Rate, 0.7), 1.2)},
+			})
+			data, err := json.Marshal(CoquiLine{Speaker: speaker, Language: "en", Speed: hint.Rate, Text: line})
+			if err != nil {
+				return nil, err
+			}
+			coqui.Write(append(data, '\n'))
+		}
+		if format == VoiceSSML {
+			path := filepath.Join(dir, character.Code+".ssml")
+			err = os.WriteFile(path, []byte(CharacterSSML(character)), 0644)
+			if err != nil {
+				return nil, err
+			}
+			paths = append(paths, path)
+		}
+	}
+
+	switch format {
+	case VoiceSSML:
+		return paths, nil
+	case VoiceElevenLabs:
+		data, err := json.MarshalIndent(elevenLabs, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		path := filepath.Join(dir, "script.elevenlabs.json")
+		return []string{path}, os.WriteFile(path, data, 0644)
+	case VoiceCoqui:
+		path := filepath.Join(dir, "script.coqui.jsonl")
+		return []string{path}, os.WriteFile(path, []byte(coqui.String()), 0644)
+	}
+	return nil, fmt.Errorf("unknown voice format %q (%s, %s, %s)", format, VoiceSSML, VoiceElevenLabs, VoiceCoqui)
+}
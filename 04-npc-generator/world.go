@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ollama/ollama/api"
+)
+
+// WorldSeed is the configuration of a whole setting (world build)
+type WorldSeed struct {
+	Name     string        `json:"name"`
+	Campaign string        `json:"campaign"`
+	Regions  []WorldRegion `json:"regions"`
+	Factions int           `json:"factions"`
+	Events   int           `json:"events"`
+}
+
+// WorldRegion names its characters with its culture: a kind or a hybrid (dwarf+human)
+type WorldRegion struct {
+	Name        string            `json:"name"`
+	Culture     string            `json:"culture"`
+	Settlements []WorldSettlement `json:"settlements"`
+}
+
+// WorldSettlement gets Population characters, its name is generated when it is missing
+type WorldSettlement struct {
+	Name       string   `json:"name"`
+	Population int      `json:"population"`
+	Characters []string `json:"characters,omitempty"`
+}
+
+// LoadWorldSeed reads and checks the seed file (world.yaml, or a JSON file)
+func LoadWorldSeed(path string) (WorldSeed, error) {
+	seed := WorldSeed{Campaign: DefaultCampaign}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return seed, err
+	}
+	err = decodeConfigFile(path, data, &seed)
+	if err != nil {
+		return seed, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(seed.Regions) == 0 {
+		return seed, fmt.Errorf("%s: the world has no region", path)
+	}
+	for _, region := range seed.Regions {
+		for _, settlement := range region.Settlements {
+			if settlement.Population < 0 || settlement.Population > 1000 {
+				return seed, fmt.Errorf("%s: the population of %s must be between 0 and 1000", path, region.Name)
+			}
+		}
+	}
+	return seed, checkCampaign(seed.Campaign)
+}
+
+// cultureKind resolves the culture of a region to a kind and its parents
+func cultureKind(kinds []KindDefinition, culture string) (string, []string, error) {
+	if strings.Contains(culture, "+") {
+		return ResolveKind(kinds, "", culture)
+	}
+	definition, ok := findKind(kinds, culture)
+	if !ok {
+		return ResolveKind(kinds, culture, "")
+	}
+	return definition.Name, nil, nil
+}
+
+var settlementSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"name": map[string]any{"type": "string"},
+	},
+	"required": []string{"name"},
+}
+
+// NameSettlement generates the name of a settlement of the region with the naming rules of its culture
+func (g *Generator) NameSettlement(ctx context.Context, region WorldRegion, kind string, taken []string) (string, error) {
+	userContent := fmt.Sprintf("Generate the name of a %s settlement of the region %s.", kind, region.Name)
+	if len(taken) > 0 {
+		userContent += " These names are taken: " + strings.Join(taken, ", ") + "."
+	}
+	messages := []api.Message{
+		{Role: "system", Content: g.genre.Instructions},
+		{Role: "system", Content: GenerationInstructions(g.kinds)},
+		{Role: "user", Content: userContent},
+	}
+	for attempt := 0; attempt < 3; attempt++ {
+		answer, err := g.chat(ctx, DomainCharacter, messages, settlementSchema, map[string]interface{}{"temperature": 1.0})
+		if err != nil {
+			return "", err
+		}
+		settlement := struct {
+			Name string `json:"name"`
+		}{}
+		err = decodeAnswer(answer.Content, &settlement)
+		if err == nil {
+			err = CheckName(settlement.Name)
+		}
+		if err != nil {
+			fmt.Println("😡 settlement:", err)
+			continue
+		}
+		return strings.TrimSpace(settlement.Name), nil
+	}
+	return "", fmt.Errorf("no valid settlement name for %s after 3 attempts", region.Name)
+}
+
+// WorldMarkdown renders the regions, their settlements and their inhabitants
+func WorldMarkdown(seed WorldSeed) string {
+	markdown := "# " + escapeMarkdown(seed.Name) + "\n\n"
+	for _, region := range seed.Regions {
+		markdown += fmt.Sprintf("## %s (%s)\n\n", escapeMarkdown(region.Name), escapeMarkdown(region.Culture))
+		for _, settlement := range region.Settlements {
+			markdown += fmt.Sprintf("### %s\n\n", escapeMarkdown(settlement.Name))
+			for _, name := range settlement.Characters {
+				markdown += "- " + escapeMarkdown(name) + "\n"
+			}
+			markdown += "\n"
+		}
+	}
+	return markdown
+}
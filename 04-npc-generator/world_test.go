@@ -0,0 +1,29 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadWorldSeed(t *testing.T) {
+	seed, err := LoadWorldSeed(filepath.Join("examples", "world.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seed.Campaign != "northern-reaches" || seed.Factions != 2 || len(seed.Regions) != 3 ||
+		seed.Regions[0].Settlements[0].Name != "Khazad Tor" || seed.Regions[0].Settlements[1].Population != 3 ||
+		seed.Regions[2].Culture != "dwarf+human" {
+		t.Errorf("seed %+v", seed)
+	}
+
+	path := filepath.Join(t.TempDir(), "world.json")
+	err = os.WriteFile(path, []byte(`{"regions": [{"name": "Ironpeaks", "culture": "Dwarf", "settlements": [{"population": 2000}]}]}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = LoadWorldSeed(path)
+	if err == nil {
+		t.Error("a settlement of 2000 characters is loaded")
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// yamlExtensions are the extensions of the YAML configuration files (rubrics, world seeds)
+var yamlExtensions = []string{".yaml", ".yml"}
+
+// decodeConfigFile decodes a JSON file, or a YAML file by its extension: the YAML document
+// is converted to JSON first so the types keep their JSON names and their JSON decoding
+func decodeConfigFile(path string, data []byte, value any) error {
+	if !slices.Contains(yamlExtensions, filepath.Ext(path)) {
+		return json.Unmarshal(data, value)
+	}
+	var document any
+	err := yaml.Unmarshal(data, &document)
+	if err != nil {
+		return err
+	}
+	converted, err := json.Marshal(document)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(converted, value)
+}